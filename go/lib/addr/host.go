@@ -64,6 +64,7 @@ var (
 	SvcPS   = HostSVC(0x0001)
 	SvcCS   = HostSVC(0x0002)
 	SvcSB   = HostSVC(0x0003)
+	SvcSIG  = HostSVC(0x0004)
 	SvcNone = HostSVC(0xffff)
 )
 
@@ -173,9 +174,9 @@ var _ HostAddr = (*HostSVC)(nil)
 type HostSVC uint16
 
 // HostSVCFromString returns the SVC address corresponding to str. For anycast
-// SVC addresses, use BS_A, PS_A, CS_A, and SB_A; shorthand versions without
-// the _A suffix (e.g., PS) also return anycast SVC addresses. For multicast,
-// use BS_M, PS_M, CS_M, and SB_M.
+// SVC addresses, use BS_A, PS_A, CS_A, SB_A, and SIG_A; shorthand versions
+// without the _A suffix (e.g., PS) also return anycast SVC addresses. For
+// multicast, use BS_M, PS_M, CS_M, SB_M, and SIG_M.
 func HostSVCFromString(str string) HostSVC {
 	var m HostSVC
 	switch {
@@ -194,6 +195,8 @@ func HostSVCFromString(str string) HostSVC {
 		return SvcCS | m
 	case "SB":
 		return SvcSB | m
+	case "SIG":
+		return SvcSIG | m
 	default:
 		return SvcNone
 	}
@@ -244,6 +247,8 @@ func (h HostSVC) String() string {
 		name = "CS"
 	case SvcSB:
 		name = "SB"
+	case SvcSIG:
+		name = "SIG"
 	default:
 		name = "UNKNOWN"
 	}
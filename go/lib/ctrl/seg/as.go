@@ -34,8 +34,8 @@ type ASEntry struct {
 	HopEntries []*HopEntry `capnp:"hops"`
 	MTU        uint16      `capnp:"mtu"`
 	Exts       struct {
-		RoutingPolicy common.RawBytes `capnp:"-"` // Not supported yet
-		Sibra         common.RawBytes `capnp:"-"` // Not supported yet
+		RoutingPolicy RoutingPolicyExt `capnp:"routingPolicy"`
+		Sibra         common.RawBytes  `capnp:"-"` // Not supported yet
 	}
 }
 
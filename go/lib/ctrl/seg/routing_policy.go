@@ -0,0 +1,105 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the Go representation of the routing policy AS marking
+// extension.
+
+package seg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+type RoutingPolType uint8
+
+const (
+	// AllowAS permits transit over the interface only for traffic from or to
+	// one of the listed ISD-ASes.
+	AllowAS RoutingPolType = iota
+	// DenyAS forbids transit over the interface for traffic from or to any of
+	// the listed ISD-ASes.
+	DenyAS
+	// AllowIF restricts transit to the interfaces of the AS that have an
+	// AllowIF policy. The list of ISD-ASes is ignored.
+	AllowIF
+	// DenyIF forbids transit over the interface. The list of ISD-ASes is
+	// ignored.
+	DenyIF
+)
+
+func (t RoutingPolType) String() string {
+	switch t {
+	case AllowAS:
+		return "ALLOW_AS"
+	case DenyAS:
+		return "DENY_AS"
+	case AllowIF:
+		return "ALLOW_IF"
+	case DenyIF:
+		return "DENY_IF"
+	}
+	return fmt.Sprintf("UNKNOWN (%d)", t)
+}
+
+// RoutingPolicyExt is the routing policy extension of an AS entry. It
+// restricts how paths may transit the AS that added the AS entry. Policies
+// never restrict paths starting or ending in the AS itself.
+type RoutingPolicyExt struct {
+	// Set is true if the extension is present.
+	Set     bool           `capnp:"set"`
+	PolType RoutingPolType `capnp:"polType"`
+	// IfID is the interface the policy applies to. 0 means all interfaces.
+	IfID       common.IFIDType `capnp:"ifID"`
+	RawISDASes []addr.IAInt    `capnp:"isdases"`
+}
+
+// ISDASes returns the ISD-ASes the policy refers to.
+func (ext *RoutingPolicyExt) ISDASes() []addr.IA {
+	ias := make([]addr.IA, 0, len(ext.RawISDASes))
+	for _, raw := range ext.RawISDASes {
+		ias = append(ias, raw.IA())
+	}
+	return ias
+}
+
+// AppliesTo returns true if the policy applies to traffic using interface ifid.
+func (ext *RoutingPolicyExt) AppliesTo(ifid common.IFIDType) bool {
+	return ext.Set && (ext.IfID == 0 || ext.IfID == ifid)
+}
+
+// Contains returns true if ia is one of the ISD-ASes listed in the policy.
+func (ext *RoutingPolicyExt) Contains(ia addr.IA) bool {
+	for _, raw := range ext.RawISDASes {
+		if raw.IA().Eq(ia) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ext *RoutingPolicyExt) String() string {
+	if !ext.Set {
+		return "RoutingPolicyExt: not set"
+	}
+	ias := make([]string, 0, len(ext.RawISDASes))
+	for _, ia := range ext.ISDASes() {
+		ias = append(ias, ia.String())
+	}
+	return fmt.Sprintf("RoutingPolicyExt: Type: %s IfID: %d ISD-ASes: [%s]",
+		ext.PolType, ext.IfID, strings.Join(ias, ", "))
+}
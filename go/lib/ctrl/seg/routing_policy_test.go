@@ -0,0 +1,69 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seg
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/xtest"
+)
+
+func TestRoutingPolicyExt(t *testing.T) {
+	ia1 := xtest.MustParseIA("1-ff00:0:110")
+	ia2 := xtest.MustParseIA("1-ff00:0:111")
+	Convey("RoutingPolicyExt survives a pack/parse round trip", t, func() {
+		hopF := make(common.RawBytes, spath.HopFieldLength)
+		spath.NewHopField(hopF, 1, 2)
+		ase := &ASEntry{
+			RawIA: ia1.IAInt(),
+			HopEntries: []*HopEntry{
+				{RawInIA: ia2.IAInt(), RawOutIA: ia2.IAInt(), RawHopField: hopF},
+			},
+			MTU: 1472,
+		}
+		ase.Exts.RoutingPolicy = RoutingPolicyExt{
+			Set:        true,
+			PolType:    DenyAS,
+			IfID:       2,
+			RawISDASes: []addr.IAInt{ia2.IAInt()},
+		}
+		raw, err := ase.Pack()
+		xtest.FailOnErr(t, err)
+		parsed, err := newASEntryFromRaw(raw)
+		xtest.FailOnErr(t, err)
+		ext := parsed.Exts.RoutingPolicy
+		SoMsg("Set", ext.Set, ShouldBeTrue)
+		SoMsg("PolType", ext.PolType, ShouldEqual, DenyAS)
+		SoMsg("IfID", ext.IfID, ShouldEqual, 2)
+		SoMsg("ISDASes", ext.ISDASes(), ShouldResemble, []addr.IA{ia2})
+		SoMsg("AppliesTo 2", ext.AppliesTo(2), ShouldBeTrue)
+		SoMsg("AppliesTo 1", ext.AppliesTo(1), ShouldBeFalse)
+		SoMsg("Contains", ext.Contains(ia2), ShouldBeTrue)
+	})
+	Convey("AS entries without extension parse as unset", t, func() {
+		ase := &ASEntry{RawIA: ia1.IAInt()}
+		raw, err := ase.Pack()
+		xtest.FailOnErr(t, err)
+		parsed, err := newASEntryFromRaw(raw)
+		xtest.FailOnErr(t, err)
+		SoMsg("Set", parsed.Exts.RoutingPolicy.Set, ShouldBeFalse)
+		SoMsg("AppliesTo", parsed.Exts.RoutingPolicy.AppliesTo(0), ShouldBeFalse)
+	})
+}
@@ -22,6 +22,12 @@
 //
 // Returned paths are sorted by weight in descending order. The weight is
 // defined as the number of transited AS hops in the path.
+//
+// Each path is annotated with quality metrics (MTU, expiration time, number of
+// traversed ASes and ISDs, use of peering links and shortcuts). Callers that
+// want a different order can use CombineRanked or Sort with a Ranker, e.g.:
+//  paths := CombineRanked(src, dst, ups, cores, downs,
+//    Chain(ByFewestISDs, ByExpiration))
 package combinator
 
 import (
@@ -39,6 +45,8 @@ import (
 // Combine constructs paths between src and dst using the supplied
 // segments. All possible paths are returned, sorted according to weight (on
 // equal weight, see pathSolutionList.Less for the tie-breaking algorithm).
+// Paths that violate the routing policy extension of a transited AS entry
+// are dropped.
 //
 // If Combine cannot extract a hop field or info field from the segments, it
 // panics.
@@ -46,8 +54,12 @@ func Combine(src, dst addr.IA, ups, cores, downs []*seg.PathSegment) []*Path {
 	paths := NewDAMG(ups, cores, downs).GetPaths(VertexFromIA(src), VertexFromIA(dst))
 
 	var pathSlice []*Path
-	for _, path := range paths {
-		pathSlice = append(pathSlice, path.GetFwdPathMetadata())
+	for _, solution := range paths {
+		path := solution.GetFwdPathMetadata()
+		if !solution.compliesWithPolicies(path, src, dst) {
+			continue
+		}
+		pathSlice = append(pathSlice, path)
 	}
 	return pathSlice
 }
@@ -70,6 +82,16 @@ type Path struct {
 	Mtu        uint16
 	Interfaces []sciond.PathInterface
 	ExpTime    time.Time
+	// NumASes is the number of distinct ASes on the path, including source
+	// and destination.
+	NumASes int
+	// NumISDs is the number of distinct ISDs on the path.
+	NumISDs int
+	// Peering is true if the path crosses a peering link.
+	Peering bool
+	// Shortcut is true if the path uses a shortcut (including peering
+	// shortcuts).
+	Shortcut bool
 }
 
 func (p *Path) writeTestString(w io.Writer) {
@@ -111,6 +133,22 @@ func (p *Path) computeExpTime() {
 	}
 }
 
+func (p *Path) computeMetrics() {
+	ases := make(map[addr.IAInt]struct{})
+	isds := make(map[addr.ISD]struct{})
+	for _, pi := range p.Interfaces {
+		ia := pi.ISD_AS()
+		ases[ia.IAInt()] = struct{}{}
+		isds[ia.I] = struct{}{}
+	}
+	p.NumASes = len(ases)
+	p.NumISDs = len(isds)
+	for _, segment := range p.Segments {
+		p.Peering = p.Peering || segment.InfoField.Peer
+		p.Shortcut = p.Shortcut || segment.InfoField.Shortcut
+	}
+}
+
 type Segment struct {
 	InfoField  *InfoField
 	HopFields  []*HopField
@@ -0,0 +1,163 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package combinator
+
+import (
+	"fmt"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/sciond"
+)
+
+// DisjointMode selects which resources the paths in a disjoint path set
+// should not share.
+type DisjointMode int
+
+const (
+	// LinkDisjoint paths do not share inter-AS links. Links are identified by
+	// the interfaces on either end.
+	LinkDisjoint DisjointMode = iota
+	// ASDisjoint paths do not share any AS except source and destination.
+	ASDisjoint
+)
+
+func (m DisjointMode) String() string {
+	switch m {
+	case LinkDisjoint:
+		return "LinkDisjoint"
+	case ASDisjoint:
+		return "ASDisjoint"
+	}
+	return fmt.Sprintf("UNKNOWN (%d)", int(m))
+}
+
+// DisjointPathSet is a set of paths selected to be as disjoint as possible.
+type DisjointPathSet struct {
+	Paths []*Path
+	Mode  DisjointMode
+	// Score is the disjointness of the set, between 0 and 1. It is the number
+	// of distinct resources (links or ASes, depending on Mode) used by the
+	// paths, divided by the total number of resources used by each path. A
+	// score of 1 means that the paths are fully disjoint.
+	Score float64
+}
+
+// CombineDisjoint constructs paths between src and dst using the supplied
+// segments, and returns a set of at most k paths that are disjoint according
+// to mode. See DAMG.GetDisjointPaths for the selection algorithm.
+func CombineDisjoint(src, dst addr.IA, ups, cores, downs []*seg.PathSegment,
+	k int, mode DisjointMode) *DisjointPathSet {
+
+	return NewDAMG(ups, cores, downs).GetDisjointPaths(src, dst, k, mode)
+}
+
+// GetDisjointPaths returns a set of at most k paths from src to dst that are
+// disjoint according to mode.
+//
+// The selection is greedy: the first path is the best path according to
+// weight, and each following path is the one sharing the fewest resources
+// with the already selected paths (ties are broken by weight). If no fully
+// disjoint set of k paths exists, the returned set is maximally disjoint
+// under this heuristic, and its Score is lower than 1.
+func (g *DAMG) GetDisjointPaths(src, dst addr.IA, k int,
+	mode DisjointMode) *DisjointPathSet {
+
+	set := &DisjointPathSet{Mode: mode, Score: 1}
+	if k <= 0 {
+		return set
+	}
+	var candidates []*Path
+	for _, solution := range g.GetPaths(VertexFromIA(src), VertexFromIA(dst)) {
+		path := solution.GetFwdPathMetadata()
+		if solution.compliesWithPolicies(path, src, dst) {
+			candidates = append(candidates, path)
+		}
+	}
+	used := make(map[string]struct{})
+	for len(set.Paths) < k && len(candidates) > 0 {
+		bestIdx, bestOverlap := 0, -1
+		for i, candidate := range candidates {
+			overlap := 0
+			for _, r := range pathResources(candidate, src, dst, mode) {
+				if _, ok := used[r]; ok {
+					overlap++
+				}
+			}
+			if bestOverlap == -1 || overlap < bestOverlap {
+				bestIdx, bestOverlap = i, overlap
+			}
+		}
+		best := candidates[bestIdx]
+		candidates = append(candidates[:bestIdx], candidates[bestIdx+1:]...)
+		for _, r := range pathResources(best, src, dst, mode) {
+			used[r] = struct{}{}
+		}
+		set.Paths = append(set.Paths, best)
+	}
+	set.Score = DisjointnessScore(set.Paths, src, dst, mode)
+	return set
+}
+
+// DisjointnessScore computes the disjointness score (see DisjointPathSet) of
+// paths between src and dst.
+func DisjointnessScore(paths []*Path, src, dst addr.IA, mode DisjointMode) float64 {
+	total := 0
+	distinct := make(map[string]struct{})
+	for _, path := range paths {
+		resources := pathResources(path, src, dst, mode)
+		total += len(resources)
+		for _, r := range resources {
+			distinct[r] = struct{}{}
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(len(distinct)) / float64(total)
+}
+
+// pathResources returns the distinct resources used by path, as keys
+// suitable for use in maps.
+func pathResources(path *Path, src, dst addr.IA, mode DisjointMode) []string {
+	var resources []string
+	seen := make(map[string]struct{})
+	for _, pi := range path.Interfaces {
+		key, ok := resourceKey(pi, src, dst, mode)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			resources = append(resources, key)
+		}
+	}
+	return resources
+}
+
+func resourceKey(pi sciond.PathInterface, src, dst addr.IA,
+	mode DisjointMode) (string, bool) {
+
+	ia := pi.ISD_AS()
+	switch mode {
+	case ASDisjoint:
+		if ia.Eq(src) || ia.Eq(dst) {
+			return "", false
+		}
+		return ia.String(), true
+	default:
+		return pi.String(), true
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package combinator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/lib/xtest/graph"
+)
+
+func TestCombineDisjoint(t *testing.T) {
+	g := graph.NewDefaultGraph()
+	src := xtest.MustParseIA("1-ff00:0:130")
+	dst := xtest.MustParseIA("1-ff00:0:120")
+	cores := []*seg.PathSegment{
+		// 120 -> 130 (direct)
+		g.Beacon([]common.IFIDType{1213}),
+		// 120 -> 110 -> 130
+		g.Beacon([]common.IFIDType{1211, 1113}),
+		// 120 -> 220 -> 210 -> 110 -> 130
+		g.Beacon([]common.IFIDType{1222, 2221, 2111, 1113}),
+	}
+
+	Convey("CombineDisjoint", t, func() {
+		Convey("k=0 returns no paths", func() {
+			set := CombineDisjoint(src, dst, nil, cores, nil, 0, LinkDisjoint)
+			SoMsg("paths", len(set.Paths), ShouldEqual, 0)
+			SoMsg("score", set.Score, ShouldEqual, 1)
+		})
+		for _, mode := range []DisjointMode{LinkDisjoint, ASDisjoint} {
+			Convey(mode.String()+" k=2 returns fully disjoint paths", func() {
+				set := CombineDisjoint(src, dst, nil, cores, nil, 2, mode)
+				So(len(set.Paths), ShouldEqual, 2)
+				SoMsg("best first", set.Paths[0].Weight, ShouldEqual, 1)
+				SoMsg("second", set.Paths[1].Weight, ShouldEqual, 2)
+				SoMsg("score", set.Score, ShouldEqual, 1)
+			})
+			Convey(mode.String()+" k=3 returns maximally disjoint paths", func() {
+				set := CombineDisjoint(src, dst, nil, cores, nil, 3, mode)
+				So(len(set.Paths), ShouldEqual, 3)
+				SoMsg("score", set.Score, ShouldBeLessThan, 1)
+				SoMsg("score", set.Score, ShouldBeGreaterThan, 0)
+			})
+		}
+		Convey("k larger than the number of paths returns all paths", func() {
+			set := CombineDisjoint(src, dst, nil, cores, nil, 10, LinkDisjoint)
+			SoMsg("paths", len(set.Paths), ShouldEqual, 3)
+		})
+	})
+
+	Convey("DisjointnessScore counts shared links", t, func() {
+		// Both paths share the 130-110 link.
+		paths := Combine(src, dst, nil, cores[1:], nil)
+		So(len(paths), ShouldEqual, 2)
+		score := DisjointnessScore(paths, src, dst, LinkDisjoint)
+		SoMsg("link score", score, ShouldAlmostEqual, 10.0/12.0)
+		score = DisjointnessScore(paths, src, dst, ASDisjoint)
+		SoMsg("AS score", score, ShouldAlmostEqual, 3.0/4.0)
+	})
+}
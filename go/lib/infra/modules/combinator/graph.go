@@ -288,6 +288,16 @@ func (solution *PathSolution) GetFwdPathMetadata() *Path {
 			var inIFID, outIFID common.IFIDType
 			asEntry := asEntries[asEntryIdx]
 			path.Mtu = minUint16(path.Mtu, asEntry.MTU)
+			// The hop entry contains the MTU of the link to the previous AS of
+			// the segment. That link is not traversed if the path switches
+			// segments at this AS, except for peering links, whose MTU is in
+			// the peer entry.
+			switch {
+			case asEntryIdx != solEdge.edge.Shortcut:
+				path.Mtu = minLinkMTU(path.Mtu, asEntry.HopEntries[0].InMTU)
+			case solEdge.edge.Peer != 0:
+				path.Mtu = minLinkMTU(path.Mtu, asEntry.HopEntries[solEdge.edge.Peer].InMTU)
+			}
 
 			// Normal hop field.
 			newHF := currentSeg.appendHopFieldFrom(asEntry.HopEntries[0])
@@ -346,6 +356,7 @@ func (solution *PathSolution) GetFwdPathMetadata() *Path {
 	path.reverseDownSegment()
 	path.aggregateInterfaces()
 	path.computeExpTime()
+	path.computeMetrics()
 	return path
 }
 
@@ -423,6 +434,15 @@ func minUint16(x, y uint16) uint16 {
 	return y
 }
 
+// minLinkMTU returns the smaller of mtu and the link MTU linkMTU. A link MTU
+// of 0 is unknown, and ignored.
+func minLinkMTU(mtu, linkMTU uint16) uint16 {
+	if linkMTU == 0 {
+		return mtu
+	}
+	return minUint16(mtu, linkMTU)
+}
+
 func getPathInterfaces(ia addr.IA, inIFID, outIFID common.IFIDType) []sciond.PathInterface {
 	var result []sciond.PathInterface
 	if inIFID != 0 {
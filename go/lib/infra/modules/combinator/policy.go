@@ -0,0 +1,102 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package combinator
+
+import (
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+)
+
+// routingPolicies collects the routing policy extensions of all the AS
+// entries that are traversed by the solution, keyed by the AS that declared
+// them.
+func (solution *PathSolution) routingPolicies() map[addr.IA][]*seg.RoutingPolicyExt {
+	policies := make(map[addr.IA][]*seg.RoutingPolicyExt)
+	for _, solEdge := range solution.edges {
+		asEntries := solEdge.segment.ASEntries
+		for asEntryIdx := len(asEntries) - 1; asEntryIdx >= solEdge.edge.Shortcut; asEntryIdx-- {
+			asEntry := asEntries[asEntryIdx]
+			if asEntry.Exts.RoutingPolicy.Set {
+				policies[asEntry.IA()] = append(policies[asEntry.IA()],
+					&asEntry.Exts.RoutingPolicy)
+			}
+		}
+	}
+	return policies
+}
+
+// compliesWithPolicies returns true if path, constructed from solution, does
+// not violate the routing policy of any of the ASes it transits.
+func (solution *PathSolution) compliesWithPolicies(path *Path, src, dst addr.IA) bool {
+	policies := solution.routingPolicies()
+	if len(policies) == 0 {
+		return true
+	}
+	// Collect the interfaces used in each transit AS.
+	intfs := make(map[addr.IA][]common.IFIDType)
+	for i := range path.Interfaces {
+		ia := path.Interfaces[i].ISD_AS()
+		intfs[ia] = append(intfs[ia], path.Interfaces[i].IfID)
+	}
+	for ia, asPolicies := range policies {
+		if ia.Eq(src) || ia.Eq(dst) {
+			continue
+		}
+		if !transitAllowed(asPolicies, intfs[ia], src, dst) {
+			return false
+		}
+	}
+	return true
+}
+
+// transitAllowed checks whether traffic between src and dst may transit an AS
+// over ifids, given the AS's policies.
+func transitAllowed(policies []*seg.RoutingPolicyExt, ifids []common.IFIDType,
+	src, dst addr.IA) bool {
+
+	hasAllowIF := false
+	for _, p := range policies {
+		if p.PolType == seg.AllowIF {
+			hasAllowIF = true
+		}
+	}
+	for _, ifid := range ifids {
+		allowedIF := !hasAllowIF
+		for _, p := range policies {
+			if !p.AppliesTo(ifid) {
+				continue
+			}
+			switch p.PolType {
+			case seg.AllowAS:
+				if !p.Contains(src) && !p.Contains(dst) {
+					return false
+				}
+			case seg.DenyAS:
+				if p.Contains(src) || p.Contains(dst) {
+					return false
+				}
+			case seg.AllowIF:
+				allowedIF = true
+			case seg.DenyIF:
+				return false
+			}
+		}
+		if !allowedIF {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package combinator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/lib/xtest/graph"
+)
+
+func TestRoutingPolicy(t *testing.T) {
+	g := graph.NewDefaultGraph()
+	src := xtest.MustParseIA("1-ff00:0:130")
+	dst := xtest.MustParseIA("1-ff00:0:120")
+	ia110 := xtest.MustParseIA("1-ff00:0:110")
+
+	// policySegments returns a direct core segment 120 -> 130, and a core
+	// segment 120 -> 110 -> 130 where the AS entry at asEntryIdx carries
+	// policy.
+	policySegments := func(asEntryIdx int, policy seg.RoutingPolicyExt) []*seg.PathSegment {
+		transit := g.Beacon([]common.IFIDType{1211, 1113})
+		transit.ASEntries[asEntryIdx].Exts.RoutingPolicy = policy
+		return []*seg.PathSegment{g.Beacon([]common.IFIDType{1213}), transit}
+	}
+
+	testCases := []struct {
+		Name       string
+		ASEntryIdx int
+		Policy     seg.RoutingPolicyExt
+		NumPaths   int
+	}{
+		{
+			Name:       "no policy",
+			ASEntryIdx: 1,
+			Policy:     seg.RoutingPolicyExt{},
+			NumPaths:   2,
+		},
+		{
+			Name:       "deny source AS on all interfaces",
+			ASEntryIdx: 1,
+			Policy: seg.RoutingPolicyExt{Set: true, PolType: seg.DenyAS,
+				RawISDASes: []addr.IAInt{src.IAInt()}},
+			NumPaths: 1,
+		},
+		{
+			Name:       "deny other AS",
+			ASEntryIdx: 1,
+			Policy: seg.RoutingPolicyExt{Set: true, PolType: seg.DenyAS,
+				RawISDASes: []addr.IAInt{ia110.IAInt()}},
+			NumPaths: 2,
+		},
+		{
+			Name:       "allow destination AS",
+			ASEntryIdx: 1,
+			Policy: seg.RoutingPolicyExt{Set: true, PolType: seg.AllowAS,
+				RawISDASes: []addr.IAInt{dst.IAInt()}},
+			NumPaths: 2,
+		},
+		{
+			Name:       "allow other AS only",
+			ASEntryIdx: 1,
+			Policy: seg.RoutingPolicyExt{Set: true, PolType: seg.AllowAS,
+				IfID: 1113, RawISDASes: []addr.IAInt{ia110.IAInt()}},
+			NumPaths: 1,
+		},
+		{
+			Name:       "deny used interface",
+			ASEntryIdx: 1,
+			Policy:     seg.RoutingPolicyExt{Set: true, PolType: seg.DenyIF, IfID: 1112},
+			NumPaths:   1,
+		},
+		{
+			Name:       "deny unused interface",
+			ASEntryIdx: 1,
+			Policy:     seg.RoutingPolicyExt{Set: true, PolType: seg.DenyIF, IfID: 1121},
+			NumPaths:   2,
+		},
+		{
+			Name:       "allow unused interface only",
+			ASEntryIdx: 1,
+			Policy:     seg.RoutingPolicyExt{Set: true, PolType: seg.AllowIF, IfID: 1121},
+			NumPaths:   1,
+		},
+		{
+			Name:       "policies of the source AS are ignored",
+			ASEntryIdx: 2,
+			Policy:     seg.RoutingPolicyExt{Set: true, PolType: seg.DenyIF},
+			NumPaths:   2,
+		},
+	}
+
+	Convey("Combine honors routing policies", t, func() {
+		for _, tc := range testCases {
+			Convey(tc.Name, func() {
+				cores := policySegments(tc.ASEntryIdx, tc.Policy)
+				paths := Combine(src, dst, nil, cores, nil)
+				SoMsg("paths", len(paths), ShouldEqual, tc.NumPaths)
+				set := CombineDisjoint(src, dst, nil, cores, nil, 2, LinkDisjoint)
+				SoMsg("disjoint paths", len(set.Paths), ShouldEqual, tc.NumPaths)
+			})
+		}
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package combinator
+
+import (
+	"sort"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+)
+
+// Ranker defines an order on paths. Callers (e.g., sciond, the SIG or snet)
+// implement it to sort paths according to their own cost function.
+type Ranker interface {
+	// Less returns true if path a is preferred over path b.
+	Less(a, b *Path) bool
+}
+
+// RankFunc is an adapter to allow the use of ordinary functions as Rankers.
+type RankFunc func(a, b *Path) bool
+
+func (f RankFunc) Less(a, b *Path) bool {
+	return f(a, b)
+}
+
+var (
+	// ByWeight prefers paths with lower weight. This is the order used by
+	// Combine.
+	ByWeight Ranker = RankFunc(func(a, b *Path) bool {
+		return a.Weight < b.Weight
+	})
+	// ByExpiration prefers longer-lived paths.
+	ByExpiration Ranker = RankFunc(func(a, b *Path) bool {
+		return a.ExpTime.After(b.ExpTime)
+	})
+	// ByMTU prefers paths with a larger MTU.
+	ByMTU Ranker = RankFunc(func(a, b *Path) bool {
+		return a.Mtu > b.Mtu
+	})
+	// ByFewestASes prefers paths that traverse fewer ASes.
+	ByFewestASes Ranker = RankFunc(func(a, b *Path) bool {
+		return a.NumASes < b.NumASes
+	})
+	// ByFewestISDs prefers paths that traverse fewer ISDs.
+	ByFewestISDs Ranker = RankFunc(func(a, b *Path) bool {
+		return a.NumISDs < b.NumISDs
+	})
+)
+
+// Chain returns a Ranker that orders paths according to the first ranker in
+// rankers that distinguishes between them.
+func Chain(rankers ...Ranker) Ranker {
+	return RankFunc(func(a, b *Path) bool {
+		for _, r := range rankers {
+			if r.Less(a, b) {
+				return true
+			}
+			if r.Less(b, a) {
+				return false
+			}
+		}
+		return false
+	})
+}
+
+// Sort sorts paths according to r. The sort is stable, so paths that r
+// considers equal keep their relative order (for paths returned by Combine,
+// this is the order by weight).
+func Sort(paths []*Path, r Ranker) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return r.Less(paths[i], paths[j])
+	})
+}
+
+// CombineRanked is like Combine, but sorts the returned paths according to r.
+// Paths that r considers equal are ordered by weight.
+func CombineRanked(src, dst addr.IA, ups, cores, downs []*seg.PathSegment,
+	r Ranker) []*Path {
+
+	paths := Combine(src, dst, ups, cores, downs)
+	Sort(paths, r)
+	return paths
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package combinator
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/lib/xtest/graph"
+)
+
+func TestMetrics(t *testing.T) {
+	g := graph.NewDefaultGraph()
+	Convey("Paths are annotated with metrics", t, func() {
+		Convey("peering path within one ISD", func() {
+			paths := Combine(
+				xtest.MustParseIA("1-ff00:0:112"),
+				xtest.MustParseIA("1-ff00:0:122"),
+				[]*seg.PathSegment{g.Beacon([]common.IFIDType{1114, 1417})},
+				[]*seg.PathSegment{g.Beacon([]common.IFIDType{1211})},
+				[]*seg.PathSegment{g.Beacon([]common.IFIDType{1215, 1518})},
+			)
+			So(len(paths), ShouldBeGreaterThan, 0)
+			p := paths[0]
+			SoMsg("NumASes", p.NumASes, ShouldEqual, 4)
+			SoMsg("NumISDs", p.NumISDs, ShouldEqual, 1)
+			SoMsg("Peering", p.Peering, ShouldBeTrue)
+			SoMsg("Shortcut", p.Shortcut, ShouldBeTrue)
+		})
+		Convey("core path across two ISDs", func() {
+			paths := Combine(
+				xtest.MustParseIA("1-ff00:0:132"),
+				xtest.MustParseIA("2-ff00:0:212"),
+				[]*seg.PathSegment{g.Beacon([]common.IFIDType{1316, 1619})},
+				[]*seg.PathSegment{g.Beacon([]common.IFIDType{2111, 1113})},
+				[]*seg.PathSegment{g.Beacon([]common.IFIDType{2123, 2325})},
+			)
+			So(len(paths), ShouldEqual, 1)
+			p := paths[0]
+			SoMsg("NumASes", p.NumASes, ShouldEqual, 7)
+			SoMsg("NumISDs", p.NumISDs, ShouldEqual, 2)
+			SoMsg("Peering", p.Peering, ShouldBeFalse)
+			SoMsg("Shortcut", p.Shortcut, ShouldBeFalse)
+		})
+		Convey("the MTU of a link lower than the AS MTUs", func() {
+			ups := []*seg.PathSegment{g.Beacon([]common.IFIDType{1316, 1619})}
+			cores := []*seg.PathSegment{g.Beacon([]common.IFIDType{2111, 1113})}
+			downs := []*seg.PathSegment{g.Beacon([]common.IFIDType{2123, 2325})}
+			setMTUs(1500, 1472, 0, ups, cores, downs)
+			cores[0].ASEntries[1].HopEntries[0].InMTU = 1400
+			paths := Combine(
+				xtest.MustParseIA("1-ff00:0:132"),
+				xtest.MustParseIA("2-ff00:0:212"),
+				ups, cores, downs,
+			)
+			So(len(paths), ShouldEqual, 1)
+			SoMsg("Mtu", paths[0].Mtu, ShouldEqual, 1400)
+		})
+		Convey("the MTU of a peering link lower than the AS MTUs", func() {
+			ups := []*seg.PathSegment{g.Beacon([]common.IFIDType{1114, 1417})}
+			cores := []*seg.PathSegment{g.Beacon([]common.IFIDType{1211})}
+			downs := []*seg.PathSegment{g.Beacon([]common.IFIDType{1215, 1518})}
+			setMTUs(1500, 1472, 1300, ups, cores, downs)
+			paths := Combine(
+				xtest.MustParseIA("1-ff00:0:112"),
+				xtest.MustParseIA("1-ff00:0:122"),
+				ups, cores, downs,
+			)
+			So(len(paths), ShouldBeGreaterThan, 0)
+			SoMsg("Peering", paths[0].Peering, ShouldBeTrue)
+			SoMsg("Mtu", paths[0].Mtu, ShouldEqual, 1300)
+		})
+	})
+}
+
+// setMTUs sets the MTU of the ASes of segs to asMTU, and the MTU of the links
+// to linkMTU, or to peerMTU for peering links.
+func setMTUs(asMTU, linkMTU, peerMTU uint16, segs ...[]*seg.PathSegment) {
+	for _, segments := range segs {
+		for _, s := range segments {
+			for _, asEntry := range s.ASEntries {
+				asEntry.MTU = asMTU
+				for i, hopEntry := range asEntry.HopEntries {
+					if i == 0 {
+						hopEntry.InMTU = linkMTU
+					} else {
+						hopEntry.InMTU = peerMTU
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	now := time.Now()
+	a := &Path{Weight: 1, Mtu: 1000, ExpTime: now, NumASes: 3, NumISDs: 2}
+	b := &Path{Weight: 2, Mtu: 1500, ExpTime: now.Add(time.Hour), NumASes: 3, NumISDs: 1}
+	c := &Path{Weight: 3, Mtu: 1500, ExpTime: now.Add(time.Minute), NumASes: 2, NumISDs: 1}
+	testCases := []struct {
+		Name     string
+		Ranker   Ranker
+		Expected []*Path
+	}{
+		{"ByWeight", ByWeight, []*Path{a, b, c}},
+		{"ByExpiration", ByExpiration, []*Path{b, c, a}},
+		{"ByMTU is stable", ByMTU, []*Path{b, c, a}},
+		{"ByFewestASes", ByFewestASes, []*Path{c, a, b}},
+		{"ByFewestISDs, ByFewestASes", Chain(ByFewestISDs, ByFewestASes), []*Path{c, b, a}},
+		{"custom", RankFunc(func(x, y *Path) bool { return x.Weight > y.Weight }),
+			[]*Path{c, b, a}},
+	}
+	Convey("Sort orders paths according to the ranker", t, func() {
+		for _, tc := range testCases {
+			Convey(tc.Name, func() {
+				paths := []*Path{a, b, c}
+				Sort(paths, tc.Ranker)
+				SoMsg("order", paths, ShouldResemble, tc.Expected)
+			})
+		}
+	})
+}
@@ -0,0 +1,301 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains an in-memory backend for the PathDB. It is intended for
+// unit tests and short-lived tools that do not need persistence.
+
+package mem
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/pathdb/conn"
+	"github.com/scionproto/scion/go/lib/pathdb/query"
+)
+
+type segMeta struct {
+	RowID       int64
+	SegID       common.RawBytes
+	LastUpdated time.Time
+	Seg         *seg.PathSegment
+	Intfs       []query.IntfSpec
+	StartsAt    addr.IA
+	EndsAt      addr.IA
+	Types       []seg.Type
+	HpCfgIDs    []*query.HPCfgID
+}
+
+var _ conn.Conn = (*Backend)(nil)
+
+type Backend struct {
+	sync.RWMutex
+	segs      map[string]*segMeta
+	nextRowID int64
+}
+
+// New returns a new, empty in-memory backend.
+func New() *Backend {
+	return &Backend{
+		segs:      make(map[string]*segMeta),
+		nextRowID: 1,
+	}
+}
+
+func (b *Backend) Insert(pseg *seg.PathSegment, segTypes []seg.Type) (int, error) {
+	return b.InsertWithHPCfgIDs(pseg, segTypes, []*query.HPCfgID{&query.NullHpCfgID})
+}
+
+func (b *Backend) InsertWithHPCfgIDs(pseg *seg.PathSegment,
+	segTypes []seg.Type, hpCfgIDs []*query.HPCfgID) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	// Check if we already have a path segment.
+	segID, err := pseg.ID()
+	if err != nil {
+		return 0, err
+	}
+	meta, ok := b.segs[string(segID)]
+	if ok {
+		// Check if the new segment is more recent.
+		newInfo, _ := pseg.InfoF()
+		curInfo, _ := meta.Seg.InfoF()
+		if newInfo.Timestamp().After(curInfo.Timestamp()) {
+			// Update existing path segment.
+			meta.Seg = pseg
+			meta.LastUpdated = time.Now()
+			meta.addTypes(segTypes)
+			meta.addHPCfgIDs(hpCfgIDs)
+			return 1, nil
+		}
+		return 0, nil
+	}
+	// Do full insert.
+	meta, err = b.newSegMeta(pseg, segID)
+	if err != nil {
+		return 0, err
+	}
+	meta.addTypes(segTypes)
+	meta.addHPCfgIDs(hpCfgIDs)
+	b.segs[string(segID)] = meta
+	b.nextRowID++
+	return 1, nil
+}
+
+func (b *Backend) newSegMeta(pseg *seg.PathSegment, segID common.RawBytes) (*segMeta, error) {
+	intfs, err := extractInterfaces(pseg.ASEntries)
+	if err != nil {
+		return nil, err
+	}
+	return &segMeta{
+		RowID:       b.nextRowID,
+		SegID:       segID,
+		LastUpdated: time.Now(),
+		Seg:         pseg,
+		Intfs:       intfs,
+		StartsAt:    pseg.ASEntries[0].IA(),
+		EndsAt:      pseg.ASEntries[pseg.MaxAEIdx()].IA(),
+	}, nil
+}
+
+// extractInterfaces returns the interfaces that are indexed for a path
+// segment. This mirrors the IntfToSeg table of the SQLite backend: the
+// ingress interface of every hop entry and the egress interface of the first
+// hop entry of each AS entry.
+func extractInterfaces(ases []*seg.ASEntry) ([]query.IntfSpec, error) {
+	var intfs []query.IntfSpec
+	for _, as := range ases {
+		ia := as.IA()
+		for idx, hop := range as.HopEntries {
+			hof, err := hop.HopField()
+			if err != nil {
+				return nil, common.NewBasicError("Failed to extract hop field", err)
+			}
+			if hof.ConsIngress != 0 {
+				intfs = append(intfs, query.IntfSpec{IA: ia, IfID: uint64(hof.ConsIngress)})
+			}
+			// Only index the Egress interface for the first hop entry in an AS entry.
+			if idx == 0 && hof.ConsEgress != 0 {
+				intfs = append(intfs, query.IntfSpec{IA: ia, IfID: uint64(hof.ConsEgress)})
+			}
+		}
+	}
+	return intfs, nil
+}
+
+func (m *segMeta) addTypes(segTypes []seg.Type) {
+	for _, segType := range segTypes {
+		if !m.hasType(segType) {
+			m.Types = append(m.Types, segType)
+		}
+	}
+}
+
+func (m *segMeta) addHPCfgIDs(hpCfgIDs []*query.HPCfgID) {
+	for _, hpCfgID := range hpCfgIDs {
+		if !m.hasHPCfgID(hpCfgID) {
+			id := *hpCfgID
+			m.HpCfgIDs = append(m.HpCfgIDs, &id)
+		}
+	}
+}
+
+func (m *segMeta) hasType(segType seg.Type) bool {
+	for _, t := range m.Types {
+		if t == segType {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *segMeta) hasHPCfgID(hpCfgID *query.HPCfgID) bool {
+	for _, id := range m.HpCfgIDs {
+		if id.Eq(hpCfgID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *segMeta) hasIntf(spec *query.IntfSpec) bool {
+	for _, intf := range m.Intfs {
+		if intf.IA.Eq(spec.IA) && intf.IfID == spec.IfID {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Backend) Delete(segID common.RawBytes) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	if _, ok := b.segs[string(segID)]; !ok {
+		return 0, nil
+	}
+	delete(b.segs, string(segID))
+	return 1, nil
+}
+
+func (b *Backend) DeleteWithIntf(intf query.IntfSpec) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	deleted := 0
+	for key, meta := range b.segs {
+		if meta.hasIntf(&intf) {
+			delete(b.segs, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (b *Backend) Get(params *query.Params) ([]*query.Result, error) {
+	b.RLock()
+	defer b.RUnlock()
+	metas := make([]*segMeta, 0, len(b.segs))
+	for _, meta := range b.segs {
+		metas = append(metas, meta)
+	}
+	// Return the segments in insertion order, like the SQLite backend does.
+	sort.Slice(metas, func(i, j int) bool { return metas[i].RowID < metas[j].RowID })
+	res := []*query.Result{}
+	for _, meta := range metas {
+		if r := match(meta, params); r != nil {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// match returns the result for meta if it matches params, nil otherwise. If
+// params restricts the HPCfgIDs, only the matching HPCfgIDs are part of the
+// result.
+func match(meta *segMeta, params *query.Params) *query.Result {
+	if params == nil {
+		return &query.Result{Seg: meta.Seg, HpCfgIDs: copyHPCfgIDs(meta.HpCfgIDs)}
+	}
+	if len(params.SegID) > 0 && !bytes.Equal(params.SegID, meta.SegID) {
+		return nil
+	}
+	if len(params.SegTypes) > 0 && !matchTypes(meta, params.SegTypes) {
+		return nil
+	}
+	if len(params.Intfs) > 0 && !matchIntfs(meta, params.Intfs) {
+		return nil
+	}
+	if len(params.StartsAt) > 0 && !matchIA(meta.StartsAt, params.StartsAt) {
+		return nil
+	}
+	if len(params.EndsAt) > 0 && !matchIA(meta.EndsAt, params.EndsAt) {
+		return nil
+	}
+	hpCfgIDs := meta.HpCfgIDs
+	if len(params.HpCfgIDs) > 0 {
+		hpCfgIDs = nil
+		for _, id := range meta.HpCfgIDs {
+			for _, want := range params.HpCfgIDs {
+				if id.Eq(want) {
+					hpCfgIDs = append(hpCfgIDs, id)
+					break
+				}
+			}
+		}
+		if len(hpCfgIDs) == 0 {
+			return nil
+		}
+	}
+	return &query.Result{Seg: meta.Seg, HpCfgIDs: copyHPCfgIDs(hpCfgIDs)}
+}
+
+func matchTypes(meta *segMeta, segTypes []seg.Type) bool {
+	for _, segType := range segTypes {
+		if meta.hasType(segType) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIntfs(meta *segMeta, intfs []*query.IntfSpec) bool {
+	for _, spec := range intfs {
+		if meta.hasIntf(spec) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIA(ia addr.IA, ias []addr.IA) bool {
+	for _, other := range ias {
+		if ia.Eq(other) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyHPCfgIDs(hpCfgIDs []*query.HPCfgID) []*query.HPCfgID {
+	res := make([]*query.HPCfgID, 0, len(hpCfgIDs))
+	for _, id := range hpCfgIDs {
+		c := *id
+		res = append(res, &c)
+	}
+	return res
+}
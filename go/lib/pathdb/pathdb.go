@@ -17,25 +17,36 @@
 package pathdb
 
 import (
+	"sync"
+
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/log"
 	"github.com/scionproto/scion/go/lib/pathdb/conn"
+	"github.com/scionproto/scion/go/lib/pathdb/mem"
 	"github.com/scionproto/scion/go/lib/pathdb/query"
 	"github.com/scionproto/scion/go/lib/pathdb/sqlite"
 )
 
 type DB struct {
 	conn conn.Conn
+	// writeLock serializes modifications, such that the change notifications
+	// reflect the order in which the changes were applied.
+	writeLock sync.Mutex
+	subs      subscriptions
 }
 
 // New creates a new or open an existing PathDB at a given path using the
-// given backend.
+// given backend. The "mem" backend ignores path and keeps all path segments
+// in memory only.
 func New(path string, backend string) (*DB, error) {
 	db := &DB{}
 	var err error
 	switch backend {
 	case "sqlite":
 		db.conn, err = sqlite.New(path)
+	case "mem":
+		db.conn = mem.New()
 	default:
 		return nil, common.NewBasicError("Unknown backend", nil, "backend", backend)
 	}
@@ -48,26 +59,103 @@ func New(path string, backend string) (*DB, error) {
 // Insert inserts or updates a path segment. It returns the number of path segments
 // that have been inserted/updated.
 func (db *DB) Insert(pseg *seg.PathSegment, segTypes []seg.Type) (int, error) {
-	return db.conn.Insert(pseg, segTypes)
+	return db.InsertWithHPCfgIDs(pseg, segTypes, []*query.HPCfgID{&query.NullHpCfgID})
 }
 
 // InsertWithCfgIDs inserts or updates a path segment with a set of HPCfgIDs. It
 // returns the number of path segments that have been inserted/updated.
 func (db *DB) InsertWithHPCfgIDs(pseg *seg.PathSegment,
 	segTypes []seg.Type, hpCfgIDs []*query.HPCfgID) (int, error) {
-	return db.conn.InsertWithHPCfgIDs(pseg, segTypes, hpCfgIDs)
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	if !db.hasSubscribers() {
+		return db.conn.InsertWithHPCfgIDs(pseg, segTypes, hpCfgIDs)
+	}
+	segID, err := pseg.ID()
+	if err != nil {
+		return 0, err
+	}
+	existing, err := db.conn.Get(&query.Params{SegID: segID})
+	if err != nil {
+		return 0, err
+	}
+	n, err := db.conn.InsertWithHPCfgIDs(pseg, segTypes, hpCfgIDs)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	evType := EventInserted
+	if len(existing) > 0 {
+		evType = EventUpdated
+	}
+	p, err := db.prepareEvent(evType, segID, pseg)
+	if err != nil {
+		log.Error("Unable to notify subscribers", "event", evType, "err", err)
+		return n, nil
+	}
+	db.publish([]*pendingEvent{p})
+	return n, nil
 }
 
 // Delete deletes a path segment with a given ID. Returns the number of deleted
 // path segments (0 or 1).
 func (db *DB) Delete(segID common.RawBytes) (int, error) {
-	return db.conn.Delete(segID)
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	if !db.hasSubscribers() {
+		return db.conn.Delete(segID)
+	}
+	pending, err := db.prepareDeletions(&query.Params{SegID: segID})
+	if err != nil {
+		return 0, err
+	}
+	n, err := db.conn.Delete(segID)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	db.publish(pending)
+	return n, nil
 }
 
 // DeleteWithIntf deletes all path segments that contain a given interface. Returns
 // the number of path segments deleted.
 func (db *DB) DeleteWithIntf(intf query.IntfSpec) (int, error) {
-	return db.conn.DeleteWithIntf(intf)
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	if !db.hasSubscribers() {
+		return db.conn.DeleteWithIntf(intf)
+	}
+	pending, err := db.prepareDeletions(&query.Params{Intfs: []*query.IntfSpec{&intf}})
+	if err != nil {
+		return 0, err
+	}
+	n, err := db.conn.DeleteWithIntf(intf)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	db.publish(pending)
+	return n, nil
+}
+
+// prepareDeletions creates the deletion events for all segments matching
+// params. It has to be called before the segments are deleted.
+func (db *DB) prepareDeletions(params *query.Params) ([]*pendingEvent, error) {
+	res, err := db.conn.Get(params)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]*pendingEvent, 0, len(res))
+	for _, r := range res {
+		segID, err := r.Seg.ID()
+		if err != nil {
+			return nil, err
+		}
+		p, err := db.prepareEvent(EventDeleted, segID, r.Seg)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, nil
 }
 
 // Get returns all path segment(s) matching the parameters specified.
@@ -0,0 +1,312 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pathdbtest contains a conformance test suite that all PathDB
+// backends have to pass. Backends call TestPathDB from their own tests:
+//
+//  func TestConformance(t *testing.T) {
+//    pathdbtest.TestPathDB(t, func() (conn.Conn, func()) {
+//      return New(), func() {}
+//    })
+//  }
+package pathdbtest
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/pathdb/conn"
+	"github.com/scionproto/scion/go/lib/pathdb/query"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/proto"
+)
+
+var (
+	ia330 = addr.IA{I: 1, A: 0xff0000000330}
+	ia311 = addr.IA{I: 1, A: 0xff0000000311}
+	ia331 = addr.IA{I: 1, A: 0xff0000000331}
+	ia332 = addr.IA{I: 1, A: 0xff0000000332}
+
+	ifs1 = []uint64{0, 5, 2, 3, 6, 3, 1, 0}
+	ifs2 = []uint64{0, 4, 2, 3, 1, 3, 2, 0}
+
+	hpCfgIDs = []*query.HPCfgID{
+		&query.NullHpCfgID,
+		{ia330, 0xdeadbeef},
+	}
+	types = []seg.Type{seg.UpSegment, seg.DownSegment}
+)
+
+// SetupFunc returns a fresh, empty backend and a function that releases
+// all resources associated with it.
+type SetupFunc func() (conn.Conn, func())
+
+// TestPathDB runs the conformance test suite against the backends created by
+// setup. Each test case operates on its own backend.
+func TestPathDB(t *testing.T, setup SetupFunc) {
+	Convey("PathDB backend conformance", t, func() {
+		b, cleanup := setup()
+		defer cleanup()
+		Convey("Insert should insert a new segment", func() {
+			testInsert(t, b)
+		})
+		Convey("Insert should update an existing segment with a newer timestamp", func() {
+			testUpdateExisting(t, b)
+		})
+		Convey("Insert should ignore an older segment", func() {
+			testOlderIgnored(t, b)
+		})
+		Convey("Delete should remove a path segment", func() {
+			testDelete(t, b)
+		})
+		Convey("DeleteWithIntf should remove all affected path segments", func() {
+			testDeleteWithIntf(t, b)
+		})
+		Convey("Get should filter by SegID and SegTypes", func() {
+			testGetMixed(t, b)
+		})
+		Convey("Get should return all path segments", func() {
+			testGetAll(t, b)
+		})
+		Convey("Get should filter by StartsAt and EndsAt", func() {
+			testGetStartsAtEndsAt(t, b)
+		})
+		Convey("Get should filter by interfaces", func() {
+			testGetWithIntfs(t, b)
+		})
+		Convey("Get should filter by HPCfgIDs", func() {
+			testGetWithHpCfgIDs(t, b)
+		})
+	})
+}
+
+func testInsert(t *testing.T, b conn.Conn) {
+	TS := uint32(10)
+	pseg, segID := AllocPathSegment(ifs1, TS)
+	inserted, err := b.InsertWithHPCfgIDs(pseg, types, hpCfgIDs)
+	xtest.FailOnErr(t, err)
+	SoMsg("Inserted", inserted, ShouldEqual, 1)
+	checkResult(t, b, segID, TS, types, hpCfgIDs)
+}
+
+func testUpdateExisting(t *testing.T, b conn.Conn) {
+	oldTS := uint32(10)
+	oldSeg, _ := AllocPathSegment(ifs1, oldTS)
+	newTS := uint32(20)
+	newSeg, newSegID := AllocPathSegment(ifs1, newTS)
+	insertSeg(t, b, oldSeg, types[:1], hpCfgIDs[:1])
+	inserted := insertSeg(t, b, newSeg, types, hpCfgIDs)
+	SoMsg("Inserted", inserted, ShouldEqual, 1)
+	checkResult(t, b, newSegID, newTS, types, hpCfgIDs)
+}
+
+func testOlderIgnored(t *testing.T, b conn.Conn) {
+	newTS := uint32(20)
+	newSeg, newSegID := AllocPathSegment(ifs1, newTS)
+	oldTS := uint32(10)
+	oldSeg, _ := AllocPathSegment(ifs1, oldTS)
+	insertSeg(t, b, newSeg, types, hpCfgIDs)
+	inserted := insertSeg(t, b, oldSeg, types[:1], hpCfgIDs[:1])
+	SoMsg("Inserted", inserted, ShouldEqual, 0)
+	checkResult(t, b, newSegID, newTS, types, hpCfgIDs)
+}
+
+func testDelete(t *testing.T, b conn.Conn) {
+	pseg, segID := AllocPathSegment(ifs1, 10)
+	insertSeg(t, b, pseg, types, hpCfgIDs)
+	deleted, err := b.Delete(segID)
+	xtest.FailOnErr(t, err)
+	SoMsg("Deleted", deleted, ShouldEqual, 1)
+	res, err := b.Get(nil)
+	xtest.FailOnErr(t, err)
+	SoMsg("Empty", len(res), ShouldEqual, 0)
+	deleted, err = b.Delete(segID)
+	xtest.FailOnErr(t, err)
+	SoMsg("Deleted again", deleted, ShouldEqual, 0)
+}
+
+func testDeleteWithIntf(t *testing.T, b conn.Conn) {
+	pseg1, _ := AllocPathSegment(ifs1, 10)
+	pseg2, _ := AllocPathSegment(ifs2, 10)
+	insertSeg(t, b, pseg1, types, hpCfgIDs)
+	insertSeg(t, b, pseg2, types, hpCfgIDs)
+	deleted, err := b.DeleteWithIntf(query.IntfSpec{IA: ia331, IfID: 2})
+	xtest.FailOnErr(t, err)
+	SoMsg("Deleted", deleted, ShouldEqual, 2)
+}
+
+func testGetMixed(t *testing.T, b conn.Conn) {
+	pseg1, segID1 := AllocPathSegment(ifs1, 10)
+	pseg2, _ := AllocPathSegment(ifs2, 10)
+	insertSeg(t, b, pseg1, types, hpCfgIDs)
+	insertSeg(t, b, pseg2, types[:1], hpCfgIDs[:1])
+	params := &query.Params{
+		SegID:    segID1,
+		SegTypes: []seg.Type{seg.UpSegment},
+	}
+	res, err := b.Get(params)
+	xtest.FailOnErr(t, err)
+	SoMsg("Result count", len(res), ShouldEqual, 1)
+	resSegID, _ := res[0].Seg.ID()
+	SoMsg("SegIDs match", resSegID, ShouldResemble, segID1)
+	SoMsg("HpCfgIDs match", res[0].HpCfgIDs, ShouldResemble, hpCfgIDs)
+}
+
+func testGetAll(t *testing.T, b conn.Conn) {
+	pseg1, segID1 := AllocPathSegment(ifs1, 10)
+	pseg2, segID2 := AllocPathSegment(ifs2, 10)
+	insertSeg(t, b, pseg1, types, hpCfgIDs)
+	insertSeg(t, b, pseg2, types[:1], hpCfgIDs[:1])
+	res, err := b.Get(nil)
+	xtest.FailOnErr(t, err)
+	SoMsg("Result count", len(res), ShouldEqual, 2)
+	for _, r := range res {
+		resSegID, _ := r.Seg.ID()
+		if bytes.Equal(resSegID, segID1) {
+			SoMsg("HpCfgIDs match", r.HpCfgIDs, ShouldResemble, hpCfgIDs)
+		} else if bytes.Equal(resSegID, segID2) {
+			SoMsg("HpCfgIDs match", r.HpCfgIDs, ShouldResemble, hpCfgIDs[:1])
+		} else {
+			t.Fatal("Unexpected result", "seg", r.Seg)
+		}
+	}
+}
+
+func testGetStartsAtEndsAt(t *testing.T, b conn.Conn) {
+	pseg1, _ := AllocPathSegment(ifs1, 10)
+	pseg2, _ := AllocPathSegment(ifs2, 10)
+	insertSeg(t, b, pseg1, types, hpCfgIDs)
+	insertSeg(t, b, pseg2, types[:1], hpCfgIDs[:1])
+	res, err := b.Get(&query.Params{StartsAt: []addr.IA{ia330, ia332}})
+	xtest.FailOnErr(t, err)
+	SoMsg("StartsAt count", len(res), ShouldEqual, 2)
+	res, err = b.Get(&query.Params{EndsAt: []addr.IA{ia330, ia332}})
+	xtest.FailOnErr(t, err)
+	SoMsg("EndsAt count", len(res), ShouldEqual, 2)
+	res, err = b.Get(&query.Params{StartsAt: []addr.IA{ia332}})
+	xtest.FailOnErr(t, err)
+	SoMsg("No match count", len(res), ShouldEqual, 0)
+}
+
+func testGetWithIntfs(t *testing.T, b conn.Conn) {
+	pseg1, _ := AllocPathSegment(ifs1, 10)
+	pseg2, _ := AllocPathSegment(ifs2, 10)
+	insertSeg(t, b, pseg1, types, hpCfgIDs)
+	insertSeg(t, b, pseg2, types[:1], hpCfgIDs[:1])
+	params := &query.Params{
+		Intfs: []*query.IntfSpec{
+			{IA: ia330, IfID: 5},
+			{IA: ia332, IfID: 2},
+		},
+	}
+	res, err := b.Get(params)
+	xtest.FailOnErr(t, err)
+	SoMsg("Result count", len(res), ShouldEqual, 2)
+}
+
+func testGetWithHpCfgIDs(t *testing.T, b conn.Conn) {
+	pseg1, _ := AllocPathSegment(ifs1, 10)
+	pseg2, _ := AllocPathSegment(ifs2, 10)
+	insertSeg(t, b, pseg1, types, hpCfgIDs)
+	insertSeg(t, b, pseg2, types[:1], hpCfgIDs[:1])
+	res, err := b.Get(&query.Params{HpCfgIDs: hpCfgIDs[1:]})
+	xtest.FailOnErr(t, err)
+	SoMsg("Result count", len(res), ShouldEqual, 1)
+	SoMsg("HpCfgIDs match", res[0].HpCfgIDs, ShouldResemble, hpCfgIDs[1:])
+}
+
+func checkResult(t *testing.T, b conn.Conn, segID common.RawBytes, ts uint32,
+	types []seg.Type, hpCfgIDs []*query.HPCfgID) {
+
+	res, err := b.Get(&query.Params{SegID: segID})
+	xtest.FailOnErr(t, err)
+	SoMsg("Result count", len(res), ShouldEqual, 1)
+	info, _ := res[0].Seg.InfoF()
+	SoMsg("Timestamps match", info.TsInt, ShouldEqual, ts)
+	SoMsg("HpCfgIDs match", res[0].HpCfgIDs, ShouldResemble, hpCfgIDs)
+	for _, segType := range types {
+		res, err := b.Get(&query.Params{SegID: segID, SegTypes: []seg.Type{segType}})
+		xtest.FailOnErr(t, err)
+		SoMsg(fmt.Sprintf("Has type %v", segType), len(res), ShouldEqual, 1)
+	}
+}
+
+func insertSeg(t *testing.T, b conn.Conn,
+	pseg *seg.PathSegment, types []seg.Type, hpCfgIDs []*query.HPCfgID) int {
+
+	inserted, err := b.InsertWithHPCfgIDs(pseg, types, hpCfgIDs)
+	xtest.FailOnErr(t, err)
+	return inserted
+}
+
+// AllocPathSegment creates a path segment 1-ff00:0:330 -> 1-ff00:0:331 ->
+// 1-ff00:0:332. ifs contains the ingress/egress interface pairs of the four
+// hop entries; the AS entry of 1-ff00:0:331 has two hop entries (the second
+// one being a peering entry to 1-ff00:0:311).
+func AllocPathSegment(ifs []uint64, expiration uint32) (*seg.PathSegment, common.RawBytes) {
+	rawHops := make([][]byte, len(ifs)/2)
+	for i := 0; i < len(ifs)/2; i++ {
+		rawHops[i] = make([]byte, 8)
+		spath.NewHopField(rawHops[i], common.IFIDType(ifs[2*i]), common.IFIDType(ifs[2*i+1]))
+	}
+	ases := []*seg.ASEntry{
+		{
+			RawIA: ia330.IAInt(),
+			HopEntries: []*seg.HopEntry{
+				allocHopEntry(addr.IA{}, ia331, rawHops[0]),
+			},
+		},
+		{
+			RawIA: ia331.IAInt(),
+			HopEntries: []*seg.HopEntry{
+				allocHopEntry(ia330, ia332, rawHops[1]),
+				allocHopEntry(ia311, ia332, rawHops[2]),
+			},
+		},
+		{
+			RawIA: ia332.IAInt(),
+			HopEntries: []*seg.HopEntry{
+				allocHopEntry(ia331, addr.IA{}, rawHops[3]),
+			},
+		},
+	}
+	info := &spath.InfoField{
+		TsInt: expiration,
+		ISD:   1,
+		Hops:  3,
+	}
+	pseg, _ := seg.NewSeg(info)
+	for _, ase := range ases {
+		if err := pseg.AddASEntry(ase, proto.SignType_none, nil); err != nil {
+			fmt.Printf("Error adding ASEntry: %v", err)
+		}
+	}
+	segID, _ := pseg.ID()
+	return pseg, segID
+}
+
+func allocHopEntry(inIA, outIA addr.IA, hopF common.RawBytes) *seg.HopEntry {
+	return &seg.HopEntry{
+		RawInIA:     inIA.IAInt(),
+		RawOutIA:    outIA.IAInt(),
+		RawHopField: hopF,
+	}
+}
@@ -26,6 +26,8 @@ import (
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/pathdb/conn"
+	"github.com/scionproto/scion/go/lib/pathdb/pathdbtest"
 	"github.com/scionproto/scion/go/lib/pathdb/query"
 	"github.com/scionproto/scion/go/lib/spath"
 	"github.com/scionproto/scion/go/proto"
@@ -524,3 +526,13 @@ func Test_OpenNewer(t *testing.T) {
 		SoMsg("Err returned", err, ShouldNotBeNil)
 	})
 }
+
+func TestConformance(t *testing.T) {
+	pathdbtest.TestPathDB(t, func() (conn.Conn, func()) {
+		b, tmpF := setupDB(t)
+		return b, func() {
+			b.db.Close()
+			os.Remove(tmpF)
+		}
+	})
+}
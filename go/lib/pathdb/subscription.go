@@ -0,0 +1,247 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the change notification support of the PathDB.
+
+package pathdb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/pathdb/query"
+)
+
+// DefaultSubscriptionBufSize is the number of events buffered for a
+// subscriber if no explicit buffer size is requested.
+const DefaultSubscriptionBufSize = 64
+
+type EventType int
+
+const (
+	// EventInserted is emitted when a previously unknown segment is inserted.
+	EventInserted EventType = iota
+	// EventUpdated is emitted when an existing segment is replaced by a more
+	// recent version.
+	EventUpdated
+	// EventDeleted is emitted when a segment is removed from the database.
+	EventDeleted
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventInserted:
+		return "Inserted"
+	case EventUpdated:
+		return "Updated"
+	case EventDeleted:
+		return "Deleted"
+	}
+	return fmt.Sprintf("UNKNOWN (%d)", t)
+}
+
+// Event describes a change of a single path segment in the database.
+type Event struct {
+	Type  EventType
+	SegID common.RawBytes
+	// SegTypes contains the types the segment is registered as after the
+	// change. For deletions, it contains the types the segment was registered
+	// as before it was removed.
+	SegTypes []seg.Type
+	// Seg is the path segment the event refers to.
+	Seg *seg.PathSegment
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("%s SegID: %s SegTypes: %v", e.Type, e.SegID, e.SegTypes)
+}
+
+// Subscription delivers the events matching its filter on channel C.
+//
+// Events are buffered up to the buffer size passed to Subscribe. Writers to
+// the database never block on subscribers: if the buffer of a subscription is
+// full, the new event is dropped and the drop counter is incremented. A
+// subscriber that observes a non-zero Dropped count can no longer rely on its
+// view being consistent and should re-sync by querying the database.
+type Subscription struct {
+	// C is the channel events are delivered on. It is closed by Close.
+	C       <-chan *Event
+	c       chan *Event
+	params  *query.Params
+	db      *DB
+	dropped uint64
+}
+
+// Dropped returns the number of events that were dropped because the buffer
+// of the subscription was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close unregisters the subscription and closes C. It is safe to call Close
+// multiple times.
+func (s *Subscription) Close() {
+	s.db.unsubscribe(s)
+}
+
+func (s *Subscription) send(e *Event) {
+	select {
+	case s.c <- e:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+type subscriptions struct {
+	sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscribe registers a new subscription for changes of path segments that
+// match params. A nil params matches all segments. bufSize is the number of
+// events buffered for the subscriber; if it is not positive,
+// DefaultSubscriptionBufSize is used.
+func (db *DB) Subscribe(params *query.Params, bufSize int) *Subscription {
+	if bufSize <= 0 {
+		bufSize = DefaultSubscriptionBufSize
+	}
+	c := make(chan *Event, bufSize)
+	s := &Subscription{C: c, c: c, params: params, db: db}
+	db.subs.Lock()
+	defer db.subs.Unlock()
+	if db.subs.subs == nil {
+		db.subs.subs = make(map[*Subscription]struct{})
+	}
+	db.subs.subs[s] = struct{}{}
+	return s
+}
+
+func (db *DB) unsubscribe(s *Subscription) {
+	db.subs.Lock()
+	defer db.subs.Unlock()
+	if _, ok := db.subs.subs[s]; !ok {
+		return
+	}
+	delete(db.subs.subs, s)
+	close(s.c)
+}
+
+func (db *DB) hasSubscribers() bool {
+	db.subs.RLock()
+	defer db.subs.RUnlock()
+	return len(db.subs.subs) > 0
+}
+
+// matchingSubscribers returns the subscriptions whose filter matches the
+// segment with the given ID in the current state of the database.
+func (db *DB) matchingSubscribers(segID common.RawBytes) ([]*Subscription, error) {
+	db.subs.RLock()
+	defer db.subs.RUnlock()
+	var subs []*Subscription
+	for s := range db.subs.subs {
+		ok, err := db.matches(s.params, segID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			subs = append(subs, s)
+		}
+	}
+	return subs, nil
+}
+
+// matches checks whether the segment with the given ID matches params. The
+// check is delegated to the backend, such that subscriptions use exactly the
+// same filter semantics as Get.
+func (db *DB) matches(params *query.Params, segID common.RawBytes) (bool, error) {
+	var p query.Params
+	if params != nil {
+		if len(params.SegID) > 0 && !bytes.Equal(params.SegID, segID) {
+			return false, nil
+		}
+		p = *params
+	}
+	p.SegID = segID
+	res, err := db.conn.Get(&p)
+	if err != nil {
+		return false, err
+	}
+	return len(res) > 0, nil
+}
+
+// segTypes returns the types the segment with the given ID is registered as.
+func (db *DB) segTypes(segID common.RawBytes) ([]seg.Type, error) {
+	var types []seg.Type
+	for _, t := range []seg.Type{seg.UpSegment, seg.DownSegment, seg.CoreSegment} {
+		res, err := db.conn.Get(&query.Params{SegID: segID, SegTypes: []seg.Type{t}})
+		if err != nil {
+			return nil, err
+		}
+		if len(res) > 0 {
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
+// notify sends e to all subscriptions in subs that have not been closed in
+// the meantime.
+func (db *DB) notify(subs []*Subscription, e *Event) {
+	db.subs.RLock()
+	defer db.subs.RUnlock()
+	for _, s := range subs {
+		if _, ok := db.subs.subs[s]; ok {
+			s.send(e)
+		}
+	}
+}
+
+// pendingEvent is an event together with the subscriptions it has to be
+// delivered to. For deletions, the subscribers have to be determined before
+// the segment is removed from the backend.
+type pendingEvent struct {
+	event *Event
+	subs  []*Subscription
+}
+
+// prepareEvent creates the event of type t for the segment with the given ID
+// based on the current state of the database.
+func (db *DB) prepareEvent(t EventType, segID common.RawBytes,
+	pseg *seg.PathSegment) (*pendingEvent, error) {
+
+	subs, err := db.matchingSubscribers(segID)
+	if err != nil || len(subs) == 0 {
+		return nil, err
+	}
+	types, err := db.segTypes(segID)
+	if err != nil {
+		return nil, err
+	}
+	return &pendingEvent{
+		event: &Event{Type: t, SegID: segID, SegTypes: types, Seg: pseg},
+		subs:  subs,
+	}, nil
+}
+
+func (db *DB) publish(pending []*pendingEvent) {
+	for _, p := range pending {
+		if p != nil {
+			db.notify(p.subs, p.event)
+		}
+	}
+}
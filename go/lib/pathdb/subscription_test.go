@@ -0,0 +1,146 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathdb
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/pathdb/pathdbtest"
+	"github.com/scionproto/scion/go/lib/pathdb/query"
+	"github.com/scionproto/scion/go/lib/xtest"
+)
+
+var (
+	ifs1 = []uint64{0, 5, 2, 3, 6, 3, 1, 0}
+	ifs2 = []uint64{0, 4, 2, 3, 1, 3, 2, 0}
+)
+
+func newMemDB(t *testing.T) *DB {
+	db, err := New("", "mem")
+	xtest.FailOnErr(t, err)
+	return db
+}
+
+func nextEvent(s *Subscription) *Event {
+	select {
+	case e := <-s.C:
+		return e
+	default:
+		return nil
+	}
+}
+
+func Test_Subscribe(t *testing.T) {
+	Convey("Subscriptions receive typed events", t, func() {
+		db := newMemDB(t)
+		s := db.Subscribe(nil, 0)
+		defer s.Close()
+		oldSeg, segID := pathdbtest.AllocPathSegment(ifs1, 10)
+		newSeg, _ := pathdbtest.AllocPathSegment(ifs1, 20)
+		Convey("Insert emits EventInserted", func() {
+			_, err := db.Insert(oldSeg, []seg.Type{seg.UpSegment})
+			xtest.FailOnErr(t, err)
+			e := nextEvent(s)
+			So(e, ShouldNotBeNil)
+			SoMsg("Type", e.Type, ShouldEqual, EventInserted)
+			SoMsg("SegID", e.SegID, ShouldResemble, segID)
+			SoMsg("SegTypes", e.SegTypes, ShouldResemble, []seg.Type{seg.UpSegment})
+		})
+		Convey("Newer segment emits EventUpdated with merged types", func() {
+			db.Insert(oldSeg, []seg.Type{seg.UpSegment})
+			nextEvent(s)
+			_, err := db.Insert(newSeg, []seg.Type{seg.DownSegment})
+			xtest.FailOnErr(t, err)
+			e := nextEvent(s)
+			So(e, ShouldNotBeNil)
+			SoMsg("Type", e.Type, ShouldEqual, EventUpdated)
+			SoMsg("SegTypes", e.SegTypes, ShouldResemble,
+				[]seg.Type{seg.UpSegment, seg.DownSegment})
+		})
+		Convey("Older segment emits nothing", func() {
+			db.Insert(newSeg, []seg.Type{seg.UpSegment})
+			nextEvent(s)
+			db.Insert(oldSeg, []seg.Type{seg.UpSegment})
+			SoMsg("Event", nextEvent(s), ShouldBeNil)
+		})
+		Convey("Delete emits EventDeleted", func() {
+			db.Insert(oldSeg, []seg.Type{seg.UpSegment})
+			nextEvent(s)
+			_, err := db.Delete(segID)
+			xtest.FailOnErr(t, err)
+			e := nextEvent(s)
+			So(e, ShouldNotBeNil)
+			SoMsg("Type", e.Type, ShouldEqual, EventDeleted)
+			SoMsg("SegID", e.SegID, ShouldResemble, segID)
+			SoMsg("SegTypes", e.SegTypes, ShouldResemble, []seg.Type{seg.UpSegment})
+		})
+		Convey("DeleteWithIntf emits an event per deleted segment", func() {
+			seg2, _ := pathdbtest.AllocPathSegment(ifs2, 10)
+			db.Insert(oldSeg, []seg.Type{seg.UpSegment})
+			db.Insert(seg2, []seg.Type{seg.UpSegment})
+			nextEvent(s)
+			nextEvent(s)
+			ia331 := addr.IA{I: 1, A: 0xff0000000331}
+			_, err := db.DeleteWithIntf(query.IntfSpec{IA: ia331, IfID: 2})
+			xtest.FailOnErr(t, err)
+			SoMsg("First", nextEvent(s).Type, ShouldEqual, EventDeleted)
+			SoMsg("Second", nextEvent(s).Type, ShouldEqual, EventDeleted)
+		})
+	})
+}
+
+func Test_SubscribeFilter(t *testing.T) {
+	Convey("Subscriptions only receive events matching their filter", t, func() {
+		db := newMemDB(t)
+		up := db.Subscribe(&query.Params{SegTypes: []seg.Type{seg.UpSegment}}, 0)
+		defer up.Close()
+		core := db.Subscribe(&query.Params{SegTypes: []seg.Type{seg.CoreSegment}}, 0)
+		defer core.Close()
+		pseg, _ := pathdbtest.AllocPathSegment(ifs1, 10)
+		db.Insert(pseg, []seg.Type{seg.UpSegment})
+		SoMsg("Up event", nextEvent(up), ShouldNotBeNil)
+		SoMsg("Core event", nextEvent(core), ShouldBeNil)
+	})
+}
+
+func Test_SubscribeDrop(t *testing.T) {
+	Convey("Full subscriptions drop new events", t, func() {
+		db := newMemDB(t)
+		s := db.Subscribe(nil, 1)
+		defer s.Close()
+		pseg1, segID1 := pathdbtest.AllocPathSegment(ifs1, 10)
+		pseg2, _ := pathdbtest.AllocPathSegment(ifs2, 10)
+		db.Insert(pseg1, []seg.Type{seg.UpSegment})
+		db.Insert(pseg2, []seg.Type{seg.UpSegment})
+		SoMsg("Dropped", s.Dropped(), ShouldEqual, 1)
+		SoMsg("Oldest kept", nextEvent(s).SegID, ShouldResemble, segID1)
+		SoMsg("Empty", nextEvent(s), ShouldBeNil)
+	})
+	Convey("Closed subscriptions do not receive events", t, func() {
+		db := newMemDB(t)
+		s := db.Subscribe(nil, 0)
+		s.Close()
+		s.Close()
+		pseg, _ := pathdbtest.AllocPathSegment(ifs1, 10)
+		_, err := db.Insert(pseg, []seg.Type{seg.UpSegment})
+		xtest.FailOnErr(t, err)
+		_, ok := <-s.C
+		SoMsg("Closed", ok, ShouldBeFalse)
+	})
+}
@@ -50,6 +50,9 @@ type cache struct {
 	maxAge time.Duration
 	// Revocation table mapping uifid to paths that contain the uifid
 	revTable *revTable
+	// Paths reported as unusable, mapped to the time until which they are
+	// ignored
+	bad map[spathmeta.PathKey]time.Time
 }
 
 func newCache(maxAge time.Duration) *cache {
@@ -57,6 +60,7 @@ func newCache(maxAge time.Duration) *cache {
 		m:        make(map[IAKey]*cacheEntry),
 		maxAge:   maxAge,
 		revTable: newRevTable(),
+		bad:      make(map[spathmeta.PathKey]time.Time),
 	}
 }
 
@@ -68,9 +72,10 @@ func (c *cache) update(src, dst addr.IA, aps spathmeta.AppPathSet) {
 	if !ok {
 		entry = c.addEntry(src, dst)
 	}
+	aps = c.withoutBad(aps)
 	entry.aps = aps
 	// Update all watches
-	entry.fs.update(entry.aps)
+	entry.fs.update(entry.aps, EventRemoved)
 	// Update revocation lists
 	c.revTable.updatePathSet(aps)
 	entry.timestamp = time.Now()
@@ -120,7 +125,7 @@ func (c *cache) watch(src, dst addr.IA, filter *pktcls.ActionFilterPaths) {
 			pp:       filter,
 			refCount: 1,
 		}
-		pf.update(entry.aps)
+		pf.update(entry.aps, EventRemoved)
 		entry.fs[key] = pf
 	} else {
 		pf.refCount++
@@ -185,6 +190,41 @@ func (c *cache) removeWatch(src, dst addr.IA, filter *pktcls.ActionFilterPaths)
 		"src", src, "dst", dst)
 }
 
+// subscribe adds s to the subscriptions of its watch, and queues the paths
+// of the watch as added paths. The watch must exist.
+func (c *cache) subscribe(s *Subscription) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := filterKey(s.filter)
+	entry, ok := c.getEntry(s.src, s.dst)
+	if !ok {
+		return common.NewBasicError("Unable to subscribe, src and dst are not watched", nil,
+			"src", s.src, "dst", s.dst)
+	}
+	pf, ok := entry.fs[key]
+	if !ok {
+		return common.NewBasicError("Unable to subscribe, filter not found", nil,
+			"src", s.src, "dst", s.dst, "filter", key)
+	}
+	if pf.subs == nil {
+		pf.subs = make(map[*Subscription]struct{})
+	}
+	pf.subs[s] = struct{}{}
+	s.notify(pf.sp.Load().APS, nil, EventRemoved)
+	return nil
+}
+
+// unsubscribe removes s from the subscriptions of its watch.
+func (c *cache) unsubscribe(s *Subscription) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if entry, ok := c.getEntry(s.src, s.dst); ok {
+		if pf, ok := entry.fs[filterKey(s.filter)]; ok {
+			delete(pf.subs, s)
+		}
+	}
+}
+
 // revoke all paths containing uifid from the cache.
 func (c *cache) revoke(u uifid) {
 	c.mutex.Lock()
@@ -197,12 +237,46 @@ func (c *cache) revoke(u uifid) {
 			log.Warn("Unable to extract src and dst IAs from path", "path", ap)
 			continue
 		}
-		c.remove(src, dst, ap)
+		c.remove(src, dst, ap, EventRevoked)
 	}
 }
 
+// markBad removes the path identified by key from the set of paths between
+// src and dst, and ignores it in updates until the specified time.
+func (c *cache) markBad(src, dst addr.IA, key spathmeta.PathKey, until time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.bad[key] = until
+	if entry, ok := c.getEntry(src, dst); ok {
+		if ap, ok := entry.aps[key]; ok {
+			c.remove(src, dst, ap, EventRemoved)
+		}
+	}
+}
+
+// withoutBad (internal) returns the paths in aps that are not marked as bad.
+// Expired marks are removed.
+func (c *cache) withoutBad(aps spathmeta.AppPathSet) spathmeta.AppPathSet {
+	if len(c.bad) == 0 {
+		return aps
+	}
+	now := time.Now()
+	for key, until := range c.bad {
+		if now.After(until) {
+			delete(c.bad, key)
+		}
+	}
+	result := make(spathmeta.AppPathSet)
+	for key, ap := range aps {
+		if _, ok := c.bad[key]; !ok {
+			result[key] = ap
+		}
+	}
+	return result
+}
+
 // remove (internal) one path from the set of paths between src and dst.
-func (c *cache) remove(src, dst addr.IA, ap *spathmeta.AppPath) {
+func (c *cache) remove(src, dst addr.IA, ap *spathmeta.AppPath, removal EventType) {
 	entry, ok := c.getEntry(src, dst)
 	if !ok {
 		log.Warn("Attempted to remove known path, but no path set found", "path",
@@ -211,9 +285,7 @@ func (c *cache) remove(src, dst addr.IA, ap *spathmeta.AppPath) {
 	}
 	delete(entry.aps, ap.Key())
 	// Update all watches
-	for _, pf := range entry.fs {
-		pf.update(entry.aps)
-	}
+	entry.fs.update(entry.aps, removal)
 }
 
 // getEntry (internal) retrieves the cache entry for src and dst.
@@ -49,11 +49,12 @@ func (k IAKey) String() string {
 type filterSet map[string]*pathFilter
 
 // update all the pathFilters in fs to contain the paths in aps that match
-// their respective spathmeta.PathPredicates.
-func (fs filterSet) update(aps spathmeta.AppPathSet) {
+// their respective spathmeta.PathPredicates. Subscribers are notified about
+// removed paths with event type removal.
+func (fs filterSet) update(aps spathmeta.AppPathSet, removal EventType) {
 	// Walk each PathFilter in this FilterSet and Update paths if needed
 	for _, pathFilter := range fs {
-		pathFilter.update(aps)
+		pathFilter.update(aps, removal)
 	}
 }
 
@@ -61,11 +62,14 @@ type pathFilter struct {
 	sp       *SyncPaths
 	pp       *pktcls.ActionFilterPaths
 	refCount int
+	// Subscriptions notified about path changes
+	subs map[*Subscription]struct{}
 }
 
 // update replaces the pathFilter's paths with those from aps, filtered by the
-// pathFilter's spathmeta.PathPredicate (if set).
-func (pf *pathFilter) update(aps spathmeta.AppPathSet) {
+// pathFilter's spathmeta.PathPredicate (if set). Subscribers are notified
+// about the changes, with event type removal for removed paths.
+func (pf *pathFilter) update(aps spathmeta.AppPathSet, removal EventType) {
 	// Filter the paths according to the current predicate
 	newAPS := make(spathmeta.AppPathSet)
 	if pf.pp == nil {
@@ -73,5 +77,15 @@ func (pf *pathFilter) update(aps spathmeta.AppPathSet) {
 	} else {
 		newAPS = pf.pp.Act(aps).(spathmeta.AppPathSet)
 	}
-	pf.sp.update(newAPS)
+	added, removed := pf.sp.update(newAPS)
+	for s := range pf.subs {
+		s.notify(added, removed, removal)
+	}
+}
+
+func filterKey(filter *pktcls.ActionFilterPaths) string {
+	if filter == nil {
+		return matchAll
+	}
+	return filter.GetName()
 }
@@ -26,6 +26,18 @@
 // paths, the resolver will atomically change the value within the SyncPaths
 // object. The data can be accessed by calling Load again.
 //
+// Instead of polling SyncPaths objects, callers can register for path changes
+// via 'Subscribe' (events are delivered on a channel) or 'SubscribeFunc'
+// (events are delivered to a callback). Subscribers receive an event for each
+// path that is added, removed or revoked. Revocations passed to 'Revoke' are
+// first sent to SCIOND for verification, and only applied to the cache if
+// SCIOND accepts them (or cannot verify them). Notifications of revoked paths
+// are therefore delayed by the round trip to SCIOND, but forged revocations
+// cannot remove paths.
+//
+// Watched paths are refreshed shortly before the first of them expires, and
+// at least every NormalRefire.
+//
 // An example of how this package can be used can be found in the associated
 // infra test file.
 //
@@ -53,21 +65,31 @@ import (
 
 // Timers is used to customize the timers for a new Path Manager.
 type Timers struct {
-	// Wait time after a successful path lookup (for periodic lookups)
+	// Maximum wait time after a successful path lookup (for periodic
+	// lookups). Paths are refreshed earlier if one of them expires sooner.
 	NormalRefire time.Duration
 	// Wait time after a failed (error or empty) path lookup (for periodic lookups)
 	ErrorRefire time.Duration
 	// Duration after which a path is considered stale
 	MaxAge time.Duration
+	// Time before the expiration of a watched path at which paths are
+	// refreshed
+	ExpiryMargin time.Duration
 }
 
 const (
-	// Default wait time after a successful path lookup (for periodic lookups)
+	// Default maximum wait time after a successful path lookup (for periodic
+	// lookups)
 	DefaultNormalRefire = time.Minute
 	// Default wait time after a failed path lookup (for periodic lookups)
 	DefaultErrorRefire = time.Second
 	// Default time after which a path is considered stale
 	DefaultMaxAge = 6 * time.Hour
+	// Default time before the expiration of a path at which paths are
+	// refreshed
+	DefaultExpiryMargin = time.Minute
+	// Time during which a path marked as bad is ignored
+	BadPathTimeout = 10 * time.Minute
 )
 
 func setDefaultTimers(timers *Timers) {
@@ -80,6 +102,9 @@ func setDefaultTimers(timers *Timers) {
 	if timers.MaxAge == 0 {
 		timers.MaxAge = DefaultMaxAge
 	}
+	if timers.ExpiryMargin == 0 {
+		timers.ExpiryMargin = DefaultExpiryMargin
+	}
 }
 
 type PR struct {
@@ -125,6 +150,7 @@ func New(srvc sciond.Service, timers *Timers, logger log.Logger) (*PR, error) {
 		requestQueue:  pr.requestQueue,
 		normalRefire:  timers.NormalRefire,
 		errorRefire:   timers.ErrorRefire,
+		expiryMargin:  timers.ExpiryMargin,
 	}
 	go r.run()
 	return pr, nil
@@ -216,26 +242,48 @@ func (r *PR) UnwatchFilter(src, dst addr.IA, filter *pktcls.ActionFilterPaths) e
 	return r.cache.removeWatch(src, dst, filter)
 }
 
-// Revoke asynchronously informs SCIOND about a revocation and flushes any
-// paths containing the revoked IFID.
+// MarkBad removes the path identified by key from the paths between src and
+// dst, including the paths of watches. The path is ignored in SCIOND replies
+// for BadPathTimeout. It is used when a router reports that the path is
+// unusable, e.g., because one of its hop fields expired or has an invalid MAC.
+func (r *PR) MarkBad(src, dst addr.IA, key spathmeta.PathKey) {
+	r.cache.markBad(src, dst, key, time.Now().Add(BadPathTimeout))
+}
+
+// Revoke informs SCIOND about the revocation. If SCIOND accepts it (or
+// cannot verify it), any paths containing the revoked IFID are flushed and
+// the subscribers of the affected paths are notified. Revocations that are
+// not active are ignored.
 func (r *PR) Revoke(revInfo common.RawBytes) {
+	sRevInfo, err := path_mgmt.NewSignedRevInfoFromRaw(revInfo)
+	if err != nil {
+		log.Error("Revocation failed, unable to parse signed revocation info",
+			"raw", revInfo, "err", err)
+		return
+	}
+	info, err := sRevInfo.RevInfo()
+	if err != nil {
+		log.Error("Revocation failed, unable to parse revocation info",
+			"sRevInfo", sRevInfo, "err", err)
+		return
+	}
+	if err := info.Active(); err != nil {
+		log.Warn("Ignoring inactive revocation", "revInfo", info, "err", err)
+		return
+	}
 	// Revoke asynchronously to prevent cases where waiting on SCIOND
 	// blocks the data plane receiver which got the SCMP packet.
 	go func() {
 		defer log.LogPanicAndExit()
 		r.Lock()
 		defer r.Unlock()
-		r.revoke(revInfo)
+		r.revoke(sRevInfo, info)
 	}()
 }
 
-func (r *PR) revoke(b common.RawBytes) {
-	sRevInfo, err := path_mgmt.NewSignedRevInfoFromRaw(b)
-	if err != nil {
-		log.Error("Revocation failed, unable to parse signed revocation info",
-			"raw", b, "err", err)
-		return
-	}
+// revoke flushes the paths affected by the revocation once SCIOND has checked
+// its signature, such that spoofed revocations do not remove paths.
+func (r *PR) revoke(sRevInfo *path_mgmt.SignedRevInfo, revInfo *path_mgmt.RevInfo) {
 	conn, err := r.sciondService.Connect()
 	if err != nil {
 		log.Error("Revocation failed, unable to connect to SCIOND", "err", err)
@@ -251,16 +299,9 @@ func (r *PR) revoke(b common.RawBytes) {
 		log.Error("Revocation error, unable to close SCIOND connection", "err", err)
 		// Continue with revocation
 	}
-	revInfo, err := sRevInfo.RevInfo()
-	if err != nil {
-		log.Error("Revocation failed, unable to parse revocation info",
-			"sRevInfo", sRevInfo, "err", err)
-		return
-	}
 	switch reply.Result {
 	case sciond.RevUnknown, sciond.RevValid:
-		uifid := uifidFromValues(revInfo.IA(), common.IFIDType(revInfo.IfID))
-		r.cache.revoke(uifid)
+		r.cache.revoke(uifidFromValues(revInfo.IA(), common.IFIDType(revInfo.IfID)))
 	case sciond.RevStale:
 		log.Warn("Found stale revocation notification", "revInfo", revInfo)
 	case sciond.RevInvalid:
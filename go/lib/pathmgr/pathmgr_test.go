@@ -21,6 +21,7 @@ import (
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
 	"github.com/scionproto/scion/go/lib/log"
 	"github.com/scionproto/scion/go/lib/pktcls"
 	"github.com/scionproto/scion/go/lib/sciond"
@@ -212,6 +213,91 @@ func TestRevoke(t *testing.T) {
 	})
 }
 
+func TestRevokeVerification(t *testing.T) {
+	Convey("Watch a path, revoke an interface on it", t, func() {
+		g := graph.NewDefaultGraph()
+		sd := &revSciond{MockService: sciond.NewMockService(g)}
+		pm, err := New(sd, &Timers{}, log.Root())
+		xtest.FailOnErr(t, err)
+		srcIA := xtest.MustParseIA("1-ff00:0:133")
+		dstIA := xtest.MustParseIA("1-ff00:0:131")
+		sp, err := pm.Watch(srcIA, dstIA)
+		xtest.FailOnErr(t, err)
+		sRevInfo := &path_mgmt.SignedRevInfo{}
+		revInfo := &path_mgmt.RevInfo{IfID: 1019, RawIsdas: srcIA.IAInt()}
+
+		Convey("Paths are kept if SCIOND finds the revocation invalid", func() {
+			sd.result = sciond.RevInvalid
+			pm.revoke(sRevInfo, revInfo)
+			apsCheckPaths("watch", sp.Load().APS,
+				"[1-ff00:0:133#1019 1-ff00:0:132#1910 "+
+					"1-ff00:0:132#1916 1-ff00:0:131#1619]")
+		})
+		Convey("Paths are flushed if SCIOND finds the revocation valid", func() {
+			sd.result = sciond.RevValid
+			pm.revoke(sRevInfo, revInfo)
+			apsCheckPaths("watch", sp.Load().APS)
+		})
+	})
+}
+
+// revSciond is a mock SCIOND that answers revocation notifications with a
+// fixed result.
+type revSciond struct {
+	*sciond.MockService
+	result sciond.RevResult
+}
+
+func (s *revSciond) Connect() (sciond.Connector, error) {
+	conn, err := s.MockService.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &revConn{Connector: conn, s: s}, nil
+}
+
+type revConn struct {
+	sciond.Connector
+	s *revSciond
+}
+
+func (c *revConn) RevNotification(*path_mgmt.SignedRevInfo) (*sciond.RevReply, error) {
+	return &sciond.RevReply{Result: c.s.result}, nil
+}
+
+func TestMarkBad(t *testing.T) {
+	Convey("Watch two paths, mark one as bad", t, func() {
+		g := graph.NewDefaultGraph()
+		g.AddLink("1-ff00:0:133", 101902, "1-ff00:0:132", 191002, false)
+		pm := NewPR(t, g, 50, 50, 50)
+		srcIA := xtest.MustParseIA("1-ff00:0:133")
+		dstIA := xtest.MustParseIA("1-ff00:0:131")
+
+		sp, err := pm.Watch(srcIA, dstIA)
+		SoMsg("err", err, ShouldBeNil)
+		SoMsg("aps", len(sp.Load().APS), ShouldEqual, 2)
+		var badKey spathmeta.PathKey
+		for key, ap := range sp.Load().APS {
+			if ap.Entry.Path.Interfaces[0].IfID == 101902 {
+				badKey = key
+			}
+		}
+		pm.MarkBad(srcIA, dstIA, badKey)
+		apsCheckPaths("watch", sp.Load().APS,
+			"[1-ff00:0:133#1019 1-ff00:0:132#1910 "+
+				"1-ff00:0:132#1916 1-ff00:0:131#1619]")
+		apsCheckPaths("query", pm.Query(srcIA, dstIA),
+			"[1-ff00:0:133#1019 1-ff00:0:132#1910 "+
+				"1-ff00:0:132#1916 1-ff00:0:131#1619]")
+		Convey("The bad path is ignored after SCIOND is queried again", func() {
+			<-time.After(200 * time.Millisecond)
+			apsCheckPaths("watch", sp.Load().APS,
+				"[1-ff00:0:133#1019 1-ff00:0:132#1910 "+
+					"1-ff00:0:132#1916 1-ff00:0:131#1619]")
+		})
+	})
+}
+
 func NewPR(t *testing.T, g *graph.Graph, normalRefire, errorRefire, maxAge int) *PR {
 	t.Helper()
 
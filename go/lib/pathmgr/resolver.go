@@ -30,8 +30,10 @@ type resolver struct {
 	sciondConn    sciond.Connector
 	// Wait time after a failed (error or empty) path lookup (for periodic lookups)
 	errorRefire time.Duration
-	// Wait time after a successful path lookup (for periodic lookups)
+	// Maximum wait time after a successful path lookup (for periodic lookups)
 	normalRefire time.Duration
+	// Time before the expiration of the first path at which paths are refreshed
+	expiryMargin time.Duration
 	// information about paths
 	cache *cache
 	// queue of outstanding requests
@@ -60,15 +62,9 @@ func (r *resolver) run() {
 			if r.cache.isWatched(request.src, request.dst) {
 				// Create new request, without done channel
 				request.done = nil
-				var wait time.Duration
-				if len(aps) == 0 {
-					wait = r.errorRefire
-				} else {
-					wait = r.normalRefire
-				}
 				// Make a copy of loop var for closure.
 				req := request
-				time.AfterFunc(wait, func() {
+				time.AfterFunc(r.refireAfter(aps), func() {
 					r.requestQueue <- req
 				})
 			}
@@ -78,6 +74,27 @@ func (r *resolver) run() {
 	}
 }
 
+// refireAfter returns the wait time until the next periodic lookup. Paths are
+// refreshed expiryMargin before the first of them expires, but at least
+// every normalRefire. Failed lookups are retried after errorRefire.
+func (r *resolver) refireAfter(aps spathmeta.AppPathSet) time.Duration {
+	if len(aps) == 0 {
+		return r.errorRefire
+	}
+	wait := r.normalRefire
+	now := time.Now()
+	for _, ap := range aps {
+		if untilRefresh := ap.Entry.Path.Expiry().Sub(now) - r.expiryMargin; untilRefresh < wait {
+			wait = untilRefresh
+		}
+	}
+	if wait < r.errorRefire {
+		// Avoid busy looping if SCIOND only knows paths that expire soon
+		wait = r.errorRefire
+	}
+	return wait
+}
+
 // lookup queries SCIOND, blocking while waiting for the response.
 func (r *resolver) lookup(src, dst addr.IA) spathmeta.AppPathSet {
 	reply, err := r.sciondConn.Paths(dst, src, numReqPaths, sciond.PathReqFlags{})
@@ -0,0 +1,231 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathmgr
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pktcls"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+)
+
+const (
+	// Capacity of the channel of channel-based subscriptions
+	eventChanCap = 1 << 4
+	// Maximum number of events queued for delivery per subscription. When a
+	// subscriber falls further behind, the oldest events are dropped.
+	eventQueueCap = 1 << 10
+)
+
+// EventType describes how the paths of a subscription changed.
+type EventType int
+
+const (
+	// EventAdded is delivered for paths that became available.
+	EventAdded EventType = iota
+	// EventRemoved is delivered for paths that are no longer returned by
+	// SCIOND, or that were marked as bad.
+	EventRemoved
+	// EventRevoked is delivered for paths that contain a revoked interface.
+	EventRevoked
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "Added"
+	case EventRemoved:
+		return "Removed"
+	case EventRevoked:
+		return "Revoked"
+	}
+	return fmt.Sprintf("UNKNOWN (%d)", int(t))
+}
+
+// Event is a change of a single path between Src and Dst.
+type Event struct {
+	Type EventType
+	Src  addr.IA
+	Dst  addr.IA
+	Path *spathmeta.AppPath
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("%s %s -> %s: %v", e.Type, e.Src, e.Dst, e.Path.Entry.Path.Interfaces)
+}
+
+// Subscription delivers the changes of the paths between two ASes. Events are
+// delivered in order by a dedicated goroutine, so slow subscribers do not
+// block the resolver or other subscribers.
+type Subscription struct {
+	// C delivers the events of subscriptions created with Subscribe. It is
+	// closed after the subscription is closed. For subscriptions created
+	// with SubscribeFunc, C is nil.
+	C <-chan *Event
+
+	pr     *PR
+	src    addr.IA
+	dst    addr.IA
+	filter *pktcls.ActionFilterPaths
+	// Callback of subscriptions created with SubscribeFunc
+	f func(*Event)
+	// Send side of C
+	events chan *Event
+	mutex  sync.Mutex
+	// Events waiting to be delivered
+	queue []*Event
+	// Signals the delivering goroutine that the queue is not empty
+	signal chan struct{}
+	// Closed when Close is called
+	closedChan chan struct{}
+	closeOnce  sync.Once
+}
+
+// Subscribe watches the paths from src to dst that adhere to filter (nil
+// matches all paths), and returns a subscription whose channel delivers an
+// event for each added, removed or revoked path. Paths available at the time
+// of the call are delivered as added paths first.
+//
+// Callers must keep reading from the channel until they call Close. If more
+// than eventQueueCap events are pending, the oldest ones are dropped.
+func (r *PR) Subscribe(src, dst addr.IA, filter *pktcls.ActionFilterPaths) (*Subscription,
+	error) {
+
+	events := make(chan *Event, eventChanCap)
+	s := newSubscription(r, src, dst, filter)
+	s.events = events
+	s.C = events
+	if err := r.subscribe(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SubscribeFunc is like Subscribe, but calls f for each event instead of
+// delivering it on a channel. Calls to f are sequential; f must not call
+// Close on the subscription.
+func (r *PR) SubscribeFunc(src, dst addr.IA, filter *pktcls.ActionFilterPaths,
+	f func(*Event)) (*Subscription, error) {
+
+	s := newSubscription(r, src, dst, filter)
+	s.f = f
+	if err := r.subscribe(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSubscription(r *PR, src, dst addr.IA, filter *pktcls.ActionFilterPaths) *Subscription {
+	return &Subscription{
+		pr:         r,
+		src:        src,
+		dst:        dst,
+		filter:     filter,
+		signal:     make(chan struct{}, 1),
+		closedChan: make(chan struct{}),
+	}
+}
+
+func (r *PR) subscribe(s *Subscription) error {
+	if _, err := r.WatchFilter(s.src, s.dst, s.filter); err != nil {
+		return err
+	}
+	if err := r.cache.subscribe(s); err != nil {
+		r.UnwatchFilter(s.src, s.dst, s.filter)
+		return err
+	}
+	go func() {
+		defer log.LogPanicAndExit()
+		s.run()
+	}()
+	return nil
+}
+
+// Close stops the delivery of events and unregisters the watch of the
+// subscription. Events that were not delivered yet are discarded.
+func (s *Subscription) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.pr.cache.unsubscribe(s)
+		close(s.closedChan)
+		err = s.pr.UnwatchFilter(s.src, s.dst, s.filter)
+	})
+	return err
+}
+
+// notify queues events for the added and removed paths. Removed paths are
+// reported with event type removal. notify does not block; if the queue
+// exceeds eventQueueCap, the oldest events are dropped.
+func (s *Subscription) notify(added, removed spathmeta.AppPathSet, removal EventType) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	for _, ap := range added {
+		s.queue = append(s.queue, &Event{Type: EventAdded, Src: s.src, Dst: s.dst, Path: ap})
+	}
+	for _, ap := range removed {
+		s.queue = append(s.queue, &Event{Type: removal, Src: s.src, Dst: s.dst, Path: ap})
+	}
+	if dropped := len(s.queue) - eventQueueCap; dropped > 0 {
+		log.Warn("Dropping path events of slow subscriber", "src", s.src, "dst", s.dst,
+			"dropped", dropped)
+		s.queue = append([]*Event(nil), s.queue[dropped:]...)
+	}
+	s.mutex.Unlock()
+	select {
+	case s.signal <- struct{}{}:
+	default:
+		// The delivering goroutine has not consumed the previous signal
+		// yet, and will also pick up these events.
+	}
+}
+
+// run delivers queued events until the subscription is closed.
+func (s *Subscription) run() {
+	if s.events != nil {
+		defer close(s.events)
+	}
+	for {
+		select {
+		case <-s.closedChan:
+			return
+		case <-s.signal:
+		}
+		s.mutex.Lock()
+		events := s.queue
+		s.queue = nil
+		s.mutex.Unlock()
+		for _, event := range events {
+			if s.f != nil {
+				select {
+				case <-s.closedChan:
+					return
+				default:
+				}
+				s.f(event)
+				continue
+			}
+			select {
+			case s.events <- event:
+			case <-s.closedChan:
+				return
+			}
+		}
+	}
+}
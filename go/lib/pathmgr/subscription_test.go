@@ -0,0 +1,176 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathmgr
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/lib/xtest/graph"
+)
+
+func TestSubscribe(t *testing.T) {
+	Convey("Subscribe to paths, receive the initial path", t, func() {
+		g := graph.NewDefaultGraph()
+		pm := NewPR(t, g, 50, 50, 50)
+		srcIA := xtest.MustParseIA("1-ff00:0:133")
+		dstIA := xtest.MustParseIA("1-ff00:0:131")
+
+		sub, err := pm.Subscribe(srcIA, dstIA, nil)
+		xtest.FailOnErr(t, err)
+		defer sub.Close()
+		event := nextEvent(sub)
+		SoMsg("type", event.Type, ShouldEqual, EventAdded)
+		SoMsg("src", event.Src, ShouldResemble, srcIA)
+		SoMsg("dst", event.Dst, ShouldResemble, dstIA)
+		SoMsg("path", eventPath(event),
+			ShouldEqual, "[1-ff00:0:133#1019 1-ff00:0:132#1910 "+
+				"1-ff00:0:132#1916 1-ff00:0:131#1619]")
+
+		Convey("A new link is delivered as an added path", func() {
+			g.AddLink("1-ff00:0:133", 101902, "1-ff00:0:132", 191002, false)
+			event := nextEvent(sub)
+			SoMsg("type", event.Type, ShouldEqual, EventAdded)
+			SoMsg("path", eventPath(event),
+				ShouldEqual, "[1-ff00:0:133#101902 1-ff00:0:132#191002 "+
+					"1-ff00:0:132#1916 1-ff00:0:131#1619]")
+		})
+		Convey("A revocation is delivered as a revoked path", func() {
+			pm.cache.revoke(uifidFromValues(srcIA, 1019))
+			event := nextEvent(sub)
+			SoMsg("type", event.Type, ShouldEqual, EventRevoked)
+			SoMsg("path", eventPath(event),
+				ShouldEqual, "[1-ff00:0:133#1019 1-ff00:0:132#1910 "+
+					"1-ff00:0:132#1916 1-ff00:0:131#1619]")
+		})
+		Convey("A path marked as bad is delivered as a removed path", func() {
+			pm.MarkBad(srcIA, dstIA, event.Path.Key())
+			event := nextEvent(sub)
+			SoMsg("type", event.Type, ShouldEqual, EventRemoved)
+		})
+		Convey("Closing the subscription closes the channel", func() {
+			err := sub.Close()
+			SoMsg("err", err, ShouldBeNil)
+			select {
+			case _, ok := <-sub.C:
+				SoMsg("closed", ok, ShouldBeFalse)
+			case <-time.After(time.Second):
+				t.Fatal("channel not closed")
+			}
+			SoMsg("unwatched", pm.cache.isWatched(srcIA, dstIA), ShouldBeFalse)
+		})
+	})
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	Convey("Subscribe to paths with a callback, receive the initial path", t, func() {
+		g := graph.NewDefaultGraph()
+		pm := NewPR(t, g, 50, 50, 50)
+		srcIA := xtest.MustParseIA("1-ff00:0:122")
+		dstIA := xtest.MustParseIA("2-ff00:0:220")
+
+		events := make(chan *Event, 8)
+		sub, err := pm.SubscribeFunc(srcIA, dstIA, nil, func(e *Event) {
+			events <- e
+		})
+		xtest.FailOnErr(t, err)
+		defer sub.Close()
+		select {
+		case event := <-events:
+			SoMsg("type", event.Type, ShouldEqual, EventAdded)
+		case <-time.After(time.Second):
+			t.Fatal("no event received")
+		}
+	})
+}
+
+func TestSubscriptionQueue(t *testing.T) {
+	Convey("The events queued for a slow subscriber are bounded", t, func() {
+		s := newSubscription(nil, xtest.MustParseIA("1-ff00:0:133"),
+			xtest.MustParseIA("1-ff00:0:131"), nil)
+		durations := make([]time.Duration, eventQueueCap+10)
+		for i := range durations {
+			durations[i] = time.Hour
+		}
+		s.notify(pathsExpiringIn(durations...), nil, EventRemoved)
+		SoMsg("queue", len(s.queue), ShouldEqual, eventQueueCap)
+	})
+}
+
+func TestRefireAfter(t *testing.T) {
+	Convey("Given a resolver", t, func() {
+		r := &resolver{
+			normalRefire: 10 * time.Minute,
+			errorRefire:  time.Second,
+			expiryMargin: time.Minute,
+		}
+		Convey("Failed lookups are retried after the error refire", func() {
+			SoMsg("wait", r.refireAfter(spathmeta.AppPathSet{}), ShouldEqual, time.Second)
+		})
+		Convey("Long-lived paths are refreshed after the normal refire", func() {
+			aps := pathsExpiringIn(time.Hour)
+			SoMsg("wait", r.refireAfter(aps), ShouldEqual, 10*time.Minute)
+		})
+		Convey("Paths are refreshed before they expire", func() {
+			aps := pathsExpiringIn(time.Hour, 5*time.Minute)
+			wait := r.refireAfter(aps)
+			SoMsg("wait", wait, ShouldBeLessThanOrEqualTo, 4*time.Minute)
+			SoMsg("wait", wait, ShouldBeGreaterThan, 3*time.Minute)
+		})
+		Convey("Paths expiring within the margin are refreshed after the error refire", func() {
+			aps := pathsExpiringIn(30 * time.Second)
+			SoMsg("wait", r.refireAfter(aps), ShouldEqual, time.Second)
+		})
+	})
+}
+
+func pathsExpiringIn(durations ...time.Duration) spathmeta.AppPathSet {
+	aps := make(spathmeta.AppPathSet)
+	for i, d := range durations {
+		aps.Add(&sciond.PathReplyEntry{
+			Path: &sciond.FwdPathMeta{
+				Interfaces: []sciond.PathInterface{
+					{RawIsdas: xtest.MustParseIA("1-ff00:0:133").IAInt(),
+						IfID: common.IFIDType(i + 1)},
+				},
+				ExpTime: uint32(time.Now().Add(d).Unix()),
+			},
+		})
+	}
+	return aps
+}
+
+func nextEvent(sub *Subscription) *Event {
+	select {
+	case event := <-sub.C:
+		return event
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+func eventPath(event *Event) string {
+	if event == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", event.Path.Entry.Path.Interfaces)
+}
@@ -60,12 +60,14 @@ func NewSyncPaths() *SyncPaths {
 	return sp
 }
 
-// update adds and removes paths in sp to match newAPS. If a path was added or
-// removed, the modified timestamp is updated. The refresh timestamp is always
-// updated.
+// update adds and removes paths in sp to match newAPS, and returns the paths
+// that were added and removed. If a path was added or removed, the modified
+// timestamp is updated. The refresh timestamp is always updated.
 // FIXME(scrye): Add SCIOND support s.t. the refresh timestamp is changed only
 // when paths (including path metadata) change.
-func (sp *SyncPaths) update(newAPS spathmeta.AppPathSet) {
+func (sp *SyncPaths) update(newAPS spathmeta.AppPathSet) (spathmeta.AppPathSet,
+	spathmeta.AppPathSet) {
+
 	sp.mutex.Lock()
 	defer sp.mutex.Unlock()
 	value := sp.value.Load().(*SyncPathsData)
@@ -77,6 +79,7 @@ func (sp *SyncPaths) update(newAPS spathmeta.AppPathSet) {
 	}
 	value.APS = newAPS
 	sp.value.Store(value)
+	return toAdd, toRemove
 }
 
 // Load returns a SyncPathsData snapshot of the data within sp.
@@ -67,6 +67,31 @@ func TestClassMap(t *testing.T) {
 				),
 			},
 		},
+		{
+			Name:     "IPv6",
+			FileName: "class_3",
+			Classes: ClassMap{
+				"transit IPv6": NewClass(
+					"transit IPv6",
+					NewCondAnyOf(
+						NewCondIPv6(&IPv6MatchDSCP{0x2e}),
+						NewCondIPv6(&IPv6MatchTrafficClass{0xb8}),
+						NewCondIPv6(&IPv6MatchSource{
+							&net.IPNet{
+								IP:   net.ParseIP("2001:db8:1::"),
+								Mask: net.CIDRMask(48, 128),
+							},
+						}),
+						NewCondIPv6(&IPv6MatchDestination{
+							&net.IPNet{
+								IP:   net.ParseIP("2001:db8:2::"),
+								Mask: net.CIDRMask(48, 128),
+							},
+						}),
+					),
+				),
+			},
+		},
 		{
 			Name:     "nil ClassMap stays nil",
 			FileName: "class_2",
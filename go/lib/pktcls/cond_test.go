@@ -144,6 +144,78 @@ func TestIPCond(t *testing.T) {
 			),
 			ExpEval: false,
 		},
+		{
+			Name: "Match IPv6 DSCP and destination",
+			Cond: NewCondAllOf(
+				NewCondIPv6(&IPv6MatchDSCP{DSCP: 0x2e}),
+				NewCondIPv6(
+					&IPv6MatchDestination{
+						&net.IPNet{
+							IP:   net.ParseIP("2001:db8:2::"),
+							Mask: net.CIDRMask(48, 128),
+						},
+					},
+				),
+			),
+			Packet: newTestIPv6Packet(
+				&layers.IPv6{
+					Version:      6,
+					TrafficClass: 0x2e << 2,
+					SrcIP:        net.ParseIP("2001:db8:1::1"),
+					DstIP:        net.ParseIP("2001:db8:2::1"),
+				},
+				[]byte{3, 3, 3, 3},
+			),
+			ExpEval: true,
+		},
+		{
+			Name: "Match IPv6 source but not traffic class",
+			Cond: NewCondAllOf(
+				NewCondIPv6(&IPv6MatchTrafficClass{TrafficClass: 0xb8}),
+				NewCondIPv6(
+					&IPv6MatchSource{
+						&net.IPNet{
+							IP:   net.ParseIP("2001:db8:1::"),
+							Mask: net.CIDRMask(48, 128),
+						},
+					},
+				),
+			),
+			Packet: newTestIPv6Packet(
+				&layers.IPv6{
+					Version: 6,
+					SrcIP:   net.ParseIP("2001:db8:1::1"),
+					DstIP:   net.ParseIP("2001:db8:2::1"),
+				},
+				[]byte{4, 4, 4, 4},
+			),
+			ExpEval: false,
+		},
+		{
+			Name: "IPv4 conditions do not match IPv6 packets",
+			Cond: NewCondIPv4(&IPv4MatchDSCP{DSCP: 0}),
+			Packet: newTestIPv6Packet(
+				&layers.IPv6{
+					Version: 6,
+					SrcIP:   net.ParseIP("2001:db8:1::1"),
+					DstIP:   net.ParseIP("2001:db8:2::1"),
+				},
+				[]byte{5, 5, 5, 5},
+			),
+			ExpEval: false,
+		},
+		{
+			Name: "IPv6 conditions do not match IPv4 packets",
+			Cond: NewCondIPv6(&IPv6MatchDSCP{DSCP: 0}),
+			Packet: newTestPacket(
+				&layers.IPv4{
+					SrcIP: net.IP{192, 168, 1, 1},
+					DstIP: net.IP{10, 0, 0, 2},
+				},
+				[]byte{6, 6, 6, 6},
+			),
+			ExpEval: false,
+		},
 	}
 
 	Convey("TestIPCond", t, func() {
@@ -165,3 +237,17 @@ func newTestPacket(ipv4 *layers.IPv4, pld []byte) *Packet {
 	)
 	return NewPacket(buf.Bytes())
 }
+
+func newTestIPv6Packet(ipv6 *layers.IPv6, pld []byte) *Packet {
+	// The zero value of NextHeader is the hop-by-hop options header, whose
+	// parsing would fail.
+	ipv6.NextHeader = layers.IPProtocolNoNextHeader
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(
+		buf,
+		gopacket.SerializeOptions{FixLengths: true},
+		ipv6,
+		gopacket.Payload(pld),
+	)
+	return NewPacket(buf.Bytes())
+}
@@ -19,14 +19,16 @@
 // true for a ClsPkt, that packet is considered to be part of that class.
 //
 // The following conditions are supported:
-// AnyOf, AllOf, Boolean true, Boolean false and IPv4. AnyOf returns true if at
-// least one subcondition returns true. AllOf returns true if all subconditions
-// return true.  AllOf or AnyOf without subconditions return true. Boolean
-// conditions always return their internal value. IPv4 conditions include
-// predicates that compare the analyzed packet to preset values. Supported IPv4
+// AnyOf, AllOf, Boolean true, Boolean false, IPv4 and IPv6. AnyOf returns true
+// if at least one subcondition returns true. AllOf returns true if all
+// subconditions return true.  AllOf or AnyOf without subconditions return true.
+// Boolean conditions always return their internal value. IPv4 and IPv6
+// conditions include predicates that compare the analyzed packet to preset
+// values; they never match packets of the other IP version. Supported IPv4
 // conditions currently include destination network match, source network match
-// and ToS/DSCP fields match. Multiple predicates can be checked by enumerating
-// them under AllOf or AnyOf.
+// and ToS/DSCP fields match. Supported IPv6 conditions include destination
+// network match, source network match and Traffic Class/DSCP fields match.
+// Multiple predicates can be checked by enumerating them under AllOf or AnyOf.
 //
 // Actions are marshalable objects that describe a process. Currently, the only
 // supported actions are Path Filters (ActionFilterPaths), which are containers
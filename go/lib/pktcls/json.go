@@ -40,17 +40,22 @@ type Typer interface {
 // concrete type is unmarshaled.
 
 const (
-	TypeCondAllOf            = "CondAllOf"
-	TypeCondAnyOf            = "CondAnyOf"
-	TypeCondNot              = "CondNot"
-	TypeCondBool             = "CondBool"
-	TypeCondIPv4             = "CondIPv4"
-	TypeCondPathPredicate    = "CondPathPredicate"
-	TypeActionFilterPaths    = "ActionFilterPaths"
-	TypeIPv4MatchSource      = "MatchSource"
-	TypeIPv4MatchDestination = "MatchDestination"
-	TypeIPv4MatchToS         = "MatchToS"
-	TypeIPv4MatchDSCP        = "MatchDSCP"
+	TypeCondAllOf             = "CondAllOf"
+	TypeCondAnyOf             = "CondAnyOf"
+	TypeCondNot               = "CondNot"
+	TypeCondBool              = "CondBool"
+	TypeCondIPv4              = "CondIPv4"
+	TypeCondIPv6              = "CondIPv6"
+	TypeCondPathPredicate     = "CondPathPredicate"
+	TypeActionFilterPaths     = "ActionFilterPaths"
+	TypeIPv4MatchSource       = "MatchSource"
+	TypeIPv4MatchDestination  = "MatchDestination"
+	TypeIPv4MatchToS          = "MatchToS"
+	TypeIPv4MatchDSCP         = "MatchDSCP"
+	TypeIPv6MatchSource       = "IPv6MatchSource"
+	TypeIPv6MatchDestination  = "IPv6MatchDestination"
+	TypeIPv6MatchTrafficClass = "IPv6MatchTrafficClass"
+	TypeIPv6MatchDSCP         = "IPv6MatchDSCP"
 )
 
 // generic container for marshaling custom data
@@ -97,6 +102,10 @@ func unmarshalInterface(b []byte) (Typer, error) {
 			var c CondIPv4
 			err := json.Unmarshal(*v, &c)
 			return &c, err
+		case TypeCondIPv6:
+			var c CondIPv6
+			err := json.Unmarshal(*v, &c)
+			return &c, err
 		case TypeCondPathPredicate:
 			var c CondPathPredicate
 			err := json.Unmarshal(*v, &c)
@@ -121,6 +130,22 @@ func unmarshalInterface(b []byte) (Typer, error) {
 			var p IPv4MatchDSCP
 			err := json.Unmarshal(*v, &p)
 			return &p, err
+		case TypeIPv6MatchSource:
+			var p IPv6MatchSource
+			err := json.Unmarshal(*v, &p)
+			return &p, err
+		case TypeIPv6MatchDestination:
+			var p IPv6MatchDestination
+			err := json.Unmarshal(*v, &p)
+			return &p, err
+		case TypeIPv6MatchTrafficClass:
+			var p IPv6MatchTrafficClass
+			err := json.Unmarshal(*v, &p)
+			return &p, err
+		case TypeIPv6MatchDSCP:
+			var p IPv6MatchDSCP
+			err := json.Unmarshal(*v, &p)
+			return &p, err
 		default:
 			return nil, common.NewBasicError("Unknown type", nil, "type", k)
 		}
@@ -167,6 +192,19 @@ func unmarshalPredicate(b []byte) (IPv4Predicate, error) {
 	return p, nil
 }
 
+// unmarshalIPv6Predicate extracts an IPv6Predicate from a JSON encoding
+func unmarshalIPv6Predicate(b []byte) (IPv6Predicate, error) {
+	t, err := unmarshalInterface(b)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := t.(IPv6Predicate)
+	if !ok {
+		return nil, common.NewBasicError("Unable to extract IPv6Predicate from interface", nil)
+	}
+	return p, nil
+}
+
 // Special case slices because we only need them for Conds
 
 func marshalCondSlice(conds []Cond) ([]byte, error) {
@@ -28,9 +28,15 @@ type Packet struct {
 	parsedPkt gopacket.Packet
 }
 
+// NewPacket parses raw as an IPv4 or IPv6 packet, depending on the IP version
+// in the first header nibble.
 func NewPacket(raw common.RawBytes) *Packet {
+	decoder := layers.LayerTypeIPv4
+	if len(raw) > 0 && raw[0]>>4 == 6 {
+		decoder = layers.LayerTypeIPv6
+	}
 	return &Packet{
 		rawPkt:    raw,
-		parsedPkt: gopacket.NewPacket(raw, layers.LayerTypeIPv4, gopacket.NoCopy),
+		parsedPkt: gopacket.NewPacket(raw, decoder, gopacket.NoCopy),
 	}
 }
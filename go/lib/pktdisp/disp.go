@@ -27,10 +27,15 @@ type DispPkt struct {
 
 type DispatchFunc func(*DispPkt)
 
+// Conn is the connection a PktDispatcher reads from, e.g., a *snet.Conn.
+type Conn interface {
+	ReadFromSCION(b []byte) (int, *snet.Addr, error)
+}
+
 // PktDispatcher listens on c, and calls f for every packet read.
 // N.B. the DispPkt passed to f is reused, so applications should make a copy if
 // this is a problem.
-func PktDispatcher(c *snet.Conn, f DispatchFunc) {
+func PktDispatcher(c Conn, f DispatchFunc) {
 	defer log.LogPanicAndExit()
 	var err error
 	var n int
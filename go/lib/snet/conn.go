@@ -21,10 +21,10 @@ import (
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
 	"github.com/scionproto/scion/go/lib/hpkt"
 	"github.com/scionproto/scion/go/lib/l4"
 	"github.com/scionproto/scion/go/lib/log"
-	"github.com/scionproto/scion/go/lib/overlay"
 	"github.com/scionproto/scion/go/lib/pathmgr"
 	"github.com/scionproto/scion/go/lib/sciond"
 	"github.com/scionproto/scion/go/lib/scmp"
@@ -62,14 +62,14 @@ var _ net.Conn = (*Conn)(nil)
 var _ net.PacketConn = (*Conn)(nil)
 
 type Conn struct {
-	conn *reliable.Conn
+	conn packetConn
 	// Local, remote and bind SCION addresses (IA, L3, L4)
 	laddr *Addr
 	raddr *Addr
 	baddr *Addr
 	// svc address
 	svc addr.HostSVC
-	// Describes L3 and L4 protocol; currently only udp4 is implemented
+	// Describes L3 and L4 protocol; one of udp4, udp6 or udp (dual-stack)
 	net        string
 	readMutex  sync.Mutex
 	writeMutex sync.Mutex
@@ -80,8 +80,11 @@ type Conn struct {
 	sp *pathmgr.SyncPaths
 	// Reference to SCION networking context
 	scionNet *Network
-	// Key of last used path, used to select the same path for the next packet
-	prefPathKey spathmeta.PathKey
+	// Chooses the path for each destination; protected by selectorMutex
+	selector      PathSelector
+	selectorMutex sync.Mutex
+	// Information learned from SCMP messages
+	scmpState *scmpState
 }
 
 // DialSCION calls DialSCION on the default networking context.
@@ -147,7 +150,7 @@ func (c *Conn) read(b []byte, from bool) (int, *Addr, error) {
 	}
 	n, lastHopNetAddr, err := c.conn.ReadFrom(c.recvBuffer)
 	if err != nil {
-		return 0, nil, common.NewBasicError("Dispatcher read error", err)
+		return 0, nil, common.NewBasicError("Underlay read error", err)
 	}
 	lastHop := lastHopNetAddr.(*reliable.AppAddr)
 	if !from {
@@ -167,8 +170,8 @@ func (c *Conn) read(b []byte, from bool) (int, *Addr, error) {
 	if err != nil {
 		return 0, nil, common.NewBasicError("Unable to copy payload", err)
 	}
-	// On UDP4 network we can get either UDP traffic or SCMP messages
-	if c.net == "udp4" {
+	// On UDP networks we can get either UDP traffic or SCMP messages
+	if isUDPNetwork(c.net) {
 		// Extract remote address
 		remote = &Addr{
 			IA:   pkt.SrcIA,
@@ -190,7 +193,9 @@ func (c *Conn) read(b []byte, from bool) (int, *Addr, error) {
 			remote.L4Port = hdr.SrcPort
 			return n, remote, nil
 		case *scmp.Hdr:
-			c.handleSCMP(hdr, pkt)
+			if err := c.handleSCMP(hdr, pkt); err != nil {
+				return n, remote, err
+			}
 			return n, remote, &OpError{scmp: hdr}
 		default:
 			return n, remote, common.NewBasicError("Unexpected SCION L4 protocol", nil,
@@ -200,15 +205,6 @@ func (c *Conn) read(b []byte, from bool) (int, *Addr, error) {
 	return 0, nil, common.NewBasicError("Unknown network", nil, "net", c.net)
 }
 
-func (c *Conn) handleSCMP(hdr *scmp.Hdr, pkt *spkt.ScnPkt) {
-	// Only handle revocations for now
-	if hdr.Class == scmp.C_Path && hdr.Type == scmp.T_P_RevokedIF {
-		c.handleSCMPRev(hdr, pkt)
-	} else {
-		log.Warn("Received unsupported SCMP message", "class", hdr.Class, "type", hdr.Type)
-	}
-}
-
 func (c *Conn) handleSCMPRev(hdr *scmp.Hdr, pkt *spkt.ScnPkt) {
 	scmpPayload, ok := pkt.Pld.(*scmp.Payload)
 	if !ok {
@@ -220,6 +216,14 @@ func (c *Conn) handleSCMPRev(hdr *scmp.Hdr, pkt *spkt.ScnPkt) {
 			"type", common.TypeOf(scmpPayload.Info))
 	}
 	log.Info("Received SCMP revocation", "header", hdr.String(), "payload", scmpPayload.String())
+	// Let the selector fail over immediately, as the path resolver needs to
+	// contact SCIOND before it removes the revoked paths.
+	if sRevInfo, err := path_mgmt.NewSignedRevInfoFromRaw(info.RawSRev); err == nil {
+		if revInfo, err := sRevInfo.RevInfo(); err == nil {
+			expiry := time.Unix(int64(revInfo.Timestamp+uint64(revInfo.TTL)), 0)
+			c.PathSelector().Revoke(revInfo.IA(), common.IFIDType(revInfo.IfID), expiry)
+		}
+	}
 	// Extract RevInfo buffer and send it to path manager
 	c.scionNet.pathResolver.Revoke(info.RawSRev)
 }
@@ -229,8 +233,17 @@ func (c *Conn) WriteToSCION(b []byte, raddr *Addr) (int, error) {
 	if c.conn == nil {
 		return 0, common.NewBasicError("Connection not initialized", nil)
 	}
+	// Report SCMP unreachable messages received since the last write
+	if err := c.scmpState.popPending(raddr); err != nil {
+		return 0, err
+	}
 	n, err := c.write(b, raddr)
 	if err != nil {
+		// Oversized packets are reported as is, so that applications can
+		// adapt the size of their writes.
+		if _, ok := err.(*MTUError); ok {
+			return 0, err
+		}
 		return 0, common.NewBasicError("Dispatcher error", err)
 	}
 	return n, err
@@ -259,29 +272,23 @@ func (c *Conn) Write(b []byte) (int, error) {
 func (c *Conn) write(b []byte, raddr *Addr) (int, error) {
 	c.writeMutex.Lock()
 	defer c.writeMutex.Unlock()
-	var err error
-	var path *spath.Path
-	var nextHopHost addr.HostAddr
-	var nextHopPort uint16
-	// If src and dst are in the same AS, the path will be empty
-	if !c.laddr.IA.Eq(raddr.IA) {
-		if raddr.Path != nil && raddr.NextHopHost != nil && raddr.NextHopPort != 0 {
-			path = raddr.Path
-			nextHopHost = raddr.NextHopHost
-			nextHopPort = raddr.NextHopPort
-		} else {
-			pathEntry, err := c.selectPathEntry(raddr)
-			if err != nil {
-				return 0, err
-			}
-			path = spath.New(pathEntry.Path.FwdPath)
-			nextHopHost = pathEntry.HostInfo.Host()
-			nextHopPort = pathEntry.HostInfo.Port
-			err = path.InitOffsets()
-			if err != nil {
-				return 0, common.NewBasicError("Unable to initialize path", err)
-			}
-		}
+	// SVC addresses are resolved by the remote AS, so they are valid on all
+	// networks.
+	if raddr.Host.Type() != addr.HostTypeSVC && !hostAllowed(c.net, raddr.Host) {
+		return 0, common.NewBasicError("Remote address does not match network", nil,
+			"net", c.net, "actual", raddr.Host.Type())
+	}
+	path, nextHop, mtu, err := c.resolvePath(raddr)
+	if err != nil {
+		return 0, err
+	}
+	if path != nil {
+		c.scmpState.setLastPath(raddr, path)
+	}
+	// MTUs reported by routers or found by probing are more accurate than the
+	// advertised MTU.
+	if known, ok := c.scmpState.mtu(pathKey(path)); ok {
+		mtu = known
 	}
 
 	// Prepare packet fields
@@ -303,28 +310,42 @@ func (c *Conn) write(b []byte, raddr *Addr) (int, error) {
 	if err != nil {
 		return 0, common.NewBasicError("Unable to serialize SCION packet", err)
 	}
-
-	// Construct overlay next-hop
-	var appAddr reliable.AppAddr
-	if path == nil {
-		// Overlay next-hop is destination
-		appAddr = reliable.AppAddr{
-			Addr: pkt.DstHost,
-			Port: overlay.EndhostPort}
-	} else {
-		// Overlay next-hop is contained in path
-		appAddr = reliable.AppAddr{Addr: nextHopHost, Port: nextHopPort}
+	if mtu != 0 && n > int(mtu) {
+		return 0, &MTUError{MTU: mtu, Size: n, MaxPayload: len(b) - (n - int(mtu))}
 	}
 
 	// Send message
-	n, err = c.conn.WriteTo(c.sendBuffer[:n], &appAddr)
+	n, err = c.conn.WriteTo(c.sendBuffer[:n], nextHop)
 	if err != nil {
-		return 0, common.NewBasicError("Dispatcher write error", err)
+		return 0, common.NewBasicError("Underlay write error", err)
 	}
 
 	return pkt.Pld.Len(), nil
 }
 
+// resolvePath returns the path and overlay next hop used to reach raddr, and
+// the MTU advertised for the path (0 if unknown). If src and dst are in the
+// same AS, the path is nil and the next hop is the destination.
+func (c *Conn) resolvePath(raddr *Addr) (*spath.Path, *reliable.AppAddr, uint16, error) {
+	if c.laddr.IA.Eq(raddr.IA) {
+		return nil, &reliable.AppAddr{Addr: raddr.Host, Port: c.scionNet.endhostPort()}, 0, nil
+	}
+	if raddr.Path != nil && raddr.NextHopHost != nil && raddr.NextHopPort != 0 {
+		nextHop := &reliable.AppAddr{Addr: raddr.NextHopHost, Port: raddr.NextHopPort}
+		return raddr.Path, nextHop, 0, nil
+	}
+	pathEntry, err := c.selectPathEntry(raddr)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	path := spath.New(pathEntry.Path.FwdPath)
+	if err := path.InitOffsets(); err != nil {
+		return nil, nil, 0, common.NewBasicError("Unable to initialize path", err)
+	}
+	nextHop := &reliable.AppAddr{Addr: pathEntry.HostInfo.Host(), Port: pathEntry.HostInfo.Port}
+	return path, nextHop, pathEntry.Path.Mtu, nil
+}
+
 func (c *Conn) selectPathEntry(raddr *Addr) (*sciond.PathReplyEntry, error) {
 	var err error
 	var pathSet spathmeta.AppPathSet
@@ -349,15 +370,29 @@ func (c *Conn) selectPathEntry(raddr *Addr) (*sciond.PathReplyEntry, error) {
 			"srcIA", c.laddr.IA, "dstIA", raddr.IA)
 	}
 
-	// FIXME(scrye): A preferred path should be stored for each contacted
-	// destination. Currently the code below only supports one, which means
-	// that alternating sends between two remotes offers no guarantees on
-	// the path ever being the same.
-	path := pathSet.GetAppPath(c.prefPathKey)
-	c.prefPathKey = path.Key()
+	path := c.PathSelector().SelectPath(raddr, pathSet)
+	if path == nil {
+		return nil, common.NewBasicError("No path selected", nil,
+			"srcIA", c.laddr.IA, "dstIA", raddr.IA)
+	}
 	return path.Entry, nil
 }
 
+// PathSelector returns the PathSelector used by c.
+func (c *Conn) PathSelector() PathSelector {
+	c.selectorMutex.Lock()
+	defer c.selectorMutex.Unlock()
+	return c.selector
+}
+
+// SetPathSelector changes the PathSelector used by c to choose paths for
+// writes without an explicit path.
+func (c *Conn) SetPathSelector(selector PathSelector) {
+	c.selectorMutex.Lock()
+	defer c.selectorMutex.Unlock()
+	c.selector = selector
+}
+
 func (c *Conn) BindAddr() net.Addr {
 	return c.baddr
 }
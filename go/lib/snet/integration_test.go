@@ -141,8 +141,12 @@ func ClientServer(idx int, tc TestCase) {
 func TestListen(t *testing.T) {
 	aStr := fmt.Sprintf("%v,[127.0.0.1]:80", localIA)
 	zStr := fmt.Sprintf("%v,[0.0.0.0]:80", localIA)
+	a6Str := fmt.Sprintf("%v,[::1]:80", localIA)
+	z6Str := fmt.Sprintf("%v,[::]:80", localIA)
 	a, _ := AddrFromString(aStr)
 	z, _ := AddrFromString(zStr)
+	a6, _ := AddrFromString(a6Str)
+	z6, _ := AddrFromString(z6Str)
 	tests := []struct {
 		desc    string
 		isError bool
@@ -153,6 +157,12 @@ func TestListen(t *testing.T) {
 		{"bind to nil laddr", true, "udp4", nil},
 		{"bind to 0.0.0.0 laddr", true, "udp4", z},
 		{fmt.Sprintf("bind to %v", a), false, "udp4", a},
+		{"bind to :: laddr", true, "udp6", z6},
+		{fmt.Sprintf("bind to %v", a6), false, "udp6", a6},
+		{fmt.Sprintf("bind to %v on udp4", a6), true, "udp4", a6},
+		{fmt.Sprintf("bind to %v on udp6", a), true, "udp6", a},
+		{fmt.Sprintf("bind to %v on udp", a), false, "udp", a},
+		{fmt.Sprintf("bind to %v on udp", a6), false, "udp", a6},
 	}
 	Convey("Method Listen", t, func() {
 		for _, test := range tests {
@@ -166,6 +176,7 @@ func TestListen(t *testing.T) {
 					raddr := conn.RemoteSnetAddr()
 					SoMsg("Local address", laddr.EqAddr(test.laddr), ShouldBeTrue)
 					SoMsg("Remote address", raddr, ShouldBeNil)
+					conn.Close()
 				}
 			})
 		}
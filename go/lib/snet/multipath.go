@@ -0,0 +1,318 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+)
+
+// MultipathStrategy describes how a MultipathWriter spreads packets across
+// the available paths.
+type MultipathStrategy int
+
+const (
+	// RoundRobin sends each packet on the next path, cycling through all the
+	// available paths.
+	RoundRobin MultipathStrategy = iota
+	// Weighted sends each packet on one path, such that each path carries a
+	// share of the packets proportional to its weight.
+	Weighted
+	// Redundant sends each packet on multiple paths.
+	Redundant
+)
+
+func (s MultipathStrategy) String() string {
+	switch s {
+	case RoundRobin:
+		return "RoundRobin"
+	case Weighted:
+		return "Weighted"
+	case Redundant:
+		return "Redundant"
+	}
+	return fmt.Sprintf("UNKNOWN (%d)", int(s))
+}
+
+const (
+	// DefaultRedundancy is the number of paths used by the Redundant strategy
+	// if none is configured.
+	DefaultRedundancy = 2
+)
+
+// MultipathConfig configures a MultipathWriter.
+type MultipathConfig struct {
+	Strategy MultipathStrategy
+	// Number of paths each packet is sent on, for the Redundant strategy. If
+	// fewer paths are available, all of them are used.
+	Redundancy int
+	// Weight returns the weight of a path, for the Weighted strategy. Paths
+	// with weights of 0 or less are not used. If nil, all paths have weight 1.
+	Weight func(path *spathmeta.AppPath) int
+}
+
+// PathStats contains the counters of a path used by a MultipathWriter.
+type PathStats struct {
+	// Number of packets sent successfully
+	Packets uint64
+	// Number of payload bytes sent successfully
+	Bytes uint64
+	// Number of failed sends
+	Errors uint64
+	// Error of the last failed send
+	LastErr error
+}
+
+// MultipathWriter sends packets to a fixed remote address over multiple
+// paths, according to a MultipathStrategy. The set of paths is kept up to
+// date by the path resolver of the Conn's network.
+type MultipathWriter struct {
+	conn  *Conn
+	raddr *Addr
+	sp    *pathmgr.SyncPaths
+	mutex sync.Mutex
+	sched *scheduler
+	stats map[spathmeta.PathKey]*PathStats
+}
+
+// NewMultipathWriter creates a MultipathWriter that uses conn to send packets
+// to raddr. The source and destination ISD-ASes are registered with the path
+// resolver for continuous path updates until Close is called. If config is
+// nil, the RoundRobin strategy is used.
+func NewMultipathWriter(conn *Conn, raddr *Addr,
+	config *MultipathConfig) (*MultipathWriter, error) {
+
+	if raddr == nil {
+		return nil, common.NewBasicError("Unable to write to nil remote", nil)
+	}
+	if config == nil {
+		config = &MultipathConfig{}
+	}
+	switch config.Strategy {
+	case RoundRobin, Weighted, Redundant:
+	default:
+		return nil, common.NewBasicError("Unknown multipath strategy", nil,
+			"strategy", config.Strategy)
+	}
+	w := &MultipathWriter{
+		conn:  conn,
+		raddr: raddr.Copy(),
+		sched: newScheduler(config),
+		stats: make(map[spathmeta.PathKey]*PathStats),
+	}
+	if !conn.laddr.IA.Eq(raddr.IA) {
+		var err error
+		w.sp, err = conn.scionNet.pathResolver.Watch(conn.laddr.IA, raddr.IA)
+		if err != nil {
+			return nil, common.NewBasicError("Unable to register src-dst IAs", err,
+				"src", conn.laddr.IA, "dst", raddr.IA)
+		}
+	}
+	return w, nil
+}
+
+// Write sends b to the remote address on the paths chosen by the strategy.
+// For the Redundant strategy, the write succeeds if b was sent on at least
+// one path; the error of each path is recorded in its PathStats.
+func (w *MultipathWriter) Write(b []byte) (int, error) {
+	if w.sp == nil {
+		// Destination is in the local AS, no path needed
+		return w.conn.WriteToSCION(b, w.raddr)
+	}
+	aps := w.sp.Load().APS
+	if len(aps) == 0 {
+		return 0, common.NewBasicError("Path not found", nil,
+			"srcIA", w.conn.laddr.IA, "dstIA", w.raddr.IA)
+	}
+	w.mutex.Lock()
+	paths := w.sched.pick(sortedPaths(aps))
+	w.mutex.Unlock()
+	if len(paths) == 0 {
+		return 0, common.NewBasicError("No path selected", nil,
+			"srcIA", w.conn.laddr.IA, "dstIA", w.raddr.IA)
+	}
+	var n int
+	var err error
+	sent := false
+	for _, path := range paths {
+		n, err = w.writePath(b, path)
+		w.record(path.Key(), n, err)
+		if err == nil {
+			sent = true
+		}
+	}
+	if sent {
+		return len(b), nil
+	}
+	return 0, err
+}
+
+func (w *MultipathWriter) writePath(b []byte, path *spathmeta.AppPath) (int, error) {
+	raddr := w.raddr.Copy()
+	raddr.Path = spath.New(path.Entry.Path.FwdPath)
+	if err := raddr.Path.InitOffsets(); err != nil {
+		return 0, common.NewBasicError("Unable to initialize path", err)
+	}
+	raddr.NextHopHost = path.Entry.HostInfo.Host()
+	raddr.NextHopPort = path.Entry.HostInfo.Port
+	return w.conn.WriteToSCION(b, raddr)
+}
+
+func (w *MultipathWriter) record(key spathmeta.PathKey, n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	stats, ok := w.stats[key]
+	if !ok {
+		stats = &PathStats{}
+		w.stats[key] = stats
+	}
+	if err != nil {
+		stats.Errors++
+		stats.LastErr = err
+		return
+	}
+	stats.Packets++
+	stats.Bytes += uint64(n)
+}
+
+// Stats returns a snapshot of the counters of every path the writer has used.
+func (w *MultipathWriter) Stats() map[spathmeta.PathKey]PathStats {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	stats := make(map[spathmeta.PathKey]PathStats, len(w.stats))
+	for k, v := range w.stats {
+		stats[k] = *v
+	}
+	return stats
+}
+
+// Paths returns the paths that are currently available to the writer.
+func (w *MultipathWriter) Paths() spathmeta.AppPathSet {
+	if w.sp == nil {
+		return spathmeta.AppPathSet{}
+	}
+	return w.sp.Load().APS
+}
+
+// Close unregisters the source and destination ISD-ASes from the path
+// resolver. It does not close the underlying Conn.
+func (w *MultipathWriter) Close() error {
+	if w.sp == nil {
+		return nil
+	}
+	return w.conn.scionNet.pathResolver.Unwatch(w.conn.laddr.IA, w.raddr.IA)
+}
+
+// sortedPaths returns the paths in aps ordered by key, such that strategies
+// see paths in a stable order.
+func sortedPaths(aps spathmeta.AppPathSet) []*spathmeta.AppPath {
+	paths := make([]*spathmeta.AppPath, 0, len(aps))
+	for _, ap := range aps {
+		paths = append(paths, ap)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Key() < paths[j].Key()
+	})
+	return paths
+}
+
+// scheduler implements the multipath strategies. It is not safe for
+// concurrent use.
+type scheduler struct {
+	config MultipathConfig
+	// Key of the path used last, for RoundRobin and Redundant
+	last spathmeta.PathKey
+	// Current weights, for Weighted (smooth weighted round-robin)
+	current map[spathmeta.PathKey]int
+}
+
+func newScheduler(config *MultipathConfig) *scheduler {
+	s := &scheduler{
+		config:  *config,
+		current: make(map[spathmeta.PathKey]int),
+	}
+	if s.config.Redundancy <= 0 {
+		s.config.Redundancy = DefaultRedundancy
+	}
+	if s.config.Weight == nil {
+		s.config.Weight = func(*spathmeta.AppPath) int { return 1 }
+	}
+	return s
+}
+
+// pick returns the paths the next packet should be sent on. Argument paths
+// must be sorted by key.
+func (s *scheduler) pick(paths []*spathmeta.AppPath) []*spathmeta.AppPath {
+	if len(paths) == 0 {
+		return nil
+	}
+	switch s.config.Strategy {
+	case Weighted:
+		return s.pickWeighted(paths)
+	case Redundant:
+		n := s.config.Redundancy
+		if n > len(paths) {
+			n = len(paths)
+		}
+		return s.pickNext(paths, n)
+	default:
+		return s.pickNext(paths, 1)
+	}
+}
+
+// pickNext returns the n paths following the last used one. Paths that were
+// added or removed in the meantime do not reset the rotation.
+func (s *scheduler) pickNext(paths []*spathmeta.AppPath, n int) []*spathmeta.AppPath {
+	start := sort.Search(len(paths), func(i int) bool {
+		return paths[i].Key() > s.last
+	})
+	result := make([]*spathmeta.AppPath, 0, n)
+	for i := 0; i < n; i++ {
+		result = append(result, paths[(start+i)%len(paths)])
+	}
+	s.last = result[len(result)-1].Key()
+	return result
+}
+
+func (s *scheduler) pickWeighted(paths []*spathmeta.AppPath) []*spathmeta.AppPath {
+	var best *spathmeta.AppPath
+	total := 0
+	current := make(map[spathmeta.PathKey]int, len(paths))
+	for _, path := range paths {
+		weight := s.config.Weight(path)
+		if weight <= 0 {
+			continue
+		}
+		key := path.Key()
+		current[key] = s.current[key] + weight
+		total += weight
+		if best == nil || current[key] > current[best.Key()] {
+			best = path
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	current[best.Key()] -= total
+	// Forget the state of paths that are no longer available
+	s.current = current
+	return []*spathmeta.AppPath{best}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+)
+
+func TestScheduler(t *testing.T) {
+	aps := make(spathmeta.AppPathSet)
+	for i := 1; i <= 3; i++ {
+		aps.Add(newTestPath(common.IFIDType(i)))
+	}
+	paths := sortedPaths(aps)
+
+	Convey("RoundRobin cycles through all paths", t, func() {
+		s := newScheduler(&MultipathConfig{Strategy: RoundRobin})
+		for i := 0; i < 9; i++ {
+			picked := s.pick(paths)
+			So(len(picked), ShouldEqual, 1)
+			SoMsg("path", picked[0], ShouldEqual, paths[i%3])
+		}
+		Convey("and continues after a path is removed", func() {
+			// The last path used was paths[2], so the rotation wraps.
+			picked := s.pick(paths[1:])
+			SoMsg("path", picked[0], ShouldEqual, paths[1])
+		})
+	})
+
+	Convey("Redundant sends on multiple paths", t, func() {
+		s := newScheduler(&MultipathConfig{Strategy: Redundant})
+		picked := s.pick(paths)
+		SoMsg("default redundancy", picked, ShouldResemble, paths[:2])
+		picked = s.pick(paths)
+		SoMsg("rotation", picked, ShouldResemble, []*spathmeta.AppPath{paths[2], paths[0]})
+		Convey("but never on more paths than available", func() {
+			s := newScheduler(&MultipathConfig{Strategy: Redundant, Redundancy: 5})
+			SoMsg("all paths", len(s.pick(paths)), ShouldEqual, 3)
+		})
+	})
+
+	Convey("Weighted distributes packets proportionally to weights", t, func() {
+		weights := map[spathmeta.PathKey]int{
+			paths[0].Key(): 3,
+			paths[1].Key(): 1,
+			paths[2].Key(): 0,
+		}
+		s := newScheduler(&MultipathConfig{
+			Strategy: Weighted,
+			Weight: func(path *spathmeta.AppPath) int {
+				return weights[path.Key()]
+			},
+		})
+		counts := make(map[spathmeta.PathKey]int)
+		for i := 0; i < 40; i++ {
+			picked := s.pick(paths)
+			So(len(picked), ShouldEqual, 1)
+			counts[picked[0].Key()]++
+		}
+		SoMsg("weight 3", counts[paths[0].Key()], ShouldEqual, 30)
+		SoMsg("weight 1", counts[paths[1].Key()], ShouldEqual, 10)
+		SoMsg("weight 0", counts[paths[2].Key()], ShouldEqual, 0)
+		Convey("and selects nothing if all weights are zero", func() {
+			s := newScheduler(&MultipathConfig{
+				Strategy: Weighted,
+				Weight:   func(*spathmeta.AppPath) int { return 0 },
+			})
+			SoMsg("picked", s.pick(paths), ShouldBeEmpty)
+		})
+	})
+
+	Convey("No paths are picked from an empty set", t, func() {
+		for _, strategy := range []MultipathStrategy{RoundRobin, Weighted, Redundant} {
+			s := newScheduler(&MultipathConfig{Strategy: strategy})
+			SoMsg(strategy.String(), s.pick(nil), ShouldBeEmpty)
+		}
+	})
+}
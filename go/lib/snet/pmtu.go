@@ -0,0 +1,348 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/hpkt"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spkt"
+)
+
+const (
+	// DefaultProbeMax is the largest packet size probed, unless the path
+	// advertises a larger MTU. It is the largest SCION packet that fits in an
+	// Ethernet frame with an IPv4/UDP overlay.
+	DefaultProbeMax = 1472
+	// DefaultProbeTimeout is the time to wait for the reply to a probe.
+	DefaultProbeTimeout = time.Second
+	// DefaultProbeRetries is the number of times a lost probe is resent
+	// before its size is considered too large.
+	DefaultProbeRetries = 2
+	// DefaultProbeGranularity is the precision of the probed MTU, in bytes.
+	DefaultProbeGranularity = 8
+)
+
+// MTUError is returned by writes that result in a SCION packet larger than
+// the MTU of the path to the destination. Nothing is sent.
+type MTUError struct {
+	// MTU of the path, either advertised by SCIOND, reported via SCMP or
+	// found by probing
+	MTU uint16
+	// Size of the SCION packet that was not sent
+	Size int
+	// MaxPayload is the largest payload that fits in the MTU, with the same
+	// headers.
+	MaxPayload int
+}
+
+func (e *MTUError) Error() string {
+	return fmt.Sprintf("packet size %d exceeds path MTU %d (max payload %d)",
+		e.Size, e.MTU, e.MaxPayload)
+}
+
+// ProbeConfig configures MTU probing. Zero values are replaced by defaults.
+type ProbeConfig struct {
+	// Min is the smallest packet size probed. It defaults to common.MinMTU.
+	Min uint16
+	// Max is the largest packet size probed. It defaults to DefaultProbeMax,
+	// or to the MTU advertised for the path if that is larger. The advertised
+	// MTU might be wrong, so it does not limit the result otherwise.
+	Max uint16
+	// Timeout is the time to wait for each reply.
+	Timeout time.Duration
+	// Retries is the number of times a lost probe is resent.
+	Retries int
+	// Granularity is the precision of the result, in bytes.
+	Granularity uint16
+}
+
+func (cfg *ProbeConfig) initDefaults(advertised uint16) {
+	if cfg.Min == 0 {
+		cfg.Min = common.MinMTU
+	}
+	if cfg.Max == 0 {
+		cfg.Max = DefaultProbeMax
+		if advertised > cfg.Max {
+			cfg.Max = advertised
+		}
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultProbeTimeout
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = DefaultProbeRetries
+	}
+	if cfg.Granularity == 0 {
+		cfg.Granularity = DefaultProbeGranularity
+	}
+}
+
+// ProbeMTU finds the MTU of the path used to send to raddr, by sending SCMP
+// echo requests of increasing size and narrowing down the largest size that
+// is answered. Routers that report an oversize packet further bound the
+// search. The result is stored in the MTU cache of c, and replaces the MTU
+// advertised for the path, whether it is larger or smaller. Subsequent writes
+// to raddr larger than the MTU fail with an MTUError. If cfg is nil, defaults
+// are used.
+//
+// The probes are sent from a separate port on the local host, so ProbeMTU can
+// run concurrently with reads on c.
+func (c *Conn) ProbeMTU(raddr *Addr, cfg *ProbeConfig) (uint16, error) {
+	if c.scionNet == nil {
+		return 0, common.NewBasicError("SCION network not initialized", nil)
+	}
+	path, nextHop, advertised, err := c.resolvePath(raddr)
+	if err != nil {
+		return 0, err
+	}
+	var config ProbeConfig
+	if cfg != nil {
+		config = *cfg
+	}
+	config.initDefaults(advertised)
+	if config.Min > config.Max {
+		return 0, common.NewBasicError("Invalid probe size range", nil,
+			"min", config.Min, "max", config.Max)
+	}
+	conn, err := c.scionNet.ListenSCION(c.net, &Addr{IA: c.laddr.IA, Host: c.laddr.Host})
+	if err != nil {
+		return 0, common.NewBasicError("Unable to open probe connection", err)
+	}
+	defer conn.Close()
+	p := newProber(conn, raddr, path, nextHop, &config)
+	mtu, err := p.run()
+	if err != nil {
+		return 0, err
+	}
+	log.Debug("Probed path MTU", "raddr", raddr, "mtu", mtu)
+	c.scmpState.storeMTU(pathKey(path), mtu)
+	return mtu, nil
+}
+
+// Ping sends an SCMP echo request to raddr and returns the round-trip time of
+// the reply. If raddr contains a path and a next hop, the request is sent on
+// that path. An error is returned if no reply is received within timeout.
+func (c *Conn) Ping(raddr *Addr, timeout time.Duration) (time.Duration, error) {
+	if c.scionNet == nil {
+		return 0, common.NewBasicError("SCION network not initialized", nil)
+	}
+	path, nextHop, _, err := c.resolvePath(raddr)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := c.scionNet.ListenSCION(c.net, &Addr{IA: c.laddr.IA, Host: c.laddr.Host})
+	if err != nil {
+		return 0, common.NewBasicError("Unable to open probe connection", err)
+	}
+	defer conn.Close()
+	p := newProber(conn, raddr, path, nextHop, &ProbeConfig{Timeout: timeout})
+	start := time.Now()
+	ok, _, err := p.probe(p.minSize())
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, common.NewBasicError("No reply to SCMP echo request", nil,
+			"raddr", raddr, "timeout", timeout)
+	}
+	return time.Since(start), nil
+}
+
+// prober sends SCMP echo requests of a given size and waits for the replies.
+type prober struct {
+	conn    *Conn
+	raddr   *Addr
+	path    *spath.Path
+	nextHop *reliable.AppAddr
+	cfg     *ProbeConfig
+	id      uint64
+	seq     uint16
+	buf     common.RawBytes
+}
+
+func newProber(conn *Conn, raddr *Addr, path *spath.Path, nextHop *reliable.AppAddr,
+	cfg *ProbeConfig) *prober {
+
+	p := &prober{
+		conn:    conn,
+		raddr:   raddr,
+		path:    path,
+		nextHop: nextHop,
+		cfg:     cfg,
+		id:      rand.Uint64(),
+		buf:     make(common.RawBytes, BufSize),
+	}
+	if mc, ok := conn.conn.(*muxConn); ok {
+		// Without a dispatcher, echo replies are demultiplexed by ID.
+		mc.registerEcho(p.id)
+	}
+	return p
+}
+
+// run returns the largest packet size between the configured minimum and
+// maximum that reaches the destination.
+func (p *prober) run() (uint16, error) {
+	ok, _, err := p.probe(p.cfg.Min)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, common.NewBasicError("No reply to minimum size probe", nil,
+			"raddr", p.raddr, "size", p.cfg.Min)
+	}
+	// good is known to get through, bad is known not to.
+	good, bad := int(p.cfg.Min), int(p.cfg.Max)+1
+	for bad-good > int(p.cfg.Granularity) {
+		size := good + (bad-good)/2
+		ok, reported, err := p.probe(uint16(size))
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case ok:
+			good = size
+		case int(reported) > good && int(reported) < size:
+			// A router on the path reported its MTU, check it directly.
+			ok, _, err := p.probe(reported)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return reported, nil
+			}
+			bad = int(reported)
+		default:
+			bad = size
+		}
+	}
+	return uint16(good), nil
+}
+
+// probe sends an echo request of the given size and waits for the reply,
+// retrying on timeouts. It reports whether a reply was received, and the MTU
+// reported by a router if the probe was too large.
+func (p *prober) probe(size uint16) (bool, uint16, error) {
+	for i := 0; i <= p.cfg.Retries; i++ {
+		p.seq++
+		if err := p.send(size); err != nil {
+			return false, 0, err
+		}
+		ok, reported, err := p.wait()
+		if err != nil {
+			return false, 0, err
+		}
+		if ok || reported != 0 {
+			return ok, reported, nil
+		}
+	}
+	return false, 0, nil
+}
+
+// minSize returns the size of an echo request without padding.
+func (p *prober) minSize() uint16 {
+	info := &scmp.InfoEcho{}
+	return uint16(p.newPkt().HdrLen() + scmp.HdrLen + scmp.MetaLen + info.Len())
+}
+
+// newPkt returns an echo request packet without L4 header and payload.
+func (p *prober) newPkt() *spkt.ScnPkt {
+	return &spkt.ScnPkt{
+		DstIA:   p.raddr.IA,
+		SrcIA:   p.conn.laddr.IA,
+		DstHost: p.raddr.Host,
+		SrcHost: p.conn.laddr.Host,
+		Path:    p.path,
+	}
+}
+
+func (p *prober) send(size uint16) error {
+	info := &scmp.InfoEcho{Id: p.id, Seq: p.seq}
+	pkt := p.newPkt()
+	// Pad the payload after the echo info, so that the packet has the
+	// requested size.
+	pldLen := int(size) - pkt.HdrLen() - scmp.HdrLen
+	if pldLen < scmp.MetaLen+info.Len() {
+		return common.NewBasicError("Probe size too small", nil, "size", size)
+	}
+	pld := make(common.RawBytes, pldLen)
+	meta := scmp.Meta{InfoLen: uint8(info.Len() / common.LineLen)}
+	meta.Write(pld)
+	info.Write(pld[scmp.MetaLen:])
+	pkt.L4 = scmp.NewHdr(scmp.ClassType{Class: scmp.C_General, Type: scmp.T_G_EchoRequest},
+		len(pld))
+	pkt.Pld = pld
+	n, err := hpkt.WriteScnPkt(pkt, p.buf)
+	if err != nil {
+		return common.NewBasicError("Unable to serialize SCION packet", err)
+	}
+	if _, err := p.conn.conn.WriteTo(p.buf[:n], p.nextHop); err != nil {
+		return common.NewBasicError("Underlay write error", err)
+	}
+	return nil
+}
+
+// wait reads packets until the reply to the last probe is received, a router
+// reports the probe as oversized, or the timeout expires.
+func (p *prober) wait() (bool, uint16, error) {
+	if err := p.conn.conn.SetReadDeadline(time.Now().Add(p.cfg.Timeout)); err != nil {
+		return false, 0, err
+	}
+	for {
+		n, _, err := p.conn.conn.ReadFrom(p.buf)
+		if err != nil {
+			if common.IsTimeoutErr(err) {
+				return false, 0, nil
+			}
+			return false, 0, common.NewBasicError("Underlay read error", err)
+		}
+		pkt := &spkt.ScnPkt{
+			DstIA: addr.IA{},
+			SrcIA: addr.IA{},
+			Path:  &spath.Path{},
+		}
+		if err := hpkt.ParseScnPkt(pkt, p.buf[:n]); err != nil {
+			log.Debug("Unable to parse packet received while probing", "err", err)
+			continue
+		}
+		hdr, ok := pkt.L4.(*scmp.Hdr)
+		if !ok {
+			continue
+		}
+		pld, ok := pkt.Pld.(*scmp.Payload)
+		if !ok {
+			continue
+		}
+		switch {
+		case hdr.Class == scmp.C_General && hdr.Type == scmp.T_G_EchoReply:
+			info, ok := pld.Info.(*scmp.InfoEcho)
+			if ok && info.Id == p.id && info.Seq == p.seq {
+				return true, 0, nil
+			}
+		case hdr.Class == scmp.C_Routing && hdr.Type == scmp.T_R_OversizePkt:
+			if info, ok := pld.Info.(*scmp.InfoPktSize); ok {
+				return false, info.MTU, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/xtest"
+)
+
+func TestPathMTU(t *testing.T) {
+	Convey("Given two dispatcher-less networks on loopback", t, func() {
+		netA, netB := newLoopbackNetworks(t)
+		defer netA.Close()
+		defer netB.Close()
+		ia := netA.IA()
+		connA, err := netA.ListenSCION("udp4",
+			&Addr{IA: ia, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 1))})
+		So(err, ShouldBeNil)
+		connB, err := netB.ListenSCION("udp4",
+			&Addr{IA: ia, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 2))})
+		So(err, ShouldBeNil)
+		raddr := connB.LocalSnetAddr()
+
+		Convey("Writes larger than the known MTU fail with an MTUError", func() {
+			connA.scmpState.storeMTU(pathKey(nil), 200)
+			_, err := connA.WriteToSCION(make([]byte, 300), raddr)
+			So(err, ShouldNotBeNil)
+			merr, ok := err.(*MTUError)
+			So(ok, ShouldBeTrue)
+			SoMsg("mtu", merr.MTU, ShouldEqual, 200)
+			SoMsg("size", merr.Size, ShouldBeGreaterThan, 300)
+			_, err = connA.WriteToSCION(make([]byte, merr.MaxPayload), raddr)
+			SoMsg("max payload fits", err, ShouldBeNil)
+			_, err = connA.WriteToSCION(make([]byte, merr.MaxPayload+1), raddr)
+			SoMsg("larger payload", err, ShouldHaveSameTypeAs, &MTUError{})
+		})
+		Convey("ProbeMTU finds the largest size that is answered", func() {
+			mtu, err := connA.ProbeMTU(raddr, &ProbeConfig{Max: 1500, Granularity: 1})
+			So(err, ShouldBeNil)
+			SoMsg("mtu", mtu, ShouldEqual, 1500)
+			known, ok := connA.PathMTU(nil)
+			SoMsg("cached", ok, ShouldBeTrue)
+			SoMsg("cached mtu", known, ShouldEqual, 1500)
+			_, err = connA.WriteToSCION(make([]byte, 1500), raddr)
+			SoMsg("write", err, ShouldHaveSameTypeAs, &MTUError{})
+		})
+		Convey("Ping returns the round-trip time of an echo request", func() {
+			rtt, err := connA.Ping(raddr, time.Second)
+			So(err, ShouldBeNil)
+			SoMsg("rtt", rtt, ShouldBeGreaterThan, 0)
+		})
+		Convey("ProbeMTU fails if the destination does not answer", func() {
+			other := &Addr{IA: ia, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 3)), L4Port: 40000}
+			_, err := connA.ProbeMTU(other, &ProbeConfig{Timeout: 50 * time.Millisecond,
+				Retries: 1})
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestProbeAdvertisedMTU(t *testing.T) {
+	Convey("Given a path whose advertised MTU is lower than the real one", t, func() {
+		srcIA := xtest.MustParseIA("1-ff00:0:111")
+		dstIA := xtest.MustParseIA("1-ff00:0:112")
+		dstNet := NewNetworkBasic(dstIA, "", "")
+		xtest.FailOnErr(t, dstNet.BindUnderlay(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)}))
+		defer dstNet.Close()
+		entry := newTestPath(1)
+		entry.Path.FwdPath = newOneHopPath()
+		entry.Path.Mtu = common.MinMTU
+		entry.Path.ExpTime = uint32(time.Now().Add(time.Hour).Unix())
+		entry.HostInfo = *sciond.HostInfoFromHostAddr(
+			addr.HostFromIP(net.IPv4(127, 0, 0, 2)), uint16(dstNet.UnderlayAddr().Port))
+		pr, err := pathmgr.New(&pathSciond{entries: []*sciond.PathReplyEntry{entry}},
+			&pathmgr.Timers{NormalRefire: time.Minute, ErrorRefire: time.Second,
+				MaxAge: time.Minute}, log.Root())
+		xtest.FailOnErr(t, err)
+		srcNet := NewNetworkBasic(srcIA, "", "")
+		xtest.FailOnErr(t, srcNet.BindUnderlay(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}))
+		defer srcNet.Close()
+		srcNet.SetPathResolver(pr)
+		conn, err := srcNet.ListenSCION("udp4",
+			&Addr{IA: srcIA, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 1))})
+		So(err, ShouldBeNil)
+		raddr := &Addr{IA: dstIA, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 2)),
+			L4Port: 40000}
+		b := make([]byte, common.MinMTU)
+		_, err = conn.WriteToSCION(b, raddr)
+		SoMsg("advertised", err, ShouldHaveSameTypeAs, &MTUError{})
+
+		Convey("ProbeMTU raises the MTU above the advertised one", func() {
+			mtu, err := conn.ProbeMTU(raddr, &ProbeConfig{Granularity: 1})
+			So(err, ShouldBeNil)
+			SoMsg("mtu", mtu, ShouldEqual, DefaultProbeMax)
+			_, err = conn.WriteToSCION(b, raddr)
+			SoMsg("write", err, ShouldBeNil)
+		})
+	})
+}
+
+// newOneHopPath returns a forwarding path with a single hop field, which can
+// be reversed by the destination to answer echo requests.
+func newOneHopPath() common.RawBytes {
+	raw := make(common.RawBytes, spath.InfoFieldLength+spath.HopFieldLength)
+	info := &spath.InfoField{ConsDir: true, ISD: 1, Hops: 1,
+		TsInt: uint32(time.Now().Unix())}
+	info.Write(raw)
+	spath.NewHopField(raw[spath.InfoFieldLength:], 0, 0)
+	return raw
+}
+
+// pathSciond is a mock SCIOND that always returns the same paths.
+type pathSciond struct {
+	entries []*sciond.PathReplyEntry
+}
+
+func (s *pathSciond) Connect() (sciond.Connector, error) {
+	return &pathSciondConn{s: s}, nil
+}
+
+func (s *pathSciond) ConnectTimeout(timeout time.Duration) (sciond.Connector, error) {
+	return s.Connect()
+}
+
+type pathSciondConn struct {
+	sciond.Connector
+	s *pathSciond
+}
+
+func (c *pathSciondConn) Paths(dst, src addr.IA, max uint16,
+	f sciond.PathReqFlags) (*sciond.PathReply, error) {
+
+	reply := &sciond.PathReply{ErrorCode: sciond.ErrorOk}
+	for _, entry := range c.s.entries {
+		reply.Entries = append(reply.Entries, *entry)
+	}
+	return reply, nil
+}
+
+func (c *pathSciondConn) Close() error {
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpt
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+const (
+	// Maximum number of fragments of a message
+	maxFragments = 1 << 10
+	// Maximum number of messages reassembled concurrently
+	maxReassemblies = 1 << 8
+	// Time after which incomplete messages are dropped
+	reassemblyTimeout = 30 * time.Second
+	// Time during which the IDs of received messages are remembered, to
+	// suppress duplicates
+	dedupeTimeout = time.Minute
+	// Minimum time between two scans for expired entries
+	pruneInterval = time.Second
+)
+
+// rptHdr is the decoded RPT header.
+type rptHdr struct {
+	version uint8
+	flags   rptFlag
+	id      uint56
+	// Fragment fields, only present in version 1 headers
+	fragIndex uint16
+	fragCount uint16
+}
+
+func (h *rptHdr) Len() int {
+	if h.version == rptVersion1 {
+		return rptHdrLenV1
+	}
+	return rptHdrLen
+}
+
+// Write writes the header to b, which must be at least h.Len() bytes long.
+func (h *rptHdr) Write(b common.RawBytes) {
+	b[0] = h.version<<4 | byte(h.flags)
+	h.id.putUint56(b[1:])
+	if h.version == rptVersion1 {
+		common.Order.PutUint16(b[8:], h.fragIndex)
+		common.Order.PutUint16(b[10:], h.fragCount)
+	}
+}
+
+func (h *rptHdr) String() string {
+	return fmt.Sprintf("v%d flags=%#x id=%d frag=%d/%d", h.version, h.flags, h.id,
+		h.fragIndex, h.fragCount)
+}
+
+// fragment splits b into packets with payloads of at most fragSize bytes. If
+// b fits in a single packet, a version 0 packet is returned, which is
+// understood by all RPT versions.
+func fragment(id uint56, flags rptFlag, b common.RawBytes, fragSize int) ([]common.RawBytes,
+	error) {
+
+	if len(b) <= fragSize {
+		hdr := &rptHdr{version: rptVersion0, flags: flags, id: id}
+		return []common.RawBytes{newPacket(hdr, b)}, nil
+	}
+	count := (len(b) + fragSize - 1) / fragSize
+	if count > maxFragments {
+		return nil, common.NewBasicError("Unable to send, payload too long", nil,
+			"pld_len", len(b), "max_allowed", maxFragments*fragSize)
+	}
+	pkts := make([]common.RawBytes, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * fragSize
+		if end > len(b) {
+			end = len(b)
+		}
+		hdr := &rptHdr{version: rptVersion1, flags: flags, id: id,
+			fragIndex: uint16(i), fragCount: uint16(count)}
+		pkts = append(pkts, newPacket(hdr, b[i*fragSize:end]))
+	}
+	return pkts, nil
+}
+
+func newPacket(hdr *rptHdr, pld common.RawBytes) common.RawBytes {
+	b := make(common.RawBytes, hdr.Len()+len(pld))
+	hdr.Write(b)
+	copy(b[hdr.Len():], pld)
+	return b
+}
+
+// msgKey identifies a message by its sender and packet ID.
+func msgKey(a net.Addr, id uint56) string {
+	return fmt.Sprintf("%s %d", a, id)
+}
+
+// reassembly collects the fragments of a message.
+type reassembly struct {
+	frags    []common.RawBytes
+	received int
+	expiry   time.Time
+}
+
+// reassemblyTable keeps the messages that are being reassembled. It is only
+// used by the background receiver, so it is not safe for concurrent use.
+type reassemblyTable struct {
+	entries   map[string]*reassembly
+	lastPrune time.Time
+}
+
+func newReassemblyTable() *reassemblyTable {
+	return &reassemblyTable{entries: make(map[string]*reassembly)}
+}
+
+// Add stores the fragment of the message identified by key described by
+// hdr. If the message is complete, it is returned; the entry must then be
+// removed by calling Delete once the message has been delivered.
+func (t *reassemblyTable) Add(key string, hdr *rptHdr, pld common.RawBytes) (common.RawBytes,
+	error) {
+
+	if hdr.fragCount == 0 || hdr.fragCount > maxFragments || hdr.fragIndex >= hdr.fragCount {
+		return nil, common.NewBasicError("Invalid fragment", nil, "hdr", hdr)
+	}
+	now := time.Now()
+	t.prune(now)
+	r, ok := t.entries[key]
+	if !ok {
+		if len(t.entries) >= maxReassemblies {
+			return nil, common.NewBasicError("Too many messages in reassembly", nil,
+				"max", maxReassemblies)
+		}
+		r = &reassembly{
+			frags:  make([]common.RawBytes, hdr.fragCount),
+			expiry: now.Add(reassemblyTimeout),
+		}
+		t.entries[key] = r
+	}
+	if int(hdr.fragCount) != len(r.frags) {
+		return nil, common.NewBasicError("Inconsistent fragment count", nil,
+			"expected", len(r.frags), "actual", hdr.fragCount)
+	}
+	if r.frags[hdr.fragIndex] == nil {
+		r.frags[hdr.fragIndex] = append(common.RawBytes(nil), pld...)
+		r.received++
+	}
+	if r.received < len(r.frags) {
+		return nil, nil
+	}
+	var msg common.RawBytes
+	for _, frag := range r.frags {
+		msg = append(msg, frag...)
+	}
+	return msg, nil
+}
+
+func (t *reassemblyTable) Delete(key string) {
+	delete(t.entries, key)
+}
+
+func (t *reassemblyTable) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < pruneInterval {
+		return
+	}
+	t.lastPrune = now
+	for key, r := range t.entries {
+		if now.After(r.expiry) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// dedupeTable remembers recently delivered messages, so that retransmissions
+// are not delivered twice. It is only used by the background receiver, so it
+// is not safe for concurrent use.
+type dedupeTable struct {
+	entries   map[string]time.Time
+	lastPrune time.Time
+}
+
+func newDedupeTable() *dedupeTable {
+	return &dedupeTable{entries: make(map[string]time.Time)}
+}
+
+// Seen returns true if the message identified by key was delivered recently.
+func (t *dedupeTable) Seen(key string) bool {
+	expiry, ok := t.entries[key]
+	return ok && time.Now().Before(expiry)
+}
+
+// Add records the delivery of the message identified by key.
+func (t *dedupeTable) Add(key string) {
+	now := time.Now()
+	t.prune(now)
+	t.entries[key] = now.Add(dedupeTimeout)
+}
+
+func (t *dedupeTable) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < pruneInterval {
+		return
+	}
+	t.lastPrune = now
+	for key, expiry := range t.entries {
+		if now.After(expiry) {
+			delete(t.entries, key)
+		}
+	}
+}
@@ -49,18 +49,40 @@ const (
 	flagNeedACK = rptFlag(0x01)
 	// Included in ACKs.
 	flagACK = rptFlag(0x02)
+	// Mask for the flags in the first header byte; the upper 4 bits contain
+	// the version.
+	flagsMask = 0x0f
+	// Version of unfragmented messages.
+	rptVersion0 = 0
+	// Version of message fragments.
+	rptVersion1 = 1
 	// Size of RPT header.
 	rptHdrLen = 8
+	// Size of RPT header of fragments.
+	rptHdrLenV1 = 12
 	// Maximum amount of time to try and put an ACK on the network
 	rptACKTimeout = 2 * time.Second
-	// If no ACK is received, senders will resend the message every
-	// rptRetryTimeout seconds for as long as the context is not canceled.
-	rptRetryTimeout = 2 * time.Second
+)
+
+// Default configuration values.
+const (
+	// DefaultFragmentSize is the default maximum payload of a single packet.
+	// It leaves room for the SCION headers within the minimum MTU.
+	DefaultFragmentSize = 1200
+	// DefaultInitialRTO is the retransmission timeout used for destinations
+	// without RTT samples.
+	DefaultInitialRTO = time.Second
+	// DefaultMinRTO is the default lower bound of the retransmission timeout.
+	DefaultMinRTO = 200 * time.Millisecond
+	// DefaultMaxRTO is the default upper bound of the retransmission timeout.
+	DefaultMaxRTO = 60 * time.Second
 )
 
 // Internal constants
 const (
 	maxReadEvents = 1 << 8
+	// Maximum number of fragments of a message waiting for an ACK
+	maxFragsInFlight = 1 << 4
 )
 
 var (
@@ -68,6 +90,35 @@ var (
 	generator = rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
 )
 
+// Config contains the tunables of an RPT connection. Zero values are replaced
+// by the defaults.
+type Config struct {
+	// FragmentSize is the maximum payload of a single packet. Larger messages
+	// are fragmented.
+	FragmentSize int
+	// InitialRTO is the retransmission timeout used before the first RTT
+	// sample to a destination is taken.
+	InitialRTO time.Duration
+	// MinRTO and MaxRTO bound the retransmission timeout.
+	MinRTO time.Duration
+	MaxRTO time.Duration
+}
+
+func (c *Config) initDefaults() {
+	if c.FragmentSize == 0 {
+		c.FragmentSize = DefaultFragmentSize
+	}
+	if c.InitialRTO == 0 {
+		c.InitialRTO = DefaultInitialRTO
+	}
+	if c.MinRTO == 0 {
+		c.MinRTO = DefaultMinRTO
+	}
+	if c.MaxRTO == 0 {
+		c.MaxRTO = DefaultMaxRTO
+	}
+}
+
 var _ infra.Transport = (*RPT)(nil)
 
 // RPT (Reliable Packet Transport) implements a simple packet-oriented protocol
@@ -77,15 +128,38 @@ var _ infra.Transport = (*RPT)(nil)
 //
 // SendUnreliableMsgTo sends a message and returns without waiting for an ACK.
 //
-// SendMsgTo sends a message and waits for a limited amount of time for an
-// ACK; if time allows, also resends the message. Once the parent context is
-// canceled, the function returns immediately with an error.
+// SendMsgTo sends a message and waits for an ACK. If no ACK arrives within
+// the retransmission timeout, the message is resent and the timeout doubled.
+// Once the parent context is canceled, the function returns immediately with
+// an error. The retransmission timeout of each destination is estimated from
+// the round-trip times of previous messages, as described in RFC 6298.
 //
-// Header format:
+// Messages larger than the fragment size are split into fragments, which are
+// acknowledged and retransmitted independently and reassembled by the
+// receiver. If the network reports that a fragment exceeds the path MTU, the
+// message is fragmented again with a smaller size. Receivers remember the
+// IDs of recently delivered messages, and do not deliver retransmissions of
+// them again.
+//
+// Header format of unfragmented messages (version 0):
+//   0B       1        2        3        4        5        6        7
+//   +--------+--------+--------+--------+--------+--------+--------+--------+
+//   |Ver|Flag|                           PacketID                           |
+//   +--------+--------+--------+--------+--------+--------+--------+--------+
+//
+// Header format of fragments (version 1):
 //   0B       1        2        3        4        5        6        7
 //   +--------+--------+--------+--------+--------+--------+--------+--------+
-//   | Flags  |                           PacketID                           |
+//   |Ver|Flag|                           PacketID                           |
 //   +--------+--------+--------+--------+--------+--------+--------+--------+
+//   |    FragIndex    |    FragCount    |
+//   +--------+--------+--------+--------+
+//
+// The version is contained in the upper 4 bits of the first byte. ACKs use
+// the version of the packet they acknowledge, and echo its ID and fragment
+// index. Messages that fit in a single packet are always sent with version 0,
+// so they can be received by implementations that do not support
+// fragmentation.
 //
 // RPT can be safely used by concurrent goroutines.
 //
@@ -94,10 +168,13 @@ var _ infra.Transport = (*RPT)(nil)
 // connection is closed, running functions terminate with ErrClosed.
 type RPT struct {
 	conn net.PacketConn
+	cfg  *Config
 	// Incrementing packet ID generator
 	nextPktID uint56
 	// Track senders waiting for ACKs
 	ackTable ackTable
+	// RTT estimates per destination
+	rtts *rttTable
 	// Channel for received messages, used between the background goroutine and receivers
 	readEvents chan *readEventDesc
 	// Closed when Close() starts to run
@@ -110,14 +187,28 @@ type RPT struct {
 	writeLock *util.ChannelLock
 }
 
-// New creates a new RPT connection by wrapping around a PacketConn.
+// New creates a new RPT connection by wrapping around a PacketConn, using
+// the default configuration.
 //
 // New also spawns a background receiving goroutine that continuously reads
 // from conn and keeps track of ACKs and messages.
 func New(conn net.PacketConn, logger log.Logger) *RPT {
+	return NewWithConfig(conn, logger, nil)
+}
+
+// NewWithConfig is like New, but uses the tunables in cfg. If cfg is nil, the
+// default configuration is used.
+func NewWithConfig(conn net.PacketConn, logger log.Logger, cfg *Config) *RPT {
+	c := &Config{}
+	if cfg != nil {
+		*c = *cfg
+	}
+	c.initDefaults()
 	t := &RPT{
 		conn:       conn,
+		cfg:        c,
 		nextPktID:  uint56(generator.Int63n(maxUint56 + 1)),
+		rtts:       newRTTTable(c),
 		readEvents: make(chan *readEventDesc, maxReadEvents),
 		closedChan: make(chan struct{}),
 		doneChan:   make(chan struct{}),
@@ -130,65 +221,156 @@ func New(conn net.PacketConn, logger log.Logger) *RPT {
 
 // SendUnreliableMsgTo sends a message and returns without waiting for an ACK.
 func (t *RPT) SendUnreliableMsgTo(ctx context.Context, b common.RawBytes, a net.Addr) error {
-	id := t.nextPktID.Inc()
-	buffer, err := t.putHeader(id, flagsNone, b)
-	if err != nil {
-		return err
-	}
-	defer bufpool.Put(buffer)
-	return t.send(ctx, buffer.B, a)
+	return t.sendMsg(ctx, b, a, flagsNone)
 }
 
-// SendMsgTo sends a message and waits for an ACK. If no ACK is received for a
-// set amount of time, the message is retransmitted. This process repeats while
-// ctx is not canceled.
+// SendMsgTo sends a message and waits for an ACK. If no ACK is received
+// within the retransmission timeout, the message is retransmitted. This
+// process repeats while ctx is not canceled.
 func (t *RPT) SendMsgTo(ctx context.Context, b common.RawBytes, a net.Addr) error {
+	return t.sendMsg(ctx, b, a, flagNeedACK)
+}
+
+// sendMsg fragments b if needed and sends the fragments. If the network
+// reports a path MTU that is too small for the fragments, the message is
+// fragmented again to fit the MTU and sent with a new ID.
+func (t *RPT) sendMsg(ctx context.Context, b common.RawBytes, a net.Addr,
+	flags rptFlag) error {
+
+	fragSize := t.cfg.FragmentSize
+	err := t.sendFragments(ctx, b, a, flags, fragSize)
+	if mtuErr, ok := err.(*snet.MTUError); ok {
+		smaller := mtuErr.MaxPayload - rptHdrLenV1
+		if smaller <= 0 || smaller >= fragSize {
+			return err
+		}
+		t.log.Debug("Message exceeds path MTU, fragmenting again", "dst", a,
+			"mtu", mtuErr.MTU, "frag_size", smaller)
+		err = t.sendFragments(ctx, b, a, flags, smaller)
+	}
+	return err
+}
+
+// sendFragments sends b in fragments of at most fragSize bytes. If flags
+// requests ACKs, it waits until all fragments are acknowledged, with up to
+// maxFragsInFlight fragments waiting for an ACK at the same time.
+func (t *RPT) sendFragments(ctx context.Context, b common.RawBytes, a net.Addr,
+	flags rptFlag, fragSize int) error {
+
 	id := t.nextPktID.Inc()
-	buffer, err := t.putHeader(id, flagNeedACK, b)
+	pkts, err := fragment(id, flags, b, fragSize)
 	if err != nil {
 		return err
 	}
-	defer bufpool.Put(buffer)
+	if !flags.isSet(flagNeedACK) {
+		for _, pkt := range pkts {
+			if err := t.send(ctx, pkt, a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(pkts) == 1 {
+		return t.sendReliable(ctx, pkts[0], ackKey{id: id}, a)
+	}
+	ctx, cancelF := context.WithCancel(ctx)
+	defer cancelF()
+	sem := make(chan struct{}, maxFragsInFlight)
+	errs := make(chan error, len(pkts))
+	started := 0
+Loop:
+	for i, pkt := range pkts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break Loop
+		}
+		started++
+		go func(pkt common.RawBytes, key ackKey) {
+			defer log.LogPanicAndExit()
+			err := t.sendReliable(ctx, pkt, key, a)
+			<-sem
+			errs <- err
+			if err != nil {
+				// Stop sending the other fragments
+				cancelF()
+			}
+		}(pkt, ackKey{id: id, frag: uint16(i)})
+	}
+	var firstErr error
+	for i := 0; i < started; i++ {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil && started < len(pkts) {
+		return infra.NewCtxDoneError()
+	}
+	return firstErr
+}
+
+// sendReliable sends pkt until the ACK for key is received, ctx is canceled
+// or the transport is closed. The timeout between retransmissions starts at
+// the estimated RTO for a, and doubles with each retransmission.
+func (t *RPT) sendReliable(ctx context.Context, pkt common.RawBytes, key ackKey,
+	a net.Addr) error {
+
 	// Store the channel in the shared table s.t. the background receiver can
 	// close it when it gets the ACK
 	ackChannel := make(chan struct{})
-	_, loaded := t.ackTable.LoadOrStore(id, ackChannel)
+	_, loaded := t.ackTable.LoadOrStore(key, ackChannel)
 	if loaded {
 		// Packet IDs should be unique, this points to a programming error
-		panic(fmt.Sprintf("Duplicate session ID=%d", id))
+		panic(fmt.Sprintf("Duplicate session ID=%d, fragment=%d", key.id, key.frag))
 	}
+	defer t.ackTable.Delete(key)
 
-	defer t.ackTable.Delete(id)
-	for {
-		if err := t.send(ctx, buffer.B, a); err != nil {
+	estimator := t.rtts.Get(a)
+	rto := estimator.RTO()
+	for retransmit := false; ; retransmit = true {
+		sent := time.Now()
+		if err := t.send(ctx, pkt, a); err != nil {
 			return err
 		}
+		timer := time.NewTimer(rto)
 		select {
 		case <-ackChannel:
-			// Received ack and can return successfully
+			// Received ack and can return successfully. Following Karn's
+			// algorithm, ACKs of retransmitted packets are not used as RTT
+			// samples, because they cannot be matched to a transmission.
+			timer.Stop()
+			if !retransmit {
+				estimator.Update(time.Since(sent))
+			}
 			return nil
 		case <-ctx.Done():
 			// Context was canceled or we are out of time, return with failure
+			timer.Stop()
 			return infra.NewCtxDoneError()
-		case <-time.After(rptRetryTimeout):
-			// Did not get ACK and context is not canceled yet, so do nothing
+		case <-timer.C:
+			// Did not get ACK and context is not canceled yet, so back off
 			// and try to send again
+			rto = estimator.Backoff(rto)
 		case <-t.closedChan:
 			// Someone called Close, return immediately
+			timer.Stop()
 			return common.NewBasicError(infra.StrClosedError, nil)
 		}
 	}
 }
 
-func (t *RPT) sendACK(id uint56, a net.Addr) error {
-	buffer, err := t.putHeader(id, flagACK, nil)
-	if err != nil {
-		return err
+// sendACK acknowledges the packet described by hdr.
+func (t *RPT) sendACK(hdr *rptHdr, a net.Addr) error {
+	ack := &rptHdr{
+		version:   hdr.version,
+		flags:     flagACK,
+		id:        hdr.id,
+		fragIndex: hdr.fragIndex,
+		fragCount: hdr.fragCount,
 	}
-	defer bufpool.Put(buffer)
 	ctx, cancelF := context.WithTimeout(context.Background(), rptACKTimeout)
 	defer cancelF()
-	return t.send(ctx, buffer.B, a)
+	return t.send(ctx, newPacket(ack, nil), a)
 }
 
 // send sends b to a via the net.PacketConn object. send guarantees to return
@@ -224,29 +406,12 @@ func (t *RPT) send(ctx context.Context, b common.RawBytes, a net.Addr) error {
 	return nil
 }
 
-// putHeader returns a new buffer containing the RPT header and b.
-func (t *RPT) putHeader(id uint56, flags rptFlag, b common.RawBytes) (*bufpool.Buffer, error) {
-	buffer := bufpool.Get()
-	if rptHdrLen+len(b) > len(buffer.B) {
-		bufpool.Put(buffer)
-		return nil, common.NewBasicError("Unable to send, payload too long", nil,
-			"pld_len", len(b), "max_allowed", len(buffer.B)-rptHdrLen)
-	}
-	buffer.B[0] = byte(flags)
-	id.putUint56(buffer.B[1:])
-	// Because we checked bounds above, this will never reallocate
-	buffer.B = append(buffer.B[:rptHdrLen], b...)
-	return buffer, nil
-}
-
 // RecvFrom returns the next non-ACK message.
 func (t *RPT) RecvFrom(ctx context.Context) (common.RawBytes, net.Addr, error) {
 	select {
 	case event := <-t.readEvents:
 		// Propagate message payload to caller
-		b := event.buffer.CloneB()
-		bufpool.Put(event.buffer)
-		return b, event.address, nil
+		return event.payload, event.address, nil
 	case <-ctx.Done():
 		// We timed out, return with failure
 		return nil, nil, infra.NewCtxDoneError()
@@ -256,84 +421,154 @@ func (t *RPT) RecvFrom(ctx context.Context) (common.RawBytes, net.Addr, error) {
 	}
 }
 
-// goBackgroundReceiver reads messages from the network and marks received ACKs
-// in the ACK table.
+// goBackgroundReceiver reads messages from the network, marks received ACKs
+// in the ACK table and reassembles fragmented messages.
 func (t *RPT) goBackgroundReceiver() {
 	go func() {
 		defer log.LogPanicAndExit()
 		t.log.Info("Started")
 		defer t.log.Info("Stopped")
 		defer close(t.doneChan)
+		r := &receiver{
+			t:           t,
+			reassembled: newReassemblyTable(),
+			delivered:   newDedupeTable(),
+		}
+		b := bufpool.Get()
+		defer bufpool.Put(b)
 		for {
-			b := bufpool.Get()
 			n, address, err := t.conn.ReadFrom(b.B)
 			if err != nil {
 				// FIXME(scrye): For now just log and continue on SCMP errors,
 				// and destroy the background receiver on other errors.
-				if opErr, ok := err.(*snet.OpError); ok && opErr.SCMP() != nil {
+				if opErr, ok := err.(snet.Error); ok && opErr.SCMP() != nil {
 					t.log.Warn("Received SCMP message", "msg", opErr.SCMP())
-					bufpool.Put(b)
 					continue
 				} else {
 					// Do not log close events
 					if err != io.EOF {
 						t.log.Error("Read error, shutting down", "err", err)
 					}
-					bufpool.Put(b)
 					return
 				}
 			}
-
-			flags, id, payload, err := t.popHeader(b.B[:n])
+			hdr, payload, err := t.popHeader(b.B[:n])
 			if err != nil {
 				t.log.Error("Unable to remove RPT header", "err", err)
-				bufpool.Put(b)
-				continue
-			}
-			b.B = payload
-
-			// If the received message is an ACK we do not propagate it up the
-			// stack. Instead, we signal the waiting goroutine by closing its
-			// channel.
-			if flags.isSet(flagACK) {
-				ackChannel, loaded := t.ackTable.Load(id)
-				if !loaded {
-					t.log.Warn("Received ACK, but no one is waiting for it", "id", id)
-				} else {
-					close(ackChannel)
-				}
-				bufpool.Put(b)
 				continue
 			}
+			r.handle(hdr, payload, address)
+		}
+	}()
+}
 
-			// The received message is for the upper layer.
-			event := &readEventDesc{address: address, buffer: b}
-			select {
-			case t.readEvents <- event:
-				// We reliably sent the message to the upper layer, send ACK
-				// (if requested)
-				if flags.isSet(flagNeedACK) {
-					if err := t.sendACK(id, address); err != nil {
-						t.log.Warn("Unable to send ACK", "err", err)
-					}
-				}
-			default:
-				t.log.Warn("Internal queue full, dropped message", "id", id, "flags", flags,
-					"msg_len", n)
+// receiver contains the state of the background receiver.
+type receiver struct {
+	t *RPT
+	// Fragmented messages that are not yet complete
+	reassembled *reassemblyTable
+	// Reliable messages delivered recently
+	delivered *dedupeTable
+}
+
+// handle processes a received packet. The payload is only valid until handle
+// returns.
+func (r *receiver) handle(hdr *rptHdr, payload common.RawBytes, address net.Addr) {
+	t := r.t
+	// If the received message is an ACK we do not propagate it up the
+	// stack. Instead, we signal the waiting goroutine by closing its
+	// channel. The entry is removed immediately, so that duplicate ACKs do
+	// not close the channel again.
+	if hdr.flags.isSet(flagACK) {
+		key := ackKey{id: hdr.id, frag: hdr.fragIndex}
+		ackChannel, loaded := t.ackTable.Load(key)
+		if !loaded {
+			t.log.Debug("Received ACK, but no one is waiting for it", "hdr", hdr)
+		} else {
+			close(ackChannel)
+			t.ackTable.Delete(key)
+		}
+		return
+	}
+	reliable := hdr.flags.isSet(flagNeedACK)
+	key := msgKey(address, hdr.id)
+	if reliable && r.delivered.Seen(key) {
+		// Retransmission of a message that was already delivered, probably
+		// because the ACK was lost.
+		r.ack(hdr, address)
+		return
+	}
+	msg := payload
+	if hdr.version == rptVersion1 {
+		var err error
+		msg, err = r.reassembled.Add(key, hdr, payload)
+		if err != nil {
+			t.log.Warn("Unable to reassemble message", "src", address, "err", err)
+			return
+		}
+		if msg == nil {
+			// Message is incomplete; the fragment is stored, so it can be
+			// acknowledged right away.
+			if reliable {
+				r.ack(hdr, address)
 			}
+			return
 		}
-	}()
+	} else {
+		msg = append(common.RawBytes(nil), payload...)
+	}
+
+	// The received message is for the upper layer.
+	event := &readEventDesc{address: address, payload: msg}
+	select {
+	case t.readEvents <- event:
+		// We reliably sent the message to the upper layer, send ACK
+		// (if requested)
+		r.reassembled.Delete(key)
+		if reliable {
+			r.delivered.Add(key)
+			r.ack(hdr, address)
+		}
+	default:
+		// Fragments of incomplete messages are kept, so that the message is
+		// delivered once the sender retransmits the last fragment.
+		t.log.Warn("Internal queue full, dropped message", "hdr", hdr,
+			"msg_len", len(msg))
+	}
+}
+
+func (r *receiver) ack(hdr *rptHdr, address net.Addr) {
+	if err := r.t.sendACK(hdr, address); err != nil {
+		r.t.log.Warn("Unable to send ACK", "err", err)
+	}
 }
 
-// popHeader returns a slice referring only to the payload of b.
-func (t *RPT) popHeader(b common.RawBytes) (rptFlag, uint56, common.RawBytes, error) {
+// popHeader decodes the header of b, and returns a slice referring only to
+// the payload of b.
+func (t *RPT) popHeader(b common.RawBytes) (*rptHdr, common.RawBytes, error) {
 	if len(b) < rptHdrLen {
-		return 0, 0, nil, common.NewBasicError("Packet shorter than min length", nil,
+		return nil, nil, common.NewBasicError("Packet shorter than min length", nil,
 			"length", len(b), "min_length", rptHdrLen)
 	}
-	flags := rptFlag(b[0])
-	id := getUint56(b[1:])
-	return flags, id, b[rptHdrLen:], nil
+	hdr := &rptHdr{
+		version: b[0] >> 4,
+		flags:   rptFlag(b[0] & flagsMask),
+		id:      getUint56(b[1:]),
+	}
+	switch hdr.version {
+	case rptVersion0:
+	case rptVersion1:
+		if len(b) < rptHdrLenV1 {
+			return nil, nil, common.NewBasicError("Packet shorter than min length", nil,
+				"length", len(b), "min_length", rptHdrLenV1)
+		}
+		hdr.fragIndex = common.Order.Uint16(b[8:])
+		hdr.fragCount = common.Order.Uint16(b[10:])
+	default:
+		return nil, nil, common.NewBasicError("Unsupported RPT version", nil,
+			"version", hdr.version)
+	}
+	return hdr, b[hdr.Len():], nil
 }
 
 // Close closes the net.PacketConn connection and shuts down the background
@@ -355,6 +590,6 @@ func (t *RPT) Close(ctx context.Context) error {
 }
 
 type readEventDesc struct {
-	buffer  *bufpool.Buffer
+	payload common.RawBytes
 	address net.Addr
 }
@@ -26,6 +26,7 @@ import (
 
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/xtest"
 	"github.com/scionproto/scion/go/lib/xtest/loopback"
 )
 
@@ -93,6 +94,98 @@ func TestSendMsgToBadLink(t *testing.T) {
 	})
 }
 
+func TestSendFragmentedMsgTo(t *testing.T) {
+	Convey("Create RPT with small fragments, send large messages", t, func() {
+		conn := loopback.New()
+		rpt := NewWithConfig(conn, log.Root(), &Config{FragmentSize: 100})
+		msg := make(common.RawBytes, 450)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+		ctx, cancelF := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancelF()
+
+		Convey("Reliable message is reassembled", func() {
+			err := rpt.SendMsgTo(ctx, msg, &loopback.Addr{})
+			SoMsg("send err", err, ShouldBeNil)
+			b, _, err := rpt.RecvFrom(ctx)
+			SoMsg("recv err", err, ShouldBeNil)
+			SoMsg("payload", b, ShouldResemble, msg)
+		})
+		Convey("Unreliable message is reassembled", func() {
+			err := rpt.SendUnreliableMsgTo(ctx, msg, &loopback.Addr{})
+			SoMsg("send err", err, ShouldBeNil)
+			b, _, err := rpt.RecvFrom(ctx)
+			SoMsg("recv err", err, ShouldBeNil)
+			SoMsg("payload", b, ShouldResemble, msg)
+		})
+		Convey("Message with too many fragments is rejected", func() {
+			err := rpt.SendMsgTo(ctx, make(common.RawBytes, 100*maxFragments+1),
+				&loopback.Addr{})
+			SoMsg("send err", err, ShouldNotBeNil)
+		})
+
+		err := rpt.Close(ctx)
+		SoMsg("err", err, ShouldBeNil)
+	})
+}
+
+func TestDuplicateSuppression(t *testing.T) {
+	Convey("Create RPT, receive the same reliable message twice", t, func() {
+		conn := loopback.New()
+		rpt := New(conn, log.Root())
+		hdr := &rptHdr{version: rptVersion0, flags: flagNeedACK, id: 42}
+		pkt := newPacket(hdr, common.RawBytes("1234"))
+		_, err := conn.WriteTo(pkt, &loopback.Addr{})
+		xtest.FailOnErr(t, err)
+		_, err = conn.WriteTo(pkt, &loopback.Addr{})
+		xtest.FailOnErr(t, err)
+
+		ctx, cancelF := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancelF()
+		b, _, err := rpt.RecvFrom(ctx)
+		SoMsg("recv err", err, ShouldBeNil)
+		SoMsg("payload", b, ShouldResemble, common.RawBytes("1234"))
+
+		shortCtx, shortCancelF := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer shortCancelF()
+		_, _, err = rpt.RecvFrom(shortCtx)
+		SoMsg("duplicate not delivered", common.IsTimeoutErr(err), ShouldBeTrue)
+
+		err = rpt.Close(ctx)
+		SoMsg("err", err, ShouldBeNil)
+	})
+}
+
+func TestRTTEstimator(t *testing.T) {
+	Convey("Given an RTT estimator", t, func() {
+		cfg := &Config{}
+		cfg.initDefaults()
+		e := newRTTEstimator(cfg)
+		SoMsg("initial", e.RTO(), ShouldEqual, DefaultInitialRTO)
+
+		Convey("The first sample sets RTO to 3 * RTT", func() {
+			e.Update(100 * time.Millisecond)
+			SoMsg("rto", e.RTO(), ShouldEqual, 300*time.Millisecond)
+			Convey("Stable samples decrease RTO towards the minimum", func() {
+				for i := 0; i < 50; i++ {
+					e.Update(100 * time.Millisecond)
+				}
+				SoMsg("rto", e.RTO(), ShouldEqual, DefaultMinRTO)
+			})
+		})
+		Convey("Backoff doubles RTO up to the maximum", func() {
+			rto := e.Backoff(e.RTO())
+			SoMsg("doubled", rto, ShouldEqual, 2*DefaultInitialRTO)
+			SoMsg("stored", e.RTO(), ShouldEqual, 2*DefaultInitialRTO)
+			for i := 0; i < 10; i++ {
+				rto = e.Backoff(rto)
+			}
+			SoMsg("max", rto, ShouldEqual, DefaultMaxRTO)
+		})
+	})
+}
+
 // Loopback with 100% drop rate
 type BadLoopback struct {
 	*loopback.Conn
@@ -0,0 +1,127 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpt
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Clock granularity G of RFC 6298
+	clockGranularity = time.Millisecond
+	// Maximum number of destinations for which RTT estimates are kept
+	maxRTTEntries = 1 << 10
+)
+
+// rttEstimator computes the retransmission timeout (RTO) for a destination,
+// as described in RFC 6298. It is safe for concurrent use.
+type rttEstimator struct {
+	mutex  sync.Mutex
+	cfg    *Config
+	srtt   time.Duration
+	rttvar time.Duration
+	rto    time.Duration
+	// True once the first RTT sample has been taken
+	sampled bool
+}
+
+func newRTTEstimator(cfg *Config) *rttEstimator {
+	return &rttEstimator{cfg: cfg, rto: cfg.InitialRTO}
+}
+
+// RTO returns the current retransmission timeout.
+func (e *rttEstimator) RTO() time.Duration {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.rto
+}
+
+// Update adds an RTT sample. Following Karn's algorithm, callers must not
+// take samples from retransmitted packets.
+func (e *rttEstimator) Update(rtt time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.sampled {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+		e.sampled = true
+	} else {
+		delta := e.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		e.rttvar = (3*e.rttvar + delta) / 4
+		e.srtt = (7*e.srtt + rtt) / 8
+	}
+	variance := 4 * e.rttvar
+	if variance < clockGranularity {
+		variance = clockGranularity
+	}
+	e.rto = e.clamp(e.srtt + variance)
+}
+
+// Backoff returns the timeout to use after a retransmission timer with value
+// rto expired. The timeout is doubled, and kept by the estimator until the
+// next RTT sample.
+func (e *rttEstimator) Backoff(rto time.Duration) time.Duration {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	rto = e.clamp(2 * rto)
+	if rto > e.rto {
+		e.rto = rto
+	}
+	return rto
+}
+
+func (e *rttEstimator) clamp(rto time.Duration) time.Duration {
+	if rto < e.cfg.MinRTO {
+		return e.cfg.MinRTO
+	}
+	if rto > e.cfg.MaxRTO {
+		return e.cfg.MaxRTO
+	}
+	return rto
+}
+
+// rttTable keeps an RTT estimator for each destination.
+type rttTable struct {
+	mutex      sync.Mutex
+	cfg        *Config
+	estimators map[string]*rttEstimator
+}
+
+func newRTTTable(cfg *Config) *rttTable {
+	return &rttTable{cfg: cfg, estimators: make(map[string]*rttEstimator)}
+}
+
+// Get returns the estimator for a, creating it if it does not exist.
+func (t *rttTable) Get(a net.Addr) *rttEstimator {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := a.String()
+	e, ok := t.estimators[key]
+	if !ok {
+		if len(t.estimators) >= maxRTTEntries {
+			// Forget all estimates rather than tracking their age; they are
+			// rebuilt from the next samples.
+			t.estimators = make(map[string]*rttEstimator)
+		}
+		e = newRTTEstimator(t.cfg)
+		t.estimators[key] = e
+	}
+	return e
+}
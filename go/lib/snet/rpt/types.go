@@ -21,17 +21,24 @@ import (
 	"github.com/scionproto/scion/go/lib/common"
 )
 
-// ackTable maps packet IDs to channels. Goroutines waiting for an ACK for a
-// packet ID create a channel, store it in the map at that ID and wait for the
-// channel to be closed. The background receiving goroutine closes the channel
-// when it receives the corresponding ack.
+// ackKey identifies a packet waiting for an ACK. Packets that are not
+// fragments use fragment index 0.
+type ackKey struct {
+	id   uint56
+	frag uint16
+}
+
+// ackTable maps packets to channels. Goroutines waiting for an ACK for a
+// packet create a channel, store it in the map at the packet's key and wait
+// for the channel to be closed. The background receiving goroutine closes the
+// channel when it receives the corresponding ack.
 type ackTable sync.Map
 
-func (m *ackTable) Delete(key uint56) {
+func (m *ackTable) Delete(key ackKey) {
 	(*sync.Map)(m).Delete(key)
 }
 
-func (m *ackTable) Load(key uint56) (chan struct{}, bool) {
+func (m *ackTable) Load(key ackKey) (chan struct{}, bool) {
 	value, loaded := (*sync.Map)(m).Load(key)
 	if value == nil {
 		return nil, loaded
@@ -39,7 +46,7 @@ func (m *ackTable) Load(key uint56) (chan struct{}, bool) {
 	return value.(chan struct{}), loaded
 }
 
-func (m *ackTable) LoadOrStore(key uint56, value chan struct{}) (chan struct{}, bool) {
+func (m *ackTable) LoadOrStore(key ackKey, value chan struct{}) (chan struct{}, bool) {
 	newValue, loaded := (*sync.Map)(m).LoadOrStore(key, value)
 	if newValue == nil {
 		return nil, loaded
@@ -47,13 +54,13 @@ func (m *ackTable) LoadOrStore(key uint56, value chan struct{}) (chan struct{},
 	return newValue.(chan struct{}), loaded
 }
 
-func (m *ackTable) Range(f func(uint56, chan struct{}) bool) {
+func (m *ackTable) Range(f func(ackKey, chan struct{}) bool) {
 	(*sync.Map)(m).Range(func(k, v interface{}) bool {
-		return f(k.(uint56), v.(chan struct{}))
+		return f(k.(ackKey), v.(chan struct{}))
 	})
 }
 
-func (m *ackTable) Store(key uint56, value chan struct{}) {
+func (m *ackTable) Store(key ackKey, value chan struct{}) {
 	(*sync.Map)(m).Store(key, value)
 }
 
@@ -0,0 +1,315 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/l4"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/lib/spkt"
+)
+
+var _ Error = (*UnreachableError)(nil)
+
+// UnreachableError is returned when an SCMP message reports that a remote
+// host or port is unreachable. It is returned by the Read call that received
+// the SCMP message, and by the next write to the unreachable remote.
+type UnreachableError struct {
+	OpError
+	// Remote is the address that could not be reached. It is nil if the
+	// packet quoted by the SCMP message could not be parsed.
+	Remote *Addr
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("%s unreachable: %s", e.Remote, e.scmp)
+}
+
+// scmpState contains the information a Conn learns from SCMP messages.
+type scmpState struct {
+	mutex sync.Mutex
+	// Path MTUs reported by routers or found by probing, keyed by raw
+	// forwarding path (see pathKey)
+	mtus map[string]uint16
+	// Raw forwarding path last used for each remote address
+	lastPaths map[string]string
+	// Errors returned by the next write to each remote address
+	pending map[string]*UnreachableError
+}
+
+func newSCMPState() *scmpState {
+	return &scmpState{
+		mtus:      make(map[string]uint16),
+		lastPaths: make(map[string]string),
+		pending:   make(map[string]*UnreachableError),
+	}
+}
+
+func (s *scmpState) setLastPath(raddr *Addr, path *spath.Path) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastPaths[raddr.String()] = pathKey(path)
+}
+
+func (s *scmpState) lastPath(raddr *Addr) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	rawPath, ok := s.lastPaths[raddr.String()]
+	return rawPath, ok
+}
+
+// setMTU records the MTU of rawPath. If an MTU is already known, the smaller
+// one is kept.
+func (s *scmpState) setMTU(rawPath string, mtu uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if old, ok := s.mtus[rawPath]; ok && old <= mtu {
+		return
+	}
+	s.mtus[rawPath] = mtu
+}
+
+// storeMTU records the MTU of rawPath, replacing any known MTU.
+func (s *scmpState) storeMTU(rawPath string, mtu uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mtus[rawPath] = mtu
+}
+
+func (s *scmpState) mtu(rawPath string) (uint16, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	mtu, ok := s.mtus[rawPath]
+	return mtu, ok
+}
+
+func (s *scmpState) setPending(err *UnreachableError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending[err.Remote.String()] = err
+}
+
+// popPending returns and removes the pending error for raddr, if any.
+func (s *scmpState) popPending(raddr *Addr) *UnreachableError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := raddr.String()
+	err, ok := s.pending[key]
+	if !ok {
+		return nil
+	}
+	delete(s.pending, key)
+	return err
+}
+
+// handleSCMP processes SCMP messages that affect the state of the connection.
+// A non-nil error is returned for messages that should be surfaced to the
+// application as a specific error type.
+func (c *Conn) handleSCMP(hdr *scmp.Hdr, pkt *spkt.ScnPkt) error {
+	switch {
+	case hdr.Class == scmp.C_Path && hdr.Type == scmp.T_P_RevokedIF:
+		c.handleSCMPRev(hdr, pkt)
+	case hdr.Class == scmp.C_Path &&
+		(hdr.Type == scmp.T_P_ExpiredHopF || hdr.Type == scmp.T_P_BadMac):
+		c.handleSCMPBadPath(hdr, pkt)
+	case hdr.Class == scmp.C_Routing && hdr.Type == scmp.T_R_OversizePkt:
+		c.handleSCMPOversize(hdr, pkt)
+	case hdr.Class == scmp.C_Routing && isUnreachable(hdr.Type):
+		return c.handleSCMPUnreachable(hdr, pkt)
+	default:
+		log.Warn("Received unsupported SCMP message", "class", hdr.Class, "type", hdr.Type)
+	}
+	return nil
+}
+
+// handleSCMPOversize records the MTU reported by the router in the MTU cache.
+// The quoted packet does not contain the path, so the path last used to send
+// to the quoted destination is updated.
+func (c *Conn) handleSCMPOversize(hdr *scmp.Hdr, pkt *spkt.ScnPkt) {
+	pld, ok := pkt.Pld.(*scmp.Payload)
+	if !ok {
+		log.Error("Unable to type assert payload to SCMP payload", "type", common.TypeOf(pkt.Pld))
+		return
+	}
+	info, ok := pld.Info.(*scmp.InfoPktSize)
+	if !ok {
+		log.Error("Unable to type assert SCMP Info to SCMP Packet Size Info",
+			"type", common.TypeOf(pld.Info))
+		return
+	}
+	dst, err := quotedDst(pld)
+	if err != nil {
+		log.Error("Unable to parse packet quoted by SCMP message", "err", err)
+		return
+	}
+	rawPath, ok := c.scmpState.lastPath(dst)
+	if !ok {
+		log.Warn("Received SCMP oversize packet for unknown destination", "dst", dst)
+		return
+	}
+	log.Info("Received SCMP oversize packet", "dst", dst, "info", info)
+	c.scmpState.setMTU(rawPath, info.MTU)
+}
+
+// handleSCMPBadPath informs the path resolver that the path quoted by the
+// SCMP message is unusable.
+func (c *Conn) handleSCMPBadPath(hdr *scmp.Hdr, pkt *spkt.ScnPkt) {
+	pld, ok := pkt.Pld.(*scmp.Payload)
+	if !ok {
+		log.Error("Unable to type assert payload to SCMP payload", "type", common.TypeOf(pkt.Pld))
+		return
+	}
+	dst, err := quotedDst(pld)
+	if err != nil {
+		log.Error("Unable to parse packet quoted by SCMP message", "err", err)
+		return
+	}
+	log.Info("Received SCMP bad path", "header", hdr.String(), "dst", dst)
+	resolver := c.scionNet.pathResolver
+	if resolver == nil {
+		return
+	}
+	// Copy the path, as the payload references the receive buffer
+	rawPath := string(pld.PathHdr)
+	src := c.laddr.IA
+	// Querying the path resolver might block on SCIOND, so do not block the
+	// receiver.
+	go func() {
+		defer log.LogPanicAndExit()
+		if ap := findPath(resolver.Query(src, dst.IA), rawPath); ap != nil {
+			resolver.MarkBad(src, dst.IA, ap.Key())
+		}
+	}()
+}
+
+func (c *Conn) handleSCMPUnreachable(hdr *scmp.Hdr, pkt *spkt.ScnPkt) *UnreachableError {
+	err := &UnreachableError{OpError: OpError{scmp: hdr}}
+	pld, ok := pkt.Pld.(*scmp.Payload)
+	if !ok {
+		log.Error("Unable to type assert payload to SCMP payload", "type", common.TypeOf(pkt.Pld))
+		return err
+	}
+	dst, parseErr := quotedDst(pld)
+	if parseErr != nil {
+		log.Error("Unable to parse packet quoted by SCMP message", "err", parseErr)
+		return err
+	}
+	err.Remote = dst
+	c.scmpState.setPending(err)
+	return err
+}
+
+// PathMTU returns the MTU of path, as reported by routers via SCMP oversize
+// packet messages or found by ProbeMTU. A nil path stands for destinations in
+// the local AS. If no MTU is known for path, the second return value is false.
+func (c *Conn) PathMTU(path *spath.Path) (uint16, bool) {
+	return c.scmpState.mtu(pathKey(path))
+}
+
+// pathKey returns the key of path in the MTU cache. The empty path is used
+// within the local AS.
+func pathKey(path *spath.Path) string {
+	if path == nil {
+		return ""
+	}
+	return string(path.Raw)
+}
+
+func isUnreachable(t scmp.Type) bool {
+	switch t {
+	case scmp.T_R_UnreachNet, scmp.T_R_UnreachHost, scmp.T_R_UnknownHost,
+		scmp.T_R_UnreachProto, scmp.T_R_UnreachPort:
+		return true
+	}
+	return false
+}
+
+// quotedDst extracts the destination address of the packet quoted by an
+// SCMP message.
+func quotedDst(pld *scmp.Payload) (*Addr, error) {
+	return quotedAddr(pld, true)
+}
+
+// quotedSrc extracts the source address of the packet quoted by an SCMP
+// message.
+func quotedSrc(pld *scmp.Payload) (*Addr, error) {
+	return quotedAddr(pld, false)
+}
+
+func quotedAddr(pld *scmp.Payload, dst bool) (*Addr, error) {
+	if len(pld.CmnHdr) < spkt.CmnHdrLen {
+		return nil, common.NewBasicError("Quoted common header too short", nil,
+			"expected", spkt.CmnHdrLen, "actual", len(pld.CmnHdr))
+	}
+	cmnHdr, err := spkt.CmnHdrFromRaw(pld.CmnHdr)
+	if err != nil {
+		return nil, err
+	}
+	dstLen, err := addr.HostLen(cmnHdr.DstType)
+	if err != nil {
+		return nil, err
+	}
+	srcLen, err := addr.HostLen(cmnHdr.SrcType)
+	if err != nil {
+		return nil, err
+	}
+	if len(pld.AddrHdr) < 2*addr.IABytes+int(dstLen)+int(srcLen) {
+		return nil, common.NewBasicError("Quoted address header too short", nil,
+			"expected", 2*addr.IABytes+int(dstLen)+int(srcLen), "actual", len(pld.AddrHdr))
+	}
+	// Copy the address header, as the payload references the receive buffer
+	raw := append(common.RawBytes(nil), pld.AddrHdr...)
+	a := &Addr{}
+	if dst {
+		a.IA = addr.IAFromRaw(raw)
+		a.Host, err = addr.HostFromRaw(raw[2*addr.IABytes:], cmnHdr.DstType)
+	} else {
+		a.IA = addr.IAFromRaw(raw[addr.IABytes:])
+		a.Host, err = addr.HostFromRaw(raw[2*addr.IABytes+int(dstLen):], cmnHdr.SrcType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cmnHdr.NextHdr == common.L4UDP && len(pld.L4Hdr) >= l4.UDPLen {
+		udp, err := l4.UDPFromRaw(pld.L4Hdr)
+		if err != nil {
+			return nil, err
+		}
+		if dst {
+			a.L4Port = udp.DstPort
+		} else {
+			a.L4Port = udp.SrcPort
+		}
+	}
+	return a, nil
+}
+
+// findPath returns the path in aps whose forwarding path is rawPath, or nil if
+// no such path exists.
+func findPath(aps spathmeta.AppPathSet, rawPath string) *spathmeta.AppPath {
+	for _, ap := range aps {
+		if string(ap.Entry.Path.FwdPath) == rawPath {
+			return ap
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/hpkt"
+	"github.com/scionproto/scion/go/lib/l4"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spkt"
+	"github.com/scionproto/scion/go/lib/xtest"
+)
+
+var (
+	testLocal = &Addr{
+		IA:     xtest.MustParseIA("1-ff00:0:111"),
+		Host:   addr.HostFromIP(net.IPv4(127, 0, 0, 1)),
+		L4Port: 40000,
+	}
+	testRemote = &Addr{
+		IA:     xtest.MustParseIA("1-ff00:0:112"),
+		Host:   addr.HostFromIP(net.IPv4(127, 0, 0, 2)),
+		L4Port: 50000,
+	}
+	testRouter = addr.HostFromIP(net.IPv4(127, 0, 0, 3))
+	// Forwarding path used by the packets that trigger the SCMP messages.
+	// The content is irrelevant, as it is only compared byte-wise.
+	testRawPath = common.RawBytes{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18,
+	}
+)
+
+// newSCMPFixture builds an SCMP message of type ct, sent by a router in
+// response to a UDP packet from testLocal to dst over testRawPath. The
+// message is serialized and parsed again, like a packet received from the
+// dispatcher.
+func newSCMPFixture(t *testing.T, ct scmp.ClassType, info scmp.Info,
+	dst *Addr) (*scmp.Hdr, *spkt.ScnPkt) {
+
+	t.Helper()
+	raw := newRawSCMP(t, ct, info, testLocal, dst)
+	pkt := &spkt.ScnPkt{
+		DstIA: addr.IA{},
+		SrcIA: addr.IA{},
+		Path:  &spath.Path{},
+	}
+	xtest.FailOnErr(t, hpkt.ParseScnPkt(pkt, raw))
+	hdr, ok := pkt.L4.(*scmp.Hdr)
+	if !ok {
+		t.Fatalf("Fixture is not an SCMP packet, L4 type %v", pkt.L4.L4Type())
+	}
+	return hdr, pkt
+}
+
+// newRawSCMP returns the serialized SCMP message of type ct, sent by a router
+// to src in response to a UDP packet from src to dst over testRawPath.
+func newRawSCMP(t *testing.T, ct scmp.ClassType, info scmp.Info,
+	src, dst *Addr) common.RawBytes {
+
+	t.Helper()
+	orig := &spkt.ScnPkt{
+		DstIA:   dst.IA,
+		SrcIA:   src.IA,
+		DstHost: dst.Host,
+		SrcHost: src.Host,
+		Path:    spath.New(testRawPath),
+		L4:      &l4.UDP{SrcPort: src.L4Port, DstPort: dst.L4Port},
+		Pld:     common.RawBytes("hello"),
+	}
+	origRaw := make(common.RawBytes, BufSize)
+	n, err := hpkt.WriteScnPkt(orig, origRaw)
+	xtest.FailOnErr(t, err)
+	origRaw = origRaw[:n]
+	pathStart := spkt.CmnHdrLen + spkt.AddrHdrLen(orig.DstHost, orig.SrcHost)
+	l4Start := pathStart + len(testRawPath)
+	quote := func(blk scmp.RawBlock) common.RawBytes {
+		switch blk {
+		case scmp.RawCmnHdr:
+			return origRaw[:spkt.CmnHdrLen]
+		case scmp.RawAddrHdr:
+			return origRaw[spkt.CmnHdrLen:pathStart]
+		case scmp.RawPathHdr:
+			return origRaw[pathStart:l4Start]
+		case scmp.RawL4Hdr:
+			return origRaw[l4Start : l4Start+l4.UDPLen]
+		}
+		return nil
+	}
+	pld := scmp.PldFromQuotes(ct, info, common.L4UDP, quote)
+	reply := &spkt.ScnPkt{
+		DstIA:   src.IA,
+		SrcIA:   dst.IA,
+		DstHost: src.Host,
+		SrcHost: testRouter,
+		L4:      scmp.NewHdr(ct, pld.Len()),
+		Pld:     pld,
+	}
+	raw := make(common.RawBytes, BufSize)
+	n, err = hpkt.WriteScnPkt(reply, raw)
+	xtest.FailOnErr(t, err)
+	return raw[:n]
+}
+
+func newTestConn() *Conn {
+	return &Conn{
+		laddr:     testLocal.Copy(),
+		scionNet:  &Network{localIA: testLocal.IA},
+		scmpState: newSCMPState(),
+	}
+}
+
+func TestSCMPOversize(t *testing.T) {
+	Convey("SCMP oversize packet updates the path MTU cache", t, func() {
+		c := newTestConn()
+		path := spath.New(testRawPath)
+		c.scmpState.setLastPath(testRemote, path)
+		_, ok := c.PathMTU(path)
+		SoMsg("no MTU", ok, ShouldBeFalse)
+		hdr, pkt := newSCMPFixture(t, scmp.ClassType{Class: scmp.C_Routing,
+			Type: scmp.T_R_OversizePkt}, &scmp.InfoPktSize{Size: 1500, MTU: 1280}, testRemote)
+		SoMsg("err", c.handleSCMP(hdr, pkt), ShouldBeNil)
+		mtu, ok := c.PathMTU(path)
+		SoMsg("ok", ok, ShouldBeTrue)
+		SoMsg("mtu", mtu, ShouldEqual, 1280)
+		Convey("A larger MTU does not replace a smaller one", func() {
+			hdr, pkt := newSCMPFixture(t, scmp.ClassType{Class: scmp.C_Routing,
+				Type: scmp.T_R_OversizePkt}, &scmp.InfoPktSize{Size: 1500, MTU: 1400},
+				testRemote)
+			SoMsg("err", c.handleSCMP(hdr, pkt), ShouldBeNil)
+			mtu, _ := c.PathMTU(path)
+			SoMsg("mtu", mtu, ShouldEqual, 1280)
+		})
+		Convey("Messages for unknown destinations are ignored", func() {
+			other := testRemote.Copy()
+			other.L4Port++
+			hdr, pkt := newSCMPFixture(t, scmp.ClassType{Class: scmp.C_Routing,
+				Type: scmp.T_R_OversizePkt}, &scmp.InfoPktSize{Size: 1500, MTU: 1000}, other)
+			SoMsg("err", c.handleSCMP(hdr, pkt), ShouldBeNil)
+			mtu, _ := c.PathMTU(path)
+			SoMsg("mtu", mtu, ShouldEqual, 1280)
+		})
+	})
+}
+
+func TestSCMPBadPath(t *testing.T) {
+	for _, ct := range []scmp.ClassType{
+		{Class: scmp.C_Path, Type: scmp.T_P_ExpiredHopF},
+		{Class: scmp.C_Path, Type: scmp.T_P_BadMac},
+	} {
+		Convey(ct.String()+" removes the quoted path from the watched paths", t, func() {
+			entry := newTestPath(1)
+			entry.Path.FwdPath = testRawPath
+			other := newTestPath(2)
+			expTime := uint32(time.Now().Add(time.Hour).Unix())
+			entry.Path.ExpTime, other.Path.ExpTime = expTime, expTime
+			pr, err := pathmgr.New(
+				&pathSciond{entries: []*sciond.PathReplyEntry{entry, other}},
+				&pathmgr.Timers{NormalRefire: time.Minute, ErrorRefire: time.Second,
+					MaxAge: time.Minute}, log.Root())
+			xtest.FailOnErr(t, err)
+			c := newTestConn()
+			c.scionNet.SetPathResolver(pr)
+			sp, err := pr.Watch(testLocal.IA, testRemote.IA)
+			xtest.FailOnErr(t, err)
+			SoMsg("before", sp.Load().APS, ShouldHaveLength, 2)
+			hdr, pkt := newSCMPFixture(t, ct, &scmp.InfoPathOffsets{InfoF: 1, HopF: 2},
+				testRemote)
+			So(c.handleSCMP(hdr, pkt), ShouldBeNil)
+			// The path resolver is informed asynchronously.
+			aps := sp.Load().APS
+			for i := 0; i < 50 && len(aps) == 2; i++ {
+				time.Sleep(10 * time.Millisecond)
+				aps = sp.Load().APS
+			}
+			SoMsg("after", aps, ShouldHaveLength, 1)
+			SoMsg("bad", findPath(aps, string(testRawPath)), ShouldBeNil)
+			SoMsg("other", aps.GetAppPath("").Entry.Path.Interfaces, ShouldResemble,
+				other.Path.Interfaces)
+		})
+	}
+}
+
+func TestSCMPUnreachable(t *testing.T) {
+	for _, ct := range []scmp.ClassType{
+		{Class: scmp.C_Routing, Type: scmp.T_R_UnreachHost},
+		{Class: scmp.C_Routing, Type: scmp.T_R_UnreachPort},
+	} {
+		Convey(ct.String()+" is surfaced as an UnreachableError", t, func() {
+			c := newTestConn()
+			hdr, pkt := newSCMPFixture(t, ct, nil, testRemote)
+			err := c.handleSCMP(hdr, pkt)
+			So(err, ShouldNotBeNil)
+			uerr, ok := err.(*UnreachableError)
+			So(ok, ShouldBeTrue)
+			SoMsg("remote", uerr.Remote.EqAddr(testRemote), ShouldBeTrue)
+			SoMsg("scmp", uerr.SCMP().Type, ShouldEqual, ct.Type)
+			Convey("and returned once by the next write to the remote", func() {
+				SoMsg("other", c.scmpState.popPending(testLocal), ShouldBeNil)
+				SoMsg("pending", c.scmpState.popPending(testRemote), ShouldEqual, uerr)
+				SoMsg("cleared", c.scmpState.popPending(testRemote), ShouldBeNil)
+			})
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pktcls"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+)
+
+// PathSelector chooses the path a Conn uses to send packets to a remote
+// address. Implementations must be safe for concurrent use, as a selector can
+// be shared by all the connections of a Network.
+type PathSelector interface {
+	// SelectPath returns the path in aps that should be used to reach dst, or
+	// nil if none of the paths is acceptable.
+	SelectPath(dst *Addr, aps spathmeta.AppPathSet) *spathmeta.AppPath
+	// Revoke informs the selector that interface ifid of ia is down until
+	// expiry. It is called as soon as the Conn receives an SCMP revocation,
+	// before the path resolver has removed the affected paths.
+	Revoke(ia addr.IA, ifid common.IFIDType, expiry time.Time)
+}
+
+// DestIdleTimeout is the time after which DefaultPathSelector forgets the
+// path last selected for a destination it has not selected a path for since.
+const DestIdleTimeout = 10 * time.Minute
+
+var _ PathSelector = (*DefaultPathSelector)(nil)
+
+// DefaultPathSelector keeps using the same path for a destination (ISD-AS and
+// host) for as long as the path is available. Applications can pin a path to
+// a destination, and restrict the candidate paths with a filter.
+//
+// If the preferred (or pinned) path of a destination is revoked or disappears
+// from the set of available paths, another path is selected automatically. A
+// pinned path is used again as soon as it becomes available.
+//
+// The path last selected for a destination is forgotten once no path has been
+// selected for it for DestIdleTimeout. Pinned paths are kept until Unpin is
+// called.
+type DefaultPathSelector struct {
+	mutex  sync.Mutex
+	filter *pktcls.ActionFilterPaths
+	// Pinned and last selected path, per destination
+	dests map[string]*destState
+	// Time after which the state of an unused destination is removed
+	idleTimeout time.Duration
+	// Last time idle destinations were removed
+	lastPrune time.Time
+	// Revoked interfaces, mapped to the time the revocation expires
+	revoked map[revokedIF]time.Time
+}
+
+// NewPathSelector creates a new DefaultPathSelector. If filter is non-nil,
+// only paths matching the filter are selected.
+func NewPathSelector(filter *pktcls.ActionFilterPaths) *DefaultPathSelector {
+	return &DefaultPathSelector{
+		filter:      filter,
+		dests:       make(map[string]*destState),
+		idleTimeout: DestIdleTimeout,
+		lastPrune:   time.Now(),
+		revoked:     make(map[revokedIF]time.Time),
+	}
+}
+
+// SetFilter changes the filter used to restrict the candidate paths. A nil
+// filter allows all paths.
+func (s *DefaultPathSelector) SetFilter(filter *pktcls.ActionFilterPaths) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.filter = filter
+}
+
+// Pin forces the selector to use the path identified by key to reach dst,
+// whenever the path is available.
+func (s *DefaultPathSelector) Pin(dst *Addr, key spathmeta.PathKey) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	d := s.dest(destKey(dst), time.Now())
+	d.pinned = key
+	d.isPinned = true
+}
+
+// Unpin removes the pinned path of dst, if any.
+func (s *DefaultPathSelector) Unpin(dst *Addr) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if d, ok := s.dests[destKey(dst)]; ok {
+		d.pinned = ""
+		d.isPinned = false
+	}
+}
+
+// Preferred returns the key of the path last selected for dst.
+func (s *DefaultPathSelector) Preferred(dst *Addr) (spathmeta.PathKey, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	d, ok := s.dests[destKey(dst)]
+	if !ok || !d.hasPreferred {
+		return "", false
+	}
+	return d.preferred, true
+}
+
+func (s *DefaultPathSelector) SelectPath(dst *Addr,
+	aps spathmeta.AppPathSet) *spathmeta.AppPath {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	candidates := aps
+	if s.filter != nil {
+		candidates = s.filter.Act(aps).(spathmeta.AppPathSet)
+	}
+	// Avoid revoked paths, unless they are the only ones left. The revocation
+	// might be invalid, in which case SCIOND keeps returning the paths.
+	if valid := s.withoutRevoked(candidates); len(valid) > 0 {
+		candidates = valid
+	}
+	now := time.Now()
+	s.pruneIdle(now)
+	d := s.dest(destKey(dst), now)
+	if d.isPinned {
+		if ap, ok := candidates[d.pinned]; ok {
+			d.setPreferred(d.pinned)
+			return ap
+		}
+	}
+	ap := candidates.GetAppPath(d.preferred)
+	if ap == nil {
+		return nil
+	}
+	d.setPreferred(ap.Key())
+	return ap
+}
+
+func (s *DefaultPathSelector) Revoke(ia addr.IA, ifid common.IFIDType, expiry time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.revoked[revokedIF{ia: ia.IAInt(), ifid: ifid}] = expiry
+}
+
+// dest returns the state of the destination identified by key, creating it if
+// necessary, and marks it as used at now.
+func (s *DefaultPathSelector) dest(key string, now time.Time) *destState {
+	d, ok := s.dests[key]
+	if !ok {
+		d = &destState{}
+		s.dests[key] = d
+	}
+	d.lastUsed = now
+	return d
+}
+
+// pruneIdle forgets the last selected path of destinations that have not been
+// used for idleTimeout. The state of destinations without a pinned path is
+// removed. To keep SelectPath cheap, this is done at most once per
+// idleTimeout.
+func (s *DefaultPathSelector) pruneIdle(now time.Time) {
+	if now.Sub(s.lastPrune) < s.idleTimeout {
+		return
+	}
+	s.lastPrune = now
+	for key, d := range s.dests {
+		if now.Sub(d.lastUsed) < s.idleTimeout {
+			continue
+		}
+		if !d.isPinned {
+			delete(s.dests, key)
+			continue
+		}
+		d.preferred = ""
+		d.hasPreferred = false
+	}
+}
+
+// withoutRevoked returns the paths in aps that do not traverse a revoked
+// interface. Expired revocations are removed.
+func (s *DefaultPathSelector) withoutRevoked(aps spathmeta.AppPathSet) spathmeta.AppPathSet {
+	if len(s.revoked) == 0 {
+		return aps
+	}
+	now := time.Now()
+	for k, expiry := range s.revoked {
+		if now.After(expiry) {
+			delete(s.revoked, k)
+		}
+	}
+	result := make(spathmeta.AppPathSet)
+	for key, ap := range aps {
+		if !s.isRevoked(ap) {
+			result[key] = ap
+		}
+	}
+	return result
+}
+
+func (s *DefaultPathSelector) isRevoked(ap *spathmeta.AppPath) bool {
+	for _, iface := range ap.Entry.Path.Interfaces {
+		if _, ok := s.revoked[revokedIF{ia: iface.RawIsdas, ifid: iface.IfID}]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// destState contains the path selection state of a single destination.
+type destState struct {
+	pinned       spathmeta.PathKey
+	isPinned     bool
+	preferred    spathmeta.PathKey
+	hasPreferred bool
+	lastUsed     time.Time
+}
+
+func (d *destState) setPreferred(key spathmeta.PathKey) {
+	d.preferred = key
+	d.hasPreferred = true
+}
+
+// revokedIF uniquely identifies an interface.
+type revokedIF struct {
+	ia   addr.IAInt
+	ifid common.IFIDType
+}
+
+// destKey returns the key used to store per-destination state for dst.
+func destKey(dst *Addr) string {
+	if dst.Host == nil {
+		return dst.IA.String()
+	}
+	return dst.IA.String() + "," + dst.Host.String()
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pktcls"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/lib/xtest"
+)
+
+// newTestPath creates a path from 1-ff00:0:111 to 1-ff00:0:112 via core AS
+// 1-ff00:0:110, leaving 111 through ifid and entering 112 through ifid+10.
+func newTestPath(ifid common.IFIDType) *sciond.PathReplyEntry {
+	src := xtest.MustParseIA("1-ff00:0:111")
+	core := xtest.MustParseIA("1-ff00:0:110")
+	dst := xtest.MustParseIA("1-ff00:0:112")
+	return &sciond.PathReplyEntry{
+		Path: &sciond.FwdPathMeta{
+			Interfaces: []sciond.PathInterface{
+				{RawIsdas: src.IAInt(), IfID: ifid},
+				{RawIsdas: core.IAInt(), IfID: 100 + ifid},
+				{RawIsdas: core.IAInt(), IfID: 200 + ifid},
+				{RawIsdas: dst.IAInt(), IfID: 10 + ifid},
+			},
+		},
+	}
+}
+
+func TestDefaultPathSelector(t *testing.T) {
+	dstIA := xtest.MustParseIA("1-ff00:0:112")
+	dstA := &Addr{IA: dstIA, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 1))}
+	dstB := &Addr{IA: dstIA, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 2))}
+	aps := make(spathmeta.AppPathSet)
+	p1 := aps.Add(newTestPath(1))
+	p2 := aps.Add(newTestPath(2))
+	p3 := aps.Add(newTestPath(3))
+
+	Convey("Given a default path selector", t, func() {
+		s := NewPathSelector(nil)
+		Convey("The same path is used for a destination", func() {
+			first := s.SelectPath(dstA, aps)
+			So(first, ShouldNotBeNil)
+			for i := 0; i < 10; i++ {
+				SoMsg("path", s.SelectPath(dstA, aps).Key(), ShouldEqual, first.Key())
+			}
+			key, ok := s.Preferred(dstA)
+			SoMsg("preferred ok", ok, ShouldBeTrue)
+			SoMsg("preferred", key, ShouldEqual, first.Key())
+		})
+		Convey("Destinations keep separate preferred paths", func() {
+			s.Pin(dstA, p1.Key())
+			s.Pin(dstB, p2.Key())
+			s.SelectPath(dstA, aps)
+			s.SelectPath(dstB, aps)
+			s.Unpin(dstA)
+			s.Unpin(dstB)
+			for i := 0; i < 10; i++ {
+				SoMsg("A", s.SelectPath(dstA, aps).Key(), ShouldEqual, p1.Key())
+				SoMsg("B", s.SelectPath(dstB, aps).Key(), ShouldEqual, p2.Key())
+			}
+		})
+		Convey("A pinned path is used when available", func() {
+			s.Pin(dstA, p3.Key())
+			SoMsg("pinned", s.SelectPath(dstA, aps).Key(), ShouldEqual, p3.Key())
+			Convey("and failover happens when it disappears", func() {
+				reduced := spathmeta.AppPathSet{p1.Key(): p1, p2.Key(): p2}
+				selected := s.SelectPath(dstA, reduced)
+				So(selected, ShouldNotBeNil)
+				SoMsg("failover", selected.Key(), ShouldNotEqual, p3.Key())
+				SoMsg("back to pinned", s.SelectPath(dstA, aps).Key(), ShouldEqual, p3.Key())
+			})
+		})
+		Convey("Revoked paths are avoided", func() {
+			s.Pin(dstA, p2.Key())
+			s.Revoke(xtest.MustParseIA("1-ff00:0:110"), 102, time.Now().Add(time.Hour))
+			for i := 0; i < 10; i++ {
+				SoMsg("path", s.SelectPath(dstA, aps).Key(), ShouldNotEqual, p2.Key())
+			}
+			Convey("unless no other path is available", func() {
+				only := spathmeta.AppPathSet{p2.Key(): p2}
+				SoMsg("path", s.SelectPath(dstA, only).Key(), ShouldEqual, p2.Key())
+			})
+		})
+		Convey("Expired revocations are ignored", func() {
+			s.Pin(dstA, p2.Key())
+			s.Revoke(xtest.MustParseIA("1-ff00:0:110"), 102, time.Now().Add(-time.Second))
+			SoMsg("path", s.SelectPath(dstA, aps).Key(), ShouldEqual, p2.Key())
+		})
+		Convey("The filter restricts the candidate paths", func() {
+			pp, err := spathmeta.NewPathPredicate("1-ff00:0:110#101")
+			xtest.FailOnErr(t, err)
+			s.SetFilter(pktcls.NewActionFilterPaths("only1", pktcls.NewCondPathPredicate(pp)))
+			s.Pin(dstA, p3.Key())
+			for i := 0; i < 10; i++ {
+				SoMsg("path", s.SelectPath(dstA, aps).Key(), ShouldEqual, p1.Key())
+			}
+		})
+		Convey("The state of idle destinations is removed", func() {
+			s.idleTimeout = 10 * time.Millisecond
+			s.SelectPath(dstA, aps)
+			s.SelectPath(dstB, aps)
+			time.Sleep(20 * time.Millisecond)
+			s.SelectPath(dstB, aps)
+			_, ok := s.Preferred(dstA)
+			SoMsg("A removed", ok, ShouldBeFalse)
+			SoMsg("dests", len(s.dests), ShouldEqual, 1)
+			_, ok = s.Preferred(dstB)
+			SoMsg("B kept", ok, ShouldBeTrue)
+		})
+		Convey("Pinned paths of idle destinations are kept", func() {
+			s.idleTimeout = 10 * time.Millisecond
+			s.Pin(dstA, p3.Key())
+			s.SelectPath(dstA, aps)
+			time.Sleep(20 * time.Millisecond)
+			s.SelectPath(dstB, aps)
+			_, ok := s.Preferred(dstA)
+			SoMsg("preferred forgotten", ok, ShouldBeFalse)
+			SoMsg("pinned", s.SelectPath(dstA, aps).Key(), ShouldEqual, p3.Key())
+			Convey("until they are unpinned", func() {
+				s.Unpin(dstA)
+				time.Sleep(20 * time.Millisecond)
+				s.SelectPath(dstB, aps)
+				SoMsg("dests", len(s.dests), ShouldEqual, 1)
+			})
+		})
+		Convey("No path is selected from an empty set", func() {
+			SoMsg("path", s.SelectPath(dstA, spathmeta.AppPathSet{}), ShouldBeNil)
+		})
+	})
+}
@@ -34,11 +34,31 @@
 //
 // Multiple networking contexts can share the same SCIOND and/or dispatcher.
 //
-// Write calls never return SCMP errors directly. If a write call caused an
-// SCMP message to be received by the Conn, it can be inspected by calling
-// Read. In this case, the error value is non-nil and can be type asserted to
-// *OpError. Method SCMP() can be called on the error to extract the SCMP
-// header.
+// Networks can also operate without a dispatcher (see Network.BindUnderlay).
+// In this mode, the network opens its own UDP socket, sends packets directly
+// to the first-hop router and demultiplexes received packets itself.
+//
+// Unless the remote address contains a path, writes use the path chosen by the
+// PathSelector of the Conn. By default, each Conn keeps using the same path
+// for a destination until it becomes unavailable. Applications can pin paths
+// or restrict the candidate paths via DefaultPathSelector, or install a custom
+// selector via Conn.SetPathSelector or Network.SetPathSelector.
+//
+// If a write call caused an SCMP message to be received by the Conn, it can be
+// inspected by calling Read. In this case, the error value is non-nil and
+// implements interface Error. Method SCMP() can be called on the error to
+// extract the SCMP header. Usually, the error is an *OpError. If the SCMP
+// message reports that a remote host or port is unreachable, the error is an
+// *UnreachableError instead; it is also returned by the next write to that
+// remote.
+//
+// SCMP messages reporting an oversize packet update the path MTU cache of the
+// Conn (see Conn.PathMTU). Messages reporting an expired hop field or a bad
+// MAC cause the path to be marked as bad in the path resolver.
+//
+// Writes that would exceed the MTU advertised for the path, or the MTU in the
+// cache, fail with an *MTUError, which contains the largest payload that fits.
+// Conn.ProbeMTU discovers the MTU of a path with SCMP echo requests.
 //
 // Important: not draining SCMP errors via Read calls can cause the dispatcher
 // to block (see Issue #1278). To prevent this on a Conn object with only Write
@@ -52,6 +72,7 @@ import (
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/overlay"
 	"github.com/scionproto/scion/go/lib/pathmgr"
 	"github.com/scionproto/scion/go/lib/sciond"
 	"github.com/scionproto/scion/go/lib/sock/reliable"
@@ -95,7 +116,10 @@ type Network struct {
 	sciondPath     string
 	dispatcherPath string
 	pathResolver   *pathmgr.PR
+	pathSelector   PathSelector
 	localIA        addr.IA
+	// Shared UDP socket in dispatcher-less mode, nil otherwise
+	underlay *underlay
 }
 
 // NewNetworkBasic creates a minimal networking context without a path resolver.
@@ -128,15 +152,17 @@ func NewNetwork(ia addr.IA, sPath string, dPath string) (*Network, error) {
 }
 
 // DialSCION returns a SCION connection to raddr. Nil values for laddr are not
-// supported yet.  Parameter network must be "udp4". The returned connection's
-// Read and Write methods can be used to receive and send SCION packets.
+// supported yet.  Parameter network must be "udp4", "udp6" or "udp" (see
+// ListenSCIONWithBindSVC). The returned connection's Read and Write methods
+// can be used to receive and send SCION packets.
 func (n *Network) DialSCION(network string, laddr *Addr, raddr *Addr) (*Conn, error) {
 	return n.DialSCIONWithBindSVC(network, laddr, raddr, nil, addr.SvcNone)
 }
 
 // DialSCIONWithBindSVC returns a SCION connection to raddr. Nil values for laddr are not
-// supported yet.  Parameter network must be "udp4". The returned connection's
-// Read and Write methods can be used to receive and send SCION packets.
+// supported yet.  Parameter network must be "udp4", "udp6" or "udp" (see
+// ListenSCIONWithBindSVC). The returned connection's Read and Write methods
+// can be used to receive and send SCION packets.
 func (n *Network) DialSCIONWithBindSVC(network string, laddr, raddr, baddr *Addr,
 	svc addr.HostSVC) (*Conn, error) {
 	if raddr == nil {
@@ -157,7 +183,8 @@ func (n *Network) DialSCIONWithBindSVC(network string, laddr, raddr, baddr *Addr
 // ListenSCION registers laddr with the dispatcher. Nil values for laddr are
 // not supported yet. The returned connection's ReadFrom and WriteTo methods
 // can be used to receive and send SCION packets with per-packet addressing.
-// Parameter network must be "udp4".
+// Parameter network must be "udp4", "udp6" or "udp" (see
+// ListenSCIONWithBindSVC).
 func (n *Network) ListenSCION(network string, laddr *Addr) (*Conn, error) {
 	return n.ListenSCIONWithBindSVC(network, laddr, nil, addr.SvcNone)
 }
@@ -165,10 +192,15 @@ func (n *Network) ListenSCION(network string, laddr *Addr) (*Conn, error) {
 // ListenSCIONWithBindSVC registers laddr with the dispatcher. Nil values for laddr are
 // not supported yet. The returned connection's ReadFrom and WriteTo methods
 // can be used to receive and send SCION packets with per-packet addressing.
-// Parameter network must be "udp4".
+//
+// Parameter network must be "udp4", "udp6" or "udp". For "udp4" and "udp6",
+// the local and remote host addresses must be IPv4 or IPv6 addresses,
+// respectively. "udp" is dual-stack: the local address can be of either
+// family, and the connection can exchange packets with remote hosts of both
+// families.
 func (n *Network) ListenSCIONWithBindSVC(network string, laddr, baddr *Addr,
 	svc addr.HostSVC) (*Conn, error) {
-	if network != "udp4" {
+	if !isUDPNetwork(network) {
 		return nil, common.NewBasicError("Network not implemented", nil, "net", network)
 	}
 	// FIXME(scrye): If no local address is specified, we want to
@@ -177,23 +209,30 @@ func (n *Network) ListenSCIONWithBindSVC(network string, laddr, baddr *Addr,
 	// expose that address. Additionally, the dispatcher does not follow
 	// normal operating system semantics for binding on 0.0.0.0 (it
 	// considers it to be a fixed address instead of a wildcard). To avoid
-	// misuse, disallow binding to nil or 0.0.0.0 addresses for now.
+	// misuse, disallow binding to nil, 0.0.0.0 or :: addresses for now.
 	if laddr == nil {
 		return nil, common.NewBasicError("Nil laddr not supported", nil)
 	}
-	if laddr.Host.Type() != addr.HostTypeIPv4 {
+	if !hostAllowed(network, laddr.Host) {
 		return nil, common.NewBasicError("Supplied local address does not match network", nil,
-			"expected", addr.HostTypeIPv4, "actual", laddr.Host.Type())
+			"net", network, "actual", laddr.Host.Type())
 	}
-	if laddr.Host.IP().Equal(net.IPv4zero) {
-		return nil, common.NewBasicError("Binding to 0.0.0.0 not supported", nil)
+	if laddr.Host.IP().IsUnspecified() {
+		return nil, common.NewBasicError("Binding to unspecified address not supported", nil,
+			"addr", laddr.Host)
 	}
 	conn := &Conn{
 		net:        network,
 		scionNet:   n,
 		recvBuffer: make(common.RawBytes, BufSize),
 		sendBuffer: make(common.RawBytes, BufSize),
+		scmpState:  newSCMPState(),
 		svc:        svc}
+	if n.pathSelector != nil {
+		conn.selector = n.pathSelector
+	} else {
+		conn.selector = NewPathSelector(nil)
+	}
 
 	// Initialize local bind address
 	regAddr := &reliable.AppAddr{}
@@ -228,6 +267,17 @@ func (n *Network) ListenSCIONWithBindSVC(network string, laddr, baddr *Addr,
 		}
 	}
 
+	if n.underlay != nil {
+		mconn, port, err := n.underlay.register(regAddr, bindAddr, svc)
+		if err != nil {
+			return nil, common.NewBasicError("Unable to register with underlay", err)
+		}
+		log.Info("Registered with underlay", "ia", conn.scionNet.localIA, "host", regAddr.Addr,
+			"port", port)
+		conn.laddr.L4Port = port
+		conn.conn = mconn
+		return conn, nil
+	}
 	rconn, port, err := reliable.Register(conn.scionNet.dispatcherPath,
 		conn.laddr.IA, regAddr, bindAddr, svc)
 	if err != nil {
@@ -240,6 +290,55 @@ func (n *Network) ListenSCIONWithBindSVC(network string, laddr, baddr *Addr,
 	return conn, nil
 }
 
+// BindUnderlay switches n to dispatcher-less mode. Instead of registering
+// with the dispatcher, connections created after the call exchange packets
+// over a UDP socket bound to laddr, which is shared by all the connections of
+// n. Received packets are demultiplexed according to their SCION destination
+// address and port.
+//
+// Packets to hosts in the local AS are sent to the port of laddr on the
+// remote host, so all the end hosts of the AS are expected to use the same
+// underlay port (usually overlay.EndhostPort).
+func (n *Network) BindUnderlay(laddr *net.UDPAddr) error {
+	if n.underlay != nil {
+		return common.NewBasicError("Underlay already bound", nil,
+			"addr", n.underlay.LocalAddr())
+	}
+	u, err := newUnderlay(laddr)
+	if err != nil {
+		return err
+	}
+	n.underlay = u
+	return nil
+}
+
+// UnderlayAddr returns the address of the underlay socket, or nil if n is
+// not in dispatcher-less mode.
+func (n *Network) UnderlayAddr() *net.UDPAddr {
+	if n.underlay == nil {
+		return nil
+	}
+	return n.underlay.LocalAddr()
+}
+
+// Close closes the underlay socket in dispatcher-less mode. Connections using
+// the socket return io.EOF on subsequent reads. Close is a no-op for
+// networks using the dispatcher.
+func (n *Network) Close() error {
+	if n.underlay == nil {
+		return nil
+	}
+	return n.underlay.Close()
+}
+
+// endhostPort returns the overlay port of end hosts in the local AS.
+func (n *Network) endhostPort() uint16 {
+	if n.underlay != nil {
+		return uint16(n.underlay.LocalAddr().Port)
+	}
+	return overlay.EndhostPort
+}
+
 // PathResolver returns the pathmgr.PR that the network is using.
 func (n *Network) PathResolver() *pathmgr.PR {
 	return n.pathResolver
@@ -254,6 +353,20 @@ func (n *Network) SetPathResolver(resolver *pathmgr.PR) {
 	n.pathResolver = resolver
 }
 
+// PathSelector returns the PathSelector shared by the connections of the
+// network, or nil if each connection uses its own DefaultPathSelector.
+func (n *Network) PathSelector() PathSelector {
+	return n.pathSelector
+}
+
+// SetPathSelector sets the PathSelector used by connections created after the
+// call. Connections created before keep their current selector (see
+// Conn.SetPathSelector). If selector is nil, each new connection gets its own
+// DefaultPathSelector.
+func (n *Network) SetPathSelector(selector PathSelector) {
+	n.pathSelector = selector
+}
+
 // Sciond returns the sciond.Service that the network is using.
 func (n *Network) Sciond() sciond.Service {
 	return n.sciond
@@ -263,3 +376,27 @@ func (n *Network) Sciond() sciond.Service {
 func (n *Network) IA() addr.IA {
 	return n.localIA
 }
+
+// isUDPNetwork returns true if network is one of the UDP networks supported
+// by snet.
+func isUDPNetwork(network string) bool {
+	switch network {
+	case "udp4", "udp6", "udp":
+		return true
+	}
+	return false
+}
+
+// hostAllowed returns true if host is a valid IP host address for network.
+func hostAllowed(network string, host addr.HostAddr) bool {
+	if host == nil {
+		return false
+	}
+	switch host.Type() {
+	case addr.HostTypeIPv4:
+		return network == "udp4" || network == "udp"
+	case addr.HostTypeIPv6:
+		return network == "udp6" || network == "udp"
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+const (
+	// Length of the nonces exchanged during the authentication handshake
+	authNonceLen = 32
+	// Labels that separate the signatures of clients and servers
+	authClientLabel = "squic client"
+	authServerLabel = "squic server"
+)
+
+// Identity is the SCION identity of the local endpoint, used to authenticate
+// it to its peers.
+type Identity struct {
+	// Chain is the certificate chain of the local AS.
+	Chain *cert.Chain
+	// SignKey is the private key matching the subject signing key of the leaf
+	// certificate of Chain.
+	SignKey common.RawBytes
+}
+
+// TRCProvider returns verified TRCs, which are used to verify the certificate
+// chains of peers. It is implemented by trust.Store.
+type TRCProvider interface {
+	GetValidTRC(ctx context.Context, isd addr.ISD, trail ...addr.ISD) (*trc.TRC, error)
+}
+
+// authHello is sent by the client to start the authentication handshake.
+type authHello struct {
+	Chain *cert.Chain
+	Nonce common.RawBytes
+}
+
+// authReply is the answer of the server to authHello. The signature covers
+// both nonces and the TLS certificate of the server.
+type authReply struct {
+	Chain     *cert.Chain
+	Nonce     common.RawBytes
+	Signature common.RawBytes
+}
+
+// authFinish completes the handshake with the signature of the client.
+type authFinish struct {
+	Signature common.RawBytes
+}
+
+// authenticator runs the handshake that binds a QUIC session to the SCION
+// identities of both endpoints. It is run on the first stream of the session,
+// after the TLS handshake. The signatures of both endpoints include the hash
+// of the TLS certificate of the server, so that the handshake cannot be
+// relayed to another server.
+type authenticator struct {
+	id   *Identity
+	trcs TRCProvider
+}
+
+// clientHandshake authenticates the server on rw, which must belong to the
+// AS remote, and returns the verified ISD-AS of the server. srvCert is the
+// DER encoded TLS certificate presented by the server.
+func (a *authenticator) clientHandshake(ctx context.Context, rw io.ReadWriter,
+	remote addr.IA, srvCert []byte) (addr.IA, error) {
+
+	enc, dec := json.NewEncoder(rw), json.NewDecoder(rw)
+	nonce, err := newNonce()
+	if err != nil {
+		return addr.IA{}, err
+	}
+	if err := enc.Encode(&authHello{Chain: a.id.Chain, Nonce: nonce}); err != nil {
+		return addr.IA{}, common.NewBasicError("squic: Unable to send auth hello", err)
+	}
+	reply := &authReply{}
+	if err := dec.Decode(reply); err != nil {
+		return addr.IA{}, common.NewBasicError("squic: Unable to read auth reply", err)
+	}
+	sigInput := authSigInput(authServerLabel, nonce, reply.Nonce, srvCert)
+	ia, err := a.verify(ctx, reply.Chain, remote, sigInput, reply.Signature)
+	if err != nil {
+		return addr.IA{}, common.NewBasicError("squic: Unable to verify server", err)
+	}
+	sig, err := a.sign(authSigInput(authClientLabel, nonce, reply.Nonce, srvCert))
+	if err != nil {
+		return addr.IA{}, err
+	}
+	if err := enc.Encode(&authFinish{Signature: sig}); err != nil {
+		return addr.IA{}, common.NewBasicError("squic: Unable to send auth finish", err)
+	}
+	return ia, nil
+}
+
+// serverHandshake authenticates the client on rw, which must belong to the
+// AS remote, and returns the verified ISD-AS of the client. srvCert is the
+// DER encoded TLS certificate of the server.
+func (a *authenticator) serverHandshake(ctx context.Context, rw io.ReadWriter,
+	remote addr.IA, srvCert []byte) (addr.IA, error) {
+
+	enc, dec := json.NewEncoder(rw), json.NewDecoder(rw)
+	hello := &authHello{}
+	if err := dec.Decode(hello); err != nil {
+		return addr.IA{}, common.NewBasicError("squic: Unable to read auth hello", err)
+	}
+	if len(hello.Nonce) != authNonceLen {
+		return addr.IA{}, common.NewBasicError("squic: Invalid nonce length", nil,
+			"expected", authNonceLen, "actual", len(hello.Nonce))
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return addr.IA{}, err
+	}
+	sig, err := a.sign(authSigInput(authServerLabel, hello.Nonce, nonce, srvCert))
+	if err != nil {
+		return addr.IA{}, err
+	}
+	reply := &authReply{Chain: a.id.Chain, Nonce: nonce, Signature: sig}
+	if err := enc.Encode(reply); err != nil {
+		return addr.IA{}, common.NewBasicError("squic: Unable to send auth reply", err)
+	}
+	finish := &authFinish{}
+	if err := dec.Decode(finish); err != nil {
+		return addr.IA{}, common.NewBasicError("squic: Unable to read auth finish", err)
+	}
+	sigInput := authSigInput(authClientLabel, hello.Nonce, nonce, srvCert)
+	ia, err := a.verify(ctx, hello.Chain, remote, sigInput, finish.Signature)
+	if err != nil {
+		return addr.IA{}, common.NewBasicError("squic: Unable to verify client", err)
+	}
+	return ia, nil
+}
+
+// verify checks that chain is valid for the AS remote according to the TRC
+// of its ISD, and that sig is the signature of sigInput by the leaf
+// certificate of chain.
+func (a *authenticator) verify(ctx context.Context, chain *cert.Chain, remote addr.IA,
+	sigInput, sig common.RawBytes) (addr.IA, error) {
+
+	if chain == nil || chain.Leaf == nil || chain.Issuer == nil {
+		return addr.IA{}, common.NewBasicError("Incomplete certificate chain", nil)
+	}
+	ia := chain.Leaf.Subject
+	if !ia.Eq(remote) {
+		return addr.IA{}, common.NewBasicError("Certificate subject does not match remote",
+			nil, "subject", ia, "remote", remote)
+	}
+	t, err := a.trcs.GetValidTRC(ctx, ia.I)
+	if err != nil {
+		return addr.IA{}, common.NewBasicError("Unable to get TRC", err, "isd", ia.I)
+	}
+	if err := chain.Verify(ia, t); err != nil {
+		return addr.IA{}, common.NewBasicError("Invalid certificate chain", err, "ia", ia)
+	}
+	if err := crypto.Verify(sigInput, sig, chain.Leaf.SubjectSignKey,
+		chain.Leaf.SignAlgorithm); err != nil {
+		return addr.IA{}, common.NewBasicError("Invalid handshake signature", err, "ia", ia)
+	}
+	return ia, nil
+}
+
+func (a *authenticator) sign(sigInput common.RawBytes) (common.RawBytes, error) {
+	sig, err := crypto.Sign(sigInput, a.id.SignKey, a.id.Chain.Leaf.SignAlgorithm)
+	if err != nil {
+		return nil, common.NewBasicError("squic: Unable to sign handshake", err)
+	}
+	return sig, nil
+}
+
+// authSigInput returns the input of the handshake signatures.
+func authSigInput(label string, cliNonce, srvNonce common.RawBytes,
+	srvCert []byte) common.RawBytes {
+
+	certHash := sha256.Sum256(srvCert)
+	b := make(common.RawBytes, 0, len(label)+len(cliNonce)+len(srvNonce)+len(certHash))
+	b = append(b, label...)
+	b = append(b, cliNonce...)
+	b = append(b, srvNonce...)
+	return append(b, certHash[:]...)
+}
+
+func newNonce() (common.RawBytes, error) {
+	nonce := make(common.RawBytes, authNonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, common.NewBasicError("squic: Unable to generate nonce", err)
+	}
+	return nonce, nil
+}
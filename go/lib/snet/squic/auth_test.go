@@ -0,0 +1,121 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/lib/xtest/testpki"
+)
+
+var (
+	clientIA = xtest.MustParseIA("1-ff00:0:111")
+	serverIA = xtest.MustParseIA("1-ff00:0:112")
+	srvCert  = []byte("server TLS certificate")
+)
+
+// newIdentity returns an identity for ia, with a chain issued by the core AS
+// of pki.
+func newIdentity(t *testing.T, pki *testpki.PKI, ia addr.IA) *Identity {
+	t.Helper()
+	chain, key := pki.Issue(t, ia)
+	return &Identity{Chain: chain, SignKey: key}
+}
+
+type handshakeResult struct {
+	ia  addr.IA
+	err error
+}
+
+// runHandshake runs the client and server handshakes over a pipe. cliRemote
+// and srvRemote are the ISD-ASes each side expects from its peer, cliCert and
+// srvCert the TLS certificates each side sees.
+func runHandshake(cli, srv *authenticator, cliRemote, srvRemote addr.IA,
+	cliCert, srvCert []byte) (handshakeResult, handshakeResult) {
+
+	cliConn, srvConn := net.Pipe()
+	ctx := context.Background()
+	srvDone := make(chan handshakeResult)
+	go func() {
+		ia, err := srv.serverHandshake(ctx, srvConn, srvRemote, srvCert)
+		srvConn.Close()
+		srvDone <- handshakeResult{ia: ia, err: err}
+	}()
+	ia, err := cli.clientHandshake(ctx, cliConn, cliRemote, cliCert)
+	cliConn.Close()
+	return handshakeResult{ia: ia, err: err}, <-srvDone
+}
+
+func TestAuthHandshake(t *testing.T) {
+	Convey("Given a client and a server with chains of the same ISD", t, func() {
+		pki := testpki.New(t)
+		trcs := pki.TRCs()
+		cli := &authenticator{id: newIdentity(t, pki, clientIA), trcs: trcs}
+		srv := &authenticator{id: newIdentity(t, pki, serverIA), trcs: trcs}
+
+		Convey("Both sides learn the verified ISD-AS of the peer", func() {
+			cliRes, srvRes := runHandshake(cli, srv, serverIA, clientIA, srvCert, srvCert)
+			So(cliRes.err, ShouldBeNil)
+			So(srvRes.err, ShouldBeNil)
+			SoMsg("server IA", cliRes.ia, ShouldResemble, serverIA)
+			SoMsg("client IA", srvRes.ia, ShouldResemble, clientIA)
+		})
+		Convey("The client rejects a server of another AS", func() {
+			cliRes, srvRes := runHandshake(cli, srv, testpki.CoreIA, clientIA, srvCert, srvCert)
+			SoMsg("client", cliRes.err, ShouldNotBeNil)
+			SoMsg("server", srvRes.err, ShouldNotBeNil)
+		})
+		Convey("The server rejects a client of another AS", func() {
+			cliRes, srvRes := runHandshake(cli, srv, serverIA, testpki.CoreIA, srvCert, srvCert)
+			SoMsg("client", cliRes.err, ShouldBeNil)
+			SoMsg("server", srvRes.err, ShouldNotBeNil)
+		})
+		Convey("A handshake relayed to another TLS server fails", func() {
+			cliRes, srvRes := runHandshake(cli, srv, serverIA, clientIA,
+				[]byte("other TLS certificate"), srvCert)
+			SoMsg("client", cliRes.err, ShouldNotBeNil)
+			SoMsg("server", srvRes.err, ShouldNotBeNil)
+		})
+		Convey("Chains that do not verify against the TRC are rejected", func() {
+			other := testpki.New(t)
+			srv := &authenticator{id: newIdentity(t, other, serverIA), trcs: trcs}
+			cliRes, _ := runHandshake(cli, srv, serverIA, clientIA, srvCert, srvCert)
+			SoMsg("client", cliRes.err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestListenVerification(t *testing.T) {
+	Convey("Listening with verification fails without a server certificate", t, func() {
+		pki := testpki.New(t)
+		oldAuth, oldCerts := auth, srvTlsCfg.Certificates
+		Reset(func() { auth, srvTlsCfg.Certificates = oldAuth, oldCerts })
+		xtest.FailOnErr(t, InitVerification(newIdentity(t, pki, serverIA), pki.TRCs()))
+		for _, certs := range [][]tls.Certificate{nil, {{}}} {
+			srvTlsCfg.Certificates = certs
+			ln, err := ListenSCION(nil, &snet.Addr{IA: serverIA})
+			SoMsg("ln", ln, ShouldBeNil)
+			SoMsg("err", err, ShouldNotBeNil)
+		}
+	})
+}
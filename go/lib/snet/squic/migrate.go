@@ -0,0 +1,258 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squic
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+)
+
+const (
+	// DefaultProbeTimeout is the time to wait for the reply to a path probe.
+	DefaultProbeTimeout = time.Second
+)
+
+// MigrationConfig configures how dialed sessions move between paths.
+type MigrationConfig struct {
+	// Disabled turns migration off. Sessions then use the paths chosen by
+	// the PathSelector of the snet connection.
+	Disabled bool
+	// ProbeInterval is the interval at which all paths to the server are
+	// probed with SCMP echo requests. Paths that do not answer are avoided
+	// when migrating. If 0, paths are not probed.
+	ProbeInterval time.Duration
+	// ProbeTimeout is the time to wait for the reply to a probe.
+	ProbeTimeout time.Duration
+}
+
+var migrationCfg = &MigrationConfig{}
+
+// InitMigration configures the migration of sessions dialed afterwards.
+//
+// By default, a dialed session to a remote AS sends all its packets on a
+// single path. When the path disappears from the paths watched via the path
+// resolver of the network (e.g., because an interface on it was revoked), the
+// session migrates to another path. As the server replies on the path of the
+// last packet it received, migration is transparent to both endpoints.
+func InitMigration(cfg *MigrationConfig) {
+	c := *cfg
+	if c.ProbeTimeout == 0 {
+		c.ProbeTimeout = DefaultProbeTimeout
+	}
+	migrationCfg = &c
+}
+
+var _ net.PacketConn = (*pathConn)(nil)
+
+// pathConn is the connection used by dialed sessions that migrate across
+// paths. It sends all packets to the server on the current path of the
+// tracker.
+type pathConn struct {
+	*snet.Conn
+	raddr    *snet.Addr
+	resolver *pathmgr.PR
+	tracker  *pathTracker
+	// Closed when the connection is closed, to stop probing
+	stopChan  chan struct{}
+	closeOnce sync.Once
+}
+
+// newPathConn watches the paths from the local AS of conn to raddr, and
+// starts probing them if configured.
+func newPathConn(conn *snet.Conn, raddr *snet.Addr, resolver *pathmgr.PR,
+	cfg *MigrationConfig) (*pathConn, error) {
+
+	sp, err := resolver.Watch(conn.LocalSnetAddr().IA, raddr.IA)
+	if err != nil {
+		return nil, common.NewBasicError("squic: Unable to watch paths", err,
+			"src", conn.LocalSnetAddr().IA, "dst", raddr.IA)
+	}
+	c := &pathConn{
+		Conn:     conn,
+		raddr:    raddr.Copy(),
+		resolver: resolver,
+		tracker:  newPathTracker(sp),
+		stopChan: make(chan struct{}),
+	}
+	if cfg.ProbeInterval > 0 {
+		go func() {
+			defer log.LogPanicAndExit()
+			c.probe(cfg.ProbeInterval, cfg.ProbeTimeout)
+		}()
+	}
+	return c, nil
+}
+
+func (c *pathConn) WriteTo(b []byte, a net.Addr) (int, error) {
+	ap := c.tracker.path()
+	if ap == nil {
+		// No path available; let snet report the error.
+		return c.Conn.WriteTo(b, c.raddr)
+	}
+	raddr, err := addrWithPath(c.raddr, ap)
+	if err != nil {
+		return 0, err
+	}
+	return c.Conn.WriteTo(b, raddr)
+}
+
+// probe pings the server on all paths every interval, until the connection
+// is closed.
+func (c *pathConn) probe(interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+		}
+		unresponsive := make(map[spathmeta.PathKey]struct{})
+		for key, ap := range c.tracker.paths() {
+			raddr, err := addrWithPath(c.raddr, ap)
+			if err == nil {
+				_, err = c.Conn.Ping(raddr, timeout)
+			}
+			if err != nil {
+				log.Debug("squic: Path probe failed", "raddr", c.raddr,
+					"path", ap.Entry.Path, "err", err)
+				unresponsive[key] = struct{}{}
+			}
+		}
+		c.tracker.setUnresponsive(unresponsive)
+	}
+}
+
+func (c *pathConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stopChan)
+		if uerr := c.resolver.Unwatch(c.Conn.LocalSnetAddr().IA, c.raddr.IA); uerr != nil {
+			log.Warn("squic: Unable to unwatch paths", "err", uerr)
+		}
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+// addrWithPath returns a copy of raddr that uses the forwarding path and next
+// hop of ap.
+func addrWithPath(raddr *snet.Addr, ap *spathmeta.AppPath) (*snet.Addr, error) {
+	a := raddr.Copy()
+	a.Path = spath.New(ap.Entry.Path.FwdPath)
+	if err := a.Path.InitOffsets(); err != nil {
+		return nil, common.NewBasicError("squic: Unable to initialize path", err)
+	}
+	a.NextHopHost = ap.Entry.HostInfo.Host()
+	a.NextHopPort = ap.Entry.HostInfo.Port
+	return a, nil
+}
+
+// pathTracker keeps track of the path currently used by a session, and
+// switches to another path when the current one disappears from the watched
+// paths or does not answer probes.
+type pathTracker struct {
+	sp    *pathmgr.SyncPaths
+	mutex sync.Mutex
+	// Path in use, nil if no path has been chosen yet
+	current *spathmeta.AppPath
+	// Modification time of the path set when current was checked last
+	modified time.Time
+	// Paths that did not answer the last probes
+	unresponsive map[spathmeta.PathKey]struct{}
+}
+
+func newPathTracker(sp *pathmgr.SyncPaths) *pathTracker {
+	return &pathTracker{
+		sp:           sp,
+		unresponsive: make(map[spathmeta.PathKey]struct{}),
+	}
+}
+
+// path returns the path to use, or nil if no path is available.
+func (t *pathTracker) path() *spathmeta.AppPath {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	data := t.sp.Load()
+	if t.current != nil && data.ModifyTime.Equal(t.modified) {
+		return t.current
+	}
+	t.modified = data.ModifyTime
+	if t.current != nil {
+		if _, ok := data.APS[t.current.Key()]; ok {
+			return t.current
+		}
+	}
+	t.migrate(data.APS)
+	return t.current
+}
+
+// paths returns the currently watched paths.
+func (t *pathTracker) paths() spathmeta.AppPathSet {
+	return t.sp.Load().APS
+}
+
+// setUnresponsive records the paths that did not answer the last probes. If
+// the current path is one of them, another path is chosen.
+func (t *pathTracker) setUnresponsive(keys map[spathmeta.PathKey]struct{}) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.unresponsive = keys
+	if t.current == nil {
+		return
+	}
+	if _, ok := keys[t.current.Key()]; ok {
+		t.migrate(t.sp.Load().APS)
+	}
+}
+
+// migrate (internal) chooses a new current path from aps. Responsive paths
+// are preferred; the order of path keys breaks ties, so that the choice is
+// deterministic.
+func (t *pathTracker) migrate(aps spathmeta.AppPathSet) {
+	keys := make([]string, 0, len(aps))
+	for key := range aps {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+	old := t.current
+	t.current = nil
+	for _, key := range keys {
+		if _, ok := t.unresponsive[spathmeta.PathKey(key)]; !ok {
+			t.current = aps[spathmeta.PathKey(key)]
+			break
+		}
+	}
+	if t.current == nil && len(keys) > 0 {
+		// All paths are unresponsive; try them anyway.
+		t.current = aps[spathmeta.PathKey(keys[0])]
+	}
+	switch {
+	case t.current == nil:
+		log.Warn("squic: No path available for session")
+	case old != nil && old.Key() != t.current.Key():
+		log.Info("squic: Migrating session to new path",
+			"old", old.Entry.Path, "new", t.current.Entry.Path)
+	}
+}
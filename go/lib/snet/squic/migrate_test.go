@@ -0,0 +1,389 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squic
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/lib/xtest/graph"
+)
+
+func TestPathTracker(t *testing.T) {
+	Convey("Given a session with two paths to the server", t, func() {
+		g := graph.NewDefaultGraph()
+		// Add a second link between 1-ff00:0:133 and 1-ff00:0:132
+		g.AddLink("1-ff00:0:133", 101902, "1-ff00:0:132", 191002, false)
+		pr, err := pathmgr.New(
+			sciond.NewMockService(g),
+			&pathmgr.Timers{
+				NormalRefire: 50 * time.Millisecond,
+				ErrorRefire:  50 * time.Millisecond,
+				MaxAge:       50 * time.Millisecond,
+			},
+			log.Root(),
+		)
+		xtest.FailOnErr(t, err)
+		src := xtest.MustParseIA("1-ff00:0:133")
+		dst := xtest.MustParseIA("1-ff00:0:131")
+		sp, err := pr.Watch(src, dst)
+		xtest.FailOnErr(t, err)
+		So(len(sp.Load().APS), ShouldEqual, 2)
+		tracker := newPathTracker(sp)
+		first := tracker.path()
+		So(first, ShouldNotBeNil)
+		SoMsg("stable", tracker.path(), ShouldEqual, first)
+		Reset(func() { pr.Unwatch(src, dst) })
+
+		Convey("The session migrates when a link on its path goes down", func() {
+			down := firstIFID(first)
+			g.RemoveLink(down)
+			<-time.After(300 * time.Millisecond)
+			next := tracker.path()
+			So(next, ShouldNotBeNil)
+			SoMsg("new path", next.Key(), ShouldNotEqual, first.Key())
+			SoMsg("link", firstIFID(next), ShouldNotEqual, down)
+		})
+		Convey("The session migrates when its path stops answering probes", func() {
+			tracker.setUnresponsive(map[spathmeta.PathKey]struct{}{first.Key(): {}})
+			next := tracker.path()
+			So(next, ShouldNotBeNil)
+			SoMsg("new path", next.Key(), ShouldNotEqual, first.Key())
+			Convey("but uses unresponsive paths if no other is left", func() {
+				all := make(map[spathmeta.PathKey]struct{})
+				for key := range sp.Load().APS {
+					all[key] = struct{}{}
+				}
+				tracker.setUnresponsive(all)
+				SoMsg("path", tracker.path(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestMigration(t *testing.T) {
+	Convey("Given a client and a server connected via two paths", t, func() {
+		g := graph.NewDefaultGraph()
+		g.AddLink("1-ff00:0:133", 101902, "1-ff00:0:132", 191002, false)
+		cliIA := xtest.MustParseIA("1-ff00:0:133")
+		srvIA := xtest.MustParseIA("1-ff00:0:131")
+		localhost := addr.HostFromIP(net.IPv4(127, 0, 0, 1))
+
+		srvNet := snet.NewNetworkBasic(srvIA, "", "")
+		xtest.FailOnErr(t, srvNet.BindUnderlay(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}))
+		Reset(func() { srvNet.Close() })
+		sd := newRelaySciond(g, srvNet.UnderlayAddr())
+		Reset(sd.Close)
+		pr, err := pathmgr.New(
+			sd,
+			&pathmgr.Timers{
+				NormalRefire: 50 * time.Millisecond,
+				ErrorRefire:  50 * time.Millisecond,
+				MaxAge:       50 * time.Millisecond,
+			},
+			log.Root(),
+		)
+		xtest.FailOnErr(t, err)
+		cliNet := snet.NewNetworkBasic(cliIA, "", "")
+		xtest.FailOnErr(t, cliNet.BindUnderlay(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}))
+		Reset(func() { cliNet.Close() })
+		cliNet.SetPathResolver(pr)
+
+		srvTlsCfg.Certificates = []tls.Certificate{newTestTLSCert(t)}
+		InitMigration(&MigrationConfig{})
+		srvAddr := &snet.Addr{IA: srvIA, Host: localhost, L4Port: 40001}
+		ln, err := ListenSCION(srvNet, srvAddr)
+		xtest.FailOnErr(t, err)
+		Reset(func() { ln.Close() })
+		received := make(chan uint64, 1)
+		go func() {
+			received <- serveCount(ln)
+		}()
+
+		Convey("A transfer completes when a link on its path goes down", func() {
+			const total, chunk = 1 << 20, 4096
+			sess, err := DialSCION(cliNet, &snet.Addr{IA: cliIA, Host: localhost}, srvAddr)
+			So(err, ShouldBeNil)
+			defer sess.Close(nil)
+			stream, err := sess.OpenStreamSync()
+			So(err, ShouldBeNil)
+			stream.SetDeadline(time.Now().Add(10 * time.Second))
+			b := make([]byte, chunk)
+			var down *testRelay
+			for sent := 0; sent < total; sent += chunk {
+				if sent == total/2 {
+					down = sd.activeRelay()
+					So(down, ShouldNotBeNil)
+					down.setDown()
+					g.RemoveLink(down.ifid)
+				}
+				_, err := stream.Write(b)
+				So(err, ShouldBeNil)
+			}
+			So(stream.Close(), ShouldBeNil)
+			var reply [8]byte
+			_, err = io.ReadFull(stream, reply[:])
+			So(err, ShouldBeNil)
+			SoMsg("reply", binary.BigEndian.Uint64(reply[:]), ShouldEqual, total)
+			SoMsg("received", <-received, ShouldEqual, total)
+			SoMsg("migrated", sd.activeRelay(), ShouldNotEqual, down)
+		})
+	})
+}
+
+// serveCount accepts a single session and stream on ln, reads the stream
+// until EOF, and replies with the number of bytes read.
+func serveCount(ln quic.Listener) uint64 {
+	sess, err := ln.Accept()
+	if err != nil {
+		return 0
+	}
+	stream, err := sess.AcceptStream()
+	if err != nil {
+		return 0
+	}
+	n, err := io.Copy(ioutil.Discard, stream)
+	if err != nil {
+		return 0
+	}
+	var reply [8]byte
+	binary.BigEndian.PutUint64(reply[:], uint64(n))
+	stream.Write(reply[:])
+	stream.Close()
+	return uint64(n)
+}
+
+// relaySciond is a mock SCIOND that returns usable forwarding paths. The
+// packets sent on a path go through a relay for the first interface on the
+// path, which forwards them to the server (and the replies to the client).
+type relaySciond struct {
+	*sciond.MockService
+	server *net.UDPAddr
+	mutex  sync.Mutex
+	relays map[common.IFIDType]*testRelay
+}
+
+func newRelaySciond(g *graph.Graph, server *net.UDPAddr) *relaySciond {
+	return &relaySciond{
+		MockService: sciond.NewMockService(g),
+		server:      server,
+		relays:      make(map[common.IFIDType]*testRelay),
+	}
+}
+
+func (s *relaySciond) Connect() (sciond.Connector, error) {
+	conn, err := s.MockService.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &relayConn{Connector: conn, s: s}, nil
+}
+
+func (s *relaySciond) ConnectTimeout(timeout time.Duration) (sciond.Connector, error) {
+	return s.Connect()
+}
+
+// relay returns the relay for interface ifid, starting it if necessary.
+func (s *relaySciond) relay(ifid common.IFIDType) (*testRelay, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if r, ok := s.relays[ifid]; ok {
+		return r, nil
+	}
+	r, err := newTestRelay(ifid, s.server)
+	if err != nil {
+		return nil, err
+	}
+	s.relays[ifid] = r
+	return r, nil
+}
+
+// activeRelay returns the relay that forwarded a packet most recently.
+func (s *relaySciond) activeRelay() *testRelay {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var active *testRelay
+	var last time.Time
+	for _, r := range s.relays {
+		if t := r.lastForward(); t.After(last) {
+			active, last = r, t
+		}
+	}
+	return active
+}
+
+func (s *relaySciond) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, r := range s.relays {
+		r.conn.Close()
+	}
+}
+
+type relayConn struct {
+	sciond.Connector
+	s *relaySciond
+}
+
+func (c *relayConn) Paths(dst, src addr.IA, max uint16,
+	f sciond.PathReqFlags) (*sciond.PathReply, error) {
+
+	reply, err := c.Connector.Paths(dst, src, max, f)
+	if err != nil {
+		return nil, err
+	}
+	for i := range reply.Entries {
+		entry := &reply.Entries[i]
+		r, err := c.s.relay(entry.Path.Interfaces[0].IfID)
+		if err != nil {
+			return nil, err
+		}
+		entry.Path.FwdPath = newTestFwdPath(entry.Path.Interfaces)
+		entry.HostInfo = *sciond.HostInfoFromHostAddr(
+			addr.HostFromIP(r.conn.LocalAddr().(*net.UDPAddr).IP),
+			uint16(r.conn.LocalAddr().(*net.UDPAddr).Port))
+	}
+	return reply, nil
+}
+
+// newTestFwdPath returns a single segment forwarding path with one hop field
+// per AS on the path described by ifaces.
+func newTestFwdPath(ifaces []sciond.PathInterface) common.RawBytes {
+	hops := len(ifaces)/2 + 1
+	raw := make(common.RawBytes, spath.InfoFieldLength+hops*spath.HopFieldLength)
+	info := &spath.InfoField{
+		ConsDir: true,
+		ISD:     1,
+		Hops:    uint8(hops),
+		TsInt:   uint32(time.Now().Unix()),
+	}
+	info.Write(raw)
+	for i := 0; i < hops; i++ {
+		var in, out common.IFIDType
+		if i > 0 {
+			in = ifaces[2*i-1].IfID
+		}
+		if i < hops-1 {
+			out = ifaces[2*i].IfID
+		}
+		off := spath.InfoFieldLength + i*spath.HopFieldLength
+		spath.NewHopField(raw[off:off+spath.HopFieldLength], in, out)
+	}
+	return raw
+}
+
+// testRelay stands in for the border router of an interface. It forwards
+// packets from the client to the server and back, until it is set down.
+type testRelay struct {
+	ifid   common.IFIDType
+	conn   *net.UDPConn
+	server *net.UDPAddr
+	mutex  sync.Mutex
+	client *net.UDPAddr
+	down   bool
+	last   time.Time
+}
+
+func newTestRelay(ifid common.IFIDType, server *net.UDPAddr) (*testRelay, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	r := &testRelay{ifid: ifid, conn: conn, server: server}
+	go r.run()
+	return r, nil
+}
+
+func (r *testRelay) run() {
+	b := make([]byte, snet.BufSize)
+	for {
+		n, src, err := r.conn.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		r.mutex.Lock()
+		if r.down {
+			r.mutex.Unlock()
+			continue
+		}
+		dst := r.server
+		if src.String() == r.server.String() {
+			dst = r.client
+		} else {
+			r.client = src
+		}
+		r.last = time.Now()
+		r.mutex.Unlock()
+		if dst != nil {
+			r.conn.WriteToUDP(b[:n], dst)
+		}
+	}
+}
+
+// setDown makes the relay drop all packets.
+func (r *testRelay) setDown() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.down = true
+}
+
+func (r *testRelay) lastForward() time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.last
+}
+
+// newTestTLSCert returns a self-signed certificate for the QUIC server.
+func newTestTLSCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	xtest.FailOnErr(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "squic test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	xtest.FailOnErr(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func firstIFID(ap *spathmeta.AppPath) common.IFIDType {
+	return ap.Entry.Path.Interfaces[0].IfID
+}
@@ -16,24 +16,37 @@
 package squic
 
 import (
+	"context"
 	"crypto/tls"
+	"net"
+	"time"
 
 	"github.com/lucas-clemente/quic-go"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
 	"github.com/scionproto/scion/go/lib/snet"
 )
 
 const (
 	defKeyPath = "gen-certs/tls.key"
 	defPemPath = "gen-certs/tls.pem"
+	// AuthTimeout is the time allowed for the SCION authentication handshake
+	// of a session.
+	AuthTimeout = 5 * time.Second
 )
 
 var (
-	// Don't verify the server's cert, as we are not using the TLS PKI.
+	// Don't verify the server's cert, as we are not using the TLS PKI. If
+	// verification is enabled, the cert is bound to the SCION identity of the
+	// server by the authentication handshake instead.
 	cliTlsCfg = &tls.Config{InsecureSkipVerify: true}
 	srvTlsCfg = &tls.Config{}
+	// Authenticates peers with their SCION identity, if not nil
+	auth *authenticator
+	// Error used to close sessions whose handshake exceeds AuthTimeout
+	errAuthTimeout = common.NewBasicError("squic: Authentication handshake timed out", nil)
 )
 
 func Init(keyPath, pemPath string) error {
@@ -51,18 +64,91 @@ func Init(keyPath, pemPath string) error {
 	return nil
 }
 
+// InitVerification enables the authentication of peers with their SCION
+// identity. After the TLS handshake, both endpoints of a session prove that
+// they hold the signing key of a certificate chain for the ISD-AS of their
+// SCION address. The chains are verified against the TRCs returned by trcs.
+// The local endpoint is authenticated with id. Sessions whose peer cannot be
+// authenticated are closed.
+//
+// If verification is enabled, dialed and accepted sessions are of type
+// *Session, which exposes the verified ISD-AS of the peer.
+func InitVerification(id *Identity, trcs TRCProvider) error {
+	if id == nil || id.Chain == nil || id.Chain.Leaf == nil {
+		return common.NewBasicError("squic: Identity without certificate chain", nil)
+	}
+	if len(id.SignKey) == 0 {
+		return common.NewBasicError("squic: Identity without signing key", nil)
+	}
+	if trcs == nil {
+		return common.NewBasicError("squic: No TRC provider", nil)
+	}
+	auth = &authenticator{id: id, trcs: trcs}
+	return nil
+}
+
+// Session is a QUIC session whose peer has been authenticated with its SCION
+// identity.
+type Session struct {
+	quic.Session
+	remoteIA addr.IA
+}
+
+// RemoteIA returns the verified ISD-AS of the peer.
+func (s *Session) RemoteIA() addr.IA {
+	return s.remoteIA
+}
+
 func DialSCION(network *snet.Network, laddr, raddr *snet.Addr) (quic.Session, error) {
 	return DialSCIONWithBindSVC(network, laddr, raddr, nil, addr.SvcNone)
 }
 
+// DialSCIONWithBindSVC dials raddr. Unless disabled via InitMigration, the
+// session migrates to another path when its path becomes unavailable.
 func DialSCIONWithBindSVC(network *snet.Network, laddr, raddr, baddr *snet.Addr,
-	svc addr.HostSVC) (quic.Session, error) {
+	svc addr.HostSVC) (sess quic.Session, err error) {
+	if network == nil {
+		network = snet.DefNetwork
+	}
 	sconn, err := sListen(network, laddr, baddr, svc)
 	if err != nil {
 		return nil, err
 	}
+	var pconn net.PacketConn = sconn
+	if !migrationCfg.Disabled && network.PathResolver() != nil && raddr.Path == nil &&
+		!raddr.IA.Eq(sconn.LocalSnetAddr().IA) {
+		pc, perr := newPathConn(sconn, raddr, network.PathResolver(), migrationCfg)
+		if perr != nil {
+			sconn.Close()
+			return nil, perr
+		}
+		pconn = pc
+		defer func() {
+			// Stop watching the paths once the session is gone.
+			if err != nil {
+				pc.Close()
+				return
+			}
+			go func() {
+				defer log.LogPanicAndExit()
+				<-sess.Context().Done()
+				pc.Close()
+			}()
+		}()
+	}
 	// Use dummy hostname, as it's used for SNI, and we're not doing cert verification.
-	return quic.Dial(sconn, raddr, "host:0", cliTlsCfg, nil)
+	qsess, err := quic.Dial(pconn, raddr, "host:0", cliTlsCfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth == nil {
+		return qsess, nil
+	}
+	asess, err := authClient(qsess, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return asess, nil
 }
 
 func ListenSCION(network *snet.Network, laddr *snet.Addr) (quic.Listener, error) {
@@ -71,14 +157,18 @@ func ListenSCION(network *snet.Network, laddr *snet.Addr) (quic.Listener, error)
 
 func ListenSCIONWithBindSVC(network *snet.Network, laddr, baddr *snet.Addr,
 	svc addr.HostSVC) (quic.Listener, error) {
-	if len(srvTlsCfg.Certificates) == 0 {
+	if len(srvTlsCfg.Certificates) == 0 || len(srvTlsCfg.Certificates[0].Certificate) == 0 {
 		return nil, common.NewBasicError("squic: No server TLS certificate configured", nil)
 	}
 	sconn, err := sListen(network, laddr, baddr, svc)
 	if err != nil {
 		return nil, err
 	}
-	return quic.Listen(sconn, srvTlsCfg, nil)
+	ln, err := quic.Listen(sconn, srvTlsCfg, nil)
+	if err != nil || auth == nil {
+		return ln, err
+	}
+	return newAuthListener(ln, srvTlsCfg.Certificates[0].Certificate[0]), nil
 }
 
 func sListen(network *snet.Network, laddr, baddr *snet.Addr,
@@ -86,5 +176,116 @@ func sListen(network *snet.Network, laddr, baddr *snet.Addr,
 	if network == nil {
 		network = snet.DefNetwork
 	}
-	return network.ListenSCIONWithBindSVC("udp4", laddr, baddr, svc)
+	// Use the dual-stack network, such that sessions can be established with
+	// both IPv4 and IPv6 hosts.
+	return network.ListenSCIONWithBindSVC("udp", laddr, baddr, svc)
+}
+
+// authClient runs the authentication handshake on a new stream of the dialed
+// session sess.
+func authClient(sess quic.Session, raddr *snet.Addr) (*Session, error) {
+	ctx, cancelF := context.WithTimeout(context.Background(), AuthTimeout)
+	defer cancelF()
+	// Closing the session unblocks the handshake if the server does not
+	// answer in time.
+	timer := time.AfterFunc(AuthTimeout, func() { sess.Close(errAuthTimeout) })
+	defer timer.Stop()
+	certs := sess.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		err := common.NewBasicError("squic: Server presented no TLS certificate", nil)
+		sess.Close(err)
+		return nil, err
+	}
+	stream, err := sess.OpenStreamSync()
+	if err != nil {
+		sess.Close(err)
+		return nil, common.NewBasicError("squic: Unable to open auth stream", err)
+	}
+	defer stream.Close()
+	ia, err := auth.clientHandshake(ctx, stream, raddr.IA, certs[0].Raw)
+	if err != nil {
+		sess.Close(err)
+		return nil, err
+	}
+	return &Session{Session: sess, remoteIA: ia}, nil
+}
+
+// authListener only returns sessions whose client has been authenticated.
+// Handshakes run concurrently, so that slow clients do not delay others.
+type authListener struct {
+	quic.Listener
+	// TLS certificate presented to clients, bound to the local identity by
+	// the handshake
+	srvCert  []byte
+	sessions chan *Session
+	// Closed when the accept loop stops, after err is set
+	done chan struct{}
+	err  error
+}
+
+func newAuthListener(ln quic.Listener, srvCert []byte) *authListener {
+	l := &authListener{
+		Listener: ln,
+		srvCert:  srvCert,
+		sessions: make(chan *Session),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer log.LogPanicAndExit()
+		l.run()
+	}()
+	return l
+}
+
+func (l *authListener) run() {
+	defer close(l.done)
+	for {
+		sess, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			return
+		}
+		go func() {
+			defer log.LogPanicAndExit()
+			l.authenticate(sess)
+		}()
+	}
+}
+
+func (l *authListener) authenticate(sess quic.Session) {
+	ctx, cancelF := context.WithTimeout(context.Background(), AuthTimeout)
+	defer cancelF()
+	timer := time.AfterFunc(AuthTimeout, func() { sess.Close(errAuthTimeout) })
+	defer timer.Stop()
+	remote, ok := sess.RemoteAddr().(*snet.Addr)
+	if !ok {
+		sess.Close(common.NewBasicError("squic: Remote address is not a SCION address", nil))
+		return
+	}
+	stream, err := sess.AcceptStream()
+	if err != nil {
+		log.Debug("squic: Unable to accept auth stream", "remote", remote, "err", err)
+		return
+	}
+	defer stream.Close()
+	ia, err := auth.serverHandshake(ctx, stream, remote.IA, l.srvCert)
+	if err != nil {
+		log.Info("squic: Client authentication failed", "remote", remote, "err", err)
+		sess.Close(err)
+		return
+	}
+	select {
+	case l.sessions <- &Session{Session: sess, remoteIA: ia}:
+	case <-l.done:
+		sess.Close(common.NewBasicError("squic: Listener closed", nil))
+	}
+}
+
+func (l *authListener) Accept() (quic.Session, error) {
+	select {
+	case sess := <-l.sessions:
+		return sess, nil
+	case <-l.done:
+		return nil, l.err
+	}
 }
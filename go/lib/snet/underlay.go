@@ -0,0 +1,462 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/hpkt"
+	"github.com/scionproto/scion/go/lib/l4"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spkt"
+)
+
+const (
+	// Number of received packets that can be queued for each Conn in
+	// dispatcher-less mode. Further packets are dropped.
+	underlayQueueLen = 256
+	// Range of ports allocated to Conns that do not request a specific port
+	// in dispatcher-less mode.
+	underlayMinPort = 32768
+	underlayMaxPort = 65535
+)
+
+var _ packetConn = (*reliable.Conn)(nil)
+var _ packetConn = (*muxConn)(nil)
+
+// packetConn is the connection used by a Conn to exchange SCION packets with
+// the network, either through the dispatcher or directly over UDP. Addresses
+// passed to and returned by packetConns are *reliable.AppAddr overlay
+// addresses.
+type packetConn interface {
+	ReadFrom(b []byte) (int, net.Addr, error)
+	WriteTo(b []byte, a net.Addr) (int, error)
+	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// underlay is a UDP socket shared by all the connections of a Network in
+// dispatcher-less mode. It demultiplexes received SCION packets to
+// connections according to the destination host and L4 port.
+type underlay struct {
+	conn  *net.UDPConn
+	mutex sync.Mutex
+	conns map[string]*muxConn
+	// Connections listening on each host, in the order they were registered
+	hosts map[string][]*muxConn
+	// Next candidate port for connections that do not request one
+	nextPort uint16
+	closed   bool
+}
+
+func newUnderlay(laddr *net.UDPAddr) (*underlay, error) {
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to open underlay socket", err,
+			"addr", laddr)
+	}
+	u := &underlay{
+		conn:     conn,
+		conns:    make(map[string]*muxConn),
+		hosts:    make(map[string][]*muxConn),
+		nextPort: underlayMinPort,
+	}
+	go func() {
+		defer log.LogPanicAndExit()
+		u.run()
+	}()
+	return u, nil
+}
+
+// register creates a connection that receives the packets addressed to
+// public (and bind, if not nil), or to svc. If the port of public is 0, a
+// free port is allocated. The port of the connection is returned.
+func (u *underlay) register(public, bind *reliable.AppAddr,
+	svc addr.HostSVC) (*muxConn, uint16, error) {
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.closed {
+		return nil, 0, common.NewBasicError("Underlay socket closed", nil)
+	}
+	port := public.Port
+	if port == 0 {
+		var err error
+		if port, err = u.allocPort(public.Addr); err != nil {
+			return nil, 0, err
+		}
+	}
+	c := &muxConn{
+		u:            u,
+		queue:        make(chan *muxPacket, underlayQueueLen),
+		closeChan:    make(chan struct{}),
+		deadlineChan: make(chan struct{}),
+	}
+	c.keys = append(c.keys, muxKey(public.Addr, port))
+	if bind != nil {
+		c.keys = append(c.keys, muxKey(bind.Addr, bind.Port))
+	}
+	if svc != addr.SvcNone {
+		c.keys = append(c.keys, muxKey(svc, 0))
+	}
+	for _, key := range c.keys {
+		if _, ok := u.conns[key]; ok {
+			return nil, 0, common.NewBasicError("Address already in use", nil, "addr", key)
+		}
+	}
+	for _, key := range c.keys {
+		u.conns[key] = c
+	}
+	u.addHost(c, public.Addr)
+	if bind != nil && bind.Addr.String() != public.Addr.String() {
+		u.addHost(c, bind.Addr)
+	}
+	return c, port, nil
+}
+
+// addHost (internal) adds c to the connections listening on host.
+func (u *underlay) addHost(c *muxConn, host addr.HostAddr) {
+	key := host.String()
+	c.hosts = append(c.hosts, key)
+	u.hosts[key] = append(u.hosts[key], c)
+}
+
+// allocPort (internal) returns a port that is not used on host.
+func (u *underlay) allocPort(host addr.HostAddr) (uint16, error) {
+	for i := 0; i <= underlayMaxPort-underlayMinPort; i++ {
+		port := u.nextPort
+		if u.nextPort == underlayMaxPort {
+			u.nextPort = underlayMinPort
+		} else {
+			u.nextPort++
+		}
+		if _, ok := u.conns[muxKey(host, port)]; !ok {
+			return port, nil
+		}
+	}
+	return 0, common.NewBasicError("No free port available", nil, "host", host)
+}
+
+// registerEcho delivers the SCMP echo replies with the given ID to c.
+func (u *underlay) registerEcho(c *muxConn, id uint64) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	key := echoKey(id)
+	c.keys = append(c.keys, key)
+	u.conns[key] = c
+}
+
+func (u *underlay) unregister(c *muxConn) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for _, key := range c.keys {
+		if u.conns[key] == c {
+			delete(u.conns, key)
+		}
+	}
+	for _, key := range c.hosts {
+		conns := u.hosts[key]
+		for i := range conns {
+			if conns[i] == c {
+				conns = append(conns[:i], conns[i+1:]...)
+				break
+			}
+		}
+		if len(conns) == 0 {
+			delete(u.hosts, key)
+		} else {
+			u.hosts[key] = conns
+		}
+	}
+}
+
+// run reads packets from the socket and delivers them to the registered
+// connections, until the socket is closed.
+func (u *underlay) run() {
+	b := make(common.RawBytes, BufSize)
+	for {
+		n, src, err := u.conn.ReadFromUDP(b)
+		if err != nil {
+			u.mutex.Lock()
+			closed := u.closed
+			u.mutex.Unlock()
+			if closed {
+				return
+			}
+			log.Error("Underlay read error", "err", err)
+			continue
+		}
+		pkt := &spkt.ScnPkt{
+			DstIA: addr.IA{},
+			SrcIA: addr.IA{},
+			Path:  &spath.Path{},
+		}
+		if err := hpkt.ParseScnPkt(pkt, b[:n]); err != nil {
+			log.Debug("Unable to parse packet received on underlay", "err", err)
+			continue
+		}
+		if isEchoRequest(pkt) {
+			u.replyEcho(pkt, src)
+			continue
+		}
+		c := u.lookup(pkt)
+		if c == nil {
+			log.Debug("Dropped packet for unknown destination", "src", src)
+			continue
+		}
+		c.deliver(append(common.RawBytes(nil), b[:n]...), src)
+	}
+}
+
+// replyEcho answers an SCMP echo request on behalf of the local host, like
+// the dispatcher does.
+func (u *underlay) replyEcho(pkt *spkt.ScnPkt, src *net.UDPAddr) {
+	if err := pkt.Reverse(); err != nil {
+		log.Debug("Unable to reverse SCMP echo request", "err", err)
+		return
+	}
+	hdr := pkt.L4.(*scmp.Hdr)
+	hdr.Type = scmp.T_G_EchoReply
+	// The padding of the request is not sent back, as the parsed payload only
+	// contains the echo info.
+	b := make(common.RawBytes, BufSize)
+	n, err := hpkt.WriteScnPkt(pkt, b)
+	if err != nil {
+		log.Debug("Unable to serialize SCMP echo reply", "err", err)
+		return
+	}
+	if _, err := u.conn.WriteToUDP(b[:n], src); err != nil {
+		log.Debug("Unable to send SCMP echo reply", "err", err)
+	}
+}
+
+// lookup (internal) returns the connection that should receive pkt, or nil
+// if no connection is registered for it.
+func (u *underlay) lookup(pkt *spkt.ScnPkt) *muxConn {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	switch hdr := pkt.L4.(type) {
+	case *l4.UDP:
+		if c, ok := u.conns[muxKey(pkt.DstHost, hdr.DstPort)]; ok {
+			return c
+		}
+		return u.conns[muxKey(pkt.DstHost, 0)]
+	case *scmp.Hdr:
+		// SCMP echo replies are delivered to the connection that sent the
+		// request.
+		if hdr.Class == scmp.C_General && hdr.Type == scmp.T_G_EchoReply {
+			if pld, ok := pkt.Pld.(*scmp.Payload); ok {
+				if info, ok := pld.Info.(*scmp.InfoEcho); ok {
+					return u.conns[echoKey(info.Id)]
+				}
+			}
+			return nil
+		}
+		// SCMP errors are delivered to the sender of the quoted packet.
+		if pld, ok := pkt.Pld.(*scmp.Payload); ok {
+			if src, err := quotedSrc(pld); err == nil {
+				if c, ok := u.conns[muxKey(src.Host, src.L4Port)]; ok {
+					return c
+				}
+			}
+		}
+		// Otherwise, deliver to the connection registered first on the
+		// destination host.
+		if conns := u.hosts[pkt.DstHost.String()]; len(conns) > 0 {
+			return conns[0]
+		}
+	}
+	return nil
+}
+
+func (u *underlay) WriteTo(b []byte, a net.Addr) (int, error) {
+	appAddr, ok := a.(*reliable.AppAddr)
+	if !ok {
+		return 0, common.NewBasicError("Unsupported address type", nil,
+			"type", common.TypeOf(a))
+	}
+	if appAddr.Addr.Type() != addr.HostTypeIPv4 && appAddr.Addr.Type() != addr.HostTypeIPv6 {
+		return 0, common.NewBasicError("Unsupported overlay address", nil, "addr", appAddr)
+	}
+	return u.conn.WriteToUDP(b, &net.UDPAddr{IP: appAddr.Addr.IP(), Port: int(appAddr.Port)})
+}
+
+// LocalAddr returns the address of the underlay socket.
+func (u *underlay) LocalAddr() *net.UDPAddr {
+	return u.conn.LocalAddr().(*net.UDPAddr)
+}
+
+func (u *underlay) Close() error {
+	u.mutex.Lock()
+	u.closed = true
+	conns := u.conns
+	u.conns = make(map[string]*muxConn)
+	u.hosts = make(map[string][]*muxConn)
+	u.mutex.Unlock()
+	for _, c := range conns {
+		c.closeQueue()
+	}
+	return u.conn.Close()
+}
+
+// muxKey returns the key of a registration for host and port. Port 0 is used
+// for SVC registrations, which accept packets for any port.
+func muxKey(host addr.HostAddr, port uint16) string {
+	return net.JoinHostPort(host.String(), strconv.Itoa(int(port)))
+}
+
+// echoKey returns the key of a registration for SCMP echo replies with the
+// given ID.
+func echoKey(id uint64) string {
+	return fmt.Sprintf("echo:%d", id)
+}
+
+func isEchoRequest(pkt *spkt.ScnPkt) bool {
+	hdr, ok := pkt.L4.(*scmp.Hdr)
+	return ok && hdr.Class == scmp.C_General && hdr.Type == scmp.T_G_EchoRequest
+}
+
+// muxConn is the packetConn of a Conn in dispatcher-less mode.
+type muxConn struct {
+	u     *underlay
+	keys  []string
+	hosts []string
+	// Queue of received packets
+	queue chan *muxPacket
+	// Closed when the connection is closed
+	closeChan chan struct{}
+	closeOnce sync.Once
+	// Protects the deadlines
+	mutex        sync.Mutex
+	readDeadline time.Time
+	// Closed and replaced when the read deadline changes
+	deadlineChan chan struct{}
+}
+
+type muxPacket struct {
+	raw     common.RawBytes
+	lastHop *net.UDPAddr
+}
+
+func (c *muxConn) deliver(raw common.RawBytes, lastHop *net.UDPAddr) {
+	select {
+	case c.queue <- &muxPacket{raw: raw, lastHop: lastHop}:
+	default:
+		log.Debug("Dropped packet, receive queue full")
+	}
+}
+
+func (c *muxConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mutex.Lock()
+		deadline, deadlineChan := c.readDeadline, c.deadlineChan
+		c.mutex.Unlock()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		select {
+		case pkt := <-c.queue:
+			stopTimer(timer)
+			n := copy(b, pkt.raw)
+			lastHop := &reliable.AppAddr{
+				Addr: addr.HostFromIP(pkt.lastHop.IP),
+				Port: uint16(pkt.lastHop.Port),
+			}
+			return n, lastHop, nil
+		case <-c.closeChan:
+			stopTimer(timer)
+			return 0, nil, io.EOF
+		case <-timeout:
+			return 0, nil, &timeoutError{}
+		case <-deadlineChan:
+			// Deadline changed, wait again
+			stopTimer(timer)
+		}
+	}
+}
+
+func (c *muxConn) registerEcho(id uint64) {
+	c.u.registerEcho(c, id)
+}
+
+func (c *muxConn) WriteTo(b []byte, a net.Addr) (int, error) {
+	select {
+	case <-c.closeChan:
+		return 0, common.NewBasicError("Connection closed", nil)
+	default:
+	}
+	return c.u.WriteTo(b, a)
+}
+
+func (c *muxConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *muxConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.readDeadline = t
+	close(c.deadlineChan)
+	c.deadlineChan = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline is a no-op, as writes to the shared UDP socket do not
+// block.
+func (c *muxConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *muxConn) Close() error {
+	c.u.unregister(c)
+	c.closeQueue()
+	return nil
+}
+
+func (c *muxConn) closeQueue() {
+	c.closeOnce.Do(func() { close(c.closeChan) })
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+var _ net.Error = (*timeoutError)(nil)
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
@@ -0,0 +1,171 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/lib/xtest"
+)
+
+// newLoopbackNetworks creates two dispatcher-less networks in the same AS,
+// with underlay sockets on 127.0.0.1 and 127.0.0.2 using the same port.
+func newLoopbackNetworks(t *testing.T) (*Network, *Network) {
+	t.Helper()
+	ia := xtest.MustParseIA("1-ff00:0:111")
+	netA := NewNetworkBasic(ia, "", "")
+	xtest.FailOnErr(t, netA.BindUnderlay(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}))
+	netB := NewNetworkBasic(ia, "", "")
+	err := netB.BindUnderlay(&net.UDPAddr{
+		IP:   net.IPv4(127, 0, 0, 2),
+		Port: netA.UnderlayAddr().Port,
+	})
+	if err != nil {
+		netA.Close()
+		t.Fatalf("Unable to bind second underlay socket: %v", err)
+	}
+	return netA, netB
+}
+
+func TestUnderlay(t *testing.T) {
+	Convey("Given two dispatcher-less networks on loopback", t, func() {
+		netA, netB := newLoopbackNetworks(t)
+		defer netA.Close()
+		defer netB.Close()
+		ia := netA.IA()
+		connA, err := netA.ListenSCION("udp4",
+			&Addr{IA: ia, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 1))})
+		So(err, ShouldBeNil)
+		connB, err := netB.ListenSCION("udp4",
+			&Addr{IA: ia, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 2)), L4Port: 40000})
+		So(err, ShouldBeNil)
+		SoMsg("allocated port", connA.LocalSnetAddr().L4Port, ShouldNotEqual, 0)
+		SoMsg("requested port", connB.LocalSnetAddr().L4Port, ShouldEqual, 40000)
+
+		Convey("Packets are exchanged in both directions", func() {
+			_, err := connA.WriteToSCION([]byte("ping"), connB.LocalSnetAddr())
+			So(err, ShouldBeNil)
+			b := make([]byte, 128)
+			connB.SetReadDeadline(time.Now().Add(time.Second))
+			n, remote, err := connB.ReadFromSCION(b)
+			So(err, ShouldBeNil)
+			SoMsg("payload", string(b[:n]), ShouldEqual, "ping")
+			SoMsg("remote", remote.EqAddr(connA.LocalSnetAddr()), ShouldBeTrue)
+
+			_, err = connB.WriteToSCION([]byte("pong"), remote)
+			So(err, ShouldBeNil)
+			connA.SetReadDeadline(time.Now().Add(time.Second))
+			n, remote, err = connA.ReadFromSCION(b)
+			So(err, ShouldBeNil)
+			SoMsg("payload", string(b[:n]), ShouldEqual, "pong")
+			SoMsg("remote", remote.EqAddr(connB.LocalSnetAddr()), ShouldBeTrue)
+		})
+		Convey("Packets are demultiplexed by destination port", func() {
+			other, err := netB.ListenSCION("udp4",
+				&Addr{IA: ia, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 2)), L4Port: 40001})
+			So(err, ShouldBeNil)
+			_, err = connA.WriteToSCION([]byte("to other"), other.LocalSnetAddr())
+			So(err, ShouldBeNil)
+			b := make([]byte, 128)
+			other.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := other.ReadFromSCION(b)
+			So(err, ShouldBeNil)
+			SoMsg("payload", string(b[:n]), ShouldEqual, "to other")
+			connB.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			_, _, err = connB.ReadFromSCION(b)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Registering the same address twice fails", func() {
+			_, err := netB.ListenSCION("udp4",
+				&Addr{IA: ia, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 2)), L4Port: 40000})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Reads time out", func() {
+			connA.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			_, _, err := connA.conn.ReadFrom(make([]byte, 128))
+			nerr, ok := err.(net.Error)
+			So(ok, ShouldBeTrue)
+			SoMsg("timeout", nerr.Timeout(), ShouldBeTrue)
+		})
+		Convey("Reads return io.EOF after the connection is closed", func() {
+			connA.Close()
+			_, _, err := connA.conn.ReadFrom(make([]byte, 128))
+			SoMsg("err", err, ShouldEqual, io.EOF)
+		})
+	})
+}
+
+func TestUnderlaySCMPFallback(t *testing.T) {
+	Convey("Given a dispatcher-less underlay on IPv6 loopback", t, func() {
+		u, err := newUnderlay(&net.UDPAddr{IP: net.IPv6loopback})
+		if err != nil {
+			t.Skipf("IPv6 loopback not available: %v", err)
+		}
+		defer u.Close()
+		host := addr.HostFromIP(net.IPv6loopback)
+		var conns []*muxConn
+		for _, port := range []uint16{40002, 40001, 40000} {
+			c, _, err := u.register(&reliable.AppAddr{Addr: host, Port: port}, nil,
+				addr.SvcNone)
+			xtest.FailOnErr(t, err)
+			conns = append(conns, c)
+		}
+		sender, err := net.DialUDP("udp6", nil, u.LocalAddr())
+		xtest.FailOnErr(t, err)
+		defer sender.Close()
+		// The quoted packet was sent from a port no connection listens on.
+		src := &Addr{IA: testLocal.IA, Host: host, L4Port: 50000}
+		raw := newRawSCMP(t, scmp.ClassType{Class: scmp.C_Routing,
+			Type: scmp.T_R_UnreachHost}, nil, src, testRemote)
+		Convey("SCMP errors that cannot be attributed go to the first connection", func() {
+			for i := 0; i < 5; i++ {
+				_, err := sender.Write(raw)
+				xtest.FailOnErr(t, err)
+				conns[0].SetReadDeadline(time.Now().Add(time.Second))
+				_, _, err = conns[0].ReadFrom(make([]byte, BufSize))
+				SoMsg("first", err, ShouldBeNil)
+			}
+			for _, c := range conns[1:] {
+				c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+				_, _, err := c.ReadFrom(make([]byte, BufSize))
+				SoMsg("others", err, ShouldNotBeNil)
+			}
+		})
+		Convey("The next connection receives them once the first is closed", func() {
+			conns[0].Close()
+			_, err := sender.Write(raw)
+			xtest.FailOnErr(t, err)
+			conns[1].SetReadDeadline(time.Now().Add(time.Second))
+			_, _, err = conns[1].ReadFrom(make([]byte, BufSize))
+			SoMsg("second", err, ShouldBeNil)
+		})
+	})
+}
+
+func TestMuxKey(t *testing.T) {
+	Convey("Mux keys of IPv6 hosts are unambiguous", t, func() {
+		SoMsg("v6", muxKey(addr.HostFromIP(net.ParseIP("::1")), 80), ShouldEqual, "[::1]:80")
+		SoMsg("v4", muxKey(addr.HostFromIP(net.IPv4(127, 0, 0, 1)), 80),
+			ShouldEqual, "127.0.0.1:80")
+	})
+}
@@ -38,18 +38,20 @@ type Topo struct {
     // if they want to use a given (external) interface.
     IFInfoMap map[common.IFIDType]IFInfo
 
-    BS      map[string]TopoAddr
-    BSNames []string
-    CS      map[string]TopoAddr
-    CSNames []string
-    PS      map[string]TopoAddr
-    PSNames []string
-    SB      map[string]TopoAddr
-    SBNames []string
-    RS      map[string]TopoAddr
-    RSNames []string
-    DS      map[string]TopoAddr
-    DSNames []string
+    BS       map[string]TopoAddr
+    BSNames  []string
+    CS       map[string]TopoAddr
+    CSNames  []string
+    PS       map[string]TopoAddr
+    PSNames  []string
+    SB       map[string]TopoAddr
+    SBNames  []string
+    RS       map[string]TopoAddr
+    RSNames  []string
+    DS       map[string]TopoAddr
+    DSNames  []string
+    SIG      map[string]TopoAddr
+    SIGNames []string
 
     ZK map[int]TopoAddr
 }
@@ -52,6 +52,7 @@ type RawTopo struct {
 	SibraService       map[string]RawAddrInfo `json:",omitempty"`
 	RainsService       map[string]RawAddrInfo `json:",omitempty"`
 	DiscoveryService   map[string]RawAddrInfo `json:",omitempty"`
+	SIG                map[string]RawAddrInfo `json:",omitempty"`
 }
 
 type RawBRInfo struct {
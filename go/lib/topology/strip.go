@@ -33,6 +33,7 @@ func StripServices(rt *RawTopo) {
 	// Clear services that don't need to be publicly visible
 	rt.BeaconService = make(map[string]RawAddrInfo)
 	rt.SibraService = make(map[string]RawAddrInfo)
+	rt.SIG = make(map[string]RawAddrInfo)
 	rt.ZookeeperService = make(map[int]RawAddrPort)
 }
 
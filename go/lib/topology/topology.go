@@ -42,18 +42,20 @@ type Topo struct {
 	// if they want to use a given interface.
 	IFInfoMap map[common.IFIDType]IFInfo
 
-	BS      map[string]TopoAddr
-	BSNames []string
-	CS      map[string]TopoAddr
-	CSNames []string
-	PS      map[string]TopoAddr
-	PSNames []string
-	SB      map[string]TopoAddr
-	SBNames []string
-	RS      map[string]TopoAddr
-	RSNames []string
-	DS      map[string]TopoAddr
-	DSNames []string
+	BS       map[string]TopoAddr
+	BSNames  []string
+	CS       map[string]TopoAddr
+	CSNames  []string
+	PS       map[string]TopoAddr
+	PSNames  []string
+	SB       map[string]TopoAddr
+	SBNames  []string
+	RS       map[string]TopoAddr
+	RSNames  []string
+	DS       map[string]TopoAddr
+	DSNames  []string
+	SIG      map[string]TopoAddr
+	SIGNames []string
 
 	ZK map[int]TopoAddr
 }
@@ -68,6 +70,7 @@ func NewTopo() *Topo {
 		SB:        make(map[string]TopoAddr),
 		RS:        make(map[string]TopoAddr),
 		DS:        make(map[string]TopoAddr),
+		SIG:       make(map[string]TopoAddr),
 		ZK:        make(map[int]TopoAddr),
 		IFInfoMap: make(map[common.IFIDType]IFInfo),
 	}
@@ -150,7 +153,7 @@ func (t *Topo) populateBR(raw *RawTopo) error {
 }
 
 func (t *Topo) populateServices(raw *RawTopo) error {
-	// Populate BS, CS, PS, SB, RS and DS maps
+	// Populate BS, CS, PS, SB, RS, DS and SIG maps
 	var err error
 	if t.BSNames, err = svcMapFromRaw(raw.BeaconService, "BS", t.BS, t.Overlay); err != nil {
 		return err
@@ -170,6 +173,9 @@ func (t *Topo) populateServices(raw *RawTopo) error {
 	if t.DSNames, err = svcMapFromRaw(raw.DiscoveryService, "DS", t.DS, t.Overlay); err != nil {
 		return err
 	}
+	if t.SIGNames, err = svcMapFromRaw(raw.SIG, "SIG", t.SIG, t.Overlay); err != nil {
+		return err
+	}
 	return nil
 }
 
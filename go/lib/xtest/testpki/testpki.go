@@ -0,0 +1,123 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testpki provides a minimal PKI for tests that need certificate
+// chains and TRCs. It consists of a single ISD with one core AS, which issues
+// the certificates of all other ASes.
+package testpki
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/xtest"
+)
+
+// CoreIA is the core AS of the PKI.
+var CoreIA = xtest.MustParseIA("1-ff00:0:110")
+
+// TRCs is a TRC store backed by a map.
+type TRCs map[addr.ISD]*trc.TRC
+
+// GetNewestTRC returns the TRC of isd, or nil if it is unknown.
+func (t TRCs) GetNewestTRC(isd addr.ISD) *trc.TRC {
+	return t[isd]
+}
+
+// GetValidTRC returns the TRC of isd, or an error if it is unknown.
+func (t TRCs) GetValidTRC(ctx context.Context, isd addr.ISD,
+	trail ...addr.ISD) (*trc.TRC, error) {
+
+	if trc, ok := t[isd]; ok {
+		return trc, nil
+	}
+	return nil, common.NewBasicError("TRC not found", nil, "isd", isd)
+}
+
+// PKI is a minimal ISD with one core AS that issues certificates.
+type PKI struct {
+	// TRC is the TRC of the ISD.
+	TRC       *trc.TRC
+	issuer    *cert.Certificate
+	issuerKey common.RawBytes
+}
+
+// New creates a PKI with fresh keys. Its TRC and certificates expire in an
+// hour at the latest.
+func New(t *testing.T) *PKI {
+	t.Helper()
+	onlinePub, onlinePriv := newKeyPair(t)
+	pki := &PKI{
+		TRC: &trc.TRC{
+			ISD:            CoreIA.I,
+			ExpirationTime: uint64(time.Now().Unix()) + 3600,
+			CoreASes: map[addr.IA]*trc.CoreAS{
+				CoreIA: {OnlineKey: onlinePub, OnlineKeyAlg: crypto.Ed25519},
+			},
+		},
+	}
+	var issuerPub common.RawBytes
+	issuerPub, pki.issuerKey = newKeyPair(t)
+	pki.issuer = newCert(CoreIA, issuerPub, true)
+	xtest.FailOnErr(t, pki.issuer.Sign(onlinePriv, crypto.Ed25519))
+	return pki
+}
+
+// TRCs returns a TRC store containing the TRC of the PKI.
+func (pki *PKI) TRCs() TRCs {
+	return TRCs{pki.TRC.ISD: pki.TRC}
+}
+
+// Issue returns a certificate chain for ia, issued by the core AS, and the
+// private key matching the subject signing key of the leaf certificate.
+func (pki *PKI) Issue(t *testing.T, ia addr.IA) (*cert.Chain, common.RawBytes) {
+	t.Helper()
+	pub, priv := newKeyPair(t)
+	leaf := newCert(ia, pub, false)
+	xtest.FailOnErr(t, leaf.Sign(pki.issuerKey, crypto.Ed25519))
+	chain, err := cert.ChainFromSlice([]*cert.Certificate{leaf, pki.issuer})
+	xtest.FailOnErr(t, err)
+	return chain, priv
+}
+
+func newCert(subject addr.IA, signKey common.RawBytes, canIssue bool) *cert.Certificate {
+	now := uint64(time.Now().Unix())
+	return &cert.Certificate{
+		CanIssue:       canIssue,
+		ExpirationTime: now + 1800,
+		Issuer:         CoreIA,
+		IssuingTime:    now - 60,
+		SignAlgorithm:  crypto.Ed25519,
+		Subject:        subject,
+		SubjectSignKey: signKey,
+		TRCVersion:     1,
+		Version:        1,
+	}
+}
+
+func newKeyPair(t *testing.T) (common.RawBytes, common.RawBytes) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	xtest.FailOnErr(t, err)
+	return common.RawBytes(pub), common.RawBytes(priv)
+}
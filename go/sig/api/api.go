@@ -0,0 +1,265 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api implements the management API of the SIG. The API is served
+// with HTTP on a UNIX socket, which only the user running the SIG can access.
+// Requests and replies are encoded in JSON:
+//
+//	GET    /status  the state of the remote ASes, their networks, SIGs and sessions
+//	POST   /nets    add a network, e.g. {"IA": "1-ff00:0:110", "Net": "192.0.2.0/24"}
+//	DELETE /nets    remove a network, with the same request as POST
+//	POST   /sigs    add a SIG, e.g. {"IA": "1-ff00:0:110", "Id": "remote-1",
+//	                "Addr": "192.0.2.1", "CtrlPort": 10081, "EncapPort": 10080}
+//	DELETE /sigs    remove a SIG, e.g. {"IA": "1-ff00:0:110", "Id": "remote-1"}
+//
+// Changes are made to the loaded config, which is written back to the config
+// file if -apipersist is set. Otherwise, they are lost when the config file is
+// reloaded.
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/sig/base"
+	"github.com/scionproto/scion/go/sig/config"
+	"github.com/scionproto/scion/go/sig/siginfo"
+)
+
+var (
+	sockPath = flag.String("api", "", "UNIX socket of the management API (disabled if empty)")
+	persist  = flag.Bool("apipersist", false,
+		"Write the changes made with the management API to the config file")
+)
+
+// NetReq is the request to add or remove a network of a remote AS.
+type NetReq struct {
+	IA  addr.IA
+	Net *config.IPNet
+}
+
+// SigReq is the request to add or remove a SIG of a remote AS. Only IA and Id
+// are needed to remove a SIG.
+type SigReq struct {
+	IA        addr.IA
+	Id        siginfo.SigIdType
+	Addr      net.IP
+	CtrlPort  uint16
+	EncapPort uint16
+}
+
+// Start serves the management API, if it is enabled. The config file at
+// cfgPath is updated with the changes if -apipersist is set.
+func Start(cfgPath string) error {
+	if *sockPath == "" {
+		return nil
+	}
+	// Remove the socket of a previous run.
+	if err := os.Remove(*sockPath); err != nil && !os.IsNotExist(err) {
+		return common.NewBasicError("Unable to remove old API socket", err, "path", *sockPath)
+	}
+	// Create the socket without permissions for other users, such that it is
+	// never reachable by them.
+	oldMask := syscall.Umask(0177)
+	ln, err := net.Listen("unix", *sockPath)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return common.NewBasicError("Unable to listen on API socket", err, "path", *sockPath)
+	}
+	log.Info("Serving management API", "path", *sockPath)
+	go func() {
+		defer log.LogPanicAndExit()
+		if err := http.Serve(ln, NewHandler(cfgPath)); err != nil {
+			log.Error("Management API stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+type handler struct {
+	cfgPath string
+}
+
+// NewHandler returns the handler of the API requests. If cfgPath is not empty
+// and -apipersist is set, changes are written to the config file at cfgPath.
+func NewHandler(cfgPath string) http.Handler {
+	h := &handler{cfgPath: cfgPath}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", h.status)
+	mux.HandleFunc("/nets", h.nets)
+	mux.HandleFunc("/sigs", h.sigs)
+	return mux
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reply(w, base.Map.Status())
+}
+
+func (h *handler) nets(w http.ResponseWriter, r *http.Request) {
+	req := &NetReq{}
+	if !checkMethod(w, r) || !decode(w, r, req) {
+		return
+	}
+	if req.IA.I == 0 || req.IA.A == 0 || req.Net == nil {
+		http.Error(w, "IA and Net are required", http.StatusBadRequest)
+		return
+	}
+	var f func(*config.Cfg) error
+	switch r.Method {
+	case http.MethodPost:
+		f = func(cfg *config.Cfg) error {
+			as := asEntry(cfg, req.IA)
+			for _, ipnet := range as.Nets {
+				if ipnet.String() == req.Net.String() {
+					return nil
+				}
+			}
+			as.Nets = append(as.Nets, req.Net)
+			return nil
+		}
+	case http.MethodDelete:
+		f = func(cfg *config.Cfg) error {
+			if as, ok := cfg.ASes[req.IA]; ok {
+				for i, ipnet := range as.Nets {
+					if ipnet.String() == req.Net.String() {
+						as.Nets = append(as.Nets[:i], as.Nets[i+1:]...)
+						return nil
+					}
+				}
+			}
+			return common.NewBasicError("Network not configured", nil,
+				"ia", req.IA, "net", req.Net)
+		}
+	}
+	h.update(w, f)
+}
+
+func (h *handler) sigs(w http.ResponseWriter, r *http.Request) {
+	req := &SigReq{}
+	if !checkMethod(w, r) || !decode(w, r, req) {
+		return
+	}
+	if req.IA.I == 0 || req.IA.A == 0 || req.Id == "" {
+		http.Error(w, "IA and Id are required", http.StatusBadRequest)
+		return
+	}
+	var f func(*config.Cfg) error
+	switch r.Method {
+	case http.MethodPost:
+		if req.Addr == nil {
+			http.Error(w, "Addr is required", http.StatusBadRequest)
+			return
+		}
+		f = func(cfg *config.Cfg) error {
+			asEntry(cfg, req.IA).Sigs[req.Id] = &config.SIG{
+				Addr: req.Addr, CtrlPort: req.CtrlPort, EncapPort: req.EncapPort,
+			}
+			return nil
+		}
+	case http.MethodDelete:
+		f = func(cfg *config.Cfg) error {
+			if as, ok := cfg.ASes[req.IA]; ok {
+				if _, ok := as.Sigs[req.Id]; ok {
+					delete(as.Sigs, req.Id)
+					return nil
+				}
+			}
+			return common.NewBasicError("SIG not configured", nil, "ia", req.IA, "id", req.Id)
+		}
+	}
+	h.update(w, f)
+}
+
+// update applies f to the loaded config, reloads it, and persists it if
+// enabled. It replies with the state of the remote ASes.
+func (h *handler) update(w http.ResponseWriter, f func(*config.Cfg) error) {
+	var save func(*config.Cfg) error
+	var saveErr error
+	if *persist && h.cfgPath != "" {
+		// The config is saved before other changes can be loaded, so that the
+		// config file does not miss changes that are loaded.
+		save = func(cfg *config.Cfg) error {
+			saveErr = cfg.SaveToFile(h.cfgPath)
+			return saveErr
+		}
+	}
+	cfg, err := base.Map.UpdateConfig(f, save)
+	if cfg == nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		if saveErr != nil {
+			log.Error("API: Unable to save config", "err", err)
+		} else {
+			log.Error("API: config change only partially applied", "err", err)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reply(w, base.Map.Status())
+}
+
+// asEntry returns the entry of the AS ia in cfg, which is added if needed.
+func asEntry(cfg *config.Cfg, ia addr.IA) *config.ASEntry {
+	as, ok := cfg.ASes[ia]
+	if !ok {
+		as = &config.ASEntry{Nets: []*config.IPNet{}, Sigs: config.SIGSet{}}
+		if cfg.ASes == nil {
+			cfg.ASes = make(map[addr.IA]*config.ASEntry)
+		}
+		cfg.ASes[ia] = as
+	}
+	if as.Sigs == nil {
+		as.Sigs = config.SIGSet{}
+	}
+	return as
+}
+
+// checkMethod checks that r adds (POST) or removes (DELETE) an element.
+func checkMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(v); err != nil {
+		log.Error("API: Unable to send reply", "err", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/xtest"
+)
+
+func TestHandler(t *testing.T) {
+	Convey("Given the API handler", t, func() {
+		h := NewHandler("")
+		do := func(method, path, body string) int {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+			return w.Code
+		}
+		Convey("Status is read-only", func() {
+			SoMsg("get", do(http.MethodGet, "/status", ""), ShouldEqual, http.StatusOK)
+			SoMsg("post", do(http.MethodPost, "/status", "{}"), ShouldEqual,
+				http.StatusMethodNotAllowed)
+		})
+		Convey("Networks and SIGs can only be added and removed", func() {
+			SoMsg("nets", do(http.MethodGet, "/nets", ""), ShouldEqual,
+				http.StatusMethodNotAllowed)
+			SoMsg("sigs", do(http.MethodPut, "/sigs", "{}"), ShouldEqual,
+				http.StatusMethodNotAllowed)
+		})
+		Convey("Invalid requests are rejected", func() {
+			SoMsg("malformed", do(http.MethodPost, "/nets", "{"), ShouldEqual,
+				http.StatusBadRequest)
+			SoMsg("no net", do(http.MethodPost, "/nets", `{"IA": "1-ff00:0:110"}`),
+				ShouldEqual, http.StatusBadRequest)
+			SoMsg("bad net", do(http.MethodPost, "/nets",
+				`{"IA": "1-ff00:0:110", "Net": "192.0.2.0"}`), ShouldEqual, http.StatusBadRequest)
+			SoMsg("no IA", do(http.MethodDelete, "/sigs", `{"Id": "remote-1"}`),
+				ShouldEqual, http.StatusBadRequest)
+			SoMsg("no addr", do(http.MethodPost, "/sigs",
+				`{"IA": "1-ff00:0:110", "Id": "remote-1"}`), ShouldEqual, http.StatusBadRequest)
+		})
+		Convey("Changes require a loaded config", func() {
+			SoMsg("add", do(http.MethodPost, "/nets",
+				`{"IA": "1-ff00:0:110", "Net": "192.0.2.0/24"}`), ShouldEqual,
+				http.StatusBadRequest)
+		})
+	})
+}
+
+func TestStart(t *testing.T) {
+	Convey("The API socket is only accessible by the user running the SIG", t, func() {
+		dir, err := ioutil.TempDir("", "sig-api")
+		xtest.FailOnErr(t, err)
+		defer os.RemoveAll(dir)
+		oldPath := *sockPath
+		defer func() { *sockPath = oldPath }()
+		*sockPath = filepath.Join(dir, "api.sock")
+		So(Start(""), ShouldBeNil)
+		fi, err := os.Stat(*sockPath)
+		So(err, ShouldBeNil)
+		SoMsg("mode", fi.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+	})
+}
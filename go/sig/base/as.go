@@ -15,6 +15,7 @@
 package base
 
 import (
+	"encoding/json"
 	"net"
 	"sync"
 	"time"
@@ -24,9 +25,11 @@ import (
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pktcls"
 	"github.com/scionproto/scion/go/lib/ringbuf"
 	"github.com/scionproto/scion/go/sig/config"
 	"github.com/scionproto/scion/go/sig/egress"
+	"github.com/scionproto/scion/go/sig/mgmt"
 	"github.com/scionproto/scion/go/sig/sigcmn"
 	"github.com/scionproto/scion/go/sig/siginfo"
 )
@@ -49,7 +52,21 @@ type ASEntry struct {
 	version           uint64 // used to track certain changes made to ASEntry
 	log.Logger
 
+	// Default session, used for packets that do not match any traffic class
 	Session *egress.Session
+	// Sessions of traffic classes, keyed by session ID
+	sessions map[mgmt.SessionType]*egress.Session
+	// Configuration of the traffic class sessions, used to detect changes
+	sessCfgs map[mgmt.SessionType]string
+	// Chooses the session of egress packets
+	selector *egress.SessSelector
+	// Networks from the config file
+	staticNets map[string]struct{}
+	// Configuration of the AS, restricts the learned networks
+	cfg *config.ASEntry
+	// Networks and SIGs learned from prefix announcements, with their expiry
+	learnedNets map[string]time.Time
+	learnedSigs map[siginfo.SigIdType]time.Time
 }
 
 func newASEntry(ia addr.IA) (*ASEntry, error) {
@@ -61,24 +78,141 @@ func newASEntry(ia addr.IA) (*ASEntry, error) {
 		Sigs:              &siginfo.SigMap{},
 		sigMgrStop:        make(chan struct{}),
 		healthMonitorStop: make(chan struct{}),
+		sessions:          make(map[mgmt.SessionType]*egress.Session),
+		sessCfgs:          make(map[mgmt.SessionType]string),
+		staticNets:        make(map[string]struct{}),
+		cfg:               &config.ASEntry{},
+		learnedNets:       make(map[string]time.Time),
+		learnedSigs:       make(map[siginfo.SigIdType]time.Time),
 	}
 	var err error
-	if ae.Session, err = egress.NewSession(ia, 0, ae.Sigs, ae.Logger); err != nil {
+	ae.Session, err = ae.newSession(config.DefaultSessId, nil)
+	if err != nil {
 		return nil, err
 	}
+	ae.selector = egress.NewSessSelector(ae.Session)
 	return ae, nil
 }
 
+// newSession creates a session to the remote AS, on a new connection.
+func (ae *ASEntry) newSession(sessId mgmt.SessionType,
+	filter *pktcls.ActionFilterPaths) (*egress.Session, error) {
+
+	conn, err := egress.NewSessConn()
+	if err != nil {
+		return nil, err
+	}
+	return egress.NewSession(ae.IA, sessId, filter, ae.Sigs, conn, ae.Logger)
+}
+
 func (ae *ASEntry) ReloadConfig(cfg *config.ASEntry) bool {
 	ae.Lock()
 	defer ae.Unlock()
+	if *sigcmn.Discovery && ae.egressRing == nil {
+		// Discovery runs in the sigMgr, which needs the network setup even
+		// if no networks are configured.
+		if err := ae.setupNet(); err != nil {
+			ae.Error("Unable to set up network", "err", err)
+			return false
+		}
+	}
+	ae.staticNets = make(map[string]struct{})
+	for _, ipnet := range cfg.Nets {
+		ae.staticNets[ipnet.IPNet().String()] = struct{}{}
+	}
+	ae.cfg = cfg
+	// Learned networks that are no longer allowed are removed by delOldNets.
+	for key := range ae.learnedNets {
+		if ipnet, ok := ae.Nets[key]; !ok || !cfg.AllowsNet(ipnet) {
+			delete(ae.learnedNets, key)
+		}
+	}
 	// Method calls first to prevent skips due to logical short-circuit
 	s := ae.addNewSIGS(cfg.Sigs)
 	s = ae.delOldSIGS(cfg.Sigs) && s
+	s = ae.reloadSessions(cfg) && s
 	s = ae.addNewNets(cfg.Nets) && s
 	return ae.delOldNets(cfg.Nets) && s
 }
 
+// reloadSessions creates a session for each traffic class in cfg, removes
+// the sessions that are no longer configured, and updates the session
+// selector. Sessions whose path filter changed are recreated.
+func (ae *ASEntry) reloadSessions(cfg *config.ASEntry) bool {
+	s := true
+	sessCfgs := make(map[mgmt.SessionType]string)
+	for _, sessCfg := range cfg.Sessions {
+		desc, err := describeSession(cfg, sessCfg)
+		if err != nil {
+			ae.Error("Unable to describe session", "id", sessCfg.Id, "err", err)
+			s = false
+			continue
+		}
+		sessCfgs[sessCfg.Id] = desc
+	}
+	// Remove old sessions first, as pathmgr identifies path filters by name.
+	for id := range ae.sessions {
+		if desc, ok := sessCfgs[id]; ok && desc == ae.sessCfgs[id] {
+			continue
+		}
+		ae.delSession(id)
+	}
+	policies := make([]*egress.SessPolicy, 0, len(cfg.Sessions))
+	for _, sessCfg := range cfg.Sessions {
+		desc, ok := sessCfgs[sessCfg.Id]
+		if !ok {
+			continue
+		}
+		sess, ok := ae.sessions[sessCfg.Id]
+		if !ok {
+			var err error
+			sess, err = ae.newSession(sessCfg.Id, cfg.PathFilter(sessCfg))
+			if err != nil {
+				ae.Error("Unable to add session", "id", sessCfg.Id, "err", err)
+				s = false
+				continue
+			}
+			ae.sessions[sessCfg.Id] = sess
+			ae.sessCfgs[sessCfg.Id] = desc
+			if ae.egressRing != nil {
+				// The network is already set up, so start the session right away.
+				sess.Start()
+			}
+			ae.Info("Added session", "id", sessCfg.Id, "class", sessCfg.Class,
+				"filter", sessCfg.PathFilter)
+		}
+		policies = append(policies,
+			&egress.SessPolicy{Class: cfg.Classes[sessCfg.Class], Sess: sess})
+	}
+	ae.selector.Update(ae.Session, policies)
+	return s
+}
+
+// delSession stops and removes the traffic class session with the given id.
+func (ae *ASEntry) delSession(id mgmt.SessionType) {
+	sess := ae.sessions[id]
+	delete(ae.sessions, id)
+	delete(ae.sessCfgs, id)
+	if err := sess.Cleanup(); err != nil {
+		sess.Error("Error cleaning up session", "err", err)
+	}
+	ae.Info("Removed session", "id", id)
+}
+
+// describeSession returns a string describing the configuration of a traffic
+// class session, which changes whenever its path filter changes.
+func describeSession(cfg *config.ASEntry, sessCfg *config.SessionEntry) (string, error) {
+	filter := cfg.PathFilter(sessCfg)
+	if filter == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(pktcls.ActionMap{filter.GetName(): filter})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
 // addNewNets adds the networks in ipnets that are not currently configured.
 func (ae *ASEntry) addNewNets(ipnets []*config.IPNet) bool {
 	s := true
@@ -93,10 +227,14 @@ func (ae *ASEntry) addNewNets(ipnets []*config.IPNet) bool {
 }
 
 // delOldNets deletes currently configured networks that are not in ipnets.
+// Learned networks are kept until they expire.
 func (ae *ASEntry) delOldNets(ipnets []*config.IPNet) bool {
 	s := true
 Top:
 	for k, v := range ae.Nets {
+		if _, ok := ae.learnedNets[k]; ok {
+			continue
+		}
 		for _, ipnet := range ipnets {
 			if k == ipnet.IPNet().String() {
 				continue Top
@@ -264,9 +402,16 @@ func (ae *ASEntry) sigMgr() {
 	ticker := time.NewTicker(sigMgrTick)
 	defer ticker.Stop()
 	ae.Info("sigMgr starting")
+	// discoveryC stays nil, and thus never fires, if discovery is disabled.
+	var discoveryC <-chan time.Time
+	if *sigcmn.Discovery {
+		discoveryTicker := time.NewTicker(discoveryTick)
+		defer discoveryTicker.Stop()
+		discoveryC = discoveryTicker.C
+		ae.discover()
+	}
 Top:
 	for {
-		// TODO(kormat): handle adding new SIGs from discovery, and updating existing ones.
 		select {
 		case <-ae.sigMgrStop:
 			break Top
@@ -275,6 +420,9 @@ Top:
 				sig.ExpireFails()
 				return true
 			})
+			ae.expireLearned(time.Now())
+		case <-discoveryC:
+			ae.discover()
 		}
 	}
 	close(ae.sigMgrStop)
@@ -349,6 +497,9 @@ func (ae *ASEntry) Cleanup() error {
 }
 
 func (ae *ASEntry) cleanSessions() {
+	for id := range ae.sessions {
+		ae.delSession(id)
+	}
 	if err := ae.Session.Cleanup(); err != nil {
 		ae.Session.Error("Error cleaning up session", "err", err)
 	}
@@ -357,10 +508,13 @@ func (ae *ASEntry) cleanSessions() {
 func (ae *ASEntry) setupNet() error {
 	ae.egressRing = ringbuf.New(64, nil, "egress",
 		prometheus.Labels{"ringId": ae.IAString, "sessId": ""})
-	go egress.NewDispatcher(ae.IA, ae.egressRing, ae.Session).Run()
+	go egress.NewDispatcher(ae.IA, ae.egressRing, ae.selector).Run()
 	go ae.sigMgr()
 	go ae.monitorHealth()
 	ae.Session.Start()
+	for _, sess := range ae.sessions {
+		sess.Start()
+	}
 	ae.Info("Network setup done")
 	return nil
 }
@@ -0,0 +1,54 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/proto"
+	"github.com/scionproto/scion/go/sig/disp"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+// replyCtrl answers the request rpld with the SIG ctrl message u. Key exchange
+// and prefix announcement requests are sent from the ctrl conn of the remote
+// SIG, so the reply is sent back to the source address of the request.
+func replyCtrl(rpld *disp.RegPld, u proto.Cerealizable) error {
+	return sendCtrl(rpld.Id, u, rpld.Addr)
+}
+
+// sendCtrl sends the SIG ctrl message u with the given id to dst.
+func sendCtrl(id mgmt.MsgIdType, u proto.Cerealizable, dst *snet.Addr) error {
+	spld, err := mgmt.NewPld(id, u)
+	if err != nil {
+		return common.NewBasicError("Error creating SIGCtrl payload", err)
+	}
+	cpld, err := ctrl.NewPld(spld, nil)
+	if err != nil {
+		return common.NewBasicError("Error creating Ctrl payload", err)
+	}
+	scpld, err := cpld.SignedPld(ctrl.NullSigner)
+	if err != nil {
+		return common.NewBasicError("Error creating signed Ctrl payload", err)
+	}
+	raw, err := scpld.PackPld()
+	if err != nil {
+		return common.NewBasicError("Error packing signed Ctrl payload", err)
+	}
+	_, err = sigcmn.CtrlConn.WriteToSCION(raw, dst)
+	return err
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/sig/config"
+	"github.com/scionproto/scion/go/sig/disp"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/sigcrypto"
+	"github.com/scionproto/scion/go/sig/siginfo"
+)
+
+const (
+	// discoveryTick is the interval at which the SIGs of remote ASes are
+	// queried for their prefixes.
+	discoveryTick = 30 * time.Second
+	// learnedLifetime is the time after which learned SIGs and networks are
+	// removed, unless they are announced again.
+	learnedLifetime = 3 * discoveryTick
+)
+
+// announced contains the local networks ([]*net.IPNet) announced to remote
+// SIGs.
+var announced atomic.Value
+
+func init() {
+	announced.Store([]*net.IPNet{})
+}
+
+func setAnnounced(ipnets []*config.IPNet) {
+	nets := make([]*net.IPNet, 0, len(ipnets))
+	for _, ipnet := range ipnets {
+		nets = append(nets, ipnet.IPNet())
+	}
+	announced.Store(nets)
+}
+
+// discover sends a signed prefix announcement request to the SIG SVC address
+// of the remote AS. The SIG that receives it learns the local SIG, and answers
+// with its own announcement.
+func (ae *ASEntry) discover() {
+	req := mgmt.NewAnnReq(sigcmn.MgmtAddr, announced.Load().([]*net.IPNet))
+	if err := sigcrypto.SignAnn(sigcrypto.Local, sigcmn.IA, req.PrefixAnn,
+		time.Now()); err != nil {
+		ae.Error("Unable to sign SIGAnnReq", "err", err)
+		return
+	}
+	dst := &snet.Addr{IA: ae.IA, Host: addr.SvcSIG}
+	if err := sendCtrl(mgmt.MsgIdType(time.Now().UnixNano()), req, dst); err != nil {
+		ae.Error("Unable to send SIGAnnReq", "err", err)
+	}
+}
+
+// Learn adds the SIG and the networks of a verified prefix announcement of
+// the remote AS. They are removed after learnedLifetime, unless they are
+// announced again. Networks that are not learnable are ignored.
+func (ae *ASEntry) Learn(ann *mgmt.PrefixAnn, now time.Time) error {
+	ipnets, err := ann.IPNets()
+	if err != nil {
+		return err
+	}
+	ae.Lock()
+	defer ae.Unlock()
+	expiry := now.Add(learnedLifetime)
+	if err := ae.learnSig(ann.Addr, expiry); err != nil {
+		return err
+	}
+	for _, ipnet := range ipnets {
+		if err := ae.checkLearnable(ipnet); err != nil {
+			ae.Warn("Ignoring announced network", "net", ipnet, "err", err)
+			continue
+		}
+		if err := ae.addNet(ipnet); err != nil {
+			ae.Error("Unable to add learned network", "net", ipnet, "err", err)
+			continue
+		}
+		ae.learnedNets[ipnet.String()] = expiry
+	}
+	return nil
+}
+
+// checkLearnable returns an error if the announced network ipnet must not be
+// learned. Default routes, networks overlapping the local announced networks,
+// and networks outside the allowed networks of the AS are rejected. Overlaps
+// with the networks of other ASes are rejected by egress.NetMap.
+func (ae *ASEntry) checkLearnable(ipnet *net.IPNet) error {
+	if ones, _ := ipnet.Mask.Size(); ones == 0 {
+		return common.NewBasicError("Default route not learnable", nil)
+	}
+	ip := ipnet.IP.Mask(ipnet.Mask)
+	for _, local := range announced.Load().([]*net.IPNet) {
+		if local.Contains(ip) || ipnet.Contains(local.IP) {
+			return common.NewBasicError("Network overlaps local network", nil,
+				"local", local)
+		}
+	}
+	if !ae.cfg.AllowsNet(ipnet) {
+		return common.NewBasicError("Network not in allowed networks", nil)
+	}
+	return nil
+}
+
+// learnSig adds the SIG at a, unless it is already in the config file.
+func (ae *ASEntry) learnSig(a *mgmt.Addr, expiry time.Time) error {
+	host := a.Ctrl.Host()
+	static := false
+	ae.Sigs.Range(func(id siginfo.SigIdType, sig *siginfo.Sig) bool {
+		if sig.Static && sig.Host.IP().Equal(host.IP()) &&
+			sig.CtrlL4Port == int(a.Ctrl.Port) && sig.EncapL4Port == int(a.EncapPort) {
+			static = true
+			return false
+		}
+		return true
+	})
+	if static {
+		return nil
+	}
+	id := siginfo.SigIdType(fmt.Sprintf("learned-[%s]:%d:%d", host, a.Ctrl.Port, a.EncapPort))
+	if _, ok := ae.learnedSigs[id]; !ok {
+		err := ae.AddSig(id, host.IP(), int(a.Ctrl.Port), int(a.EncapPort), false)
+		if err != nil {
+			return err
+		}
+	}
+	ae.learnedSigs[id] = expiry
+	return nil
+}
+
+// expireLearned removes the learned SIGs and networks that have not been
+// announced again in time. Networks that are also in the config file are
+// kept.
+func (ae *ASEntry) expireLearned(now time.Time) {
+	ae.Lock()
+	defer ae.Unlock()
+	for id, expiry := range ae.learnedSigs {
+		if now.Before(expiry) {
+			continue
+		}
+		delete(ae.learnedSigs, id)
+		if err := ae.DelSig(id); err != nil {
+			ae.Error("Unable to delete expired SIG", "id", id, "err", err)
+		}
+	}
+	for key, expiry := range ae.learnedNets {
+		if now.Before(expiry) {
+			continue
+		}
+		delete(ae.learnedNets, key)
+		if _, ok := ae.staticNets[key]; ok {
+			continue
+		}
+		if ipnet, ok := ae.Nets[key]; ok {
+			if err := ae.delNet(ipnet); err != nil {
+				ae.Error("Unable to delete expired network", "net", key, "err", err)
+			}
+		}
+	}
+}
+
+// AnnHdlr handles the prefix announcements of remote SIGs. Announcements are
+// only accepted from configured ASes, and if they are signed by the remote AS.
+// Requests are answered with the announcement of the local SIG.
+func AnnHdlr() {
+	defer log.LogPanicAndExit()
+	log.Info("AnnHdlr: starting")
+	for rpld := range disp.Dispatcher.AnnC {
+		var ann *mgmt.PrefixAnn
+		switch pld := rpld.P.(type) {
+		case *mgmt.AnnReq:
+			ann = pld.PrefixAnn
+		case *mgmt.AnnRep:
+			ann = pld.PrefixAnn
+		default:
+			log.Error("AnnHdlr: non-SIGPrefixAnn payload received",
+				"src", rpld.Addr, "type", common.TypeOf(rpld.P), "Id", rpld.Id, "pld", rpld.P)
+			continue
+		}
+		if !*sigcmn.Discovery {
+			log.Warn("AnnHdlr: discovery disabled, ignoring SIGPrefixAnn", "src", rpld.Addr)
+			continue
+		}
+		ae := Map.ASEntry(rpld.Addr.IA)
+		if ae == nil {
+			log.Warn("AnnHdlr: SIGPrefixAnn from unknown AS", "src", rpld.Addr)
+			continue
+		}
+		now := time.Now()
+		if err := sigcrypto.VerifyAnn(sigcrypto.TRCs, rpld.Addr.IA, ann, now); err != nil {
+			log.Error("AnnHdlr: Invalid SIGPrefixAnn", "src", rpld.Addr, "err", err)
+			continue
+		}
+		if err := ae.Learn(ann, now); err != nil {
+			log.Error("AnnHdlr: Unable to learn SIGPrefixAnn", "src", rpld.Addr, "err", err)
+			continue
+		}
+		if _, ok := rpld.P.(*mgmt.AnnReq); !ok {
+			continue
+		}
+		rep := mgmt.NewAnnRep(sigcmn.MgmtAddr, announced.Load().([]*net.IPNet))
+		if err := sigcrypto.SignAnn(sigcrypto.Local, sigcmn.IA, rep.PrefixAnn, now); err != nil {
+			log.Error("AnnHdlr: Unable to sign SIGAnnRep", "err", err)
+			continue
+		}
+		if err := replyCtrl(rpld, rep); err != nil {
+			log.Error("AnnHdlr: Unable to send SIGAnnRep", "dst", rpld.Addr, "err", err)
+		}
+	}
+	log.Info("AnnHdlr: stopped")
+}
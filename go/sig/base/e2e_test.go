@@ -0,0 +1,380 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/ringbuf"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/sig/disp"
+	"github.com/scionproto/scion/go/sig/egress"
+	"github.com/scionproto/scion/go/sig/ingress"
+	"github.com/scionproto/scion/go/sig/metrics"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/siginfo"
+	"github.com/scionproto/scion/go/sig/xnet"
+)
+
+const ip6HdrLen = 40
+
+var (
+	// testIA is the AS of the test SIGs. They share the ctrl plane of the
+	// process, so they are in the same AS, and use distinct session ids.
+	testIA = xtest.MustParseIA("1-ff00:0:1")
+	// testNet connects the test SIGs.
+	testNet = &memNetwork{conns: make(map[string]*memConn)}
+	// icmpTun receives the ICMP errors of all test SIGs.
+	icmpTun = xnet.NewMemTun(16)
+)
+
+func init() {
+	metrics.Init("test")
+	egress.Init(icmpTun)
+}
+
+func TestEndToEnd(t *testing.T) {
+	a := &testSIG{host: net.IP{127, 0, 1, 1}, sessId: 1,
+		nets: []string{"10.1.0.0/16", "2001:db8:1::/48"}}
+	b := &testSIG{host: net.IP{127, 0, 2, 1}, sessId: 2,
+		nets: []string{"10.2.0.0/16", "2001:db8:2::/48"}}
+	initCtrl(t, a, b)
+	Convey("Given two SIGs connected by an in-memory SCION network", t, func() {
+		a.start(t, b)
+		b.start(t, a)
+		defer a.stop(t)
+		defer b.stop(t)
+		SoMsg("a healthy", a.waitHealthy(), ShouldBeTrue)
+		SoMsg("b healthy", b.waitHealthy(), ShouldBeTrue)
+		Convey("IP packets are carried both ways", func() {
+			ab4 := newTestPkt(net.ParseIP("10.1.0.1"), net.ParseIP("10.2.0.1"), 100)
+			ba4 := newTestPkt(net.ParseIP("10.2.0.1"), net.ParseIP("10.1.0.1"), 100)
+			ab6 := newTestPkt(net.ParseIP("2001:db8:1::1"), net.ParseIP("2001:db8:2::1"), 100)
+			ba6 := newTestPkt(net.ParseIP("2001:db8:2::1"), net.ParseIP("2001:db8:1::1"), 100)
+			xtest.FailOnErr(t, a.tun.Inject(ab4))
+			SoMsg("IPv4 a->b", recvPkt(b.tun), ShouldResemble, ab4)
+			xtest.FailOnErr(t, b.tun.Inject(ba4))
+			SoMsg("IPv4 b->a", recvPkt(a.tun), ShouldResemble, ba4)
+			xtest.FailOnErr(t, a.tun.Inject(ab6))
+			SoMsg("IPv6 a->b", recvPkt(b.tun), ShouldResemble, ab6)
+			xtest.FailOnErr(t, b.tun.Inject(ba6))
+			SoMsg("IPv6 b->a", recvPkt(a.tun), ShouldResemble, ba6)
+		})
+		Convey("Packets larger than a frame are carried in order", func() {
+			var pkts []common.RawBytes
+			for _, l := range []int{4000, 20, 1400, 3000} {
+				pkt := newTestPkt(net.ParseIP("10.2.0.1"), net.ParseIP("10.1.0.1"), l)
+				pkts = append(pkts, pkt)
+				xtest.FailOnErr(t, b.tun.Inject(pkt))
+			}
+			for i, pkt := range pkts {
+				SoMsg(fmt.Sprintf("pkt %d", i), recvPkt(a.tun), ShouldResemble, pkt)
+			}
+		})
+		Convey("Packets exceeding the tunnel MTU are answered with ICMP errors", func() {
+			// 1472B path MTU - 32B SCION header - 8B UDP header - 8B SIG header
+			// - 2B packet length.
+			mtu := 1422
+			pkt := newTestPkt(net.ParseIP("2001:db8:1::1"), net.ParseIP("2001:db8:2::1"), 2000)
+			xtest.FailOnErr(t, a.tun.Inject(pkt))
+			reply := recvPkt(icmpTun)
+			SoMsg("reply", reply, ShouldNotBeNil)
+			SoMsg("type", int(reply[ip6HdrLen]), ShouldEqual, layers.ICMPv6TypePacketTooBig)
+			SoMsg("mtu", int(common.Order.Uint32(reply[ip6HdrLen+4:])), ShouldEqual, mtu)
+			SoMsg("dropped", recvPkt(b.tun), ShouldBeNil)
+		})
+		Convey("Packets to unknown networks are dropped", func() {
+			pkt := newTestPkt(net.ParseIP("10.1.0.1"), net.ParseIP("10.3.0.1"), 100)
+			xtest.FailOnErr(t, a.tun.Inject(pkt))
+			SoMsg("dropped", recvPkt(b.tun), ShouldBeNil)
+		})
+	})
+}
+
+// initCtrl sets up the ctrl plane of the process on testNet. Its ctrl conn
+// listens on the ctrl addresses of sigs, which receive polls, and on the ctrl
+// address of the process, which receives the replies. The paths of all
+// sessions are empty, like paths within the local AS.
+func initCtrl(t *testing.T, sigs ...*testSIG) {
+	sigcmn.IA = testIA
+	// Used to compute the frame overhead, and as the source of ICMP errors.
+	sigcmn.Host = addr.HostFromIP(net.IP{127, 0, 0, 1})
+	sigcmn.MgmtAddr = mgmt.NewAddr(sigcmn.Host, sigcmn.DefaultCtrlPort,
+		sigcmn.DefaultEncapPort)
+	path := &sciond.PathReplyEntry{Path: &sciond.FwdPathMeta{Mtu: 1472,
+		ExpTime: uint32(time.Now().Add(time.Hour).Unix())}}
+	var err error
+	sigcmn.PathMgr, err = pathmgr.New(&pathSciond{entry: path},
+		&pathmgr.Timers{NormalRefire: time.Minute, ErrorRefire: time.Second,
+			MaxAge: time.Hour}, log.Root())
+	xtest.FailOnErr(t, err)
+	conn := testNet.listen(sigcmn.CtrlSnetAddr())
+	for _, s := range sigs {
+		testNet.bind(conn, s.ctrlAddr())
+	}
+	sigcmn.CtrlConn = conn
+	disp.Init(conn)
+	go PollReqHdlr()
+}
+
+// testSIG is a SIG, which exchanges frames and polls with a remote SIG over
+// testNet, and IP packets with the hosts of its AS over a MemTun.
+type testSIG struct {
+	host   net.IP
+	sessId mgmt.SessionType
+	nets   []string
+	tun    *xnet.MemTun
+	disp   *ingress.Dispatcher
+	sess   *egress.Session
+	ring   *ringbuf.Ring
+	// the networks of the remote SIG, routed to sess
+	routes []*net.IPNet
+}
+
+func (s *testSIG) ctrlAddr() *snet.Addr {
+	return &snet.Addr{IA: testIA, Host: addr.HostFromIP(s.host), L4Port: sigcmn.DefaultCtrlPort}
+}
+
+func (s *testSIG) encapAddr() *snet.Addr {
+	return &snet.Addr{IA: testIA, Host: addr.HostFromIP(s.host), L4Port: sigcmn.DefaultEncapPort}
+}
+
+func (s *testSIG) start(t *testing.T, remote *testSIG) {
+	s.tun = xnet.NewMemTun(64)
+	s.disp = ingress.NewDispatcher(testNet.listen(s.encapAddr()), s.tun)
+	go s.disp.Run()
+	sigMap := &siginfo.SigMap{}
+	sig := siginfo.NewSig(testIA, "remote", addr.HostFromIP(remote.host),
+		sigcmn.DefaultCtrlPort, sigcmn.DefaultEncapPort, true)
+	sigMap.Store(sig.Id, sig)
+	var err error
+	s.sess, err = egress.NewSession(testIA, s.sessId, nil, sigMap,
+		testNet.listen(&snet.Addr{IA: testIA, Host: addr.HostFromIP(s.host)}),
+		log.New("sig", s.host))
+	xtest.FailOnErr(t, err)
+	s.sess.Start()
+	// Route the networks of the remote SIG to the session.
+	s.ring = ringbuf.New(64, nil, "egress", prometheus.Labels{
+		"ringId": s.host.String(), "sessId": s.sessId.String()})
+	for _, cidr := range remote.nets {
+		_, ipnet, _ := net.ParseCIDR(cidr)
+		egress.NetMap.Add(ipnet, testIA, s.ring)
+		s.routes = append(s.routes, ipnet)
+	}
+	go egress.NewDispatcher(testIA, s.ring, egress.NewSessSelector(s.sess)).Run()
+	go egress.NewReader(s.tun).Run()
+}
+
+// waitHealthy returns whether the session of the SIG becomes healthy, i.e.,
+// its polls are answered, within five seconds.
+func (s *testSIG) waitHealthy() bool {
+	for i := 0; i < 50; i++ {
+		if s.sess.Healthy() {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func (s *testSIG) stop(t *testing.T) {
+	s.tun.Close()
+	s.ring.Close()
+	xtest.FailOnErr(t, s.sess.Cleanup())
+	xtest.FailOnErr(t, s.disp.Stop())
+	for _, ipnet := range s.routes {
+		egress.NetMap.Delete(ipnet)
+	}
+	s.routes = nil
+}
+
+// recvPkt returns the next packet written to tun, or nil if none is written
+// within a second.
+func recvPkt(tun *xnet.MemTun) common.RawBytes {
+	select {
+	case pkt := <-tun.Recv():
+		return pkt
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// newTestPkt returns an IP packet from src to dst with a payload of the given
+// length.
+func newTestPkt(src, dst net.IP, pldLen int) common.RawBytes {
+	pld := make(gopacket.Payload, pldLen)
+	for i := range pld {
+		pld[i] = byte(i)
+	}
+	var l3 gopacket.SerializableLayer
+	if src.To4() != nil {
+		l3 = &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP,
+			SrcIP: src.To4(), DstIP: dst.To4()}
+	} else {
+		l3 = &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolNoNextHeader,
+			SrcIP: src, DstIP: dst}
+	}
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, l3, pld)
+	return buf.Bytes()
+}
+
+// memNetwork is an in-memory SCION network, which delivers the packets written
+// to a memConn to the memConn listening on the destination address.
+type memNetwork struct {
+	mutex sync.Mutex
+	conns map[string]*memConn
+	// next port allocated to connections that do not request one
+	nextPort uint16
+}
+
+func (n *memNetwork) listen(laddr *snet.Addr) *memConn {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	laddr = laddr.Copy()
+	if laddr.L4Port == 0 {
+		n.nextPort++
+		laddr.L4Port = 30000 + n.nextPort
+	}
+	c := &memConn{n: n, laddr: laddr, pkts: make(chan memPkt, 64),
+		closeC: make(chan struct{})}
+	n.conns[memKey(laddr)] = c
+	c.keys = append(c.keys, memKey(laddr))
+	return c
+}
+
+// bind makes c also receive the packets sent to a.
+func (n *memNetwork) bind(c *memConn, a *snet.Addr) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.conns[memKey(a)] = c
+	c.keys = append(c.keys, memKey(a))
+}
+
+func (n *memNetwork) remove(c *memConn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, key := range c.keys {
+		if n.conns[key] == c {
+			delete(n.conns, key)
+		}
+	}
+}
+
+func (n *memNetwork) lookup(a *snet.Addr) *memConn {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.conns[memKey(a)]
+}
+
+func memKey(a *snet.Addr) string {
+	return fmt.Sprintf("%s,[%s]:%d", a.IA, a.Host, a.L4Port)
+}
+
+var _ sigcmn.FrameConn = (*memConn)(nil)
+
+type memConn struct {
+	n     *memNetwork
+	laddr *snet.Addr
+	pkts  chan memPkt
+	// the keys of the addresses c listens on
+	keys      []string
+	closeOnce sync.Once
+	closeC    chan struct{}
+}
+
+type memPkt struct {
+	raw common.RawBytes
+	src *snet.Addr
+}
+
+func (c *memConn) ReadFromSCION(b []byte) (int, *snet.Addr, error) {
+	select {
+	case pkt := <-c.pkts:
+		return copy(b, pkt.raw), pkt.src, nil
+	case <-c.closeC:
+		return 0, nil, common.NewBasicError("Connection closed", nil, "addr", c.laddr)
+	}
+}
+
+// WriteToSCION delivers a copy of b to the connection listening on raddr. Like
+// a UDP socket, it drops the packet if the receiver's queue is full.
+func (c *memConn) WriteToSCION(b []byte, raddr *snet.Addr) (int, error) {
+	dst := c.n.lookup(raddr)
+	if dst == nil {
+		return 0, common.NewBasicError("No connection listening", nil, "addr", raddr)
+	}
+	select {
+	case dst.pkts <- memPkt{raw: append(common.RawBytes(nil), b...), src: c.laddr.Copy()}:
+	default:
+	}
+	return len(b), nil
+}
+
+// Close stops listening, and unblocks pending reads.
+func (c *memConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.n.remove(c)
+		close(c.closeC)
+	})
+	return nil
+}
+
+// pathSciond is a mock SCIOND that always returns the same path.
+type pathSciond struct {
+	entry *sciond.PathReplyEntry
+}
+
+func (s *pathSciond) Connect() (sciond.Connector, error) {
+	return &pathSciondConn{s: s}, nil
+}
+
+func (s *pathSciond) ConnectTimeout(timeout time.Duration) (sciond.Connector, error) {
+	return s.Connect()
+}
+
+type pathSciondConn struct {
+	sciond.Connector
+	s *pathSciond
+}
+
+func (c *pathSciondConn) Paths(dst, src addr.IA, max uint16,
+	f sciond.PathReqFlags) (*sciond.PathReply, error) {
+
+	return &sciond.PathReply{
+		ErrorCode: sciond.ErrorOk,
+		Entries:   []sciond.PathReplyEntry{*c.s.entry},
+	}, nil
+}
+
+func (c *pathSciondConn) Close() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/sig/disp"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/sigcrypto"
+)
+
+// KeyReqHdlr answers the key exchange requests of remote SIGs, and stores the
+// established keys for the ingress dispatcher. Retransmitted requests are
+// answered with the reply of the original request.
+func KeyReqHdlr() {
+	defer log.LogPanicAndExit()
+	log.Info("KeyReqHdlr: starting")
+	for rpld := range disp.Dispatcher.KeyReqC {
+		req, ok := rpld.P.(*mgmt.KeyReq)
+		if !ok {
+			log.Error("KeyReqHdlr: non-SIGKeyReq payload received",
+				"src", rpld.Addr, "type", common.TypeOf(rpld.P), "Id", rpld.Id, "pld", rpld.P)
+			continue
+		}
+		if !sigcrypto.Enabled() {
+			log.Warn("KeyReqHdlr: encryption disabled, ignoring SIGKeyReq", "src", rpld.Addr)
+			continue
+		}
+		rep, err := sigcrypto.Keys.Reply(rpld.Addr.IA, req)
+		if err != nil {
+			log.Error("KeyReqHdlr: Rejecting SIGKeyReq", "src", rpld.Addr, "err", err)
+			continue
+		}
+		if rep == nil {
+			var key *sigcrypto.FrameKey
+			rep, key, err = sigcrypto.Respond(sigcrypto.Local, sigcrypto.TRCs, rpld.Addr.IA,
+				sigcmn.IA, req, sigcrypto.NewEpoch(time.Now()))
+			if err != nil {
+				log.Error("KeyReqHdlr: Invalid SIGKeyReq", "src", rpld.Addr, "err", err)
+				continue
+			}
+			sigcrypto.Keys.Add(rpld.Addr.IA, req, rep, key)
+			log.Info("KeyReqHdlr: established new key", "src", rpld.Addr,
+				"session", req.Session, "epoch", req.Epoch)
+		}
+		if err := replyCtrl(rpld, rep); err != nil {
+			log.Error("KeyReqHdlr: Unable to send SIGKeyRep", "dst", rpld.Addr, "err", err)
+		}
+	}
+	log.Info("KeyReqHdlr: stopped")
+}
@@ -59,7 +59,58 @@ func (am *ASMap) Range(f func(key addr.IAInt, value *ASEntry) bool) {
 	})
 }
 
+// cfgMtx serializes config reloads, and protects currCfg.
+var cfgMtx sync.Mutex
+
+// currCfg is the config that was last loaded.
+var currCfg *config.Cfg
+
 func (am *ASMap) ReloadConfig(cfg *config.Cfg) bool {
+	cfgMtx.Lock()
+	defer cfgMtx.Unlock()
+	return am.reloadConfig(cfg)
+}
+
+// UpdateConfig applies f to a copy of the last loaded config, and loads the
+// result. It returns the new config, which is loaded even if some of its
+// changes could not be applied (see the logs for details). In that case, the
+// error is non-nil.
+//
+// If persist is not nil, it is called with the loaded config before the next
+// config is loaded, such that concurrent updates and reloads are persisted in
+// the order they are loaded. An error of persist is returned.
+func (am *ASMap) UpdateConfig(f, persist func(*config.Cfg) error) (*config.Cfg, error) {
+	cfgMtx.Lock()
+	defer cfgMtx.Unlock()
+	if currCfg == nil {
+		return nil, common.NewBasicError("No config loaded", nil)
+	}
+	cfg, err := currCfg.Copy()
+	if err != nil {
+		return nil, err
+	}
+	if err := f(cfg); err != nil {
+		return nil, err
+	}
+	// Check that the modified config is still valid.
+	if cfg, err = cfg.Copy(); err != nil {
+		return nil, err
+	}
+	s := am.reloadConfig(cfg)
+	if persist != nil {
+		if err := persist(cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if !s {
+		return cfg, common.NewBasicError("Unable to apply all config changes", nil)
+	}
+	return cfg, nil
+}
+
+func (am *ASMap) reloadConfig(cfg *config.Cfg) bool {
+	currCfg = cfg
+	setAnnounced(cfg.Announce)
 	// Method calls first to prevent skips due to logical short-circuit
 	s := am.addNewIAs(cfg)
 	return am.delOldIAs(cfg) && s
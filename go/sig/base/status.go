@@ -0,0 +1,77 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"sort"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/sig/egress"
+	"github.com/scionproto/scion/go/sig/siginfo"
+)
+
+// ASStatus is a snapshot of the state of a remote AS.
+type ASStatus struct {
+	IA       addr.IA
+	Healthy  bool
+	Nets     []string
+	Sigs     []*SigStatus
+	Sessions []*egress.SessStatus
+}
+
+// SigStatus is a snapshot of the state of a remote SIG.
+type SigStatus struct {
+	Id        siginfo.SigIdType
+	Addr      string
+	Static    bool
+	FailCount uint16
+}
+
+// Status returns the state of all remote ASes, sorted by ISD-AS.
+func (am *ASMap) Status() []*ASStatus {
+	var st []*ASStatus
+	am.Range(func(_ addr.IAInt, ae *ASEntry) bool {
+		st = append(st, ae.Status())
+		return true
+	})
+	sort.Slice(st, func(i, j int) bool { return st[i].IA.IAInt() < st[j].IA.IAInt() })
+	return st
+}
+
+// Status returns the state of the remote AS, with its networks, SIGs and
+// sessions. The default session is listed first.
+func (ae *ASEntry) Status() *ASStatus {
+	ae.RLock()
+	defer ae.RUnlock()
+	st := &ASStatus{IA: ae.IA, Healthy: ae.checkHealth()}
+	for key := range ae.Nets {
+		st.Nets = append(st.Nets, key)
+	}
+	sort.Strings(st.Nets)
+	ae.Sigs.Range(func(id siginfo.SigIdType, sig *siginfo.Sig) bool {
+		st.Sigs = append(st.Sigs, &SigStatus{Id: id, Addr: sig.String(), Static: sig.Static,
+			FailCount: sig.FailCount()})
+		return true
+	})
+	sort.Slice(st.Sigs, func(i, j int) bool { return st.Sigs[i].Id < st.Sigs[j].Id })
+	st.Sessions = append(st.Sessions, ae.Session.Status())
+	for _, sess := range ae.sessions {
+		st.Sessions = append(st.Sessions, sess.Status())
+	}
+	sort.Slice(st.Sessions[1:], func(i, j int) bool {
+		return st.Sessions[i+1].Id < st.Sessions[j+1].Id
+	})
+	return st
+}
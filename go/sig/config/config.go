@@ -20,9 +20,13 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pktcls"
+	"github.com/scionproto/scion/go/sig/mgmt"
 	"github.com/scionproto/scion/go/sig/siginfo"
 )
 
@@ -30,6 +34,9 @@ import (
 type Cfg struct {
 	ASes          map[addr.IA]*ASEntry
 	ConfigVersion uint64
+	// Announce contains the local prefixes that are announced to the SIGs of
+	// remote ASes, if discovery is enabled.
+	Announce []*IPNet `json:",omitempty"`
 }
 
 // Load a JSON config file from path and parse it into a Cfg struct.
@@ -38,29 +45,168 @@ func LoadFromFile(path string) (*Cfg, error) {
 	if err != nil {
 		return nil, common.NewBasicError("Unable to open SIG config", err)
 	}
+	return Parse(b)
+}
+
+// Parse parses and validates a JSON config.
+func Parse(b []byte) (*Cfg, error) {
 	cfg := &Cfg{}
 	if err := json.Unmarshal(b, cfg); err != nil {
 		return nil, common.NewBasicError("Unable to parse SIG config", err)
 	}
-	cfg.postprocess()
+	if err := cfg.postprocess(); err != nil {
+		return nil, common.NewBasicError("Invalid SIG config", err)
+	}
 	return cfg, nil
 }
 
+// Copy returns a deep copy of cfg.
+func (cfg *Cfg) Copy() (*Cfg, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to marshal SIG config", err)
+	}
+	return Parse(b)
+}
+
+// SaveToFile atomically replaces the config file at path with cfg. The file is
+// written to a temporary file in the same directory first, which is then
+// renamed to path.
+func (cfg *Cfg) SaveToFile(path string) error {
+	b, err := json.MarshalIndent(cfg, "", "    ")
+	if err != nil {
+		return common.NewBasicError("Unable to marshal SIG config", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return common.NewBasicError("Unable to create temporary SIG config", err)
+	}
+	defer os.Remove(f.Name())
+	if fi, statErr := os.Stat(path); statErr == nil {
+		// Keep the permissions of the existing file.
+		err = f.Chmod(fi.Mode())
+	}
+	if err == nil {
+		_, err = f.Write(append(b, '\n'))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return common.NewBasicError("Unable to write temporary SIG config", err,
+			"path", f.Name())
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return common.NewBasicError("Unable to replace SIG config", err, "path", path)
+	}
+	return nil
+}
+
 // postprocess sets the SIG IDs of the SIG objects in cfg according the keys in
-// SIGSet.
-func (cfg *Cfg) postprocess() {
-	// Populate IDs
-	for _, as := range cfg.ASes {
+// SIGSet, and validates the traffic class sessions.
+func (cfg *Cfg) postprocess() error {
+	for ia, as := range cfg.ASes {
+		// Populate IDs
 		for id := range as.Sigs {
 			sig := as.Sigs[id]
 			sig.Id = id
 		}
+		if err := as.validateSessions(); err != nil {
+			return common.NewBasicError("Invalid sessions", err, "ia", ia)
+		}
 	}
+	return nil
 }
 
 type ASEntry struct {
 	Nets []*IPNet
 	Sigs SIGSet
+	// AllowedNets restricts the networks learned from the prefix
+	// announcements of the AS, if discovery is enabled. Only networks
+	// contained in one of the allowed networks are learned; if empty, no
+	// networks are learned.
+	AllowedNets []*IPNet `json:",omitempty"`
+	// Classes contains the traffic classes of packets sent to the AS, keyed
+	// by name.
+	Classes pktcls.ClassMap `json:",omitempty"`
+	// PathFilters contains path filters (ActionFilterPaths), keyed by name.
+	PathFilters pktcls.ActionMap `json:",omitempty"`
+	// Sessions maps traffic classes to sessions. Packets are sent on the
+	// session of the first class they match; packets matching no class are
+	// sent on the default session (ID 0), which uses all paths.
+	Sessions []*SessionEntry `json:",omitempty"`
+}
+
+// validateSessions checks that the sessions have unique non-default IDs, and
+// refer to existing classes and path filters.
+func (as *ASEntry) validateSessions() error {
+	ids := make(map[mgmt.SessionType]struct{})
+	for _, s := range as.Sessions {
+		if s.Id == DefaultSessId {
+			return common.NewBasicError("Session ID reserved for default session", nil,
+				"id", s.Id)
+		}
+		if _, ok := ids[s.Id]; ok {
+			return common.NewBasicError("Duplicate session ID", nil, "id", s.Id)
+		}
+		ids[s.Id] = struct{}{}
+		if _, ok := as.Classes[s.Class]; !ok {
+			return common.NewBasicError("Unknown traffic class", nil,
+				"id", s.Id, "class", s.Class)
+		}
+		if s.PathFilter == "" {
+			continue
+		}
+		action, ok := as.PathFilters[s.PathFilter]
+		if !ok {
+			return common.NewBasicError("Unknown path filter", nil,
+				"id", s.Id, "filter", s.PathFilter)
+		}
+		if _, ok := action.(*pktcls.ActionFilterPaths); !ok {
+			return common.NewBasicError("Path filter is not an ActionFilterPaths", nil,
+				"id", s.Id, "filter", s.PathFilter, "type", common.TypeOf(action))
+		}
+	}
+	return nil
+}
+
+// AllowsNet returns whether ipnet is contained in one of the allowed networks
+// of the AS.
+func (as *ASEntry) AllowsNet(ipnet *net.IPNet) bool {
+	ones, bits := ipnet.Mask.Size()
+	for _, allowed := range as.AllowedNets {
+		aOnes, aBits := allowed.Mask.Size()
+		if aBits == bits && aOnes <= ones && allowed.IPNet().Contains(ipnet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// PathFilter returns the path filter of s, or nil if s uses all paths. The
+// configuration must have been validated.
+func (as *ASEntry) PathFilter(s *SessionEntry) *pktcls.ActionFilterPaths {
+	if s.PathFilter == "" {
+		return nil
+	}
+	return as.PathFilters[s.PathFilter].(*pktcls.ActionFilterPaths)
+}
+
+// DefaultSessId is the ID of the session used for packets that do not match
+// any traffic class.
+const DefaultSessId mgmt.SessionType = 0
+
+// SessionEntry describes a session carrying a traffic class.
+type SessionEntry struct {
+	Id mgmt.SessionType
+	// Class is the name of the traffic class sent on the session.
+	Class string
+	// PathFilter is the name of the path filter restricting the paths of
+	// the session. If empty, all paths are used.
+	PathFilter string `json:",omitempty"`
 }
 
 // IPNet is custom type of net.IPNet, to allow custom unmarshalling.
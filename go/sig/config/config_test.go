@@ -16,7 +16,9 @@ package config
 
 import (
 	"flag"
+	"io/ioutil"
 	"net"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -109,3 +111,93 @@ func TestLoadFromFile(t *testing.T) {
 		}
 	})
 }
+
+func TestSaveToFile(t *testing.T) {
+	Convey("Given a loaded config", t, func() {
+		cfg, err := LoadFromFile(filepath.Join("testdata", "02-classes.json"))
+		xtest.FailOnErr(t, err)
+		dir, err := ioutil.TempDir("", "sig-config")
+		xtest.FailOnErr(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "sig.json")
+		Convey("Copies are equal but independent", func() {
+			c, err := cfg.Copy()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("copy", c, ShouldResemble, cfg)
+			c.ASes[xtest.MustParseIA("1-ff00:0:1")].Nets = nil
+			SoMsg("orig", cfg.ASes[xtest.MustParseIA("1-ff00:0:1")].Nets, ShouldNotBeNil)
+		})
+		Convey("Saved configs can be loaded again", func() {
+			xtest.FailOnErr(t, ioutil.WriteFile(path, []byte("{}"), 0640))
+			SoMsg("err", cfg.SaveToFile(path), ShouldBeNil)
+			loaded, err := LoadFromFile(path)
+			SoMsg("load err", err, ShouldBeNil)
+			SoMsg("cfg", loaded, ShouldResemble, cfg)
+			fi, err := os.Stat(path)
+			xtest.FailOnErr(t, err)
+			SoMsg("mode", fi.Mode(), ShouldEqual, os.FileMode(0640))
+			files, err := ioutil.ReadDir(dir)
+			xtest.FailOnErr(t, err)
+			SoMsg("no temporary files", len(files), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestLoadSessions(t *testing.T) {
+	Convey("Load config with traffic classes", t, func() {
+		cfg, err := LoadFromFile(filepath.Join("testdata", "02-classes.json"))
+		So(err, ShouldBeNil)
+		as := cfg.ASes[xtest.MustParseIA("1-ff00:0:1")]
+		So(as, ShouldNotBeNil)
+		SoMsg("sessions", as.Sessions, ShouldResemble, []*SessionEntry{
+			{Id: 1, Class: "voice", PathFilter: "low-latency"},
+			{Id: 2, Class: "bulk", PathFilter: "no-isd-2"},
+		})
+		SoMsg("class", as.Classes["voice"].GetName(), ShouldEqual, "voice")
+		for _, sess := range as.Sessions {
+			filter := as.PathFilter(sess)
+			So(filter, ShouldNotBeNil)
+			SoMsg("filter", filter.GetName(), ShouldEqual, sess.PathFilter)
+		}
+	})
+	Convey("Sessions must refer to existing classes", t, func() {
+		_, err := LoadFromFile(filepath.Join("testdata", "03-unknown-class.json"))
+		SoMsg("err", err, ShouldNotBeNil)
+	})
+	Convey("Sessions must not use the default session ID", t, func() {
+		_, err := LoadFromFile(filepath.Join("testdata", "04-default-session-id.json"))
+		SoMsg("err", err, ShouldNotBeNil)
+	})
+}
+
+func TestAllowsNet(t *testing.T) {
+	Convey("Given an AS with allowed networks", t, func() {
+		as := &ASEntry{AllowedNets: []*IPNet{mustIPNet(t, "10.1.0.0/16"),
+			mustIPNet(t, "2001:db8::/32")}}
+		testCases := []struct {
+			Net     string
+			Allowed bool
+		}{
+			{"10.1.0.0/16", true},
+			{"10.1.2.0/24", true},
+			{"10.0.0.0/8", false},
+			{"10.2.0.0/24", false},
+			{"0.0.0.0/0", false},
+			{"2001:db8:1::/48", true},
+			{"::/0", false},
+		}
+		for _, tc := range testCases {
+			SoMsg(tc.Net, as.AllowsNet(mustIPNet(t, tc.Net).IPNet()), ShouldEqual, tc.Allowed)
+		}
+		Convey("No networks are allowed by default", func() {
+			as := &ASEntry{}
+			SoMsg("allowed", as.AllowsNet(mustIPNet(t, "10.1.0.0/16").IPNet()), ShouldBeFalse)
+		})
+	})
+}
+
+func mustIPNet(t *testing.T, s string) *IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	xtest.FailOnErr(t, err)
+	return (*IPNet)(ipnet)
+}
@@ -25,9 +25,10 @@ import (
 	"github.com/scionproto/scion/go/lib/pktdisp"
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
 )
 
-func Init(conn *snet.Conn) {
+func Init(conn sigcmn.FrameConn) {
 	go pktdisp.PktDispatcher(conn, dispFunc)
 }
 
@@ -35,12 +36,15 @@ type RegType int
 
 const (
 	RegPollRep RegType = iota
+	RegKeyRep
 )
 
 func (rt RegType) String() string {
 	switch rt {
 	case RegPollRep:
 		return "RegPollRep"
+	case RegKeyRep:
+		return "RegKeyRep"
 	}
 	return fmt.Sprintf("UNKNOWN (%d)", rt)
 }
@@ -61,12 +65,18 @@ type dispRegistry struct {
 	sync.RWMutex
 	PollReqC RegPldChan
 	pollRep  map[RegPollKey]RegPldChan
+	KeyReqC  RegPldChan
+	keyRep   map[RegPollKey]RegPldChan
+	AnnC     RegPldChan
 }
 
 func newDispReg() *dispRegistry {
 	return &dispRegistry{
 		PollReqC: make(RegPldChan, 16),
 		pollRep:  make(map[RegPollKey]RegPldChan),
+		KeyReqC:  make(RegPldChan, 16),
+		keyRep:   make(map[RegPollKey]RegPldChan),
+		AnnC:     make(RegPldChan, 16),
 	}
 }
 
@@ -76,6 +86,8 @@ func (dm *dispRegistry) Register(regType RegType, key RegPollKey, c RegPldChan)
 	switch regType {
 	case RegPollRep:
 		dm.pollRep[key] = c
+	case RegKeyRep:
+		dm.keyRep[key] = c
 	default:
 		return common.NewBasicError("Register: Unsupported dispatcher RegType", nil, "v", regType)
 	}
@@ -88,6 +100,8 @@ func (dm *dispRegistry) Unregister(regType RegType, key RegPollKey) error {
 	switch regType {
 	case RegPollRep:
 		delete(dm.pollRep, key)
+	case RegKeyRep:
+		delete(dm.keyRep, key)
 	default:
 		return common.NewBasicError("Unregister: Unsupported dispatcher RegType", nil, "v", regType)
 	}
@@ -118,6 +132,29 @@ func (dm *dispRegistry) sigCtrl(pld *mgmt.Pld, addr *snet.Addr) {
 			return
 		}
 		entry <- regPld
+	case *mgmt.KeyReq:
+		select {
+		case dm.KeyReqC <- &RegPld{Id: msgId, P: pld, Addr: addr}:
+		default:
+			log.Warn("Dropping SIG KeyReq, handler busy", "src", addr)
+		}
+	case *mgmt.KeyRep:
+		entry, ok := dm.keyRep[MkRegPollKey(addr.IA, pld.Session)]
+		if !ok {
+			log.Warn("Unexpected SIG KeyRep received", "src", addr, "pld", pld)
+			return
+		}
+		select {
+		case entry <- &RegPld{Id: msgId, P: pld, Addr: addr}:
+		default:
+			log.Warn("Dropping SIG KeyRep, session monitor busy", "src", addr)
+		}
+	case *mgmt.AnnReq, *mgmt.AnnRep:
+		select {
+		case dm.AnnC <- &RegPld{Id: msgId, P: pld, Addr: addr}:
+		default:
+			log.Warn("Dropping SIG prefix announcement, handler busy", "src", addr)
+		}
 	default:
 		log.Error("Unsupported ctrl payload type", common.TypeOf(pld), "src", addr)
 	}
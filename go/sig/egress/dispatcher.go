@@ -27,15 +27,15 @@ type egressDispatcher struct {
 	log.Logger
 	ia               addr.IA
 	ring             *ringbuf.Ring
-	sess             *Session
+	selector         *SessSelector
 	pktsRecvCounters map[metrics.CtrPairKey]metrics.CtrPair
 }
 
-func NewDispatcher(ia addr.IA, ring *ringbuf.Ring, sess *Session) *egressDispatcher {
+func NewDispatcher(ia addr.IA, ring *ringbuf.Ring, selector *SessSelector) *egressDispatcher {
 	return &egressDispatcher{
 		Logger:           log.New("ia", ia.String()),
 		ring:             ring,
-		sess:             sess,
+		selector:         selector,
 		pktsRecvCounters: make(map[metrics.CtrPairKey]metrics.CtrPair),
 	}
 }
@@ -59,7 +59,11 @@ func (ed *egressDispatcher) Run() {
 				ed.Debug("EgressDispatcher: unable to find session")
 				continue
 			}
-			sess.ring.Write(ringbuf.EntryList{buf}, true)
+			if n, _ := sess.ring.Write(ringbuf.EntryList{buf}, true); n < 0 {
+				// The session was removed by a config reload after it was chosen.
+				egressFreePkts.Write(ringbuf.EntryList{buf}, true)
+				continue
+			}
 			ed.updateMetrics(sess.IA.IAInt(), sess.SessId, len(buf))
 		}
 	}
@@ -67,7 +71,7 @@ func (ed *egressDispatcher) Run() {
 }
 
 func (ed *egressDispatcher) chooseSess(b common.RawBytes) *Session {
-	return ed.sess
+	return ed.selector.ChooseSess(b)
 }
 
 func (ed *egressDispatcher) updateMetrics(remoteIA addr.IAInt, sessId mgmt.SessionType, read int) {
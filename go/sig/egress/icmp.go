@@ -0,0 +1,153 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"net"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/util"
+)
+
+const (
+	ip4HdrLen  = 20
+	ip6HdrLen  = 40
+	icmpHdrLen = 8
+	// ip6MinMTU is the minimum MTU of IPv6 links. Smaller IPv6 packets are
+	// always carried, even if they do not fit into a single frame.
+	ip6MinMTU = 1280
+	// icmp4MaxLen and icmp6MaxLen are the maximum lengths of the ICMP errors,
+	// which quote as much of the offending packet as fits.
+	icmp4MaxLen = 576
+	icmp6MaxLen = ip6MinMTU
+
+	icmp4Proto          = 1
+	icmp6Proto          = 58
+	icmp4DestUnreach    = 3
+	icmp4CodeFragNeeded = 4
+	icmp6PktTooBig      = 2
+	// ICMPv6 types below icmp6InfoType are errors.
+	icmp6InfoType = 128
+	ip4FlagDF     = 0x40
+	ip4FragOffMax = 0x1fff
+	icmpTTL       = 64
+)
+
+// newTooBig returns the ICMP error, which tells the sender of pkt that pkt
+// exceeds the tunnel mtu, or nil if no error must be sent. Errors are not sent
+// for IPv4 packets that may be fragmented, for IPv6 packets that do not exceed
+// the minimum IPv6 MTU, as these are carried across multiple frames, and for
+// packets that are ICMP errors themselves. The error is sent from local if it
+// is of the same address family as pkt, and from the destination of pkt
+// otherwise.
+func newTooBig(pkt common.RawBytes, mtu int, local net.IP) common.RawBytes {
+	if len(pkt) <= mtu || len(pkt) == 0 {
+		return nil
+	}
+	switch pkt[0] >> 4 {
+	case ip4Ver:
+		return newFragNeeded(pkt, mtu, local)
+	case ip6Ver:
+		return newPktTooBig(pkt, mtu, local)
+	}
+	return nil
+}
+
+func newFragNeeded(pkt common.RawBytes, mtu int, local net.IP) common.RawBytes {
+	hdrLen := int(pkt[0]&0x0f) * 4
+	if hdrLen < ip4HdrLen || len(pkt) < hdrLen+icmpHdrLen {
+		return nil
+	}
+	flagsFragOff := common.Order.Uint16(pkt[6:8])
+	if pkt[6]&ip4FlagDF == 0 || flagsFragOff&ip4FragOffMax != 0 {
+		return nil
+	}
+	if pkt[9] == icmp4Proto && isICMP4Error(pkt[hdrLen]) {
+		return nil
+	}
+	src := local.To4()
+	if src == nil {
+		src = net.IP(pkt[16:20])
+	}
+	quote := pkt[:intMin(len(pkt), icmp4MaxLen-ip4HdrLen-icmpHdrLen)]
+	b := make(common.RawBytes, ip4HdrLen+icmpHdrLen+len(quote))
+	b[0] = ip4Ver<<4 | ip4HdrLen/4
+	common.Order.PutUint16(b[2:4], uint16(len(b)))
+	b[8] = icmpTTL
+	b[9] = icmp4Proto
+	copy(b[12:16], src)
+	copy(b[16:20], pkt[12:16])
+	common.Order.PutUint16(b[10:12], util.Checksum(b[:ip4HdrLen]))
+	icmp := b[ip4HdrLen:]
+	icmp[0] = icmp4DestUnreach
+	icmp[1] = icmp4CodeFragNeeded
+	// The next-hop MTU follows 2 unused bytes.
+	common.Order.PutUint16(icmp[6:8], uint16(mtu))
+	copy(icmp[icmpHdrLen:], quote)
+	common.Order.PutUint16(icmp[2:4], util.Checksum(icmp))
+	return b
+}
+
+func newPktTooBig(pkt common.RawBytes, mtu int, local net.IP) common.RawBytes {
+	if mtu < ip6MinMTU {
+		mtu = ip6MinMTU
+	}
+	if len(pkt) <= mtu || len(pkt) < ip6HdrLen+icmpHdrLen {
+		return nil
+	}
+	if pkt[6] == icmp6Proto && pkt[ip6HdrLen] < icmp6InfoType {
+		return nil
+	}
+	src := local
+	if src.To4() != nil || src.To16() == nil {
+		src = net.IP(pkt[24:40])
+	}
+	quote := pkt[:intMin(len(pkt), icmp6MaxLen-ip6HdrLen-icmpHdrLen)]
+	b := make(common.RawBytes, ip6HdrLen+icmpHdrLen+len(quote))
+	b[0] = ip6Ver << 4
+	common.Order.PutUint16(b[4:6], uint16(icmpHdrLen+len(quote)))
+	b[6] = icmp6Proto
+	b[7] = icmpTTL
+	copy(b[8:24], src.To16())
+	copy(b[24:40], pkt[8:24])
+	icmp := b[ip6HdrLen:]
+	icmp[0] = icmp6PktTooBig
+	common.Order.PutUint32(icmp[4:8], uint32(mtu))
+	copy(icmp[icmpHdrLen:], quote)
+	// The checksum covers the pseudo header with the addresses, the length
+	// and the protocol.
+	pseudo := make(common.RawBytes, ip6HdrLen)
+	copy(pseudo, b[8:40])
+	common.Order.PutUint32(pseudo[32:36], uint32(len(icmp)))
+	pseudo[39] = icmp6Proto
+	common.Order.PutUint16(icmp[2:4], util.Checksum(pseudo, icmp))
+	return b
+}
+
+// isICMP4Error returns whether the ICMPv4 type t is an error.
+func isICMP4Error(t uint8) bool {
+	switch t {
+	case 3, 4, 5, 11, 12:
+		return true
+	}
+	return false
+}
+
+func intMin(x, y int) int {
+	if x <= y {
+		return x
+	}
+	return y
+}
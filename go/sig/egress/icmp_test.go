@@ -0,0 +1,110 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/util"
+)
+
+func TestNewTooBig(t *testing.T) {
+	local4 := net.IP{192, 0, 2, 254}
+	Convey("Given an IPv4 packet with the DF flag set", t, func() {
+		pkt := newTestPkt(net.ParseIP("10.1.0.1"), net.ParseIP("10.2.0.1"), 1000)
+		pkt[6] |= ip4FlagDF
+		Convey("Packets exceeding the MTU are answered with fragmentation needed", func() {
+			reply := newTooBig(pkt, 900, local4)
+			SoMsg("reply", reply, ShouldNotBeNil)
+			SoMsg("len", len(reply), ShouldEqual, icmp4MaxLen)
+			SoMsg("ip checksum", util.Checksum(reply[:ip4HdrLen]), ShouldEqual, 0)
+			SoMsg("proto", int(reply[9]), ShouldEqual, icmp4Proto)
+			SoMsg("src", net.IP(reply[12:16]).Equal(local4), ShouldBeTrue)
+			SoMsg("dst", net.IP(reply[16:20]).Equal(net.ParseIP("10.1.0.1")), ShouldBeTrue)
+			icmp := reply[ip4HdrLen:]
+			SoMsg("icmp checksum", util.Checksum(icmp), ShouldEqual, 0)
+			SoMsg("type", int(icmp[0]), ShouldEqual, icmp4DestUnreach)
+			SoMsg("code", int(icmp[1]), ShouldEqual, icmp4CodeFragNeeded)
+			SoMsg("mtu", int(common.Order.Uint16(icmp[6:8])), ShouldEqual, 900)
+			SoMsg("quote", icmp[icmpHdrLen:], ShouldResemble, pkt[:len(icmp)-icmpHdrLen])
+		})
+		Convey("Packets within the MTU are not answered", func() {
+			SoMsg("reply", newTooBig(pkt, len(pkt), local4), ShouldBeNil)
+		})
+		Convey("Packets that may be fragmented are not answered", func() {
+			pkt[6] &^= ip4FlagDF
+			SoMsg("reply", newTooBig(pkt, 900, local4), ShouldBeNil)
+		})
+	})
+	Convey("Given an IPv6 packet", t, func() {
+		src, dst := net.ParseIP("2001:db8:1::1"), net.ParseIP("2001:db8:2::1")
+		pkt := newTestPkt(src, dst, 1500)
+		Convey("Packets exceeding the MTU are answered with packet too big", func() {
+			reply := newTooBig(pkt, 1400, local4)
+			SoMsg("reply", reply, ShouldNotBeNil)
+			SoMsg("len", len(reply), ShouldEqual, icmp6MaxLen)
+			SoMsg("next hdr", int(reply[6]), ShouldEqual, icmp6Proto)
+			// The local address is IPv4, so the error is sent from the destination.
+			SoMsg("src", net.IP(reply[8:24]).Equal(dst), ShouldBeTrue)
+			SoMsg("dst", net.IP(reply[24:40]).Equal(src), ShouldBeTrue)
+			icmp := reply[ip6HdrLen:]
+			pseudo := make(common.RawBytes, ip6HdrLen)
+			copy(pseudo, reply[8:40])
+			common.Order.PutUint32(pseudo[32:36], uint32(len(icmp)))
+			pseudo[39] = icmp6Proto
+			SoMsg("icmp checksum", util.Checksum(pseudo, icmp), ShouldEqual, 0)
+			SoMsg("type", int(icmp[0]), ShouldEqual, icmp6PktTooBig)
+			SoMsg("mtu", int(common.Order.Uint32(icmp[4:8])), ShouldEqual, 1400)
+			SoMsg("quote", icmp[icmpHdrLen:], ShouldResemble, pkt[:len(icmp)-icmpHdrLen])
+		})
+		Convey("The minimum IPv6 MTU is always carried", func() {
+			SoMsg("reply", newTooBig(pkt[:ip6MinMTU], 1000, local4), ShouldBeNil)
+			reply := newTooBig(pkt, 1000, local4)
+			SoMsg("reply", reply, ShouldNotBeNil)
+			SoMsg("mtu", int(common.Order.Uint32(reply[ip6HdrLen+4:])), ShouldEqual, ip6MinMTU)
+		})
+		Convey("ICMPv6 errors are not answered", func() {
+			pkt[6] = icmp6Proto
+			pkt[ip6HdrLen] = icmp6PktTooBig
+			SoMsg("reply", newTooBig(pkt, 1400, local4), ShouldBeNil)
+		})
+	})
+}
+
+// newTestPkt returns an IP packet from src to dst with a payload of the given
+// length.
+func newTestPkt(src, dst net.IP, pldLen int) common.RawBytes {
+	pld := make(gopacket.Payload, pldLen)
+	for i := range pld {
+		pld[i] = byte(i)
+	}
+	var l3 gopacket.SerializableLayer
+	if src.To4() != nil {
+		l3 = &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP,
+			SrcIP: src.To4(), DstIP: dst.To4()}
+	} else {
+		l3 = &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolNoNextHeader,
+			SrcIP: src, DstIP: dst}
+	}
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, l3, pld)
+	return buf.Bytes()
+}
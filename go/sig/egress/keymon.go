@@ -0,0 +1,131 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/sig/disp"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/sigcrypto"
+	"github.com/scionproto/scion/go/sig/siginfo"
+)
+
+const (
+	// Time after which an unanswered key exchange is restarted
+	keyExchangeTout = 5 * time.Second
+)
+
+// keyMonitor establishes the frame keys of a session with its current remote
+// SIG. It is driven by the session monitor. Key exchanges are started when
+// the session has no key, when the remote SIG changes, every
+// sigcrypto.RekeyInterval, and when the worker runs low on sequence numbers.
+type keyMonitor struct {
+	log.Logger
+	sm *sessMonitor
+	// the key exchange waiting for a reply, nil if none is in progress.
+	kx *sigcrypto.KeyExchange
+	// the start of the current key exchange.
+	kxStart time.Time
+	// the remote the current key exchange was started with.
+	kxRemote *RemoteInfo
+	// the id of the remote SIG the session's key was established with.
+	keySigId siginfo.SigIdType
+	// set when the worker asked for a new key.
+	rekey bool
+}
+
+func newKeyMonitor(sm *sessMonitor) *keyMonitor {
+	return &keyMonitor{Logger: sm.Logger, sm: sm}
+}
+
+// tick starts a key exchange if needed, or retransmits the request of the
+// current one.
+func (km *keyMonitor) tick() {
+	select {
+	case <-km.sm.sess.rekeyC:
+		km.rekey = true
+	default:
+	}
+	remote := km.sm.sess.Remote()
+	if remote == nil || remote.Sig == nil || remote.sessPath == nil {
+		return
+	}
+	if km.kx != nil {
+		if km.kxRemote.Sig.Id == remote.Sig.Id && time.Since(km.kxStart) < keyExchangeTout {
+			// Retransmit the request, the remote SIG replies with the same key.
+			km.send(remote)
+			return
+		}
+		km.Debug("keyMonitor: restarting key exchange", "epoch", km.kx.Epoch())
+		km.kx = nil
+	}
+	key := km.sm.sess.FrameKey()
+	if key != nil && !km.rekey && km.keySigId == remote.Sig.Id &&
+		time.Since(key.Created) < sigcrypto.RekeyInterval {
+		return
+	}
+	epoch := sigcrypto.NewEpoch(time.Now())
+	if key != nil && epoch == key.Epoch {
+		// A new key must start a new epoch.
+		epoch++
+	}
+	kx, err := sigcrypto.NewKeyExchange(sigcrypto.Local, sigcmn.IA, km.sm.sess.IA,
+		km.sm.sess.SessId, epoch)
+	if err != nil {
+		km.Error("keyMonitor: Unable to start key exchange", "err", err)
+		return
+	}
+	km.kx, km.kxStart, km.kxRemote = kx, time.Now(), remote
+	km.send(remote)
+}
+
+// send sends the request of the current key exchange. Requests are sent from
+// the ctrl conn, so that the remote SIG's reply reaches the ctrl dispatcher.
+func (km *keyMonitor) send(remote *RemoteInfo) {
+	msgId := mgmt.MsgIdType(time.Now().UnixNano())
+	km.sm.sendCtrl(sigcmn.CtrlConn, msgId, km.kx.Req(), remote)
+}
+
+func (km *keyMonitor) handleRep(rpld *disp.RegPld) {
+	rep, ok := rpld.P.(*mgmt.KeyRep)
+	if !ok {
+		km.Error("keyMonitor: non-SIGKeyRep payload received",
+			"src", rpld.Addr, "type", common.TypeOf(rpld.P), "pld", rpld.P)
+		return
+	}
+	if !km.sm.sess.IA.Eq(rpld.Addr.IA) {
+		km.Error("keyMonitor: SIGKeyRep from wrong IA",
+			"expected", km.sm.sess.IA, "actual", rpld.Addr.IA)
+		return
+	}
+	if km.kx == nil || rep.Epoch != km.kx.Epoch() {
+		// Retransmitted reply of a finished key exchange.
+		return
+	}
+	key, err := km.kx.Finish(rep, sigcrypto.TRCs)
+	if err != nil {
+		km.Error("keyMonitor: Invalid SIGKeyRep", "src", rpld.Addr, "err", err)
+		return
+	}
+	km.Info("keyMonitor: established new key", "epoch", key.Epoch, "remote", km.kxRemote)
+	km.sm.sess.frameKey.Store(key)
+	km.keySigId = km.kxRemote.Sig.Id
+	km.kx = nil
+	km.rekey = false
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/sig/disp"
+	"github.com/scionproto/scion/go/sig/metrics"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+// extraPath is an additional path of a multipath session. Each extra path is
+// health checked with its own polls to the current remote SIG.
+type extraPath struct {
+	sp *sessPath
+	// the time the path was added to the session.
+	added time.Time
+	// the last time a PollRep was received on the path.
+	lastReply time.Time
+}
+
+func (ep *extraPath) healthy(now time.Time) bool {
+	return !ep.lastReply.IsZero() && now.Sub(ep.lastReply) <= tout
+}
+
+func (ep *extraPath) timedOut(now time.Time) bool {
+	last := ep.lastReply
+	if last.IsZero() {
+		last = ep.added
+	}
+	return now.Sub(last) > tout
+}
+
+// updatePaths maintains the extra paths of a session that spreads its frames
+// across several paths. Once the session has a working remote SIG and path,
+// up to sigcmn.SessPaths-1 other paths with the fewest failures are polled,
+// and the ones that answer are published to the worker, together with the
+// session's main path.
+func (sm *sessMonitor) updatePaths() {
+	now := time.Now()
+	sm.prunePathPolls(now)
+	remote := sm.sess.Remote()
+	if remote == nil || remote.Sig == nil || remote.sessPath == nil || sm.needUpdate {
+		// Wait until the main path of the session works.
+		sm.extraPaths = make(map[spathmeta.PathKey]*extraPath)
+		return
+	}
+	for key, ep := range sm.extraPaths {
+		if _, ok := sm.sessPathPool[key]; !ok || key == remote.sessPath.key {
+			delete(sm.extraPaths, key)
+		} else if ep.timedOut(now) {
+			sm.Debug("Path timeout", "path", ep.sp)
+			ep.sp.fail()
+			delete(sm.extraPaths, key)
+		}
+	}
+	for len(sm.extraPaths) < *sigcmn.SessPaths-1 {
+		sp := sm.sessPathPool.getExcluding(func(key spathmeta.PathKey) bool {
+			_, ok := sm.extraPaths[key]
+			return ok || key == remote.sessPath.key
+		})
+		if sp == nil {
+			break
+		}
+		sm.extraPaths[sp.key] = &extraPath{sp: sp, added: now}
+	}
+	paths := []*weightedPath{newWeightedPath(remote.sessPath)}
+	for _, ep := range sm.extraPaths {
+		if ep.healthy(now) {
+			paths = append(paths, newWeightedPath(ep.sp))
+		}
+		sm.sendPathPoll(remote, ep.sp)
+	}
+	sm.sess.currRemote.Store(&RemoteInfo{Sig: remote.Sig, sessPath: remote.sessPath,
+		paths: paths})
+	metrics.SessPaths.WithLabelValues(sm.sess.IA.String(),
+		sm.sess.SessId.String()).Set(float64(len(paths)))
+}
+
+// sendPathPoll polls the SIG of remote on the extra path sp.
+func (sm *sessMonitor) sendPathPoll(remote *RemoteInfo, sp *sessPath) {
+	msgId := sm.newMsgId()
+	sm.pathPolls[msgId] = sp.key
+	sm.addProbe(msgId, sp, false)
+	sm.sendCtrl(sm.sess.conn, msgId, mgmt.NewPollReq(sigcmn.MgmtAddr, sm.sess.SessId),
+		&RemoteInfo{Sig: remote.Sig, sessPath: sp})
+	sm.incPathCtr(metrics.PathPollsSent, sp.key)
+}
+
+// handlePathRep handles the replies to the polls of extra paths. It returns
+// false if rpld does not answer such a poll.
+func (sm *sessMonitor) handlePathRep(rpld *disp.RegPld) bool {
+	key, ok := sm.pathPolls[rpld.Id]
+	if !ok {
+		return false
+	}
+	delete(sm.pathPolls, rpld.Id)
+	if ep, ok := sm.extraPaths[key]; ok {
+		ep.lastReply = time.Now()
+	}
+	sm.incPathCtr(metrics.PathPollRepsRecv, key)
+	return true
+}
+
+// prunePathPolls forgets the polls that were not answered in time. Message
+// IDs are the send timestamps of the polls.
+func (sm *sessMonitor) prunePathPolls(now time.Time) {
+	for msgId := range sm.pathPolls {
+		if now.Sub(time.Unix(0, int64(msgId))) > tout {
+			delete(sm.pathPolls, msgId)
+		}
+	}
+}
+
+// incPathCtr increments the counter of the path key in v.
+func (sm *sessMonitor) incPathCtr(v *prometheus.CounterVec, key spathmeta.PathKey) {
+	v.WithLabelValues(sm.sess.IA.String(), sm.sess.SessId.String(), key.String()).Inc()
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"time"
+
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/sig/metrics"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+const (
+	// probeInterval is the interval at which paths that are not used by a
+	// session are polled, to measure their RTT and loss.
+	probeInterval = 2 * time.Second
+	// minPathSwitchInterval is the minimum time between two switches of the
+	// path of a session to a better path.
+	minPathSwitchInterval = 10 * time.Second
+)
+
+// probe is an outstanding poll, which measures the RTT and loss of its path.
+type probe struct {
+	sp   *sessPath
+	sent time.Time
+	// true if the poll was sent on a path the session does not use.
+	candidate bool
+}
+
+// addProbe records the poll with id msgId, sent on the path sp.
+func (sm *sessMonitor) addProbe(msgId mgmt.MsgIdType, sp *sessPath, candidate bool) {
+	now := time.Now()
+	sm.probes[msgId] = &probe{sp: sp, sent: now, candidate: candidate}
+	sp.lastProbe = now
+}
+
+// probeReply updates the RTT and loss of the path of the poll answered by
+// msgId. It returns the probe, or nil if there is no such poll.
+func (sm *sessMonitor) probeReply(msgId mgmt.MsgIdType, now time.Time) *probe {
+	p, ok := sm.probes[msgId]
+	if !ok {
+		return nil
+	}
+	delete(sm.probes, msgId)
+	p.sp.probeReply(now.Sub(p.sent), now)
+	sm.setPathMetrics(p.sp)
+	return p
+}
+
+// expireProbes counts the polls that were not answered in time as lost.
+func (sm *sessMonitor) expireProbes(now time.Time) {
+	for msgId, p := range sm.probes {
+		if now.Sub(p.sent) > tout {
+			delete(sm.probes, msgId)
+			p.sp.probeLost()
+			sm.setPathMetrics(p.sp)
+		}
+	}
+}
+
+// probeCandidate polls the remote SIG on the unused path that was probed
+// least recently, so that the session can switch to it if it is better.
+func (sm *sessMonitor) probeCandidate(now time.Time) {
+	remote := sm.sess.Remote()
+	if remote == nil || remote.Sig == nil || remote.sessPath == nil {
+		return
+	}
+	var cand *sessPath
+	for key, sp := range sm.sessPathPool {
+		if _, ok := sm.extraPaths[key]; ok || key == remote.sessPath.key {
+			continue
+		}
+		if cand == nil || sp.lastProbe.Before(cand.lastProbe) {
+			cand = sp
+		}
+	}
+	if cand == nil || now.Sub(cand.lastProbe) < probeInterval {
+		return
+	}
+	msgId := sm.newMsgId()
+	sm.addProbe(msgId, cand, true)
+	sm.sendCtrl(sm.sess.conn, msgId, mgmt.NewPollReq(sigcmn.MgmtAddr, sm.sess.SessId),
+		&RemoteInfo{Sig: remote.Sig, sessPath: cand})
+	sm.incPathCtr(metrics.PathPollsSent, cand.key)
+}
+
+// betterPath returns a recently answered path that is much better than the
+// current path curr, or nil if the session should keep curr.
+func (sm *sessMonitor) betterPath(curr *sessPath, now time.Time) *sessPath {
+	obj := *sigcmn.PathObjective
+	if obj == sigcmn.PathObjFailures || now.Sub(sm.lastPathSwitch) < minPathSwitchInterval {
+		return nil
+	}
+	sp := sm.sessPathPool.best(obj, func(key spathmeta.PathKey) bool {
+		return key == curr.key
+	})
+	if sp == nil || now.Sub(sp.lastReply) > tout || !sp.muchBetter(curr, obj) {
+		return nil
+	}
+	return sp
+}
+
+func (sm *sessMonitor) setPathMetrics(sp *sessPath) {
+	ia, sessId, key := sm.sess.IA.String(), sm.sess.SessId.String(), sp.key.String()
+	metrics.PathRTT.WithLabelValues(ia, sessId, key).Set(sp.rtt.Seconds())
+	metrics.PathLoss.WithLabelValues(ia, sessId, key).Set(sp.loss)
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/log"
 	"github.com/scionproto/scion/go/lib/ringbuf"
+	"github.com/scionproto/scion/go/sig/xnet"
 )
 
 const (
@@ -37,9 +38,15 @@ const (
 	ip6DstOff = 24
 )
 
-var egressFreePkts *ringbuf.Ring
+var (
+	egressFreePkts *ringbuf.Ring
+	// tunIO is the TUN device to which ICMP errors for egress packets are
+	// written.
+	tunIO xnet.Tun
+)
 
-func Init() {
+func Init(tun xnet.Tun) {
+	tunIO = tun
 	egressFreePkts = ringbuf.New(egressFreePktsCap, func() interface{} {
 		return make(common.RawBytes, common.MaxMTU)
 	}, "egress", prometheus.Labels{"ringId": "freePkts", "sessId": ""})
@@ -47,10 +54,10 @@ func Init() {
 
 type Reader struct {
 	log   log.Logger
-	tunIO io.ReadWriteCloser
+	tunIO xnet.Tun
 }
 
-func NewReader(tunIO io.ReadWriteCloser) *Reader {
+func NewReader(tunIO xnet.Tun) *Reader {
 	return &Reader{log: log.New(), tunIO: tunIO}
 }
 
@@ -113,11 +120,22 @@ BatchLoop:
 }
 
 func (r *Reader) getDestIP(b common.RawBytes) (net.IP, error) {
+	if len(b) == 0 {
+		return nil, common.NewBasicError("Empty egress packet", nil)
+	}
 	ver := (b[0] >> 4)
 	switch ver {
 	case ip4Ver:
+		if len(b) < ip4DstOff+net.IPv4len {
+			return nil, common.NewBasicError("Truncated IPv4 egress packet", nil,
+				"len", len(b))
+		}
 		return net.IP(b[ip4DstOff : ip4DstOff+net.IPv4len]), nil
 	case ip6Ver:
+		if len(b) < ip6DstOff+net.IPv6len {
+			return nil, common.NewBasicError("Truncated IPv6 egress packet", nil,
+				"len", len(b))
+		}
 		return net.IP(b[ip6DstOff : ip6DstOff+net.IPv6len]), nil
 	default:
 		return nil, common.NewBasicError("Unsupported IP protocol version in egress packet", nil,
@@ -0,0 +1,75 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+func Test_Reader_getDestIP(t *testing.T) {
+	ip4Pkt := newTestIPv4Pkt(0)
+	ip6Pkt := newTestIPv6Pkt(0)
+	var testCases = []struct {
+		desc string
+		pkt  common.RawBytes
+		ip   net.IP
+	}{
+		{"IPv4", ip4Pkt, net.IP{192, 0, 2, 1}},
+		{"IPv6", ip6Pkt, net.ParseIP("2001:db8:1::1")},
+		{"Truncated IPv4", ip4Pkt[:ip4DstOff+2], nil},
+		{"Truncated IPv6", ip6Pkt[:ip6DstOff+8], nil},
+		{"Unknown version", common.RawBytes{0x50, 0, 0, 0}, nil},
+		{"Empty", common.RawBytes{}, nil},
+	}
+	Convey("Reader.getDestIP()", t, func() {
+		r := &Reader{}
+		for _, tc := range testCases {
+			Convey(tc.desc, func() {
+				ip, err := r.getDestIP(tc.pkt)
+				if tc.ip == nil {
+					SoMsg("err", err, ShouldNotBeNil)
+				} else {
+					SoMsg("err", err, ShouldBeNil)
+					SoMsg("ip", ip.Equal(tc.ip), ShouldBeTrue)
+				}
+			})
+		}
+	})
+}
+
+func newTestIPv6Pkt(trafficClass uint8) common.RawBytes {
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(
+		buf,
+		gopacket.SerializeOptions{FixLengths: true},
+		&layers.IPv6{
+			Version:      6,
+			TrafficClass: trafficClass,
+			NextHeader:   layers.IPProtocolNoNextHeader,
+			HopLimit:     64,
+			SrcIP:        net.ParseIP("2001:db8::1"),
+			DstIP:        net.ParseIP("2001:db8:1::1"),
+		},
+		gopacket.Payload([]byte{1, 2, 3, 4}),
+	)
+	return buf.Bytes()
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"sync/atomic"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pktcls"
+)
+
+// SessPolicy maps a traffic class to the session carrying it.
+type SessPolicy struct {
+	Class *pktcls.Class
+	Sess  *Session
+}
+
+// SessSelector chooses the session of egress packets by classifying them
+// with the traffic classes of its policies. It is safe for concurrent use.
+type SessSelector struct {
+	// *sessSelectorState
+	state atomic.Value
+}
+
+type sessSelectorState struct {
+	def      *Session
+	policies []*SessPolicy
+}
+
+// NewSessSelector returns a selector that sends all packets on def.
+func NewSessSelector(def *Session) *SessSelector {
+	ss := &SessSelector{}
+	ss.Update(def, nil)
+	return ss
+}
+
+// Update atomically replaces the default session and the policies. Packets
+// are sent on the session of the first policy whose class they match, or on
+// def if they match none.
+func (ss *SessSelector) Update(def *Session, policies []*SessPolicy) {
+	ss.state.Store(&sessSelectorState{def: def, policies: policies})
+}
+
+// ChooseSess returns the session for the IP packet b.
+func (ss *SessSelector) ChooseSess(b common.RawBytes) *Session {
+	state := ss.state.Load().(*sessSelectorState)
+	if len(state.policies) == 0 {
+		// Avoid parsing the packet if there is nothing to classify.
+		return state.def
+	}
+	pkt := pktcls.NewPacket(b)
+	for _, policy := range state.policies {
+		if policy.Class.Eval(pkt) {
+			return policy.Sess
+		}
+	}
+	return state.def
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pktcls"
+)
+
+func TestSessSelector(t *testing.T) {
+	Convey("Given a selector with a DSCP EF class and a catch-all class", t, func() {
+		def := &Session{SessId: 0}
+		voice := &Session{SessId: 1}
+		bulk := &Session{SessId: 2}
+		ss := NewSessSelector(def)
+		efPkt := newTestIPv4Pkt(0x2e << 2)
+		otherPkt := newTestIPv4Pkt(0)
+		efPkt6 := newTestIPv6Pkt(0x2e << 2)
+		otherPkt6 := newTestIPv6Pkt(0)
+		SoMsg("no policies", ss.ChooseSess(efPkt), ShouldEqual, def)
+
+		ss.Update(def, []*SessPolicy{
+			{
+				Class: pktcls.NewClass("voice", pktcls.NewCondAnyOf(
+					pktcls.NewCondIPv4(&pktcls.IPv4MatchDSCP{DSCP: 0x2e}),
+					pktcls.NewCondIPv6(&pktcls.IPv6MatchDSCP{DSCP: 0x2e}),
+				)),
+				Sess: voice,
+			},
+			{
+				Class: pktcls.NewClass("bulk", pktcls.NewCondIPv4(&pktcls.IPv4MatchDestination{
+					Net: &net.IPNet{IP: net.IP{192, 0, 2, 0}, Mask: net.CIDRMask(24, 32)},
+				})),
+				Sess: bulk,
+			},
+		})
+		Convey("Packets are sent on the session of the first matching class", func() {
+			SoMsg("voice", ss.ChooseSess(efPkt), ShouldEqual, voice)
+			SoMsg("bulk", ss.ChooseSess(otherPkt), ShouldEqual, bulk)
+		})
+		Convey("IPv6 packets are classified", func() {
+			SoMsg("voice", ss.ChooseSess(efPkt6), ShouldEqual, voice)
+			SoMsg("default", ss.ChooseSess(otherPkt6), ShouldEqual, def)
+		})
+		Convey("Packets matching no class are sent on the default session", func() {
+			SoMsg("default", ss.ChooseSess(common.RawBytes{0x60, 0, 0, 0}), ShouldEqual, def)
+		})
+	})
+}
+
+func newTestIPv4Pkt(tos uint8) common.RawBytes {
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(
+		buf,
+		gopacket.SerializeOptions{FixLengths: true},
+		&layers.IPv4{
+			Version: 4,
+			TOS:     tos,
+			SrcIP:   net.IP{198, 51, 100, 1},
+			DstIP:   net.IP{192, 0, 2, 1},
+		},
+		gopacket.Payload([]byte{1, 2, 3, 4}),
+	)
+	return buf.Bytes()
+}
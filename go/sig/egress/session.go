@@ -24,11 +24,13 @@ import (
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/log"
 	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/pktcls"
 	"github.com/scionproto/scion/go/lib/pktdisp"
 	"github.com/scionproto/scion/go/lib/ringbuf"
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/sig/mgmt"
 	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/sigcrypto"
 	"github.com/scionproto/scion/go/sig/siginfo"
 )
 
@@ -38,6 +40,8 @@ type Session struct {
 	log.Logger
 	IA     addr.IA
 	SessId mgmt.SessionType
+	// filter restricting the paths of the session, nil if all paths are used
+	filter *pktcls.ActionFilterPaths
 	// pool of paths, managed by pathmgr
 	pool *pathmgr.SyncPaths
 	// remote SIGs
@@ -45,41 +49,66 @@ type Session struct {
 	// *RemoteInfo
 	currRemote atomic.Value
 	// bool
-	healthy        atomic.Value
+	healthy atomic.Value
+	// *sigcrypto.FrameKey, the key of encrypted frames
+	frameKey atomic.Value
+	// signals the session monitor that the worker needs a new key
+	rekeyC         chan struct{}
 	ring           *ringbuf.Ring
-	conn           *snet.Conn
+	conn           sigcmn.FrameConn
 	sessMonStop    chan struct{}
 	sessMonStopped chan struct{}
 	workerStopped  chan struct{}
+	// true once the session monitor and worker have been started
+	started bool
 }
 
-func NewSession(dstIA addr.IA, sessId mgmt.SessionType,
-	sigMap *siginfo.SigMap, logger log.Logger) (*Session, error) {
+// NewSessConn returns a connection for the frames and polls of a session. Any
+// unexpected messages it receives are logged.
+func NewSessConn() (sigcmn.FrameConn, error) {
+	// Not using a fixed local port, as this is for outgoing data only.
+	conn, err := snet.ListenSCION(sigcmn.Network, &snet.Addr{IA: sigcmn.IA, Host: sigcmn.Host})
+	if err != nil {
+		return nil, err
+	}
+	// spawn a PktDispatcher to log any unexpected messages received on a write-only connection.
+	go pktdisp.PktDispatcher(conn, pktdisp.DispLogger)
+	return conn, nil
+}
+
+// NewSession creates a session to dstIA, which sends its frames and polls on
+// conn. If filter is not nil, the session only uses the paths allowed by
+// filter. The session takes ownership of conn, and closes it on Cleanup, or if
+// creating the session fails.
+func NewSession(dstIA addr.IA, sessId mgmt.SessionType, filter *pktcls.ActionFilterPaths,
+	sigMap *siginfo.SigMap, conn sigcmn.FrameConn, logger log.Logger) (*Session, error) {
 	var err error
 	s := &Session{
 		Logger: logger.New("sessId", sessId),
 		IA:     dstIA,
 		SessId: sessId,
+		filter: filter,
 		sigMap: sigMap,
+		conn:   conn,
 	}
-	if s.pool, err = sigcmn.PathMgr.Watch(sigcmn.IA, s.IA); err != nil {
+	if s.pool, err = sigcmn.PathMgr.WatchFilter(sigcmn.IA, s.IA, filter); err != nil {
+		conn.Close()
 		return nil, err
 	}
 	s.currRemote.Store((*RemoteInfo)(nil))
 	s.healthy.Store(false)
+	s.frameKey.Store((*sigcrypto.FrameKey)(nil))
+	s.rekeyC = make(chan struct{}, 1)
 	s.ring = ringbuf.New(64, nil, "egress",
 		prometheus.Labels{"ringId": dstIA.String(), "sessId": sessId.String()})
-	// Not using a fixed local port, as this is for outgoing data only.
-	s.conn, err = snet.ListenSCION("udp4", &snet.Addr{IA: sigcmn.IA, Host: sigcmn.Host})
-	// spawn a PktDispatcher to log any unexpected messages received on a write-only connection.
-	go pktdisp.PktDispatcher(s.conn, pktdisp.DispLogger)
 	s.sessMonStop = make(chan struct{})
 	s.sessMonStopped = make(chan struct{})
 	s.workerStopped = make(chan struct{})
-	return s, err
+	return s, nil
 }
 
 func (s *Session) Start() {
+	s.started = true
 	go newSessMonitor(s).run()
 	go NewWorker(s, s.Logger).Run()
 }
@@ -87,15 +116,17 @@ func (s *Session) Start() {
 func (s *Session) Cleanup() error {
 	s.ring.Close()
 	close(s.sessMonStop)
-	s.Debug("egress.Session Cleanup: wait for worker")
-	<-s.workerStopped
-	s.Debug("egress.Session Cleanup: wait for session monitor")
-	<-s.sessMonStopped
+	if s.started {
+		s.Debug("egress.Session Cleanup: wait for worker")
+		<-s.workerStopped
+		s.Debug("egress.Session Cleanup: wait for session monitor")
+		<-s.sessMonStopped
+	}
 	s.Debug("egress.Session Cleanup: closing conn")
 	if err := s.conn.Close(); err != nil {
 		return common.NewBasicError("Unable to close conn", err)
 	}
-	if err := sigcmn.PathMgr.Unwatch(sigcmn.IA, s.IA); err != nil {
+	if err := sigcmn.PathMgr.UnwatchFilter(sigcmn.IA, s.IA, s.filter); err != nil {
 		return common.NewBasicError("Unable to unwatch src-dst", err, "src", sigcmn.IA, "dst", s.IA)
 	}
 	return nil
@@ -105,16 +136,64 @@ func (s *Session) Remote() *RemoteInfo {
 	return s.currRemote.Load().(*RemoteInfo)
 }
 
+// FrameKey returns the key of encrypted frames, or nil if no key has been
+// established yet.
+func (s *Session) FrameKey() *sigcrypto.FrameKey {
+	return s.frameKey.Load().(*sigcrypto.FrameKey)
+}
+
+// requestRekey asks the session monitor to establish a new key. It does not
+// block.
+func (s *Session) requestRekey() {
+	select {
+	case s.rekeyC <- struct{}{}:
+	default:
+	}
+}
+
 func (s *Session) Healthy() bool {
 	// FIxME(kormat): export as metric.
 	return s.healthy.Load().(bool)
 }
 
+// SessStatus is a snapshot of the state of a session.
+type SessStatus struct {
+	Id      mgmt.SessionType
+	Healthy bool
+	// The remote SIG and path of the session, empty if there is none.
+	Sig  string `json:",omitempty"`
+	Path string `json:",omitempty"`
+	// The paths frames are spread across, if the session uses multiple paths.
+	Paths []string `json:",omitempty"`
+}
+
+// Status returns the current state of the session.
+func (s *Session) Status() *SessStatus {
+	st := &SessStatus{Id: s.SessId, Healthy: s.Healthy()}
+	remote := s.Remote()
+	if remote == nil {
+		return st
+	}
+	if remote.Sig != nil {
+		st.Sig = remote.Sig.String()
+	}
+	if remote.sessPath != nil {
+		st.Path = remote.sessPath.pathEntry.Path.String()
+	}
+	for _, p := range remote.paths {
+		st.Paths = append(st.Paths, p.pathEntry.Path.String())
+	}
+	return st
+}
+
 type RemoteInfo struct {
 	Sig      *siginfo.Sig
 	sessPath *sessPath
+	// healthy paths that frames are spread across, including sessPath. If
+	// empty, all frames are sent on sessPath.
+	paths []*weightedPath
 }
 
 func (r *RemoteInfo) String() string {
-	return fmt.Sprintf("Sig: %s Path: %s", r.Sig, r.sessPath)
+	return fmt.Sprintf("Sig: %s Path: %s Paths: %d", r.Sig, r.sessPath, len(r.paths))
 }
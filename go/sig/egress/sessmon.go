@@ -22,9 +22,13 @@ import (
 	"github.com/scionproto/scion/go/lib/log"
 	"github.com/scionproto/scion/go/lib/pathmgr"
 	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/proto"
 	"github.com/scionproto/scion/go/sig/disp"
+	"github.com/scionproto/scion/go/sig/metrics"
 	"github.com/scionproto/scion/go/sig/mgmt"
 	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/sigcrypto"
 	"github.com/scionproto/scion/go/sig/siginfo"
 )
 
@@ -58,12 +62,32 @@ type sessMonitor struct {
 	updateMsgId mgmt.MsgIdType
 	// the last time a PollRep was received.
 	lastReply time.Time
+	// establishes the frame keys if encryption is enabled, nil otherwise.
+	keyMon *keyMonitor
+	// the additional paths of sessions that use multiple paths.
+	extraPaths map[spathmeta.PathKey]*extraPath
+	// the paths of the outstanding polls of extra paths, by message id.
+	pathPolls map[mgmt.MsgIdType]spathmeta.PathKey
+	// the id of the last message sent.
+	lastMsgId mgmt.MsgIdType
+	// the outstanding polls, by message id, which measure the RTT and loss
+	// of their paths.
+	probes map[mgmt.MsgIdType]*probe
+	// the last time the session switched to a better path.
+	lastPathSwitch time.Time
 }
 
 func newSessMonitor(sess *Session) *sessMonitor {
-	return &sessMonitor{
+	sm := &sessMonitor{
 		Logger: sess.Logger, sess: sess, pool: sess.pool, sessPathPool: make(sessPathPool),
+		extraPaths: make(map[spathmeta.PathKey]*extraPath),
+		pathPolls:  make(map[mgmt.MsgIdType]spathmeta.PathKey),
+		probes:     make(map[mgmt.MsgIdType]*probe),
 	}
+	if sigcrypto.Enabled() {
+		sm.keyMon = newKeyMonitor(sm)
+	}
+	return sm
 }
 
 func (sm *sessMonitor) run() {
@@ -75,6 +99,11 @@ func (sm *sessMonitor) run() {
 	// Register with SIG ctrl dispatcher
 	regc := make(disp.RegPldChan, 1)
 	disp.Dispatcher.Register(disp.RegPollRep, disp.MkRegPollKey(sm.sess.IA, sm.sess.SessId), regc)
+	keyc := make(disp.RegPldChan, 1)
+	if sm.keyMon != nil {
+		disp.Dispatcher.Register(disp.RegKeyRep,
+			disp.MkRegPollKey(sm.sess.IA, sm.sess.SessId), keyc)
+	}
 	sm.lastReply = time.Now()
 	sm.Info("sessMonitor: starting")
 Top:
@@ -83,12 +112,25 @@ Top:
 		case <-sm.sess.sessMonStop:
 			break Top
 		case <-reqTick.C:
+			now := time.Now()
+			sm.expireProbes(now)
 			// Update paths and sigs
 			sm.sessPathPool.update(sm.pool.Load().APS)
-			sm.updateRemote()
+			sm.updateRemote(now)
 			sm.sendReq()
+			if *sigcmn.PathObjective != sigcmn.PathObjFailures {
+				sm.probeCandidate(now)
+			}
+			if *sigcmn.SessPaths > 1 {
+				sm.updatePaths()
+			}
+			if sm.keyMon != nil {
+				sm.keyMon.tick()
+			}
 		case rpld := <-regc:
 			sm.handleRep(rpld)
+		case rpld := <-keyc:
+			sm.keyMon.handleRep(rpld)
 		}
 	}
 	err := disp.Dispatcher.Unregister(disp.RegPollRep, disp.MkRegPollKey(sm.sess.IA,
@@ -96,10 +138,17 @@ Top:
 	if err != nil {
 		log.Error("sessMonitor: unable to unregister from ctrl dispatcher", "err", err)
 	}
+	if sm.keyMon != nil {
+		err := disp.Dispatcher.Unregister(disp.RegKeyRep, disp.MkRegPollKey(sm.sess.IA,
+			sm.sess.SessId))
+		if err != nil {
+			log.Error("sessMonitor: unable to unregister from ctrl dispatcher", "err", err)
+		}
+	}
 	sm.Info("sessMonitor: stopped")
 }
 
-func (sm *sessMonitor) updateRemote() {
+func (sm *sessMonitor) updateRemote(now time.Time) {
 	currRemote := sm.smRemote
 	var currSig *siginfo.Sig
 	var currSessPath *sessPath
@@ -109,7 +158,8 @@ func (sm *sessMonitor) updateRemote() {
 		currSig = currRemote.Sig
 		currSessPath = currRemote.sessPath
 	}
-	since := time.Since(sm.lastReply)
+	switched := false
+	since := now.Sub(sm.lastReply)
 	if since > tout {
 		if currSig != nil {
 			currSig.Fail()
@@ -144,9 +194,23 @@ func (sm *sessMonitor) updateRemote() {
 			currSessPath = sm.getNewPath(nil)
 			sm.needUpdate = true
 		}
+		if !sm.needUpdate {
+			// The better path was answered recently, so the session can
+			// switch to it right away.
+			if sp := sm.betterPath(currSessPath, now); sp != nil {
+				sm.Info("sessMonitor: switching to better path", "old", currSessPath,
+					"new", sp)
+				currSessPath = sp
+				sm.lastPathSwitch = now
+				switched = true
+			}
+		}
 	}
 	sm.sess.healthy.Store(!sm.needUpdate)
 	sm.smRemote = &RemoteInfo{Sig: currSig, sessPath: currSessPath}
+	if switched {
+		sm.sess.currRemote.Store(sm.smRemote)
+	}
 }
 
 func (sm *sessMonitor) getNewSig(old *siginfo.Sig) *siginfo.Sig {
@@ -167,7 +231,7 @@ func (sm *sessMonitor) getNewPath(old *sessPath) *sessPath {
 			return sp
 		}
 	}
-	// Get path with lowest failure count
+	// Get the best path according to the path objective
 	return sm.sessPathPool.get("")
 }
 
@@ -175,13 +239,36 @@ func (sm *sessMonitor) sendReq() {
 	if sm.smRemote == nil || sm.smRemote.Sig == nil || sm.smRemote.sessPath == nil {
 		return
 	}
-	now := time.Now()
-	msgId := mgmt.MsgIdType(now.UnixNano())
+	msgId := sm.newMsgId()
 	if sm.needUpdate {
 		sm.updateMsgId = msgId
 		sm.Debug("sessMonitor: trying new remote", "msgId", msgId, "remote", sm.smRemote)
 	}
-	spld, err := mgmt.NewPld(msgId, mgmt.NewPollReq(sigcmn.MgmtAddr, sm.sess.SessId))
+	// XXX(kormat): if this blocks, both the sessMon and egress worker
+	// goroutines will block. Can't just use SetWriteDeadline, as both
+	// goroutines write to it.
+	sm.addProbe(msgId, sm.smRemote.sessPath, false)
+	sm.sendCtrl(sm.sess.conn, msgId, mgmt.NewPollReq(sigcmn.MgmtAddr, sm.sess.SessId),
+		sm.smRemote)
+	sm.incPathCtr(metrics.PathPollsSent, sm.smRemote.sessPath.key)
+}
+
+// newMsgId returns a unique id for a new message, based on the current time.
+func (sm *sessMonitor) newMsgId() mgmt.MsgIdType {
+	msgId := mgmt.MsgIdType(time.Now().UnixNano())
+	if msgId <= sm.lastMsgId {
+		msgId = sm.lastMsgId + 1
+	}
+	sm.lastMsgId = msgId
+	return msgId
+}
+
+// sendCtrl sends the SIG ctrl message u to the ctrl address of the SIG of
+// remote, on the path of remote.
+func (sm *sessMonitor) sendCtrl(conn sigcmn.FrameConn, msgId mgmt.MsgIdType, u proto.Cerealizable,
+	remote *RemoteInfo) {
+
+	spld, err := mgmt.NewPld(msgId, u)
 	if err != nil {
 		sm.Error("sessMonitor: Error creating SIGCtrl payload", "err", err)
 		return
@@ -201,17 +288,17 @@ func (sm *sessMonitor) sendReq() {
 		sm.Error("sessMonitor: Error packing signed Ctrl payload", "err", err)
 		return
 	}
-	raddr := sm.smRemote.Sig.CtrlSnetAddr()
-	raddr.Path = spath.New(sm.smRemote.sessPath.pathEntry.Path.FwdPath)
-	if err := raddr.Path.InitOffsets(); err != nil {
-		sm.Error("sessMonitor: Error initializing path offsets", "err", err)
+	raddr := remote.Sig.CtrlSnetAddr()
+	// Paths to remote SIGs in the local AS are empty.
+	if len(remote.sessPath.pathEntry.Path.FwdPath) > 0 {
+		raddr.Path = spath.New(remote.sessPath.pathEntry.Path.FwdPath)
+		if err := raddr.Path.InitOffsets(); err != nil {
+			sm.Error("sessMonitor: Error initializing path offsets", "err", err)
+		}
 	}
-	raddr.NextHopHost = sm.smRemote.sessPath.pathEntry.HostInfo.Host()
-	raddr.NextHopPort = sm.smRemote.sessPath.pathEntry.HostInfo.Port
-	// XXX(kormat): if this blocks, both the sessMon and egress worker
-	// goroutines will block. Can't just use SetWriteDeadline, as both
-	// goroutines write to it.
-	_, err = sm.sess.conn.WriteToSCION(raw, raddr)
+	raddr.NextHopHost = remote.sessPath.pathEntry.HostInfo.Host()
+	raddr.NextHopPort = remote.sessPath.pathEntry.HostInfo.Port
+	_, err = conn.WriteToSCION(raw, raddr)
 	if err != nil {
 		sm.Error("sessMonitor: Error sending signed Ctrl payload", "err", err)
 	}
@@ -229,7 +316,17 @@ func (sm *sessMonitor) handleRep(rpld *disp.RegPld) {
 			"expected", sm.sess.IA, "actual", rpld.Addr.IA)
 		return
 	}
+	if p := sm.probeReply(rpld.Id, time.Now()); p != nil && p.candidate {
+		sm.incPathCtr(metrics.PathPollRepsRecv, p.sp.key)
+		return
+	}
+	if sm.handlePathRep(rpld) {
+		return
+	}
 	sm.lastReply = time.Now()
+	if sm.smRemote != nil && sm.smRemote.sessPath != nil {
+		sm.incPathCtr(metrics.PathPollRepsRecv, sm.smRemote.sessPath.key)
+	}
 	if sm.needUpdate && sm.updateMsgId == rpld.Id {
 		// Only update the session's RemoteInfo if we get a response matching
 		// the last poll we sent.
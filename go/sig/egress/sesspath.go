@@ -21,24 +21,48 @@ import (
 
 	"github.com/scionproto/scion/go/lib/sciond"
 	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/sig/sigcmn"
 )
 
-const pathFailExpiration = 5 * time.Minute
+const (
+	pathFailExpiration = 5 * time.Minute
+	// Weight of paths without failures
+	maxPathWeight = 8
+	// Weight of new samples in the moving averages of RTT and loss
+	ewmaWeight = 0.125
+	// Number of probes after which the RTT and loss of a path are known
+	minProbes = 3
+	// Relative RTT improvement (latency objective) and absolute loss
+	// improvement (loss objective) a path must offer to replace the current
+	// path of a session
+	rttHysteresis  = 0.2
+	lossHysteresis = 0.05
+)
 
 type sessPathPool map[spathmeta.PathKey]*sessPath
 
-// Return the path with the fewest failures, excluding the current path (if specified).
+// Return the best path according to the path objective, excluding the current
+// path (if specified).
 func (spp sessPathPool) get(currKey spathmeta.PathKey) *sessPath {
+	return spp.getExcluding(func(k spathmeta.PathKey) bool { return k == currKey })
+}
+
+// Return the best path according to the path objective, excluding the paths
+// for which exclude returns true.
+func (spp sessPathPool) getExcluding(exclude func(spathmeta.PathKey) bool) *sessPath {
+	return spp.best(*sigcmn.PathObjective, exclude)
+}
+
+// best returns the best path according to the objective obj, excluding the
+// paths for which exclude returns true.
+func (spp sessPathPool) best(obj string, exclude func(spathmeta.PathKey) bool) *sessPath {
 	var sp *sessPath
-	var minFail uint16 = math.MaxUint16
 	for k, v := range spp {
-		if k == currKey {
-			// Exclude the current path, if specified.
+		if exclude(k) {
 			continue
 		}
-		if v.failCount < minFail {
+		if sp == nil || v.better(sp, obj) {
 			sp = v
-			minFail = v.failCount
 		}
 	}
 	return sp
@@ -68,6 +92,14 @@ type sessPath struct {
 	pathEntry *sciond.PathReplyEntry
 	lastFail  time.Time
 	failCount uint16
+	// moving averages of the RTT and loss of the polls sent on the path.
+	rtt  time.Duration
+	loss float64
+	// the number of polls sent on the path that were answered or lost.
+	probes int
+	// the last time a poll was sent on the path, and answered.
+	lastProbe time.Time
+	lastReply time.Time
 }
 
 func newSessPath(key spathmeta.PathKey, pathEntry *sciond.PathReplyEntry) *sessPath {
@@ -87,7 +119,132 @@ func (sp *sessPath) expireFails() {
 	}
 }
 
+// probeReply records a poll on the path that was answered after rtt.
+func (sp *sessPath) probeReply(rtt time.Duration, now time.Time) {
+	if sp.rtt == 0 {
+		sp.rtt = rtt
+	} else {
+		sp.rtt += time.Duration(ewmaWeight * float64(rtt-sp.rtt))
+	}
+	sp.loss -= ewmaWeight * sp.loss
+	sp.probes++
+	sp.lastReply = now
+}
+
+// probeLost records a poll on the path that was not answered in time.
+func (sp *sessPath) probeLost() {
+	sp.loss += ewmaWeight * (1 - sp.loss)
+	sp.probes++
+}
+
+// measured returns true if the RTT and loss of the path are known.
+func (sp *sessPath) measured() bool {
+	return sp.probes >= minProbes && sp.rtt != 0
+}
+
+// better returns true if sp is a better path than other according to the
+// objective obj. Measured paths are preferred over unknown ones, and ties are
+// broken by the number of failures.
+func (sp *sessPath) better(other *sessPath, obj string) bool {
+	if obj != sigcmn.PathObjFailures && sp.measured() != other.measured() {
+		return sp.measured()
+	}
+	if sp.measured() && other.measured() {
+		switch {
+		case obj == sigcmn.PathObjLoss && sp.loss != other.loss:
+			return sp.loss < other.loss
+		case obj != sigcmn.PathObjFailures && sp.rtt != other.rtt:
+			return sp.rtt < other.rtt
+		}
+	}
+	return sp.failCount < other.failCount
+}
+
+// muchBetter returns true if sp improves enough on the current path curr,
+// according to the objective obj, that the session should switch to sp. The
+// margins prevent sessions from flapping between similar paths.
+func (sp *sessPath) muchBetter(curr *sessPath, obj string) bool {
+	if !sp.measured() || !sp.better(curr, obj) {
+		return false
+	}
+	if !curr.measured() {
+		return true
+	}
+	switch obj {
+	case sigcmn.PathObjLatency:
+		return float64(sp.rtt) < (1-rttHysteresis)*float64(curr.rtt) &&
+			sp.loss <= curr.loss+lossHysteresis
+	case sigcmn.PathObjLoss:
+		return sp.loss < curr.loss-lossHysteresis
+	}
+	return false
+}
+
+// weight returns the share of frames sent on the path, relative to the other
+// paths of the session. Paths lose weight with each failure.
+func (sp *sessPath) weight() int {
+	w := maxPathWeight / (1 + int(sp.failCount))
+	if w < 1 {
+		return 1
+	}
+	return w
+}
+
 func (sp *sessPath) String() string {
-	return fmt.Sprintf("Key: %s %s lastFail: %s failCount: %d", sp.key,
-		sp.pathEntry.Path, sp.lastFail, sp.failCount)
+	return fmt.Sprintf("Key: %s %s lastFail: %s failCount: %d rtt: %s loss: %.3f", sp.key,
+		sp.pathEntry.Path, sp.lastFail, sp.failCount, sp.rtt, sp.loss)
+}
+
+// weightedPath is a snapshot of a path used by a session, which can be read
+// by the worker while the session monitor updates the path.
+type weightedPath struct {
+	key       spathmeta.PathKey
+	pathEntry *sciond.PathReplyEntry
+	weight    int
+}
+
+func newWeightedPath(sp *sessPath) *weightedPath {
+	return &weightedPath{key: sp.key, pathEntry: sp.pathEntry, weight: sp.weight()}
+}
+
+// pathSelector spreads frames across weighted paths with smooth weighted
+// round-robin, which interleaves the paths in proportion to their weights
+// instead of sending bursts of frames on each path. It is not safe for
+// concurrent use.
+type pathSelector struct {
+	current map[spathmeta.PathKey]int
+}
+
+func newPathSelector() *pathSelector {
+	return &pathSelector{current: make(map[spathmeta.PathKey]int)}
+}
+
+// next returns the path for the next frame, or nil if paths is empty.
+func (ps *pathSelector) next(paths []*weightedPath) *weightedPath {
+	var best *weightedPath
+	total := 0
+	for _, p := range paths {
+		ps.current[p.key] += p.weight
+		total += p.weight
+		if best == nil || ps.current[p.key] > ps.current[best.key] {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	ps.current[best.key] -= total
+	if len(ps.current) > len(paths) {
+		// Forget the state of paths that are no longer used.
+		used := make(map[spathmeta.PathKey]bool, len(paths))
+		for _, p := range paths {
+			used[p.key] = true
+		}
+		for key := range ps.current {
+			if !used[key] {
+				delete(ps.current, key)
+			}
+		}
+	}
+	return best
 }
@@ -0,0 +1,138 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+func TestPathSelector(t *testing.T) {
+	Convey("Given paths with weights 4, 2 and 1", t, func() {
+		a := &weightedPath{key: "a", weight: 4}
+		b := &weightedPath{key: "b", weight: 2}
+		c := &weightedPath{key: "c", weight: 1}
+		paths := []*weightedPath{a, b, c}
+		ps := newPathSelector()
+		Convey("Frames are spread in proportion to the weights", func() {
+			counts := make(map[spathmeta.PathKey]int)
+			for i := 0; i < 70; i++ {
+				counts[ps.next(paths).key]++
+			}
+			SoMsg("a", counts["a"], ShouldEqual, 40)
+			SoMsg("b", counts["b"], ShouldEqual, 20)
+			SoMsg("c", counts["c"], ShouldEqual, 10)
+		})
+		Convey("Paths are interleaved", func() {
+			var seq []spathmeta.PathKey
+			for i := 0; i < 7; i++ {
+				seq = append(seq, ps.next(paths).key)
+			}
+			SoMsg("seq", seq, ShouldResemble,
+				[]spathmeta.PathKey{"a", "b", "a", "c", "a", "b", "a"})
+		})
+		Convey("Removed paths are forgotten", func() {
+			ps.next(paths)
+			SoMsg("removed", ps.next([]*weightedPath{b}), ShouldEqual, b)
+			SoMsg("state", len(ps.current), ShouldEqual, 1)
+		})
+		Convey("No paths yields nil", func() {
+			SoMsg("nil", ps.next(nil), ShouldBeNil)
+		})
+	})
+}
+
+func TestSessPathPool(t *testing.T) {
+	Convey("Given a pool with paths with different failure counts", t, func() {
+		spp := sessPathPool{
+			"a": &sessPath{key: "a", failCount: 0},
+			"b": &sessPath{key: "b", failCount: 1},
+			"c": &sessPath{key: "c", failCount: 7},
+		}
+		Convey("The path with the fewest failures is returned", func() {
+			SoMsg("get", spp.get("").key, ShouldEqual, "a")
+			SoMsg("get excluding current", spp.get("a").key, ShouldEqual, "b")
+		})
+		Convey("Excluded paths are skipped", func() {
+			sp := spp.getExcluding(func(k spathmeta.PathKey) bool { return k != "c" })
+			SoMsg("getExcluding", sp.key, ShouldEqual, "c")
+			sp = spp.getExcluding(func(k spathmeta.PathKey) bool { return true })
+			SoMsg("all excluded", sp, ShouldBeNil)
+		})
+		Convey("Paths lose weight with failures", func() {
+			SoMsg("a", spp["a"].weight(), ShouldEqual, maxPathWeight)
+			SoMsg("b", spp["b"].weight(), ShouldEqual, maxPathWeight/2)
+			SoMsg("c", spp["c"].weight(), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestSessPathProbes(t *testing.T) {
+	Convey("Given a path with a known RTT", t, func() {
+		now := time.Now()
+		sp := &sessPath{key: "a"}
+		for i := 0; i < minProbes; i++ {
+			sp.probeReply(100*time.Millisecond, now)
+		}
+		SoMsg("measured", sp.measured(), ShouldBeTrue)
+		SoMsg("rtt", sp.rtt, ShouldEqual, 100*time.Millisecond)
+		SoMsg("loss", sp.loss, ShouldEqual, 0)
+		Convey("New samples are averaged", func() {
+			sp.probeReply(200*time.Millisecond, now)
+			SoMsg("rtt", sp.rtt, ShouldEqual, 112500*time.Microsecond)
+			sp.probeLost()
+			SoMsg("loss", sp.loss, ShouldAlmostEqual, ewmaWeight)
+		})
+	})
+	Convey("Given a pool with measured paths", t, func() {
+		now := time.Now()
+		newPath := func(key spathmeta.PathKey, rtt time.Duration, lost int) *sessPath {
+			sp := &sessPath{key: key}
+			for i := 0; i < minProbes; i++ {
+				sp.probeReply(rtt, now)
+			}
+			for i := 0; i < lost; i++ {
+				sp.probeLost()
+			}
+			return sp
+		}
+		spp := sessPathPool{
+			"fast":  newPath("fast", 10*time.Millisecond, 3),
+			"slow":  newPath("slow", 50*time.Millisecond, 0),
+			"close": newPath("close", 45*time.Millisecond, 0),
+			"new":   &sessPath{key: "new"},
+		}
+		none := func(spathmeta.PathKey) bool { return false }
+		Convey("Paths are chosen by the objective", func() {
+			SoMsg("latency", spp.best(sigcmn.PathObjLatency, none), ShouldEqual, spp["fast"])
+			SoMsg("loss", spp.best(sigcmn.PathObjLoss, none), ShouldEqual, spp["close"])
+		})
+		Convey("Sessions only switch to paths that are much better", func() {
+			SoMsg("lossy", spp["fast"].muchBetter(spp["slow"], sigcmn.PathObjLatency),
+				ShouldBeFalse)
+			SoMsg("loss", spp["slow"].muchBetter(spp["fast"], sigcmn.PathObjLoss),
+				ShouldBeTrue)
+			SoMsg("close", spp["close"].muchBetter(spp["slow"], sigcmn.PathObjLatency),
+				ShouldBeFalse)
+			SoMsg("unknown", spp["new"].muchBetter(spp["slow"], sigcmn.PathObjLatency),
+				ShouldBeFalse)
+		})
+	})
+}
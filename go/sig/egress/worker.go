@@ -17,17 +17,21 @@ package egress
 import (
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/l4"
 	"github.com/scionproto/scion/go/lib/log"
 	"github.com/scionproto/scion/go/lib/ringbuf"
 	"github.com/scionproto/scion/go/lib/sciond"
 	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spath/spathmeta"
 	"github.com/scionproto/scion/go/lib/spkt"
 	"github.com/scionproto/scion/go/lib/util"
 	"github.com/scionproto/scion/go/sig/metrics"
 	"github.com/scionproto/scion/go/sig/mgmt"
 	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/sigcrypto"
 	"github.com/scionproto/scion/go/sig/siginfo"
 )
 
@@ -45,12 +49,19 @@ import (
 //
 //   Inside the frame, all encapsulated packets are preceeded by a 2B length
 //   field, and then padded to an 8B boundary
+//
+//   If encryption is enabled, the epoch is the one of the session's current
+//   key, the payload following the header is encrypted, and an authentication
+//   tag of sigcrypto.Overhead bytes is appended to the frame.
 
 const (
 	PktLenSize = 2
 	MinSpace   = 16
 	SigHdrLen  = 8
 	MaxSeq     = (1 << 24) - 1
+	// Sequence number after which encrypted sessions ask for a new key, so
+	// that it is established before the sequence numbers are exhausted.
+	RekeySeq = MaxSeq / 2
 )
 
 type worker struct {
@@ -59,8 +70,20 @@ type worker struct {
 	sess          *Session
 	currSig       *siginfo.Sig
 	currPathEntry *sciond.PathReplyEntry
+	currPathKey   spathmeta.PathKey
+	pathSel       *pathSelector
 	frameSentCtrs metrics.CtrPair
+	// per-path frame counters, indexed by path key
+	pathSentCtrs map[spathmeta.PathKey]metrics.CtrPair
+	tooBigCtr    prometheus.Counter
+	mtuGauge     prometheus.Gauge
+	// the tunnel MTU, i.e., the length of the largest packet that fits into a
+	// single frame on the paths of mtuRemote, 0 if unknown.
+	mtu       int
+	mtuRemote *RemoteInfo
 
+	// key of the current epoch, nil if encryption is disabled
+	key   *sigcrypto.FrameKey
 	epoch uint16
 	seq   uint32
 	pkts  ringbuf.EntryList
@@ -75,7 +98,11 @@ func NewWorker(sess *Session, logger log.Logger) *worker {
 			Pkts:  metrics.FramesSent.WithLabelValues(sess.IA.String(), sess.SessId.String()),
 			Bytes: metrics.FrameBytesSent.WithLabelValues(sess.IA.String(), sess.SessId.String()),
 		},
-		pkts: make(ringbuf.EntryList, 0, egressBufPkts),
+		pathSel:      newPathSelector(),
+		pathSentCtrs: make(map[spathmeta.PathKey]metrics.CtrPair),
+		tooBigCtr:    metrics.PktsTooBig.WithLabelValues(sess.IA.String(), sess.SessId.String()),
+		mtuGauge:     metrics.SessMTU.WithLabelValues(sess.IA.String(), sess.SessId.String()),
+		pkts:         make(ringbuf.EntryList, 0, egressBufPkts),
 	}
 }
 
@@ -120,6 +147,17 @@ TopLoop:
 }
 
 func (w *worker) processPkt(f *frame, pkt common.RawBytes) error {
+	if w.mtu > 0 && len(pkt) > w.mtu {
+		if reply := newTooBig(pkt, w.mtu, sigcmn.Host.IP()); reply != nil {
+			// Drop the packet, and tell the sender about the tunnel MTU.
+			w.tooBigCtr.Inc()
+			if _, err := tunIO.Write(reply); err != nil {
+				return common.NewBasicError("Unable to write ICMP error to TUN", err,
+					"pktLen", len(pkt), "mtu", w.mtu)
+			}
+			return nil
+		}
+	}
 	f.startPkt(uint16(len(pkt)))
 	pktOff := 0
 	// Write chunks of the packet to frames, sending off frames as they fill up.
@@ -165,50 +203,142 @@ func (w *worker) write(f *frame) error {
 		return nil
 	}
 	snetAddr := w.currSig.EncapSnetAddr()
-	snetAddr.Path = spath.New(w.currPathEntry.Path.FwdPath)
-	if err := snetAddr.Path.InitOffsets(); err != nil {
-		return common.NewBasicError("Error initializing path offsets", err)
+	// Paths to remote SIGs in the local AS are empty.
+	if len(w.currPathEntry.Path.FwdPath) > 0 {
+		snetAddr.Path = spath.New(w.currPathEntry.Path.FwdPath)
+		if err := snetAddr.Path.InitOffsets(); err != nil {
+			return common.NewBasicError("Error initializing path offsets", err)
+		}
 	}
 	snetAddr.NextHopHost = w.currPathEntry.HostInfo.Host()
 	snetAddr.NextHopPort = w.currPathEntry.HostInfo.Port
 
-	if w.seq == 0 {
-		w.epoch = uint16(time.Now().Unix() & 0xFFFF)
+	if sigcrypto.Enabled() {
+		if !w.updateKey() {
+			// FIXME(kormat): add some metrics to track this.
+			return nil
+		}
+	} else if w.seq == 0 {
+		w.epoch = sigcrypto.NewEpoch(time.Now())
 	}
 	f.writeHdr(w.sess.SessId, w.epoch, w.seq)
+	raw := f.raw()
+	if w.key != nil {
+		raw = w.key.Seal(raw)
+	}
 	// Update sequence number for next packet
 	w.seq += 1
-	if w.seq > MaxSeq {
+	if w.seq > MaxSeq && w.key == nil {
 		w.seq = 0
 	}
-	bytesWritten, err := w.sess.conn.WriteToSCION(f.raw(), snetAddr)
+	bytesWritten, err := w.sess.conn.WriteToSCION(raw, snetAddr)
 	if err != nil {
 		return common.NewBasicError("Egress write error", err)
 	}
 	w.frameSentCtrs.Pkts.Inc()
 	w.frameSentCtrs.Bytes.Add(float64(bytesWritten))
+	pathCtrs := w.pathCtrs(w.currPathKey)
+	pathCtrs.Pkts.Inc()
+	pathCtrs.Bytes.Add(float64(bytesWritten))
 	return nil
 }
 
+func (w *worker) pathCtrs(key spathmeta.PathKey) metrics.CtrPair {
+	ctrs, ok := w.pathSentCtrs[key]
+	if !ok {
+		sessId, path := w.sess.SessId.String(), key.String()
+		ctrs = metrics.CtrPair{
+			Pkts:  metrics.PathFramesSent.WithLabelValues(w.iaString, sessId, path),
+			Bytes: metrics.PathFrameBytesSent.WithLabelValues(w.iaString, sessId, path),
+		}
+		w.pathSentCtrs[key] = ctrs
+	}
+	return ctrs
+}
+
+// updateKey switches to the current key of the session, starting a new epoch
+// if the key changed. It returns false if no usable key is available. Sequence
+// numbers never wrap with encryption, as that would reuse nonces; instead,
+// frames are dropped until a new key is established.
+func (w *worker) updateKey() bool {
+	key := w.sess.FrameKey()
+	if key == nil || time.Since(key.Created) > sigcrypto.KeyLifetime {
+		return false
+	}
+	if key != w.key {
+		w.key = key
+		w.epoch = key.Epoch
+		w.seq = 0
+	}
+	if w.seq >= RekeySeq {
+		w.sess.requestRekey()
+	}
+	return w.seq <= MaxSeq
+}
+
 func (w *worker) resetFrame(f *frame) {
-	var mtu uint16 = common.MinMTU
-	var addrLen, pathLen uint16
 	remote := w.sess.Remote()
-	if remote != nil {
-		w.currSig = remote.Sig
-		if w.currSig != nil {
-			addrLen = uint16(spkt.AddrHdrLen(w.currSig.Host, sigcmn.Host))
-		}
-		if remote.sessPath != nil {
-			w.currPathEntry = remote.sessPath.pathEntry
-		}
-		if w.currPathEntry != nil {
-			mtu = w.currPathEntry.Path.Mtu
-			pathLen = uint16(len(w.currPathEntry.Path.FwdPath))
+	if remote == nil {
+		f.reset(frameLen(nil, nil))
+		return
+	}
+	w.currSig = remote.Sig
+	if p := w.pathSel.next(remote.paths); p != nil {
+		// Spread frames across the healthy paths of the session.
+		w.currPathEntry = p.pathEntry
+		w.currPathKey = p.key
+	} else if remote.sessPath != nil {
+		w.currPathEntry = remote.sessPath.pathEntry
+		w.currPathKey = remote.sessPath.key
+	}
+	w.updateMTU(remote)
+	f.reset(frameLen(w.currSig, w.currPathEntry))
+}
+
+// updateMTU recomputes the tunnel MTU if the remote SIG or the paths of the
+// session changed. Packets that exceed the MTU would need to be split across
+// frames, as frames can be sent on any of the paths of the session.
+func (w *worker) updateMTU(remote *RemoteInfo) {
+	if remote == w.mtuRemote {
+		return
+	}
+	w.mtuRemote = remote
+	mtu := 0
+	for _, p := range remote.paths {
+		pathMTU := frameLen(remote.Sig, p.pathEntry) - sigcmn.SIGHdrSize - PktLenSize
+		if mtu == 0 || pathMTU < mtu {
+			mtu = pathMTU
 		}
 	}
+	if len(remote.paths) == 0 && remote.sessPath != nil {
+		mtu = frameLen(remote.Sig, remote.sessPath.pathEntry) - sigcmn.SIGHdrSize - PktLenSize
+	}
+	if mtu != w.mtu {
+		w.Info("EgressWorker: tunnel MTU changed", "old", w.mtu, "new", mtu)
+		w.mtu = mtu
+		w.mtuGauge.Set(float64(mtu))
+	}
+}
+
+// frameLen returns the length of the frames sent to sig on pathEntry, such
+// that the SCION packets carrying them fit into the MTU of the path. If there
+// is no path, the minimum MTU is used.
+func frameLen(sig *siginfo.Sig, pathEntry *sciond.PathReplyEntry) int {
+	mtu := common.MinMTU
+	var addrLen, pathLen int
+	if sig != nil {
+		addrLen = spkt.AddrHdrLen(sig.Host, sigcmn.Host)
+	}
+	if pathEntry != nil {
+		mtu = int(pathEntry.Path.Mtu)
+		pathLen = len(pathEntry.Path.FwdPath)
+	}
+	var overhead int
+	if sigcrypto.Enabled() {
+		overhead = sigcrypto.Overhead
+	}
 	// FIXME(kormat): to do this properly, need to account for any ext headers.
-	f.reset(mtu - spkt.CmnHdrLen - addrLen - pathLen - l4.UDPLen)
+	return mtu - spkt.CmnHdrLen - addrLen - pathLen - l4.UDPLen - overhead
 }
 
 type frame struct {
@@ -221,8 +351,8 @@ func newFrame() *frame {
 	return &frame{b: make(common.RawBytes, common.MaxMTU), offset: sigcmn.SIGHdrSize}
 }
 
-func (f *frame) reset(mtu uint16) {
-	f.b = f.b[:int(mtu)]
+func (f *frame) reset(mtu int) {
+	f.b = f.b[:mtu]
 	f.idx = 0
 	f.offset = sigcmn.SIGHdrSize
 }
@@ -16,7 +16,7 @@ package ingress
 
 import (
 	"fmt"
-	"io"
+	"sync"
 	"time"
 
 	"github.com/scionproto/scion/go/lib/addr"
@@ -30,52 +30,88 @@ import (
 	"github.com/scionproto/scion/go/sig/metrics"
 	"github.com/scionproto/scion/go/sig/mgmt"
 	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/sigcrypto"
+	"github.com/scionproto/scion/go/sig/xnet"
 )
 
 const (
 	// tunDevName is the name of the internal ingress tunnel interface.
 	tunDevName = "scion-local"
-	// workerCleanupInterval is the interval between worker cleanup rounds.
-	workerCleanupInterval = 60 * time.Second
 	// freeFramesCap is the number of preallocated Framebuf objects.
 	freeFramesCap = 1024
 )
 
 var (
-	extConn            *snet.Conn
-	tunIO              io.ReadWriteCloser
-	freeFrames         *ringbuf.Ring
-	framesRecvCounters map[metrics.CtrPairKey]metrics.CtrPair
+	freeFrames     *ringbuf.Ring
+	freeFramesOnce sync.Once
 )
 
 // Dispatcher reads new encapsulated packets, classifies the packet by
 // source ISD-AS -> source host Addr -> Sess Id and hands it off to the
 // appropriate Worker, starting a new one if none currently exists.
 type Dispatcher struct {
-	laddr   *snet.Addr
-	workers map[string]*Worker
+	conn               sigcmn.FrameConn
+	tun                xnet.Tun
+	workers            map[string]*Worker
+	framesRecvCounters map[metrics.CtrPairKey]metrics.CtrPair
+	stop               chan struct{}
+	stopped            chan struct{}
 }
 
-func Init(tio io.ReadWriteCloser) error {
-	tunIO = tio
-	freeFrames = ringbuf.New(freeFramesCap, func() interface{} {
-		return NewFrameBuf()
-	}, "ingress", prometheus.Labels{"ringId": "freeFrames", "sessId": ""})
-	framesRecvCounters = make(map[metrics.CtrPairKey]metrics.CtrPair)
-	d := &Dispatcher{
-		laddr:   sigcmn.EncapSnetAddr(),
-		workers: make(map[string]*Worker),
+// Init listens for frames on the local encap address, and writes the
+// decapsulated packets to tun. It only returns if listening fails.
+func Init(tun xnet.Tun) error {
+	conn, err := snet.ListenSCION(sigcmn.Network, sigcmn.EncapSnetAddr())
+	if err != nil {
+		return common.NewBasicError("Unable to initialize extConn", err)
 	}
-	return d.Run()
+	NewDispatcher(conn, tun).Run()
+	return nil
 }
 
-func (d *Dispatcher) Run() error {
-	var err error
-	extConn, err = snet.ListenSCION("udp4", d.laddr)
-	if err != nil {
-		return common.NewBasicError("Unable to initialize extConn", err)
+// NewDispatcher returns a Dispatcher that reads frames from conn, and writes
+// the decapsulated packets to tun.
+func NewDispatcher(conn sigcmn.FrameConn, tun xnet.Tun) *Dispatcher {
+	initFreeFrames()
+	return &Dispatcher{
+		conn:               conn,
+		tun:                tun,
+		workers:            make(map[string]*Worker),
+		framesRecvCounters: make(map[metrics.CtrPairKey]metrics.CtrPair),
+		stop:               make(chan struct{}),
+		stopped:            make(chan struct{}),
 	}
+}
+
+// initFreeFrames allocates the frame buffers shared by all dispatchers.
+func initFreeFrames() {
+	freeFramesOnce.Do(func() {
+		freeFrames = ringbuf.New(freeFramesCap, func() interface{} {
+			return NewFrameBuf()
+		}, "ingress", prometheus.Labels{"ringId": "freeFrames", "sessId": ""})
+	})
+}
+
+// Run reads and dispatches frames until the dispatcher is stopped.
+func (d *Dispatcher) Run() {
+	defer log.LogPanicAndExit()
+	defer close(d.stopped)
 	d.read()
+	for key, worker := range d.workers {
+		delete(d.workers, key)
+		worker.Stop()
+	}
+}
+
+// Stop closes the connection of the dispatcher, and waits until the
+// dispatcher stops. Its workers are stopped as well.
+func (d *Dispatcher) Stop() error {
+	close(d.stop)
+	err := d.conn.Close()
+	<-d.stopped
+	if err != nil {
+		return common.NewBasicError("Unable to close conn", err)
+	}
 	return nil
 }
 
@@ -86,26 +122,68 @@ func (d *Dispatcher) read() {
 		n, _ := freeFrames.Read(frames, true)
 		for i := 0; i < n; i++ {
 			frame := frames[i].(*FrameBuf)
-			read, src, err := extConn.ReadFromSCION(frame.raw)
-			if err != nil {
+			read, src, err := d.conn.ReadFromSCION(frame.raw)
+			if err != nil && d.stopping() {
+				for _, entry := range frames[i:n] {
+					entry.(*FrameBuf).Release()
+				}
+				return
+			} else if err != nil {
 				log.Error("IngressDispatcher: Unable to read from external ingress", "err", err)
 				frame.Release()
+			} else if frame.frameLen, err = open(frame, src, read); err != nil {
+				log.Error("IngressDispatcher: Dropping frame", "src", src, "err", err)
+				frame.Release()
 			} else {
-				frame.frameLen = read
 				frame.sessId = mgmt.SessionType((frame.raw[0]))
-				updateMetrics(src.IA.IAInt(), frame.sessId, read)
+				d.updateMetrics(src.IA.IAInt(), frame.sessId, read)
 				d.dispatch(frame, src)
 			}
 			// Clear FrameBuf reference
 			frames[i] = nil
 		}
-		if time.Since(lastCleanup) >= workerCleanupInterval {
+		// Idle workers are stopped after being unused for between one and two
+		// timeouts.
+		if time.Since(lastCleanup) >= *sigcmn.WorkerTimeout {
 			d.cleanup()
 			lastCleanup = time.Now()
 		}
 	}
 }
 
+// stopping returns whether Stop has been called.
+func (d *Dispatcher) stopping() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// open authenticates and decrypts the frame of length read received from src,
+// if encryption is enabled, and returns the length of the decrypted frame.
+func open(frame *FrameBuf, src *snet.Addr, read int) (int, error) {
+	if !sigcrypto.Enabled() {
+		return read, nil
+	}
+	if read < sigcmn.SIGHdrSize {
+		return 0, common.NewBasicError("Frame too short", nil, "len", read)
+	}
+	sessId := mgmt.SessionType(frame.raw[0])
+	epoch := common.Order.Uint16(frame.raw[1:3])
+	key := sigcrypto.Keys.Get(src.IA, sessId, epoch)
+	if key == nil {
+		return 0, common.NewBasicError("No key for frame", nil,
+			"sessId", sessId, "epoch", epoch)
+	}
+	raw, err := key.Open(frame.raw[:read])
+	if err != nil {
+		return 0, err
+	}
+	return len(raw), nil
+}
+
 // dispatch dispatches a frame to the corresponding worker, spawning one if none
 // exist yet. Dispatching is done based on source ISD-AS -> source host Addr -> Sess Id.
 func (d *Dispatcher) dispatch(frame *FrameBuf, src *snet.Addr) {
@@ -113,7 +191,7 @@ func (d *Dispatcher) dispatch(frame *FrameBuf, src *snet.Addr) {
 	// Check if we already have a worker running and start one if not.
 	worker, ok := d.workers[dispatchStr]
 	if !ok {
-		worker = NewWorker(src, frame.sessId)
+		worker = NewWorker(src, frame.sessId, d.tun)
 		d.workers[dispatchStr] = worker
 		go worker.Run()
 	}
@@ -133,16 +211,16 @@ func (d *Dispatcher) cleanup() {
 	}
 }
 
-func updateMetrics(remoteIA addr.IAInt, sessId mgmt.SessionType, read int) {
+func (d *Dispatcher) updateMetrics(remoteIA addr.IAInt, sessId mgmt.SessionType, read int) {
 	key := metrics.CtrPairKey{RemoteIA: remoteIA, SessId: sessId}
-	counters, ok := framesRecvCounters[key]
+	counters, ok := d.framesRecvCounters[key]
 	if !ok {
 		iaStr := remoteIA.IA().String()
 		counters = metrics.CtrPair{
 			Pkts:  metrics.FramesRecv.WithLabelValues(iaStr, sessId.String()),
 			Bytes: metrics.FrameBytesRecv.WithLabelValues(iaStr, sessId.String()),
 		}
-		framesRecvCounters[key] = counters
+		d.framesRecvCounters[key] = counters
 	}
 	counters.Pkts.Inc()
 	counters.Bytes.Add(float64(read))
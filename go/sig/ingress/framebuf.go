@@ -16,6 +16,7 @@ package ingress
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/log"
@@ -60,6 +61,8 @@ type FrameBuf struct {
 	raw common.RawBytes
 	// The sender object for the frame.
 	snd sender
+	// The time the frame was received.
+	recvTime time.Time
 }
 
 func NewFrameBuf() *FrameBuf {
@@ -80,6 +83,21 @@ func (fb *FrameBuf) Reset() {
 	fb.completePktsProcessed = false
 	fb.pktLen = 0
 	fb.snd = nil
+	fb.recvTime = time.Time{}
+}
+
+// parseHdr sets the sequence number and the index of the frame from its
+// header, and returns the epoch of the frame.
+func (fb *FrameBuf) parseHdr() int {
+	fb.seqNr = int(common.Order.UintN(fb.raw[3:6], 3))
+	fb.index = int(common.Order.Uint16(fb.raw[6:8]))
+	// If index == 1 then we can be sure that there is no fragment at the beginning
+	// of the frame.
+	fb.fragNProcessed = fb.index == 1
+	// If index == 0 then we can be sure that there are no complete packets in this
+	// frame.
+	fb.completePktsProcessed = fb.index == 0
+	return int(common.Order.Uint16(fb.raw[1:3]))
 }
 
 // Release reset the FrameBuf and releases it back to the ringbuf (if set).
@@ -0,0 +1,58 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/util"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+func TestFrameBufProcessCompletePkts(t *testing.T) {
+	Convey("A frame with an IPv4 and an IPv6 packet delivers both packets", t, func() {
+		ip4Pkt := common.RawBytes{0x45, 0, 0, 20, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+			192, 0, 2, 1}
+		ip6Pkt := make(common.RawBytes, 40)
+		ip6Pkt[0] = 0x60
+		ip6Pkt[39] = 1
+		snd := &testSender{}
+		fb := NewFrameBuf()
+		fb.frameLen = newTestFrame(fb.raw, ip4Pkt, ip6Pkt)
+		fb.index = 1
+		fb.snd = snd
+		fb.ProcessCompletePkts()
+		SoMsg("pkts", len(snd.pkts), ShouldEqual, 2)
+		SoMsg("IPv4", snd.pkts[0], ShouldResemble, ip4Pkt)
+		SoMsg("IPv6", snd.pkts[1], ShouldResemble, ip6Pkt)
+		SoMsg("no fragment", fb.frag0Start, ShouldEqual, 0)
+	})
+}
+
+// newTestFrame encapsulates pkts in a frame written to b, and returns the
+// length of the frame.
+func newTestFrame(b common.RawBytes, pkts ...common.RawBytes) int {
+	offset := sigcmn.SIGHdrSize
+	for _, pkt := range pkts {
+		offset += util.CalcPadding(offset, 8)
+		common.Order.PutUint16(b[offset:], uint16(len(pkt)))
+		offset += 2
+		offset += copy(b[offset:], pkt)
+	}
+	return offset
+}
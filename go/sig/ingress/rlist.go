@@ -18,6 +18,9 @@ import (
 	"bytes"
 	"container/list"
 	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/log"
@@ -29,34 +32,157 @@ import (
 // outstanding for reassembly. The frames kept in the reassambly list sorted by
 // their sequence numbers. There is always one reassembly list per epoch to
 // ensure that sequence numbers are monotonically increasing.
+//
+// Frames that arrive ahead of missing frames, e.g., because the session spreads
+// its frames across multiple paths, are held back until the missing frames
+// arrive. The missing frames are given up on if frames are received more than
+// window frames ahead of them, or if they are not received within timeout.
 type ReassemblyList struct {
 	epoch             int
 	capacity          int
+	window            int
+	timeout           time.Duration
 	snd               sender
+	ctrs              *frameCtrs
 	markedForDeletion bool
 	entries           *list.List
-	buf               *bytes.Buffer
+	// nextSeqNr is the sequence number of the next frame to reassemble, -1 if
+	// no frame has been received yet.
+	nextSeqNr int
+	// pending holds the frames received ahead of nextSeqNr, sorted by their
+	// sequence numbers.
+	pending *list.List
+	buf     *bytes.Buffer
 }
 
-// NewReassemblyList returns a ReassemblyList object for the given epoch and with
-// given maximum capacity.
-func NewReassemblyList(epoch int, capacity int, s sender) *ReassemblyList {
+// frameCtrs are the per-session counters of frames that are not received in
+// sequence.
+type frameCtrs struct {
+	OutOfOrder prometheus.Counter
+	Late       prometheus.Counter
+	Duplicated prometheus.Counter
+	Lost       prometheus.Counter
+}
+
+func newFrameCtrs(ia, sessId string) *frameCtrs {
+	return &frameCtrs{
+		OutOfOrder: metrics.SessFramesOutOfOrder.WithLabelValues(ia, sessId),
+		Late:       metrics.SessFramesLate.WithLabelValues(ia, sessId),
+		Duplicated: metrics.SessFramesDuplicated.WithLabelValues(ia, sessId),
+		Lost:       metrics.SessFramesLost.WithLabelValues(ia, sessId),
+	}
+}
+
+// NewReassemblyList returns a ReassemblyList object for the given epoch, with
+// given maximum capacity and with the given reorder window and timeout.
+func NewReassemblyList(epoch int, capacity int, window int, timeout time.Duration,
+	s sender, ctrs *frameCtrs) *ReassemblyList {
+
 	list := &ReassemblyList{
 		epoch:             epoch,
 		capacity:          capacity,
+		window:            window,
+		timeout:           timeout,
 		snd:               s,
+		ctrs:              ctrs,
 		markedForDeletion: false,
 		entries:           list.New(),
+		nextSeqNr:         -1,
+		pending:           list.New(),
 		buf:               bytes.NewBuffer(make(common.RawBytes, 0, frameBufCap)),
 	}
 	return list
 }
 
 // Insert inserts a frame into the reassembly list.
-// After inserting the frame at the correct position, Insert tries to reassemble packets
-// that involve the newly added frame. Completely processed frames get removed from the
-// list and released to the pool of frame buffers.
+// Frames are reassembled in the order of their sequence numbers. Frames received
+// ahead of missing frames are held back until the missing frames are received,
+// or given up on. Frames received after they have been given up on are dropped.
 func (l *ReassemblyList) Insert(frame *FrameBuf) {
+	// The frame might be released below.
+	now := frame.recvTime
+	if l.nextSeqNr < 0 {
+		// The sequence numbers of an epoch start at 0, so the first frames of
+		// a new epoch might still be received.
+		l.nextSeqNr = frame.seqNr
+		if frame.seqNr <= l.window {
+			l.nextSeqNr = 0
+		}
+	}
+	switch {
+	case frame.seqNr < l.nextSeqNr:
+		l.ctrs.Late.Inc()
+		metrics.FramesTooOld.Inc()
+		frame.Release()
+	case frame.seqNr == l.nextSeqNr:
+		l.reassemble(frame)
+		l.nextSeqNr++
+	case l.addPending(frame):
+		l.ctrs.OutOfOrder.Inc()
+	default:
+		log.Error("Received duplicate frame.", "epoch", l.epoch, "seqNr", frame.seqNr)
+		l.ctrs.Duplicated.Inc()
+		metrics.FramesDuplicated.Inc()
+		frame.Release()
+	}
+	l.flushPending(now)
+}
+
+// addPending adds frame to the pending frames. It returns false if a frame with
+// the same sequence number is already pending.
+func (l *ReassemblyList) addPending(frame *FrameBuf) bool {
+	for e := l.pending.Back(); e != nil; e = e.Prev() {
+		seqNr := e.Value.(*FrameBuf).seqNr
+		if seqNr == frame.seqNr {
+			return false
+		}
+		if seqNr < frame.seqNr {
+			l.pending.InsertAfter(frame, e)
+			return true
+		}
+	}
+	l.pending.PushFront(frame)
+	return true
+}
+
+// flushPending reassembles the pending frames that are next in sequence. If the
+// pending frames are too far ahead of the missing frames, or have waited too
+// long, the missing frames are given up on.
+func (l *ReassemblyList) flushPending(now time.Time) {
+	for l.pending.Len() > 0 {
+		e := l.pending.Front()
+		frame := e.Value.(*FrameBuf)
+		if frame.seqNr != l.nextSeqNr {
+			ahead := l.pending.Back().Value.(*FrameBuf).seqNr - l.nextSeqNr
+			if ahead <= l.window && !l.pendingExpired(now) {
+				return
+			}
+			l.ctrs.Lost.Add(float64(frame.seqNr - l.nextSeqNr))
+			l.nextSeqNr = frame.seqNr
+		}
+		l.pending.Remove(e)
+		l.reassemble(frame)
+		l.nextSeqNr++
+	}
+}
+
+// pendingExpired returns whether any pending frame has waited for the missing
+// frames for longer than the timeout.
+func (l *ReassemblyList) pendingExpired(now time.Time) bool {
+	for e := l.pending.Front(); e != nil; e = e.Next() {
+		if now.Sub(e.Value.(*FrameBuf).recvTime) >= l.timeout {
+			return true
+		}
+	}
+	return false
+}
+
+// reassemble adds the frame, which is next in sequence unless missing frames
+// have been given up on, to the reassembly list.
+// After inserting the frame at the correct position, reassemble tries to
+// reassemble packets that involve the newly added frame. Completely processed
+// frames get removed from the list and released to the pool of frame buffers.
+func (l *ReassemblyList) reassemble(frame *FrameBuf) {
 	// If this is the first frame, write all complete packets to the wire and
 	// add the frame to the reassembly list if it contains a fragment at the end.
 	if l.entries.Len() == 0 {
@@ -220,6 +346,16 @@ func (l *ReassemblyList) removeAll() {
 	l.removeBefore(nil)
 }
 
+// release releases all frames held by the reassembly list, including the
+// pending frames.
+func (l *ReassemblyList) release() {
+	l.removeAll()
+	for e := l.pending.Front(); e != nil; e = l.pending.Front() {
+		e.Value.(*FrameBuf).Release()
+		l.pending.Remove(e)
+	}
+}
+
 func (l *ReassemblyList) removeBefore(ele *list.Element) {
 	var next *list.Element
 	for e := l.entries.Front(); e != ele; e = next {
@@ -0,0 +1,223 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ringbuf"
+	"github.com/scionproto/scion/go/lib/util"
+	"github.com/scionproto/scion/go/sig/metrics"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+func init() {
+	metrics.Init("test")
+	initFreeFrames()
+}
+
+func TestReassemblyListInsert(t *testing.T) {
+	// With 64B frames, pkts[1] spans frames 0-2, pkts[3] frames 2-3, and
+	// pkts[5] frames 3-4.
+	pkts := newTestPkts(22, 100, 30, 40, 6, 60)
+	frames := newTestFrames(64, pkts...)
+	// The packets that are not carried by frame 1.
+	noFrame1 := []common.RawBytes{pkts[0], pkts[2], pkts[3], pkts[4], pkts[5]}
+	now := time.Now()
+	Convey("Given the frames of a sequence of packets", t, func() {
+		SoMsg("frames", len(frames), ShouldEqual, 5)
+		Convey("Frames in sequence deliver all packets", func() {
+			snd := insertFrames(frames, []int{0, 1, 2, 3, 4}, 0, now)
+			SoMsg("pkts", snd.pkts, ShouldResemble, pkts)
+		})
+		Convey("Frames in any order within the window deliver all packets", func() {
+			var failed [][]int
+			for _, order := range permutations(len(frames)) {
+				snd := insertFrames(frames, order, len(frames)-1, now)
+				if !pktsEqual(snd.pkts, pkts) {
+					failed = append(failed, order)
+				}
+			}
+			SoMsg("failed orders", failed, ShouldBeEmpty)
+		})
+		Convey("Duplicate frames deliver all packets once", func() {
+			snd := insertFrames(frames, []int{0, 2, 2, 1, 1, 3, 4, 4}, 2, now)
+			SoMsg("pkts", snd.pkts, ShouldResemble, pkts)
+		})
+		Convey("Frames beyond the window are treated like lost frames", func() {
+			snd := insertFrames(frames, []int{0, 2, 1, 3, 4}, 0, now)
+			SoMsg("reordered", snd.pkts, ShouldResemble, noFrame1)
+			snd = insertFrames(frames, []int{0, 2, 3, 4}, 1, now)
+			SoMsg("lost", snd.pkts, ShouldResemble, noFrame1)
+		})
+		Convey("Missing frames are given up on after the timeout", func() {
+			snd := &testSender{}
+			l := newTestRlist(snd, len(frames))
+			defer l.release()
+			l.Insert(newTestFrameBuf(frames[0], snd, now))
+			l.Insert(newTestFrameBuf(frames[2], snd, now))
+			SoMsg("waiting", snd.pkts, ShouldResemble, pkts[:1])
+			l.Insert(newTestFrameBuf(frames[3], snd, now.Add(time.Second)))
+			SoMsg("given up", snd.pkts, ShouldResemble, noFrame1[:4])
+			l.Insert(newTestFrameBuf(frames[1], snd, now.Add(time.Second)))
+			l.Insert(newTestFrameBuf(frames[4], snd, now.Add(time.Second)))
+			SoMsg("late", snd.pkts, ShouldResemble, noFrame1)
+		})
+		Convey("Held frames are flushed after the timeout without further frames", func() {
+			snd := &testSender{}
+			l := newTestRlist(snd, len(frames))
+			defer l.release()
+			for _, i := range []int{0, 2, 3, 4} {
+				l.Insert(newTestFrameBuf(frames[i], snd, now))
+			}
+			l.flushPending(now.Add(time.Second / 2))
+			SoMsg("waiting", snd.pkts, ShouldResemble, pkts[:1])
+			l.flushPending(now.Add(time.Second))
+			SoMsg("flushed", snd.pkts, ShouldResemble, noFrame1)
+		})
+	})
+}
+
+func newTestRlist(snd sender, window int) *ReassemblyList {
+	return NewReassemblyList(0, 100, window, time.Second, snd, newFrameCtrs("1-ff00:0:1", "0"))
+}
+
+// insertFrames inserts frames in the given order into a new reassembly list with
+// the given window, and returns the sender of the reassembled packets.
+func insertFrames(frames []common.RawBytes, order []int, window int,
+	now time.Time) *testSender {
+
+	snd := &testSender{}
+	l := newTestRlist(snd, window)
+	for _, i := range order {
+		l.Insert(newTestFrameBuf(frames[i], snd, now))
+	}
+	l.release()
+	return snd
+}
+
+// testSender collects the packets sent by frame buffers.
+type testSender struct {
+	pkts []common.RawBytes
+}
+
+func (s *testSender) send(pkt common.RawBytes) error {
+	s.pkts = append(s.pkts, append(common.RawBytes(nil), pkt...))
+	return nil
+}
+
+// newTestFrameBuf returns a FrameBuf from the free frames with a copy of raw,
+// received at now.
+func newTestFrameBuf(raw common.RawBytes, snd sender, now time.Time) *FrameBuf {
+	entries := make(ringbuf.EntryList, 1)
+	freeFrames.Read(entries, true)
+	fb := entries[0].(*FrameBuf)
+	fb.frameLen = copy(fb.raw, raw)
+	fb.parseHdr()
+	fb.snd = snd
+	fb.recvTime = now
+	return fb
+}
+
+// newTestPkts returns packets of the given lengths with distinct contents.
+func newTestPkts(lens ...int) []common.RawBytes {
+	pkts := make([]common.RawBytes, len(lens))
+	for i, l := range lens {
+		pkts[i] = make(common.RawBytes, l)
+		for j := range pkts[i] {
+			pkts[i][j] = byte(i + j)
+		}
+	}
+	return pkts
+}
+
+// newTestFrames encapsulates pkts in consecutive frames of at most frameLen
+// bytes, the same way as the egress worker does.
+func newTestFrames(frameLen int, pkts ...common.RawBytes) []common.RawBytes {
+	var frames []common.RawBytes
+	var frame common.RawBytes
+	newFrame := func() {
+		frame = make(common.RawBytes, sigcmn.SIGHdrSize, frameLen)
+		common.Order.PutUintN(frame[3:6], uint64(len(frames)), 3)
+	}
+	for _, pkt := range pkts {
+		if frame != nil {
+			pad := util.CalcPadding(len(frame), 8)
+			if len(frame)+pad+2 > frameLen {
+				frames = append(frames, frame)
+				frame = nil
+			} else {
+				frame = append(frame, make(common.RawBytes, pad)...)
+			}
+		}
+		if frame == nil {
+			newFrame()
+		}
+		if common.Order.Uint16(frame[6:8]) == 0 {
+			common.Order.PutUint16(frame[6:8], uint16(len(frame)/8))
+		}
+		data := make(common.RawBytes, 2, 2+len(pkt))
+		common.Order.PutUint16(data, uint16(len(pkt)))
+		data = append(data, pkt...)
+		for {
+			n := intMin(frameLen-len(frame), len(data))
+			frame = append(frame, data[:n]...)
+			data = data[n:]
+			if len(data) == 0 {
+				break
+			}
+			frames = append(frames, frame)
+			newFrame()
+		}
+	}
+	if frame != nil {
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// permutations returns all permutations of 0..n-1.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var perms [][]int
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			perm := make([]int, 0, n)
+			perm = append(perm, p[:i]...)
+			perm = append(perm, n-1)
+			perms = append(perms, append(perm, p[i:]...))
+		}
+	}
+	return perms
+}
+
+func pktsEqual(a, b []common.RawBytes) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -25,14 +25,13 @@ import (
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/sig/metrics"
 	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/xnet"
 )
 
-const (
-	// reassemblyListCap is the maximum capacity of a reassembly list.
-	reassemblyListCap = 100
-	// rlistCleanUpInterval is the interval between clean up of outdated reassembly lists.
-	rlistCleanUpInterval = 1 * time.Second
-)
+// pendingPolls is the number of times per reorder timeout the ring is polled
+// while frames are held back for missing frames.
+const pendingPolls = 10
 
 type sender interface {
 	send(common.RawBytes) error
@@ -44,12 +43,14 @@ type Worker struct {
 	Remote           *snet.Addr
 	SessId           mgmt.SessionType
 	Ring             *ringbuf.Ring
+	tun              xnet.Tun
 	rlists           map[int]*ReassemblyList
 	markedForCleanup bool
 	sentCtrs         metrics.CtrPair
+	frameCtrs        *frameCtrs
 }
 
-func NewWorker(remote *snet.Addr, sessId mgmt.SessionType) *Worker {
+func NewWorker(remote *snet.Addr, sessId mgmt.SessionType, tun xnet.Tun) *Worker {
 	// FIXME(kormat): these labels don't allow us to identify traffic from a
 	// specific remote sig, but adding the remote sig addr would cause a label
 	// explosion :/
@@ -61,6 +62,7 @@ func NewWorker(remote *snet.Addr, sessId mgmt.SessionType) *Worker {
 		Remote: remote,
 		SessId: sessId,
 		Ring:   ringbuf.New(64, nil, "ingress", ringLabels),
+		tun:    tun,
 		rlists: make(map[int]*ReassemblyList),
 		sentCtrs: metrics.CtrPair{
 			Pkts: metrics.PktsSent.WithLabelValues(remote.IA.String(),
@@ -68,6 +70,7 @@ func NewWorker(remote *snet.Addr, sessId mgmt.SessionType) *Worker {
 			Bytes: metrics.PktBytesSent.WithLabelValues(remote.IA.String(),
 				sessId.String()),
 		},
+		frameCtrs: newFrameCtrs(remote.IA.String(), sessId.String()),
 	}
 	return worker
 }
@@ -85,17 +88,28 @@ func (w *Worker) Run() {
 	for {
 		// This might block indefinitely, thus cleanup will be deferred. However,
 		// this is not an issue, since if there is nothing to read we also don't need
-		// to do any cleanup.
-		n, _ := w.Ring.Read(frames, true)
+		// to do any cleanup. Frames held back for missing frames must be flushed
+		// once the reorder timeout expires, so the ring is polled instead while
+		// there are any.
+		pending := w.hasPending()
+		n, _ := w.Ring.Read(frames, !pending)
 		if n < 0 {
 			break
 		}
+		if n == 0 {
+			time.Sleep(*sigcmn.ReorderTimeout / pendingPolls)
+		}
 		for i := 0; i < n; i++ {
 			frame := frames[i].(*FrameBuf)
 			w.processFrame(frame)
 			frames[i] = nil
 		}
-		if time.Since(lastCleanup) >= rlistCleanUpInterval {
+		if pending {
+			w.flushPending(time.Now())
+		}
+		// Idle reassembly lists are removed after being unused for between one
+		// and two timeouts.
+		if time.Since(lastCleanup) >= *sigcmn.RlistTimeout {
 			w.cleanup()
 			lastCleanup = time.Now()
 		}
@@ -107,20 +121,11 @@ func (w *Worker) Run() {
 // packets to the wire and then adding the frame to the corresponding reassembly
 // list if needed.
 func (w *Worker) processFrame(frame *FrameBuf) {
-	epoch := int(common.Order.Uint16(frame.raw[1:3]))
-	seqNr := int(common.Order.UintN(frame.raw[3:6], 3))
-	index := int(common.Order.Uint16(frame.raw[6:8]))
-	frame.seqNr = seqNr
-	frame.index = index
+	epoch := frame.parseHdr()
 	frame.snd = w
-	//w.Debug("Received Frame", "seqNr", seqNr, "index", index, "epoch", epoch,
+	frame.recvTime = time.Now()
+	//w.Debug("Received Frame", "seqNr", frame.seqNr, "index", frame.index, "epoch", epoch,
 	//	"len", frame.frameLen)
-	// If index == 1 then we can be sure that there is no fragment at the beginning
-	// of the frame.
-	frame.fragNProcessed = index == 1
-	// If index == 0 then we can be sure that there are no complete packets in this
-	// frame.
-	frame.completePktsProcessed = index == 0
 	// Add to frame buf reassembly list.
 	rlist := w.getRlist(epoch)
 	rlist.Insert(frame)
@@ -129,13 +134,33 @@ func (w *Worker) processFrame(frame *FrameBuf) {
 func (w *Worker) getRlist(epoch int) *ReassemblyList {
 	rlist, ok := w.rlists[epoch]
 	if !ok {
-		rlist = NewReassemblyList(epoch, reassemblyListCap, w)
+		rlist = NewReassemblyList(epoch, *sigcmn.ReassemblyCap, *sigcmn.ReorderWindow,
+			*sigcmn.ReorderTimeout, w, w.frameCtrs)
 		w.rlists[epoch] = rlist
 	}
 	rlist.markedForDeletion = false
 	return rlist
 }
 
+// hasPending returns whether any reassembly list holds back frames for missing
+// frames.
+func (w *Worker) hasPending() bool {
+	for _, rlist := range w.rlists {
+		if rlist.pending.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// flushPending gives up on the missing frames of the reassembly lists that
+// have held back frames for longer than the reorder timeout.
+func (w *Worker) flushPending(now time.Time) {
+	for _, rlist := range w.rlists {
+		rlist.flushPending(now)
+	}
+}
+
 func (w *Worker) cleanup() {
 	for epoch, rlist := range w.rlists {
 		if rlist.markedForDeletion {
@@ -143,7 +168,7 @@ func (w *Worker) cleanup() {
 			// Remove the reassembly list from the map and then release all frames
 			// back to the bufpool.
 			delete(w.rlists, epoch)
-			go rlist.removeAll()
+			go rlist.release()
 		} else {
 			// Mark the reassembly list for deletion. If it is not accessed between now
 			// and the next cleanup interval, it will be removed.
@@ -153,7 +178,7 @@ func (w *Worker) cleanup() {
 }
 
 func (w *Worker) send(packet common.RawBytes) error {
-	bytesWritten, err := tunIO.Write(packet)
+	bytesWritten, err := w.tun.Write(packet)
 	if err != nil {
 		return common.NewBasicError("Unable to write to internal ingress", err,
 			"length", len(packet))
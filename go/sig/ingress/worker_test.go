@@ -0,0 +1,60 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ringbuf"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/xnet"
+)
+
+func TestWorkerFlushesPending(t *testing.T) {
+	Convey("Frames held back by a worker are delivered after the reorder timeout", t, func() {
+		pkts := newTestPkts(22, 100, 30, 40, 6, 60)
+		frames := newTestFrames(64, pkts...)
+		tun := xnet.NewMemTun(len(pkts))
+		remote := &snet.Addr{IA: xtest.MustParseIA("1-ff00:0:1"),
+			Host: addr.HostFromIP(net.IPv4(192, 0, 2, 1))}
+		w := NewWorker(remote, 0, tun)
+		go w.Run()
+		defer w.Stop()
+		// Frame 1 is lost, and no frame is received after frame 4.
+		for _, i := range []int{0, 2, 3, 4} {
+			w.Ring.Write(ringbuf.EntryList{newTestFrameBuf(frames[i], nil, time.Now())}, true)
+		}
+		var recvd []common.RawBytes
+		timeout := time.After(*sigcmn.ReorderTimeout + time.Second)
+		for len(recvd) < len(pkts)-1 {
+			select {
+			case pkt := <-tun.Recv():
+				recvd = append(recvd, pkt)
+			case <-timeout:
+				t.Fatalf("Received %d of %d packets", len(recvd), len(pkts)-1)
+			}
+		}
+		SoMsg("pkts", recvd, ShouldResemble,
+			[]common.RawBytes{pkts[0], pkts[2], pkts[3], pkts[4], pkts[5]})
+	})
+}
@@ -16,7 +16,6 @@ package main
 
 import (
 	"flag"
-	"io"
 	"net"
 	_ "net/http/pprof"
 	"os"
@@ -30,6 +29,7 @@ import (
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/sig/api"
 	"github.com/scionproto/scion/go/sig/base"
 	"github.com/scionproto/scion/go/sig/config"
 	"github.com/scionproto/scion/go/sig/disp"
@@ -37,6 +37,7 @@ import (
 	"github.com/scionproto/scion/go/sig/ingress"
 	"github.com/scionproto/scion/go/sig/metrics"
 	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/sigcrypto"
 	"github.com/scionproto/scion/go/sig/xnet"
 )
 
@@ -92,18 +93,28 @@ func main() {
 	if err = sigcmn.Init(ia, ip); err != nil {
 		fatal("Error during initialization", "err", err)
 	}
+	if *sigcmn.Encrypt || *sigcmn.Discovery {
+		if err = sigcrypto.Init(ia, *sigcmn.ConfDir, *id, *sigcmn.Encrypt); err != nil {
+			fatal("Unable to load AS certificates", "err", err)
+		}
+	}
 	tunIO, err := setupTun()
 	if err != nil {
 		fatal("Unable to create & configure TUN device", "err", err)
 	}
-	egress.Init()
+	egress.Init(tunIO)
 	disp.Init(sigcmn.CtrlConn)
 	go base.PollReqHdlr()
+	go base.KeyReqHdlr()
+	go base.AnnHdlr()
 	// Parse config
 	if loadConfig(*cfgPath) != true {
 		fatal("Unable to load config on startup")
 	}
 	go reloadOnSIGHUP(*cfgPath)
+	if err := api.Start(*cfgPath); err != nil {
+		fatal("Unable to start management API", "err", err)
+	}
 	// Spawn egress reader
 	go egress.NewReader(tunIO).Run()
 	// Spawn ingress Dispatcher.
@@ -142,7 +153,7 @@ func checkPerms() error {
 	return nil
 }
 
-func setupTun() (io.ReadWriteCloser, error) {
+func setupTun() (xnet.Tun, error) {
 	tunLink, tunIO, err := xnet.ConnectTun(*sigcmn.SigTun)
 	if err != nil {
 		return nil, err
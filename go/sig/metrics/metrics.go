@@ -51,6 +51,21 @@ var (
 	FramesDiscarded    prometheus.Counter
 	FramesTooOld       prometheus.Counter
 	FramesDuplicated   prometheus.Counter
+	// Per-session metrics of ingress frame reordering
+	SessFramesOutOfOrder *prometheus.CounterVec
+	SessFramesLate       *prometheus.CounterVec
+	SessFramesDuplicated *prometheus.CounterVec
+	SessFramesLost       *prometheus.CounterVec
+	// Per-path metrics of egress sessions
+	PathFramesSent     *prometheus.CounterVec
+	PathFrameBytesSent *prometheus.CounterVec
+	PathPollsSent      *prometheus.CounterVec
+	PathPollRepsRecv   *prometheus.CounterVec
+	PathRTT            *prometheus.GaugeVec
+	PathLoss           *prometheus.GaugeVec
+	SessPaths          *prometheus.GaugeVec
+	SessMTU            *prometheus.GaugeVec
+	PktsTooBig         *prometheus.CounterVec
 )
 
 // Version number of loaded config, atomic
@@ -61,6 +76,7 @@ func Init(elem string) {
 	namespace := "sig"
 	constLabels := prometheus.Labels{"elem": elem}
 	iaLabels := []string{"IA", "sessId"}
+	pathLabels := []string{"IA", "sessId", "path"}
 
 	// Some closures to reduce boiler-plate.
 	newC := func(name, help string) prometheus.Counter {
@@ -73,6 +89,11 @@ func Init(elem string) {
 		prometheus.MustRegister(v)
 		return v
 	}
+	newGVec := func(name, help string, lNames []string) *prometheus.GaugeVec {
+		v := prom.NewGaugeVec(namespace, "", name, help, constLabels, lNames)
+		prometheus.MustRegister(v)
+		return v
+	}
 	// FIXME(kormat): these metrics should probably have more informative labels
 	PktsRecv = newCVec("pkts_recv_total", "Number of packets received.", iaLabels)
 	PktsSent = newCVec("pkts_sent_total", "Number of packets sent.", iaLabels)
@@ -86,6 +107,32 @@ func Init(elem string) {
 	FramesDiscarded = newC("frames_discarded_total", "Number of frames discarded.")
 	FramesTooOld = newC("frames_too_old_total", "Number of frames that are too old.")
 	FramesDuplicated = newC("frames_duplicated_total", "Number of duplicate frames.")
+	SessFramesOutOfOrder = newCVec("session_frames_out_of_order_total",
+		"Number of frames received ahead of missing frames.", iaLabels)
+	SessFramesLate = newCVec("session_frames_late_total",
+		"Number of frames received after they were given up on.", iaLabels)
+	SessFramesDuplicated = newCVec("session_frames_duplicated_total",
+		"Number of duplicate frames.", iaLabels)
+	SessFramesLost = newCVec("session_frames_lost_total",
+		"Number of frames given up on after the reorder window or timeout.", iaLabels)
+	PathFramesSent = newCVec("path_frames_sent_total",
+		"Number of frames sent per path.", pathLabels)
+	PathFrameBytesSent = newCVec("path_frame_bytes_sent_total",
+		"Number of frame bytes sent per path.", pathLabels)
+	PathPollsSent = newCVec("path_polls_sent_total",
+		"Number of poll requests sent per path.", pathLabels)
+	PathPollRepsRecv = newCVec("path_poll_replies_recv_total",
+		"Number of poll replies received per path.", pathLabels)
+	PathRTT = newGVec("path_rtt_seconds",
+		"Moving average of the poll round-trip time per path.", pathLabels)
+	PathLoss = newGVec("path_loss_ratio",
+		"Moving average of the fraction of polls lost per path.", pathLabels)
+	SessPaths = newGVec("session_paths", "Number of healthy paths used by a session.",
+		iaLabels)
+	SessMTU = newGVec("session_mtu_bytes",
+		"Length of the largest packet that fits into a single frame of a session.", iaLabels)
+	PktsTooBig = newCVec("pkts_too_big_total",
+		"Number of packets dropped for exceeding the session MTU.", iaLabels)
 
 	// Initialize ringbuf metrics.
 	ringbuf.InitMetrics("sig", constLabels, []string{"ringId", "sessId"})
@@ -0,0 +1,128 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mgmt
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/proto"
+)
+
+var _ proto.Cerealizable = (*PrefixAnn)(nil)
+
+// PrefixAnn announces a SIG of the sender's AS and the IP prefixes it serves.
+// Signature is created with the signing key of the leaf certificate of
+// RawChain.
+type PrefixAnn struct {
+	Addr      *Addr
+	Prefixes  []*Prefix
+	Timestamp uint32
+	RawChain  common.RawBytes `capnp:"chain"`
+	Signature common.RawBytes
+}
+
+func newPrefixAnn(a *Addr, ipnets []*net.IPNet) *PrefixAnn {
+	p := &PrefixAnn{Addr: a, Prefixes: make([]*Prefix, 0, len(ipnets))}
+	for _, ipnet := range ipnets {
+		p.Prefixes = append(p.Prefixes, NewPrefix(ipnet))
+	}
+	return p
+}
+
+// IPNets returns the announced prefixes, or an error if any of them is invalid.
+func (p *PrefixAnn) IPNets() ([]*net.IPNet, error) {
+	ipnets := make([]*net.IPNet, 0, len(p.Prefixes))
+	for _, prefix := range p.Prefixes {
+		ipnet, err := prefix.IPNet()
+		if err != nil {
+			return nil, err
+		}
+		ipnets = append(ipnets, ipnet)
+	}
+	return ipnets, nil
+}
+
+func (p *PrefixAnn) ProtoId() proto.ProtoIdType {
+	return proto.SIGPrefixAnn_TypeID
+}
+
+func (p *PrefixAnn) Write(b common.RawBytes) (int, error) {
+	return proto.WriteRoot(p, b)
+}
+
+func (p *PrefixAnn) String() string {
+	prefixes := make([]string, 0, len(p.Prefixes))
+	for _, prefix := range p.Prefixes {
+		prefixes = append(prefixes, prefix.String())
+	}
+	return fmt.Sprintf("%s Prefixes: [%s] Timestamp: %d", p.Addr,
+		strings.Join(prefixes, ", "), p.Timestamp)
+}
+
+// Prefix is an IP prefix of a PrefixAnn.
+type Prefix struct {
+	IP  common.RawBytes
+	Len uint8
+}
+
+func NewPrefix(ipnet *net.IPNet) *Prefix {
+	ones, _ := ipnet.Mask.Size()
+	ip := ipnet.IP.To4()
+	if ip == nil {
+		ip = ipnet.IP.To16()
+	}
+	return &Prefix{IP: common.RawBytes(ip), Len: uint8(ones)}
+}
+
+// IPNet returns the network of the prefix, with the host bits of the address
+// cleared.
+func (p *Prefix) IPNet() (*net.IPNet, error) {
+	if len(p.IP) != net.IPv4len && len(p.IP) != net.IPv6len {
+		return nil, common.NewBasicError("Invalid prefix address length", nil,
+			"len", len(p.IP))
+	}
+	if int(p.Len) > len(p.IP)*8 {
+		return nil, common.NewBasicError("Invalid prefix length", nil,
+			"ip", net.IP(p.IP), "len", p.Len)
+	}
+	mask := net.CIDRMask(int(p.Len), len(p.IP)*8)
+	return &net.IPNet{IP: net.IP(p.IP).Mask(mask), Mask: mask}, nil
+}
+
+func (p *Prefix) String() string {
+	return fmt.Sprintf("%s/%d", net.IP(p.IP), p.Len)
+}
+
+// AnnReq is sent to the SIG SVC address of a remote AS, to learn one of its
+// SIGs and the prefixes of the remote AS.
+type AnnReq struct {
+	*PrefixAnn
+}
+
+func NewAnnReq(a *Addr, ipnets []*net.IPNet) *AnnReq {
+	return &AnnReq{newPrefixAnn(a, ipnets)}
+}
+
+// AnnRep is the answer to an AnnReq.
+type AnnRep struct {
+	*PrefixAnn
+}
+
+func NewAnnRep(a *Addr, ipnets []*net.IPNet) *AnnRep {
+	return &AnnRep{newPrefixAnn(a, ipnets)}
+}
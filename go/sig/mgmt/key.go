@@ -0,0 +1,72 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mgmt
+
+import (
+	"fmt"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/proto"
+)
+
+var _ proto.Cerealizable = (*key)(nil)
+
+// key is a message of the key exchange of a session. PubKey is an ephemeral
+// X25519 public key, and Signature is created with the signing key of the
+// leaf certificate of RawChain.
+type key struct {
+	Session   SessionType
+	Epoch     uint16
+	PubKey    common.RawBytes
+	RawChain  common.RawBytes `capnp:"chain"`
+	Signature common.RawBytes
+}
+
+func newKey(s SessionType, epoch uint16, pubKey, rawChain common.RawBytes) *key {
+	return &key{Session: s, Epoch: epoch, PubKey: pubKey, RawChain: rawChain}
+}
+
+func (k *key) Chain() (*cert.Chain, error) {
+	return cert.ChainFromRaw(k.RawChain, true)
+}
+
+func (k *key) ProtoId() proto.ProtoIdType {
+	return proto.SIGKey_TypeID
+}
+
+func (k *key) Write(b common.RawBytes) (int, error) {
+	return proto.WriteRoot(k, b)
+}
+
+func (k *key) String() string {
+	return fmt.Sprintf("Session: %s Epoch: %d PubKey: %s", k.Session, k.Epoch, k.PubKey)
+}
+
+type KeyReq struct {
+	*key
+}
+
+func NewKeyReq(s SessionType, epoch uint16, pubKey, rawChain common.RawBytes) *KeyReq {
+	return &KeyReq{newKey(s, epoch, pubKey, rawChain)}
+}
+
+type KeyRep struct {
+	*key
+}
+
+func NewKeyRep(s SessionType, epoch uint16, pubKey, rawChain common.RawBytes) *KeyRep {
+	return &KeyRep{newKey(s, epoch, pubKey, rawChain)}
+}
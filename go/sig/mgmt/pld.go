@@ -33,6 +33,10 @@ type union struct {
 	Which   proto.SIGCtrl_Which
 	PollReq *PollReq
 	PollRep *PollRep
+	KeyReq  *KeyReq
+	KeyRep  *KeyRep
+	AnnReq  *AnnReq
+	AnnRep  *AnnRep
 }
 
 func (u *union) set(c proto.Cerealizable) error {
@@ -43,6 +47,18 @@ func (u *union) set(c proto.Cerealizable) error {
 	case *PollRep:
 		u.Which = proto.SIGCtrl_Which_pollRep
 		u.PollRep = p
+	case *KeyReq:
+		u.Which = proto.SIGCtrl_Which_keyReq
+		u.KeyReq = p
+	case *KeyRep:
+		u.Which = proto.SIGCtrl_Which_keyRep
+		u.KeyRep = p
+	case *AnnReq:
+		u.Which = proto.SIGCtrl_Which_annReq
+		u.AnnReq = p
+	case *AnnRep:
+		u.Which = proto.SIGCtrl_Which_annRep
+		u.AnnRep = p
 	default:
 		return common.NewBasicError("Unsupported SIG ctrl union type (set)", nil,
 			"type", common.TypeOf(c))
@@ -56,6 +72,14 @@ func (u *union) get() (proto.Cerealizable, error) {
 		return u.PollReq, nil
 	case proto.SIGCtrl_Which_pollRep:
 		return u.PollRep, nil
+	case proto.SIGCtrl_Which_keyReq:
+		return u.KeyReq, nil
+	case proto.SIGCtrl_Which_keyRep:
+		return u.KeyRep, nil
+	case proto.SIGCtrl_Which_annReq:
+		return u.AnnReq, nil
+	case proto.SIGCtrl_Which_annRep:
+		return u.AnnRep, nil
 	}
 	return nil, common.NewBasicError("Unsupported SIG ctrl union type (get)", nil,
 		"type", u.Which)
@@ -18,6 +18,7 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
@@ -32,6 +33,14 @@ const (
 	DefaultEncapPort = 10080
 	MaxPort          = (1 << 16) - 1
 	SIGHdrSize       = 8
+	// Network is the network of the SIG's SCION connections. It is dual-stack,
+	// so that the local SIG can use an IPv4 or IPv6 address, and talk to
+	// remote SIGs of both address families.
+	Network = "udp"
+	// Objectives for choosing the paths of sessions, see PathObjective.
+	PathObjFailures = "failures"
+	PathObjLatency  = "latency"
+	PathObjLoss     = "loss"
 )
 
 var (
@@ -40,7 +49,25 @@ var (
 	sciondPath     = flag.String("sciond", "", "SCIOND socket path")
 	dispatcherPath = flag.String("dispatcher", "/run/shm/dispatcher/default.sock",
 		"SCION Dispatcher path")
-	SigTun = flag.String("tun", "sig", "Name of TUN device to create")
+	SigTun  = flag.String("tun", "sig", "Name of TUN device to create")
+	Encrypt = flag.Bool("encrypt", false,
+		"Encrypt and authenticate frames (requires the AS certificates in confdir)")
+	ConfDir       = flag.String("confdir", "", "Configuration directory with the AS certs and keys")
+	SessPaths     = flag.Int("paths", 1, "Number of paths each session spreads its frames across")
+	PathObjective = flag.String("pathobj", PathObjFailures,
+		"Objective for choosing the paths of sessions (failures, latency or loss)")
+	Discovery = flag.Bool("discovery", false,
+		"Discover remote SIGs and their prefixes (requires the AS certificates in confdir)")
+	ReassemblyCap = flag.Int("reasscap", 100,
+		"Maximum number of frames held for reassembling a packet")
+	ReorderWindow = flag.Int("reorderwindow", 32,
+		"Maximum number of frames received ahead of a missing frame (0 disables reordering)")
+	ReorderTimeout = flag.Duration("reordertimeout", 50*time.Millisecond,
+		"Maximum time received frames wait for missing frames")
+	RlistTimeout = flag.Duration("rlisttimeout", time.Second,
+		"Time after which idle reassembly lists are removed")
+	WorkerTimeout = flag.Duration("workertimeout", 60*time.Second,
+		"Time after which idle ingress workers are stopped")
 )
 
 var (
@@ -48,11 +75,21 @@ var (
 	DefV6Net = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, net.IPv6len*8)}
 )
 
+var _ FrameConn = (*snet.Conn)(nil)
+
+// FrameConn is a SCION connection over which SIG frames are exchanged. It is
+// implemented by *snet.Conn, and by in-memory connections in tests.
+type FrameConn interface {
+	ReadFromSCION(b []byte) (int, *snet.Addr, error)
+	WriteToSCION(b []byte, raddr *snet.Addr) (int, error)
+	Close() error
+}
+
 var (
 	IA       addr.IA
 	Host     addr.HostAddr
 	PathMgr  *pathmgr.PR
-	CtrlConn *snet.Conn
+	CtrlConn FrameConn
 	MgmtAddr *mgmt.Addr
 )
 
@@ -66,6 +103,18 @@ func Init(ia addr.IA, ip net.IP) error {
 	if err = ValidatePort("local encap", *EncapPort); err != nil {
 		return err
 	}
+	if *SessPaths < 1 {
+		return common.NewBasicError("Invalid number of session paths", nil,
+			"min", 1, "actual", *SessPaths)
+	}
+	switch *PathObjective {
+	case PathObjFailures, PathObjLatency, PathObjLoss:
+	default:
+		return common.NewBasicError("Invalid path objective", nil, "actual", *PathObjective)
+	}
+	if err = validateReassembly(); err != nil {
+		return err
+	}
 	MgmtAddr = mgmt.NewAddr(Host, uint16(*CtrlPort), uint16(*EncapPort))
 	if *sciondPath == "" {
 		*sciondPath = sciond.GetDefaultSCIONDPath(&ia)
@@ -76,11 +125,18 @@ func Init(ia addr.IA, ip net.IP) error {
 		return common.NewBasicError("Error creating local SCION Network context", err)
 	}
 	PathMgr = snet.DefNetwork.PathResolver()
-	CtrlConn, err = snet.ListenSCION(
-		"udp4", &snet.Addr{IA: IA, Host: Host, L4Port: uint16(*CtrlPort)})
+	// With discovery, the ctrl socket also receives the prefix announcement
+	// requests sent to the SIG SVC address.
+	svc := addr.SvcNone
+	if *Discovery {
+		svc = addr.SvcSIG
+	}
+	conn, err := snet.ListenSCIONWithBindSVC(
+		Network, &snet.Addr{IA: IA, Host: Host, L4Port: uint16(*CtrlPort)}, nil, svc)
 	if err != nil {
 		return common.NewBasicError("Error creating ctrl socket", err)
 	}
+	CtrlConn = conn
 	return nil
 }
 
@@ -96,6 +152,25 @@ func EncapSnetAddr() *snet.Addr {
 	}
 }
 
+func validateReassembly() error {
+	if *ReassemblyCap < 2 {
+		return common.NewBasicError("Invalid reassembly capacity", nil,
+			"min", 2, "actual", *ReassemblyCap)
+	}
+	if *ReorderWindow < 0 {
+		return common.NewBasicError("Invalid reorder window", nil,
+			"min", 0, "actual", *ReorderWindow)
+	}
+	for desc, d := range map[string]time.Duration{"reorder": *ReorderTimeout,
+		"reassembly list": *RlistTimeout, "worker": *WorkerTimeout} {
+		if d <= 0 {
+			return common.NewBasicError(fmt.Sprintf("Invalid %s timeout", desc), nil,
+				"actual", d)
+		}
+	}
+	return nil
+}
+
 func ValidatePort(desc string, port int) error {
 	if port < 1 || port > MaxPort {
 		return common.NewBasicError(fmt.Sprintf("Invalid %s port", desc), nil,
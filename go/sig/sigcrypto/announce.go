@@ -0,0 +1,86 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sigcrypto
+
+import (
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/sig/mgmt"
+)
+
+const (
+	// MaxAnnAge is the maximum difference between the timestamp of an
+	// accepted prefix announcement and the local clock.
+	MaxAnnAge = time.Minute
+	// Label of the signatures of prefix announcements
+	annLabel = "SIG prefix ann"
+)
+
+// SignAnn timestamps and signs the prefix announcement ann of the local AS ia.
+func SignAnn(id *Identity, ia addr.IA, ann *mgmt.PrefixAnn, now time.Time) error {
+	rawChain, err := id.Chain.Compress()
+	if err != nil {
+		return common.NewBasicError("Unable to compress certificate chain", err)
+	}
+	ann.Timestamp = uint32(now.Unix())
+	ann.RawChain = rawChain
+	sigInput, err := annSigInput(ia, ann)
+	if err != nil {
+		return err
+	}
+	ann.Signature, err = sign(id, sigInput)
+	return err
+}
+
+// VerifyAnn checks that the prefix announcement ann is recent, and was signed
+// by the AS ia.
+func VerifyAnn(trcs TRCProvider, ia addr.IA, ann *mgmt.PrefixAnn, now time.Time) error {
+	ts := time.Unix(int64(ann.Timestamp), 0)
+	if now.Sub(ts) > MaxAnnAge || ts.Sub(now) > MaxAnnAge {
+		return common.NewBasicError("Prefix announcement timestamp out of range", nil,
+			"timestamp", ts, "now", now, "max_age", MaxAnnAge)
+	}
+	sigInput, err := annSigInput(ia, ann)
+	if err != nil {
+		return err
+	}
+	return verify(ann.RawChain, ia, trcs, sigInput, ann.Signature)
+}
+
+// annSigInput returns the input of the signature of ann, which binds the SIG
+// address, the prefixes and the timestamp to the AS ia.
+func annSigInput(ia addr.IA, ann *mgmt.PrefixAnn) (common.RawBytes, error) {
+	if ann.Addr == nil || ann.Addr.Ctrl == nil || ann.Addr.Ctrl.Host() == nil {
+		return nil, common.NewBasicError("Prefix announcement without SIG address", nil)
+	}
+	host := ann.Addr.Ctrl.Host()
+	b := make(common.RawBytes, addr.IABytes+1, addr.IABytes+1+host.Size()+8)
+	ia.Write(b)
+	b[addr.IABytes] = uint8(host.Type())
+	b = append(b, host.Pack()...)
+	fields := make(common.RawBytes, 8)
+	common.Order.PutUint16(fields, ann.Addr.Ctrl.Port)
+	common.Order.PutUint16(fields[2:], ann.Addr.EncapPort)
+	common.Order.PutUint32(fields[4:], ann.Timestamp)
+	b = append(b, fields...)
+	for _, p := range ann.Prefixes {
+		b = append(b, uint8(len(p.IP)))
+		b = append(b, p.IP...)
+		b = append(b, p.Len)
+	}
+	return append(common.RawBytes(annLabel), b...), nil
+}
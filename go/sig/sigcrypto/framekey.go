@@ -0,0 +1,88 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sigcrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+const (
+	// Length of the frame keys
+	frameKeyLen = 16
+	// Overhead is the number of bytes added to frames by encryption.
+	Overhead = 16
+)
+
+// FrameKey encrypts and authenticates the frames of a session in one epoch
+// with AES-GCM. The SIG frame header is authenticated, but not encrypted, so
+// that the receiver can find the key of a frame.
+//
+// The nonce of a frame is derived from the session ID, epoch and sequence
+// number of its header, so a key must not be used for more than one sequence
+// number space.
+type FrameKey struct {
+	Epoch uint16
+	// Creation time of the key
+	Created time.Time
+	aead    cipher.AEAD
+}
+
+func newFrameKey(epoch uint16, key common.RawBytes) (*FrameKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to create frame cipher", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to create frame AEAD", err)
+	}
+	return &FrameKey{Epoch: epoch, Created: time.Now(), aead: aead}, nil
+}
+
+// Seal encrypts the payload of frame in place and appends the authentication
+// tag. frame must start with the SIG frame header, and must have a capacity
+// of at least len(frame)+Overhead.
+func (k *FrameKey) Seal(frame common.RawBytes) common.RawBytes {
+	hdr := frame[:sigcmn.SIGHdrSize]
+	return k.aead.Seal(hdr, k.nonce(hdr), frame[sigcmn.SIGHdrSize:], hdr)
+}
+
+// Open authenticates and decrypts the payload of frame in place, and returns
+// the frame without the authentication tag.
+func (k *FrameKey) Open(frame common.RawBytes) (common.RawBytes, error) {
+	if len(frame) < sigcmn.SIGHdrSize+Overhead {
+		return nil, common.NewBasicError("Encrypted frame too short", nil,
+			"min", sigcmn.SIGHdrSize+Overhead, "actual", len(frame))
+	}
+	hdr := frame[:sigcmn.SIGHdrSize]
+	out, err := k.aead.Open(hdr, k.nonce(hdr), frame[sigcmn.SIGHdrSize:], hdr)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to authenticate frame", err)
+	}
+	return out, nil
+}
+
+// nonce returns the nonce of the frame with header hdr, made of the session
+// ID, epoch and sequence number.
+func (k *FrameKey) nonce(hdr common.RawBytes) []byte {
+	nonce := make([]byte, k.aead.NonceSize())
+	copy(nonce, hdr[:6])
+	return nonce
+}
@@ -0,0 +1,242 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sigcrypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/sig/mgmt"
+)
+
+const (
+	// Length of X25519 keys
+	dhKeyLen = 32
+	// Maximum difference between the epoch of a key request and the local
+	// clock, in seconds
+	maxEpochSkew = 300
+	// Labels that separate the signatures of requests and replies, and the
+	// key derivation
+	reqLabel = "SIG key req"
+	repLabel = "SIG key rep"
+	kdfLabel = "SIG frame key"
+)
+
+// Identity is the SCION identity of the local AS, used to authenticate key
+// exchanges.
+type Identity struct {
+	// Chain is the certificate chain of the local AS.
+	Chain *cert.Chain
+	// SignKey is the private key matching the subject signing key of the leaf
+	// certificate of Chain.
+	SignKey common.RawBytes
+}
+
+// TRCProvider returns the TRCs used to verify the certificate chains of
+// remote ASes. It is implemented by trust.Store.
+type TRCProvider interface {
+	GetNewestTRC(isd addr.ISD) *trc.TRC
+}
+
+// KeyExchange is the initiating side of the key exchange of an egress
+// session. The resulting key protects the frames sent from src to the remote
+// AS dst in the given session and epoch.
+type KeyExchange struct {
+	src     addr.IA
+	dst     addr.IA
+	session mgmt.SessionType
+	epoch   uint16
+	priv    [dhKeyLen]byte
+	req     *mgmt.KeyReq
+}
+
+// NewKeyExchange starts a key exchange with an ephemeral key pair, and creates
+// the signed request to send to the remote SIG.
+func NewKeyExchange(id *Identity, src, dst addr.IA, session mgmt.SessionType,
+	epoch uint16) (*KeyExchange, error) {
+
+	kx := &KeyExchange{src: src, dst: dst, session: session, epoch: epoch}
+	pub, err := newDHKey(&kx.priv)
+	if err != nil {
+		return nil, err
+	}
+	rawChain, err := id.Chain.Compress()
+	if err != nil {
+		return nil, common.NewBasicError("Unable to compress certificate chain", err)
+	}
+	kx.req = mgmt.NewKeyReq(session, epoch, pub, rawChain)
+	kx.req.Signature, err = sign(id, kx.sigInput(reqLabel, pub, nil))
+	if err != nil {
+		return nil, err
+	}
+	return kx, nil
+}
+
+// Req returns the request of the key exchange. Retransmissions must send the
+// same request.
+func (kx *KeyExchange) Req() *mgmt.KeyReq {
+	return kx.req
+}
+
+func (kx *KeyExchange) Epoch() uint16 {
+	return kx.epoch
+}
+
+// Finish verifies the reply of the remote SIG and returns the established
+// frame key.
+func (kx *KeyExchange) Finish(rep *mgmt.KeyRep, trcs TRCProvider) (*FrameKey, error) {
+	if rep.Session != kx.session || rep.Epoch != kx.epoch {
+		return nil, common.NewBasicError("KeyRep does not match request", nil,
+			"expected_session", kx.session, "expected_epoch", kx.epoch,
+			"actual_session", rep.Session, "actual_epoch", rep.Epoch)
+	}
+	sigInput := kx.sigInput(repLabel, kx.req.PubKey, rep.PubKey)
+	if err := verify(rep.RawChain, kx.dst, trcs, sigInput, rep.Signature); err != nil {
+		return nil, err
+	}
+	return kx.deriveKey(&kx.priv, rep.PubKey, kx.req.PubKey, rep.PubKey)
+}
+
+// Respond verifies the key request req received from the AS src, and returns
+// the signed reply and the key of the frames that src will send to dst.
+func Respond(id *Identity, trcs TRCProvider, src, dst addr.IA, req *mgmt.KeyReq,
+	now uint16) (*mgmt.KeyRep, *FrameKey, error) {
+
+	if skew := int16(now - req.Epoch); skew > maxEpochSkew || skew < -maxEpochSkew {
+		return nil, nil, common.NewBasicError("KeyReq epoch out of range", nil,
+			"epoch", req.Epoch, "now", now, "max_skew", maxEpochSkew)
+	}
+	kx := &KeyExchange{src: src, dst: dst, session: req.Session, epoch: req.Epoch}
+	sigInput := kx.sigInput(reqLabel, req.PubKey, nil)
+	if err := verify(req.RawChain, src, trcs, sigInput, req.Signature); err != nil {
+		return nil, nil, err
+	}
+	var priv [dhKeyLen]byte
+	pub, err := newDHKey(&priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := kx.deriveKey(&priv, req.PubKey, req.PubKey, pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawChain, err := id.Chain.Compress()
+	if err != nil {
+		return nil, nil, common.NewBasicError("Unable to compress certificate chain", err)
+	}
+	rep := mgmt.NewKeyRep(req.Session, req.Epoch, pub, rawChain)
+	rep.Signature, err = sign(id, kx.sigInput(repLabel, req.PubKey, pub))
+	if err != nil {
+		return nil, nil, err
+	}
+	return rep, key, nil
+}
+
+// sigInput returns the input of the signatures of the key exchange, which
+// binds the public keys to both ASes, the session and the epoch.
+func (kx *KeyExchange) sigInput(label string, reqPub, repPub common.RawBytes) common.RawBytes {
+	b := append(common.RawBytes(label), kx.params()...)
+	b = append(b, reqPub...)
+	return append(b, repPub...)
+}
+
+func (kx *KeyExchange) params() common.RawBytes {
+	b := make(common.RawBytes, 2*addr.IABytes+3)
+	kx.src.Write(b)
+	kx.dst.Write(b[addr.IABytes:])
+	b[2*addr.IABytes] = uint8(kx.session)
+	common.Order.PutUint16(b[2*addr.IABytes+1:], kx.epoch)
+	return b
+}
+
+// deriveKey computes the frame key from the X25519 shared secret of priv and
+// peerPub.
+func (kx *KeyExchange) deriveKey(priv *[dhKeyLen]byte, peerPub, reqPub,
+	repPub common.RawBytes) (*FrameKey, error) {
+
+	if len(peerPub) != dhKeyLen {
+		return nil, common.NewBasicError("Invalid public key length", nil,
+			"expected", dhKeyLen, "actual", len(peerPub))
+	}
+	var pub, secret [dhKeyLen]byte
+	copy(pub[:], peerPub)
+	curve25519.ScalarMult(&secret, priv, &pub)
+	salt := append(append(common.RawBytes(nil), reqPub...), repPub...)
+	info := append(common.RawBytes(kdfLabel), kx.params()...)
+	key := make(common.RawBytes, frameKeyLen)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret[:], salt, info), key); err != nil {
+		return nil, common.NewBasicError("Unable to derive frame key", err)
+	}
+	return newFrameKey(kx.epoch, key)
+}
+
+func newDHKey(priv *[dhKeyLen]byte) (common.RawBytes, error) {
+	if _, err := rand.Read(priv[:]); err != nil {
+		return nil, common.NewBasicError("Unable to generate key", err)
+	}
+	var pub [dhKeyLen]byte
+	curve25519.ScalarBaseMult(&pub, priv)
+	return common.RawBytes(pub[:]), nil
+}
+
+func sign(id *Identity, sigInput common.RawBytes) (common.RawBytes, error) {
+	sig, err := crypto.Sign(sigInput, id.SignKey, id.Chain.Leaf.SignAlgorithm)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to sign SIG ctrl message", err)
+	}
+	return sig, nil
+}
+
+// verify checks that rawChain is a valid certificate chain of the AS ia, and
+// that sig is the signature of sigInput by its leaf certificate.
+func verify(rawChain common.RawBytes, ia addr.IA, trcs TRCProvider,
+	sigInput, sig common.RawBytes) error {
+
+	if len(rawChain) < 4 {
+		return common.NewBasicError("Certificate chain too short", nil, "len", len(rawChain))
+	}
+	chain, err := cert.ChainFromRaw(rawChain, true)
+	if err != nil {
+		return common.NewBasicError("Unable to parse certificate chain", err)
+	}
+	if chain.Leaf == nil || chain.Issuer == nil {
+		return common.NewBasicError("Incomplete certificate chain", nil)
+	}
+	if !chain.Leaf.Subject.Eq(ia) {
+		return common.NewBasicError("Certificate subject does not match remote", nil,
+			"subject", chain.Leaf.Subject, "remote", ia)
+	}
+	t := trcs.GetNewestTRC(ia.I)
+	if t == nil {
+		return common.NewBasicError("TRC not found", nil, "isd", ia.I)
+	}
+	if err := chain.Verify(ia, t); err != nil {
+		return common.NewBasicError("Invalid certificate chain", err, "ia", ia)
+	}
+	if err := crypto.Verify(sigInput, sig, chain.Leaf.SubjectSignKey,
+		chain.Leaf.SignAlgorithm); err != nil {
+		return common.NewBasicError("Invalid signature", err, "ia", ia)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sigcrypto
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/sig/mgmt"
+)
+
+type keyStoreKey struct {
+	ia      addr.IAInt
+	session mgmt.SessionType
+	epoch   uint16
+}
+
+type keyEntry struct {
+	key *FrameKey
+	// Public key of the request, to recognize retransmissions
+	reqPub common.RawBytes
+	// Reply sent for the request, resent for retransmissions
+	rep    *mgmt.KeyRep
+	expiry time.Time
+}
+
+// KeyStore keeps the keys of the frames received from remote SIGs, indexed by
+// the remote ISD-AS, session and epoch. Keys expire after KeyLifetime, plus
+// the allowed clock skew. It is safe for concurrent use.
+type KeyStore struct {
+	mutex   sync.RWMutex
+	entries map[keyStoreKey]*keyEntry
+}
+
+func NewKeyStore() *KeyStore {
+	return &KeyStore{entries: make(map[keyStoreKey]*keyEntry)}
+}
+
+// Get returns the key of the frames from ia in the given session and epoch,
+// or nil if there is none.
+func (s *KeyStore) Get(ia addr.IA, session mgmt.SessionType, epoch uint16) *FrameKey {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	e, ok := s.entries[keyStoreKey{ia: ia.IAInt(), session: session, epoch: epoch}]
+	if !ok || time.Now().After(e.expiry) {
+		return nil
+	}
+	return e.key
+}
+
+// Reply returns the reply to a retransmission of the request req from ia. It
+// returns nil if the epoch of req has no key yet, and an error if the epoch
+// has been keyed by a different request.
+func (s *KeyStore) Reply(ia addr.IA, req *mgmt.KeyReq) (*mgmt.KeyRep, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	e, ok := s.entries[keyStoreKey{ia: ia.IAInt(), session: req.Session, epoch: req.Epoch}]
+	if !ok || time.Now().After(e.expiry) {
+		return nil, nil
+	}
+	if !bytes.Equal(e.reqPub, req.PubKey) {
+		return nil, common.NewBasicError("Epoch already keyed", nil,
+			"ia", ia, "session", req.Session, "epoch", req.Epoch)
+	}
+	return e.rep, nil
+}
+
+// Add stores the key established by req and rep. Expired keys are removed.
+func (s *KeyStore) Add(ia addr.IA, req *mgmt.KeyReq, rep *mgmt.KeyRep, key *FrameKey) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for k, e := range s.entries {
+		if now.After(e.expiry) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[keyStoreKey{ia: ia.IAInt(), session: req.Session, epoch: req.Epoch}] = &keyEntry{
+		key:    key,
+		reqPub: req.PubKey,
+		rep:    rep,
+		expiry: now.Add(KeyLifetime + maxEpochSkew*time.Second),
+	}
+}
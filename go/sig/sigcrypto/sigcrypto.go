@@ -0,0 +1,93 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sigcrypto implements the optional encryption of SIG frames.
+//
+// Each egress session establishes a key with the remote SIG by sending a
+// signed KeyReq with an ephemeral X25519 public key over the control channel.
+// The remote SIG answers with a signed KeyRep containing its own ephemeral
+// public key. Both messages are signed with the AS signing key and carry the
+// certificate chain of the AS, which is verified against the TRC of its ISD.
+// The frame key is derived from the shared secret with HKDF-SHA256.
+//
+// Keys are tied to the epoch field of the SIG frame header: a new key
+// exchange uses a new epoch, which also resets the sequence numbers, and
+// frames are encrypted with AES-GCM using the key of their epoch. Sessions
+// rekey every RekeyInterval, and before their sequence numbers wrap.
+//
+// The identity of the local AS is also used to sign the prefix announcements
+// of the SIG discovery, see SignAnn and VerifyAnn.
+package sigcrypto
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/trust"
+)
+
+const (
+	// RekeyInterval is the time after which sessions establish a new key.
+	RekeyInterval = 10 * time.Minute
+	// KeyLifetime is the time after which keys are no longer used.
+	KeyLifetime = 2 * RekeyInterval
+)
+
+var (
+	// Local is the identity of the local AS. It is nil if neither
+	// encryption nor discovery is enabled.
+	Local *Identity
+	// TRCs verifies the certificate chains of remote ASes.
+	TRCs TRCProvider
+	// Keys holds the keys of the frames received from remote SIGs.
+	Keys = NewKeyStore()
+	// encryptFrames is true if frames are encrypted.
+	encryptFrames bool
+)
+
+// Init loads the identity of the local AS, with the AS certificates and TRCs
+// from confDir/certs and the AS signing key from confDir/keys, and enables
+// encryption if encrypt is true. The TRCs of the ISDs of all remote ASes must
+// be present.
+func Init(ia addr.IA, confDir, id string, encrypt bool) error {
+	store, err := trust.NewStore(filepath.Join(confDir, "certs"), "", id)
+	if err != nil {
+		return common.NewBasicError("Unable to load trust store", err)
+	}
+	chain := store.GetNewestChain(ia)
+	if chain == nil {
+		return common.NewBasicError("Certificate chain not found", nil, "ia", ia)
+	}
+	signKey, err := trust.LoadKey(filepath.Join(confDir, "keys", trust.SigKeyFile))
+	if err != nil {
+		return common.NewBasicError("Unable to load signing key", err)
+	}
+	Local = &Identity{Chain: chain, SignKey: signKey}
+	TRCs = store
+	encryptFrames = encrypt
+	return nil
+}
+
+// Enabled returns true if frames are encrypted.
+func Enabled() bool {
+	return encryptFrames
+}
+
+// NewEpoch returns the epoch at time t, i.e. the lowest 16 bits of its unix
+// timestamp.
+func NewEpoch(t time.Time) uint16 {
+	return uint16(t.Unix() & 0xFFFF)
+}
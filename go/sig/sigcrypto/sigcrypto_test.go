@@ -0,0 +1,159 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sigcrypto
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/xtest"
+	"github.com/scionproto/scion/go/lib/xtest/testpki"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+var (
+	srcIA = xtest.MustParseIA("1-ff00:0:111")
+	dstIA = xtest.MustParseIA("1-ff00:0:112")
+)
+
+// newIdentity returns an identity for ia, with a chain issued by the core AS
+// of pki.
+func newIdentity(t *testing.T, pki *testpki.PKI, ia addr.IA) *Identity {
+	t.Helper()
+	chain, key := pki.Issue(t, ia)
+	return &Identity{Chain: chain, SignKey: key}
+}
+
+func TestKeyExchange(t *testing.T) {
+	Convey("Given the identities of two ASes of the same ISD", t, func() {
+		pki := testpki.New(t)
+		trcs := pki.TRCs()
+		srcId, dstId := newIdentity(t, pki, srcIA), newIdentity(t, pki, dstIA)
+		now := NewEpoch(time.Now())
+		kx, err := NewKeyExchange(srcId, srcIA, dstIA, 1, now)
+		xtest.FailOnErr(t, err)
+		Convey("Both sides establish the same key", func() {
+			rep, dstKey, err := Respond(dstId, trcs, srcIA, dstIA, kx.Req(), now)
+			SoMsg("respond err", err, ShouldBeNil)
+			srcKey, err := kx.Finish(rep, trcs)
+			SoMsg("finish err", err, ShouldBeNil)
+			SoMsg("epoch", srcKey.Epoch, ShouldEqual, now)
+
+			frame := newTestFrame(1, now, 42, "payload")
+			sealed := srcKey.Seal(frame)
+			SoMsg("sealed len", len(sealed), ShouldEqual, len(frame)+Overhead)
+			SoMsg("header in clear", sealed[:sigcmn.SIGHdrSize], ShouldResemble,
+				newTestFrame(1, now, 42, "")[:sigcmn.SIGHdrSize])
+			opened, err := dstKey.Open(append(common.RawBytes(nil), sealed...))
+			SoMsg("open err", err, ShouldBeNil)
+			SoMsg("payload", string(opened[sigcmn.SIGHdrSize:]), ShouldEqual, "payload")
+
+			Convey("Modified headers are rejected", func() {
+				sealed[3] ^= 1
+				_, err := dstKey.Open(sealed)
+				SoMsg("err", err, ShouldNotBeNil)
+			})
+		})
+		Convey("Requests from another AS are rejected", func() {
+			_, _, err := Respond(dstId, trcs, xtest.MustParseIA("1-ff00:0:113"), dstIA,
+				kx.Req(), now)
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+		Convey("Requests with an old epoch are rejected", func() {
+			_, _, err := Respond(dstId, trcs, srcIA, dstIA, kx.Req(), now+maxEpochSkew+1)
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+		Convey("Replies signed by another AS are rejected", func() {
+			otherId := newIdentity(t, pki, xtest.MustParseIA("1-ff00:0:113"))
+			rep, _, err := Respond(otherId, trcs, srcIA, dstIA, kx.Req(), now)
+			xtest.FailOnErr(t, err)
+			_, err = kx.Finish(rep, trcs)
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestKeyStore(t *testing.T) {
+	Convey("Given a key store with the key of a request", t, func() {
+		pki := testpki.New(t)
+		trcs := pki.TRCs()
+		srcId, dstId := newIdentity(t, pki, srcIA), newIdentity(t, pki, dstIA)
+		now := NewEpoch(time.Now())
+		kx, err := NewKeyExchange(srcId, srcIA, dstIA, 1, now)
+		xtest.FailOnErr(t, err)
+		rep, key, err := Respond(dstId, trcs, srcIA, dstIA, kx.Req(), now)
+		xtest.FailOnErr(t, err)
+		s := NewKeyStore()
+		s.Add(srcIA, kx.Req(), rep, key)
+
+		SoMsg("key", s.Get(srcIA, 1, now), ShouldEqual, key)
+		SoMsg("other session", s.Get(srcIA, 2, now), ShouldBeNil)
+		SoMsg("other epoch", s.Get(srcIA, 1, now+1), ShouldBeNil)
+		Convey("Retransmitted requests get the same reply", func() {
+			r, err := s.Reply(srcIA, kx.Req())
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("rep", r, ShouldEqual, rep)
+		})
+		Convey("Other requests for the same epoch are rejected", func() {
+			other, err := NewKeyExchange(srcId, srcIA, dstIA, 1, now)
+			xtest.FailOnErr(t, err)
+			_, err = s.Reply(srcIA, other.Req())
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPrefixAnn(t *testing.T) {
+	Convey("Given a prefix announcement signed by an AS", t, func() {
+		pki := testpki.New(t)
+		trcs := pki.TRCs()
+		_, ipnet, err := net.ParseCIDR("192.0.2.0/24")
+		xtest.FailOnErr(t, err)
+		a := mgmt.NewAddr(addr.HostFromIP(net.ParseIP("10.0.0.1")), 10081, 10080)
+		ann := mgmt.NewAnnReq(a, []*net.IPNet{ipnet}).PrefixAnn
+		now := time.Now()
+		xtest.FailOnErr(t, SignAnn(newIdentity(t, pki, srcIA), srcIA, ann, now))
+
+		SoMsg("valid", VerifyAnn(trcs, srcIA, ann, now), ShouldBeNil)
+		ipnets, err := ann.IPNets()
+		SoMsg("ipnets err", err, ShouldBeNil)
+		SoMsg("ipnets", ipnets, ShouldResemble, []*net.IPNet{ipnet})
+		SoMsg("other AS", VerifyAnn(trcs, dstIA, ann, now), ShouldNotBeNil)
+		SoMsg("expired", VerifyAnn(trcs, srcIA, ann, now.Add(MaxAnnAge+time.Second)),
+			ShouldNotBeNil)
+		Convey("Modified prefixes are rejected", func() {
+			ann.Prefixes[0].Len = 16
+			SoMsg("err", VerifyAnn(trcs, srcIA, ann, now), ShouldNotBeNil)
+		})
+		Convey("Modified addresses are rejected", func() {
+			ann.Addr.EncapPort++
+			SoMsg("err", VerifyAnn(trcs, srcIA, ann, now), ShouldNotBeNil)
+		})
+	})
+}
+
+func newTestFrame(sessId uint8, epoch uint16, seq uint32, pld string) common.RawBytes {
+	b := make(common.RawBytes, sigcmn.SIGHdrSize, sigcmn.SIGHdrSize+len(pld)+Overhead)
+	b[0] = sessId
+	common.Order.PutUint16(b[1:3], epoch)
+	common.Order.PutUintN(b[3:6], uint64(seq), 3)
+	return append(b, pld...)
+}
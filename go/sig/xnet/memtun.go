@@ -0,0 +1,93 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xnet
+
+import (
+	"io"
+	"sync"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+var _ Tun = (*MemTun)(nil)
+
+// MemTun is an in-memory Tun, which allows running the SIG without a kernel
+// TUN device, e.g., in tests or when embedding the SIG in another program.
+// Packets injected with Inject are read by the SIG, and packets written by
+// the SIG are received from Recv.
+type MemTun struct {
+	in        chan common.RawBytes
+	out       chan common.RawBytes
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemTun returns a MemTun that queues up to queueLen packets in each
+// direction.
+func NewMemTun(queueLen int) *MemTun {
+	return &MemTun{
+		in:     make(chan common.RawBytes, queueLen),
+		out:    make(chan common.RawBytes, queueLen),
+		closeC: make(chan struct{}),
+	}
+}
+
+// Read blocks until a packet is injected, and returns io.EOF once the MemTun
+// is closed.
+func (t *MemTun) Read(b []byte) (int, error) {
+	select {
+	case pkt := <-t.in:
+		return copy(b, pkt), nil
+	case <-t.closeC:
+		return 0, io.EOF
+	}
+}
+
+// Write queues a copy of b to be received from Recv. Like a TUN device, it
+// drops the packet if the queue is full.
+func (t *MemTun) Write(b []byte) (int, error) {
+	select {
+	case <-t.closeC:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	select {
+	case t.out <- append(common.RawBytes(nil), b...):
+		return len(b), nil
+	default:
+		return 0, common.NewBasicError("MemTun queue full", nil, "len", len(b))
+	}
+}
+
+func (t *MemTun) Close() error {
+	t.closeOnce.Do(func() { close(t.closeC) })
+	return nil
+}
+
+// Inject queues a copy of pkt to be read by the SIG. It blocks if the queue
+// is full.
+func (t *MemTun) Inject(pkt common.RawBytes) error {
+	select {
+	case t.in <- append(common.RawBytes(nil), pkt...):
+		return nil
+	case <-t.closeC:
+		return io.ErrClosedPipe
+	}
+}
+
+// Recv returns the channel of the packets written by the SIG.
+func (t *MemTun) Recv() <-chan common.RawBytes {
+	return t.out
+}
@@ -32,8 +32,14 @@ const (
 	SIGTxQlen    = 1000
 )
 
+// Tun is the device through which the SIG exchanges IP packets with the hosts
+// of the local AS. It is a kernel TUN device, or a MemTun.
+type Tun interface {
+	io.ReadWriteCloser
+}
+
 // ConnectTun creates (or opens) interface name, and then sets its state to up
-func ConnectTun(name string) (netlink.Link, io.ReadWriteCloser, error) {
+func ConnectTun(name string) (netlink.Link, Tun, error) {
 	tun, err := water.New(water.Config{
 		DeviceType:             water.TUN,
 		PlatformSpecificParams: water.PlatformSpecificParams{Name: name}})